@@ -3,6 +3,7 @@ package ipfscluster
 import (
 	"errors"
 	"fmt"
+	"strconv"
 
 	cid "github.com/ipfs/go-cid"
 	peer "github.com/libp2p/go-libp2p-peer"
@@ -18,18 +19,23 @@ import (
 // The allocation process has several steps:
 //
 // * Find which peers are pinning a CID
-// * Obtain the last values for the configured informer metrics from the
-//   monitor component
+// * Obtain the last values for the metrics of the first configured informer
+//   from the monitor component
 // * Divide the metrics between "current" (peers already pinning the CID)
 //   and "candidates" (peers that could pin the CID), as long as their metrics
-//   are valid.
+//   are valid. Blacklisted peers and peers marked as draining are left out.
+//   When the size of the CID is known, candidates reporting less free
+//   space than needed, once their pending allocations are discounted, are
+//   left out too.
 // * Given the candidates:
 //   * Check if we are overpinning an item
 //   * Check if there are not enough candidates for the "needed" replication
 //     factor.
 //   * If there are enough candidates:
 //     * Call the configured allocator, which sorts the candidates (and
-//       may veto some depending on the allocation strategy.
+//       may veto some depending on the allocation strategy. Allocators
+//       supporting several metrics receive the latest metrics from all the
+//       informers for each of the peers.
 //     * The allocator returns a list of final candidate peers sorted by
 //       order of preference.
 //     * Take as many final candidates from the list as we can, until
@@ -44,7 +50,10 @@ import (
 // into account if the given CID was previously in a "pin everywhere" mode,
 // and will consider such Pins as currently unallocated ones, providing
 // new allocations as available.
-func (c *Cluster) allocate(hash cid.Cid, rplMin, rplMax int, blacklist []peer.ID, prioritylist []peer.ID) ([]peer.ID, error) {
+//
+// The size of the content (0 when unknown) is used to leave out peers which
+// cannot fit it.
+func (c *Cluster) allocate(hash cid.Cid, size uint64, rplMin, rplMax int, blacklist []peer.ID, prioritylist []peer.ID) ([]peer.ID, error) {
 	if (rplMin + rplMax) == 0 {
 		return nil, fmt.Errorf("bad replication factors: %d/%d", rplMin, rplMax)
 	}
@@ -53,47 +62,76 @@ func (c *Cluster) allocate(hash cid.Cid, rplMin, rplMax int, blacklist []peer.ID
 		return []peer.ID{}, nil
 	}
 
+	currentAllocs, currentMetrics, candidatesMetrics, priorityMetrics := c.divideMetrics(hash, size, blacklist, prioritylist)
+
+	newAllocs, err := c.obtainAllocations(
+		hash,
+		rplMin,
+		rplMax,
+		currentMetrics,
+		candidatesMetrics,
+		priorityMetrics,
+	)
+	if err != nil {
+		return newAllocs, err
+	}
+	if newAllocs == nil {
+		newAllocs = currentAllocs
+	}
+	return newAllocs, nil
+}
+
+// divideMetrics obtains the latest metrics for the first informer and
+// divides them between the peers currently allocated to the given Cid,
+// the priority peers and the rest of candidates. Blacklisted and draining
+// peers are left out, as well as candidates which cannot fit the given
+// size. It also returns the current allocations of the Cid, without the
+// draining peers. Free space metrics have pending allocations discounted.
+func (c *Cluster) divideMetrics(hash cid.Cid, size uint64, blacklist, prioritylist []peer.ID) (
+	currentAllocs []peer.ID,
+	currentMetrics, candidatesMetrics, priorityMetrics map[peer.ID]api.Metric,
+) {
+	draining := c.drainingPeers()
+	blacklist = append(draining, blacklist...)
+
 	// Figure out who is holding the CID
 	currentPin, _ := c.PinGet(hash)
-	currentAllocs := currentPin.Allocations
-	metrics := c.monitor.LatestMetrics(c.informer.Name())
+	for _, p := range currentPin.Allocations {
+		if !containsPeer(draining, p) {
+			currentAllocs = append(currentAllocs, p)
+		}
+	}
+	metrics := c.monitor.LatestMetrics(c.informers[0].Name())
+	free := c.freeSpaceMetrics()
 
-	currentMetrics := make(map[peer.ID]api.Metric)
-	candidatesMetrics := make(map[peer.ID]api.Metric)
-	priorityMetrics := make(map[peer.ID]api.Metric)
+	currentMetrics = make(map[peer.ID]api.Metric)
+	candidatesMetrics = make(map[peer.ID]api.Metric)
+	priorityMetrics = make(map[peer.ID]api.Metric)
 
 	// Divide metrics between current and candidates.
 	// All metrics in metrics are valid (at least the
 	// moment they were compiled by the monitor)
 	for _, m := range metrics {
+		if fm, ok := free[m.Peer]; ok && m.Name == freeSpaceMetricName {
+			m = fm
+		}
+
 		switch {
 		case containsPeer(blacklist, m.Peer):
 			// discard blacklisted peers
 			continue
 		case containsPeer(currentAllocs, m.Peer):
 			currentMetrics[m.Peer] = m
+		case !fits(free, m.Peer, size):
+			// discard peers without space for the content
+			continue
 		case containsPeer(prioritylist, m.Peer):
 			priorityMetrics[m.Peer] = m
 		default:
 			candidatesMetrics[m.Peer] = m
 		}
 	}
-
-	newAllocs, err := c.obtainAllocations(
-		hash,
-		rplMin,
-		rplMax,
-		currentMetrics,
-		candidatesMetrics,
-		priorityMetrics,
-	)
-	if err != nil {
-		return newAllocs, err
-	}
-	if newAllocs == nil {
-		newAllocs = currentAllocs
-	}
-	return newAllocs, nil
+	return
 }
 
 // allocationError logs an allocation error
@@ -166,7 +204,7 @@ func (c *Cluster) obtainAllocations(
 	// on the priority of candidates grab as many as "wanted"
 
 	// the allocator returns a list of peers ordered by priority
-	finalAllocs, err := c.allocator.Allocate(
+	finalAllocs, err := c.runAllocator(
 		hash,
 		currentValidMetrics,
 		candidatesMetrics,
@@ -188,5 +226,255 @@ func (c *Cluster) obtainAllocations(
 
 	// the final result is the currently valid allocations
 	// along with the ones provided by the allocator
-	return append(validAllocations, finalAllocs[0:allocationsToUse]...), nil
+	allocs := append(validAllocations, finalAllocs[0:allocationsToUse]...)
+
+	if palloc, ok := c.allocator.(PlacementAllocator); ok {
+		metrics := make(map[peer.ID]api.Metric)
+		for _, ms := range []map[peer.ID]api.Metric{currentValidMetrics, candidatesMetrics, priorityMetrics} {
+			for p, m := range ms {
+				metrics[p] = m
+			}
+		}
+		err = palloc.CheckPlacement(hash, allocs, metrics)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return allocs, nil
+}
+
+// runAllocator calls the configured allocator with the given metrics. When
+// it is a MultiMetricAllocator, it is given the latest metrics from all the
+// informers for the same peers.
+func (c *Cluster) runAllocator(
+	hash cid.Cid,
+	current, candidates, priority map[peer.ID]api.Metric,
+) ([]peer.ID, error) {
+	multi, ok := c.allocator.(MultiMetricAllocator)
+	if !ok {
+		return c.allocator.Allocate(hash, current, candidates, priority)
+	}
+
+	byName := make(map[string]map[peer.ID]api.Metric)
+	for _, informer := range c.informers {
+		name := informer.Name()
+		if name == freeSpaceMetricName {
+			byName[name] = c.freeSpaceMetrics()
+			continue
+		}
+		byPeer := make(map[peer.ID]api.Metric)
+		for _, m := range c.monitor.LatestMetrics(name) {
+			byPeer[m.Peer] = m
+		}
+		byName[name] = byPeer
+	}
+
+	toSets := func(metrics map[peer.ID]api.Metric) map[peer.ID]api.MetricsSet {
+		sets := make(map[peer.ID]api.MetricsSet, len(metrics))
+		for p, m := range metrics {
+			set := api.MetricsSet{m.Name: m}
+			for name, byPeer := range byName {
+				if pm, ok := byPeer[p]; ok {
+					set[name] = pm
+				}
+			}
+			sets[p] = set
+		}
+		return sets
+	}
+
+	return multi.AllocateMetrics(
+		hash,
+		toSets(current),
+		toSets(candidates),
+		toSets(priority),
+	)
+}
+
+// simulateAllocation runs the allocation process for the given pin
+// without committing anything and explains the decision taken for every
+// peer.
+func (c *Cluster) simulateAllocation(pin api.Pin, blacklist []peer.ID) api.AllocationSimulation {
+	prioritylist := append(api.StringsToPeers(pin.UserAllocations), pin.Allocations...)
+	sim := api.AllocationSimulation{
+		Cid:        pin.Cid.String(),
+		Candidates: []api.AllocationCandidate{},
+	}
+
+	allocs, err := c.allocate(
+		pin.Cid,
+		pin.Size,
+		pin.ReplicationFactorMin,
+		pin.ReplicationFactorMax,
+		blacklist,
+		prioritylist,
+	)
+	if err != nil {
+		sim.Error = err.Error()
+	}
+	sim.Allocations = api.PeersToStrings(allocs)
+	everywhere := err == nil && len(allocs) == 0
+	draining := c.drainingPeers()
+	free := c.freeSpaceMetrics()
+
+	// Find out which peers the allocator would accept.
+	currentAllocs, current, candidates, priority := c.divideMetrics(pin.Cid, pin.Size, blacklist, prioritylist)
+	accepted := make(map[peer.ID]bool)
+	ranked, allocErr := c.runAllocator(pin.Cid, current, candidates, priority)
+	for _, p := range ranked {
+		accepted[p] = true
+	}
+
+	byName := make(map[string]map[peer.ID]api.Metric)
+	for _, informer := range c.informers {
+		byPeer := make(map[peer.ID]api.Metric)
+		for _, m := range c.monitor.LatestMetrics(informer.Name()) {
+			byPeer[m.Peer] = m
+		}
+		byName[informer.Name()] = byPeer
+	}
+	primary := c.informers[0].Name()
+
+	peers, err := c.consensus.Peers()
+	if err != nil {
+		logger.Error(err)
+	}
+	for _, p := range currentAllocs {
+		if !containsPeer(peers, p) {
+			peers = append(peers, p)
+		}
+	}
+
+	for _, p := range peers {
+		cand := api.AllocationCandidate{
+			Peer:    peer.IDB58Encode(p),
+			Metrics: []api.Metric{},
+		}
+		for _, informer := range c.informers {
+			if m, ok := byName[informer.Name()][p]; ok {
+				cand.Metrics = append(cand.Metrics, m)
+			}
+		}
+		_, hasMetric := byName[primary][p]
+
+		switch {
+		case everywhere:
+			cand.Allocated = true
+			cand.Reason = "replication factor is -1: pinned everywhere"
+		case containsPeer(allocs, p) && containsPeer(currentAllocs, p):
+			cand.Allocated = true
+			cand.Reason = "already allocated"
+		case containsPeer(allocs, p) && containsPeer(prioritylist, p):
+			cand.Allocated = true
+			cand.Reason = "allocated with priority"
+		case containsPeer(allocs, p):
+			cand.Allocated = true
+			cand.Reason = "selected by the allocator"
+		case containsPeer(draining, p):
+			cand.Reason = "draining"
+		case containsPeer(blacklist, p):
+			cand.Reason = "blacklisted"
+		case !hasMetric:
+			cand.Reason = fmt.Sprintf("no valid %s metric (expired or missing)", primary)
+		case !containsPeer(currentAllocs, p) && !fits(free, p, pin.Size):
+			cand.Reason = fmt.Sprintf("not enough free space for %d bytes (including pending allocations)", pin.Size)
+		case allocErr != nil:
+			cand.Reason = "allocator error: " + allocErr.Error()
+		case !accepted[p] && !containsPeer(currentAllocs, p):
+			cand.Reason = "discarded by the allocator (i.e. not enough space or constraints not met)"
+		case sim.Error != "":
+			cand.Reason = "not selected: allocation failed"
+		default:
+			cand.Reason = "not selected: other peers were preferred"
+		}
+		sim.Candidates = append(sim.Candidates, cand)
+	}
+	return sim
+}
+
+// freeSpaceMetricName is the name of the metric produced by the disk
+// informer with the freespace metric type.
+const freeSpaceMetricName = "freespace"
+
+// pendingAllocation is an allocation made after the latest free space
+// metric of a peer was produced, and therefore not accounted for in it.
+type pendingAllocation struct {
+	cid    cid.Cid
+	size   uint64
+	expire int64 // expiration of the metric when the allocation was made
+}
+
+// addPendingAllocations records the allocations of the given pin which
+// were not among the previous ones, so that their size is discounted from
+// the free space of the peers until they report new metrics.
+func (c *Cluster) addPendingAllocations(pin api.Pin, previous []peer.ID) {
+	if pin.Size == 0 {
+		return
+	}
+
+	metrics := make(map[peer.ID]api.Metric)
+	for _, m := range c.monitor.LatestMetrics(freeSpaceMetricName) {
+		metrics[m.Peer] = m
+	}
+
+	c.pendingMux.Lock()
+	defer c.pendingMux.Unlock()
+	for _, p := range pin.Allocations {
+		m, ok := metrics[p]
+		if !ok || containsPeer(previous, p) {
+			continue
+		}
+		c.pending[p] = append(c.pending[p], pendingAllocation{
+			cid:    pin.Cid,
+			size:   pin.Size,
+			expire: m.Expire,
+		})
+	}
+}
+
+// freeSpaceMetrics returns the latest free space metrics by peer, with the
+// size of the pending allocations of each peer discounted. Pending
+// allocations are forgotten once the peer reports a newer metric.
+func (c *Cluster) freeSpaceMetrics() map[peer.ID]api.Metric {
+	metrics := c.monitor.LatestMetrics(freeSpaceMetricName)
+
+	c.pendingMux.Lock()
+	defer c.pendingMux.Unlock()
+
+	free := make(map[peer.ID]api.Metric, len(metrics))
+	pending := make(map[peer.ID][]pendingAllocation)
+	for _, m := range metrics {
+		value, err := strconv.ParseUint(m.Value, 10, 64)
+		if err != nil {
+			logger.Warningf("bad %s metric from %s: %s", m.Name, m.Peer.Pretty(), err)
+			continue
+		}
+		for _, pa := range c.pending[m.Peer] {
+			if m.Expire > pa.expire { // newer metric
+				continue
+			}
+			pending[m.Peer] = append(pending[m.Peer], pa)
+			if pa.size > value {
+				value = 0
+			} else {
+				value -= pa.size
+			}
+		}
+		m.Value = strconv.FormatUint(value, 10)
+		free[m.Peer] = m
+	}
+	c.pending = pending
+	return free
+}
+
+// fits returns whether the given peer has enough free space for content
+// of the given size. Peers without free space metrics are assumed to have
+// room for it, as well as any peer when the size is unknown (0).
+func fits(free map[peer.ID]api.Metric, p peer.ID, size uint64) bool {
+	m, ok := free[p]
+	if size == 0 || !ok {
+		return true
+	}
+	value, err := strconv.ParseUint(m.Value, 10, 64)
+	return err == nil && value >= size
 }
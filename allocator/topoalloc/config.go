@@ -0,0 +1,108 @@
+package topoalloc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+const configKey = "topology"
+
+// DefaultTags are the failure domain levels used by default, from the
+// widest to the narrowest.
+var DefaultTags = []string{"region", "datacenter", "rack"}
+
+// Config allows to initialize a TopoAllocator.
+type Config struct {
+	config.Saver
+
+	// Tags are the names of the tags (as published by the tags
+	// informer) which define the failure domains, from the widest to
+	// the narrowest (i.e. region, datacenter, rack). Domains are
+	// hierarchical: two racks with the same name in different
+	// datacenters are different domains.
+	Tags []string
+
+	// MinDomains sets, for some of the Tags, the minimum number of
+	// distinct domains that the allocations of a pin must span.
+	// Allocation fails when the available peers or the replication
+	// factor of the pin cannot provide as many.
+	MinDomains map[string]int
+}
+
+type jsonConfig struct {
+	Tags       []string       `json:"tags"`
+	MinDomains map[string]int `json:"min_domains"`
+}
+
+// ConfigKey returns a human-friendly identifier for this
+// Config's type.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values.
+func (cfg *Config) Default() error {
+	cfg.Tags = make([]string, len(DefaultTags))
+	copy(cfg.Tags, DefaultTags)
+	cfg.MinDomains = make(map[string]int)
+	return nil
+}
+
+// Validate checks that the fields of this configuration have
+// sensible values.
+func (cfg *Config) Validate() error {
+	if len(cfg.Tags) == 0 {
+		return errors.New("topology.tags cannot be empty")
+	}
+
+	seen := make(map[string]bool)
+	for _, t := range cfg.Tags {
+		if t == "" || seen[t] {
+			return errors.New("topology.tags should be unique and non-empty")
+		}
+		seen[t] = true
+	}
+
+	for t, n := range cfg.MinDomains {
+		if !seen[t] {
+			return fmt.Errorf("topology.min_domains: %s is not one of the tags", t)
+		}
+		if n < 0 {
+			return fmt.Errorf("topology.min_domains: %s is negative", t)
+		}
+	}
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		return err
+	}
+
+	cfg.Default()
+
+	if len(jcfg.Tags) > 0 {
+		cfg.Tags = jcfg.Tags
+	}
+	if jcfg.MinDomains != nil {
+		cfg.MinDomains = jcfg.MinDomains
+	}
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{
+		Tags:       cfg.Tags,
+		MinDomains: cfg.MinDomains,
+	}
+
+	return config.DefaultJSONMarshal(jcfg)
+}
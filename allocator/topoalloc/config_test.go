@@ -0,0 +1,74 @@
+package topoalloc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var cfgJSON = []byte(`
+{
+      "tags": ["region", "rack"],
+      "min_domains": {
+          "region": 2
+      }
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Tags) != 2 || cfg.MinDomains["region"] != 2 {
+		t.Error("configuration was not loaded")
+	}
+
+	j := &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.MinDomains["datacenter"] = 1
+	tst, _ := json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with min_domains for an unknown tag")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.Tags = []string{"rack", "rack"}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with duplicated tags")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Tags[1] != "rack" || cfg.MinDomains["region"] != 2 {
+		t.Error("configuration was not saved")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.MinDomains["region"] = -1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
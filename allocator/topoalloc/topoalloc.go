@@ -0,0 +1,191 @@
+// Package topoalloc implements an ipfscluster.PinAllocator which spreads
+// the allocations of every pin across as many failure domains (regions,
+// datacenters, racks...) as possible. Failure domains are obtained from the
+// metrics produced by the tags informer, which must be the informer used
+// along with this allocator.
+package topoalloc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/informer/tags"
+
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var logger = logging.Logger("topoalloc")
+
+// TopoAllocator is a topology-aware PinAllocator.
+type TopoAllocator struct {
+	config *Config
+}
+
+// NewAllocator returns an initialized TopoAllocator.
+func NewAllocator(cfg *Config) (*TopoAllocator, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &TopoAllocator{
+		config: cfg,
+	}, nil
+}
+
+// SetClient does nothing in this allocator
+func (alloc *TopoAllocator) SetClient(c *rpc.Client) {}
+
+// Shutdown does nothing in this allocator
+func (alloc *TopoAllocator) Shutdown() error { return nil }
+
+// Allocate returns where to allocate a pin request based on the failure
+// domains of the peers. Peers are chosen one by one, each time picking the
+// one whose domains are the least used by the current allocations and the
+// peers chosen before it, comparing the widest domains first. Thus, the
+// first peers in the returned list are in as many different domains as
+// possible. Priority peers are always placed first.
+func (alloc *TopoAllocator) Allocate(c cid.Cid, current,
+	candidates, priority map[peer.ID]api.Metric) ([]peer.ID, error) {
+
+	err := alloc.checkMinDomains(current, candidates, priority)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make([]map[string]int, len(alloc.config.Tags))
+	for i := range used {
+		used[i] = make(map[string]int)
+	}
+	for _, m := range current {
+		use(used, alloc.domains(m))
+	}
+
+	first := alloc.spread(used, priority)
+	last := alloc.spread(used, candidates)
+	return append(first, last...), nil
+}
+
+// domains returns the failure domains of the peer which sent the given
+// metric, one for each of the configured tags. Each domain includes the
+// wider ones, so that they are unique (i.e. "eu/dc1/r1").
+func (alloc *TopoAllocator) domains(m api.Metric) []string {
+	peerTags := tags.ParseMetric(m)
+	domains := make([]string, len(alloc.config.Tags))
+	var path []string
+	for i, t := range alloc.config.Tags {
+		path = append(path, peerTags[t])
+		domains[i] = strings.Join(path, "/")
+	}
+	return domains
+}
+
+func use(used []map[string]int, domains []string) {
+	for i, d := range domains {
+		used[i][d]++
+	}
+}
+
+// spread sorts the peers in the given metrics so that each one is in the
+// least used domains, and marks their domains as used.
+func (alloc *TopoAllocator) spread(used []map[string]int, metrics map[peer.ID]api.Metric) []peer.ID {
+	peers := make([]peer.ID, 0, len(metrics))
+	peerDomains := make(map[peer.ID][]string)
+	for p, m := range metrics {
+		if m.Discard() {
+			continue
+		}
+		peers = append(peers, p)
+		peerDomains[p] = alloc.domains(m)
+	}
+
+	// less returns true when p1 is a better choice than p2.
+	less := func(p1, p2 peer.ID) bool {
+		for i := range used {
+			u1 := used[i][peerDomains[p1][i]]
+			u2 := used[i][peerDomains[p2][i]]
+			if u1 != u2 {
+				return u1 < u2
+			}
+		}
+		return p1 < p2
+	}
+
+	sorted := make([]peer.ID, 0, len(peers))
+	for len(peers) > 0 {
+		best := 0
+		for i := range peers {
+			if less(peers[i], peers[best]) {
+				best = i
+			}
+		}
+		p := peers[best]
+		sorted = append(sorted, p)
+		use(used, peerDomains[p])
+		peers = append(peers[:best], peers[best+1:]...)
+	}
+	return sorted
+}
+
+// CheckPlacement returns an error when the given allocations do not span
+// the minimum number of domains configured for any of the tags (i.e.
+// when the replication factor of the pin is lower than the minimum).
+func (alloc *TopoAllocator) CheckPlacement(c cid.Cid, allocs []peer.ID, metrics map[peer.ID]api.Metric) error {
+	placed := make(map[peer.ID]api.Metric, len(allocs))
+	for _, p := range allocs {
+		if m, ok := metrics[p]; ok {
+			placed[p] = m
+		}
+	}
+
+	for i, n := range alloc.countDomains(placed) {
+		t := alloc.config.Tags[i]
+		if min := alloc.config.MinDomains[t]; n < min {
+			logger.Errorf("%s is allocated to %d %s domains, %d required", c, n, t, min)
+			return fmt.Errorf("allocations span %d %s domains, %d required", n, t, min)
+		}
+	}
+	return nil
+}
+
+// checkMinDomains returns an error when the given peers do not span the
+// minimum number of domains configured for any of the tags.
+func (alloc *TopoAllocator) checkMinDomains(metrics ...map[peer.ID]api.Metric) error {
+	for i, n := range alloc.countDomains(metrics...) {
+		t := alloc.config.Tags[i]
+		if min := alloc.config.MinDomains[t]; n < min {
+			logger.Errorf("not enough %s domains: %d available, %d required", t, n, min)
+			return fmt.Errorf("not enough %s domains to allocate: %d available, %d required", t, n, min)
+		}
+	}
+	return nil
+}
+
+// countDomains returns, for each of the tags, the number of distinct
+// domains spanned by the peers in the given metrics.
+func (alloc *TopoAllocator) countDomains(metrics ...map[peer.ID]api.Metric) []int {
+	available := make([]map[string]struct{}, len(alloc.config.Tags))
+	for i := range available {
+		available[i] = make(map[string]struct{})
+	}
+	for _, ms := range metrics {
+		for _, m := range ms {
+			if m.Discard() {
+				continue
+			}
+			for i, d := range alloc.domains(m) {
+				available[i][d] = struct{}{}
+			}
+		}
+	}
+
+	counts := make([]int, len(available))
+	for i := range available {
+		counts[i] = len(available[i])
+	}
+	return counts
+}
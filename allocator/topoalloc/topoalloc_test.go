@@ -0,0 +1,169 @@
+package topoalloc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/informer/tags"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var (
+	peer0      = peer.ID("QmUQ6Nsejt1SuZAu8yL8WgqQZHHAYreLVYYa4VPsLUCed7")
+	peer1      = peer.ID("QmUZ13osndQ5uL4tPWHXe3iBgBgq9gfewcBMSCAuMBsDJ6")
+	peer2      = peer.ID("QmPrSBATWGAN56fiiEWEhKX3L1F3mTghEQR7vQwaeo7zHi")
+	peer3      = peer.ID("QmPGDFvBkgWhvzEK9qaTWrWurSwqXNmhnK3hgELPdZZNPa")
+	testCid, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq")
+)
+
+var inAMinute = time.Now().Add(time.Minute).UnixNano()
+
+func tagsMetric(region, rack string) api.Metric {
+	return api.Metric{
+		Name: tags.MetricName,
+		Value: tags.EncodeTags(map[string]string{
+			"region": region,
+			"rack":   rack,
+		}),
+		Expire: inAMinute,
+		Valid:  true,
+	}
+}
+
+func testAllocator(t *testing.T, minDomains map[string]int) *TopoAllocator {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Tags = []string{"region", "rack"}
+	cfg.MinDomains = minDomains
+	alloc, err := NewAllocator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return alloc
+}
+
+func TestAllocateSpreadsRacks(t *testing.T) {
+	alloc := testAllocator(t, nil)
+	candidates := map[peer.ID]api.Metric{
+		peer0: tagsMetric("eu", "r1"),
+		peer1: tagsMetric("eu", "r1"),
+		peer2: tagsMetric("eu", "r2"),
+		peer3: tagsMetric("eu", "r3"),
+	}
+
+	res, err := alloc.Allocate(testCid, nil, candidates, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 4 {
+		t.Fatal("expected all candidates to be returned")
+	}
+	if res[3] != peer1 {
+		t.Error("the second peer in rack r1 should come last")
+	}
+}
+
+func TestAllocateSpreadsRegions(t *testing.T) {
+	alloc := testAllocator(t, nil)
+	current := map[peer.ID]api.Metric{
+		peer0: tagsMetric("eu", "r1"),
+	}
+	candidates := map[peer.ID]api.Metric{
+		peer1: tagsMetric("eu", "r2"),
+		peer2: tagsMetric("eu", "r3"),
+		peer3: tagsMetric("us", "r1"),
+	}
+
+	res, err := alloc.Allocate(testCid, current, candidates, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[0] != peer3 {
+		t.Error("a peer in a new region should be preferred")
+	}
+}
+
+func TestAllocatePriority(t *testing.T) {
+	alloc := testAllocator(t, nil)
+	priority := map[peer.ID]api.Metric{
+		peer0: tagsMetric("eu", "r1"),
+	}
+	candidates := map[peer.ID]api.Metric{
+		peer1: tagsMetric("us", "r1"),
+		peer2: tagsMetric("eu", "r2"),
+	}
+
+	res, err := alloc.Allocate(testCid, nil, candidates, priority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 3 || res[0] != peer0 || res[1] != peer1 {
+		t.Error("unexpected allocation order:", res)
+	}
+}
+
+func TestAllocateFilterInvalid(t *testing.T) {
+	alloc := testAllocator(t, nil)
+	invalid := tagsMetric("us", "r1")
+	invalid.Valid = false
+	candidates := map[peer.ID]api.Metric{
+		peer0: tagsMetric("eu", "r1"),
+		peer1: invalid,
+	}
+
+	res, err := alloc.Allocate(testCid, nil, candidates, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0] != peer0 {
+		t.Error("invalid metrics should be discarded")
+	}
+}
+
+func TestAllocateMinDomains(t *testing.T) {
+	alloc := testAllocator(t, map[string]int{"region": 2})
+	candidates := map[peer.ID]api.Metric{
+		peer0: tagsMetric("eu", "r1"),
+		peer1: tagsMetric("eu", "r2"),
+	}
+
+	_, err := alloc.Allocate(testCid, nil, candidates, nil)
+	if err == nil {
+		t.Fatal("expected an error when there are not enough regions")
+	}
+
+	candidates[peer2] = tagsMetric("us", "r1")
+	_, err = alloc.Allocate(testCid, nil, candidates, nil)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckPlacement(t *testing.T) {
+	alloc := testAllocator(t, map[string]int{"region": 3})
+	metrics := map[peer.ID]api.Metric{
+		peer0: tagsMetric("eu", "r1"),
+		peer1: tagsMetric("us", "r1"),
+		peer2: tagsMetric("ap", "r1"),
+	}
+
+	// the candidates span 3 regions
+	allocs, err := alloc.Allocate(testCid, nil, metrics, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// but a replication factor of 2 only uses 2 of them
+	err = alloc.CheckPlacement(testCid, allocs[:2], metrics)
+	if err == nil {
+		t.Error("expected an error when the allocations span 2 regions")
+	}
+
+	err = alloc.CheckPlacement(testCid, allocs, metrics)
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,113 @@
+package weightalloc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+const configKey = "weighted"
+
+// Default values for Config.
+var (
+	DefaultWeights = map[string]float64{
+		"freespace": 1,
+		"numpin":    -1,
+	}
+	DefaultConstraints = []string{}
+)
+
+// Config allows to initialize a WeightAllocator.
+type Config struct {
+	config.Saver
+
+	// Weights sets how much each metric (by name) contributes to the
+	// score of a peer. Metric values are normalized among the
+	// candidates before being weighted. Positive weights favor peers
+	// with larger values, while negative weights favor peers with
+	// smaller ones. Metrics without a weight are ignored.
+	Weights map[string]float64
+
+	// Constraints are conditions that a peer's metrics must meet in
+	// order to be allocated, like "freespace > 100GB" or
+	// "numpin < 10000". Values may use byte-size units. Labels from
+	// the tags informer can be matched with "==" and "!=", like
+	// "tags.tier == ssd".
+	Constraints []string
+}
+
+type jsonConfig struct {
+	Weights     map[string]float64 `json:"weights"`
+	Constraints []string           `json:"constraints"`
+}
+
+// ConfigKey returns a human-friendly identifier for this
+// Config's type.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values.
+func (cfg *Config) Default() error {
+	cfg.Weights = make(map[string]float64)
+	for k, v := range DefaultWeights {
+		cfg.Weights[k] = v
+	}
+	cfg.Constraints = make([]string, len(DefaultConstraints))
+	copy(cfg.Constraints, DefaultConstraints)
+	return nil
+}
+
+// Validate checks that the fields of this configuration have
+// sensible values.
+func (cfg *Config) Validate() error {
+	if len(cfg.Weights) == 0 {
+		return errors.New("weighted.weights cannot be empty")
+	}
+
+	for name := range cfg.Weights {
+		if name == "" {
+			return errors.New("weighted.weights: metric names cannot be empty")
+		}
+	}
+
+	for _, c := range cfg.Constraints {
+		_, err := parseConstraint(c)
+		if err != nil {
+			return fmt.Errorf("weighted.constraints: %s", err)
+		}
+	}
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		return err
+	}
+
+	cfg.Default()
+
+	if jcfg.Weights != nil {
+		cfg.Weights = jcfg.Weights
+	}
+	if jcfg.Constraints != nil {
+		cfg.Constraints = jcfg.Constraints
+	}
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{
+		Weights:     cfg.Weights,
+		Constraints: cfg.Constraints,
+	}
+
+	return config.DefaultJSONMarshal(jcfg)
+}
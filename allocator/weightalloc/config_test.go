@@ -0,0 +1,75 @@
+package weightalloc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var cfgJSON = []byte(`
+{
+      "weights": {
+          "freespace": 2,
+          "numpin": -1
+      },
+      "constraints": ["freespace > 100GB"]
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Weights["freespace"] != 2 || len(cfg.Constraints) != 1 {
+		t.Error("configuration was not loaded")
+	}
+
+	j := &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.Constraints = []string{"freespace >> 1"}
+	tst, _ := json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error parsing constraints")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.Weights = map[string]float64{}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with no weights")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Weights["numpin"] != -1 || cfg.Constraints[0] != "freespace > 100GB" {
+		t.Error("configuration was not saved")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.Constraints = []string{"freespace"}
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
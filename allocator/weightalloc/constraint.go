@@ -0,0 +1,88 @@
+package weightalloc
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+var constraintRegexp = regexp.MustCompile(`^\s*([^\s<>=!]+)\s*(>=|<=|==|!=|>|<)\s*(\S+)\s*$`)
+
+// constraint is a condition on the value of a metric, like
+// "freespace > 100GB". Non-numeric values can be compared with "==" and
+// "!=", like "tags.region == eu-west".
+type constraint struct {
+	metric  string
+	op      string
+	value   float64
+	str     string
+	numeric bool
+}
+
+func parseConstraint(str string) (constraint, error) {
+	m := constraintRegexp.FindStringSubmatch(str)
+	if m == nil {
+		return constraint{}, fmt.Errorf("cannot parse constraint: %q", str)
+	}
+
+	value, err := parseValue(m[3])
+	if err != nil && m[2] != "==" && m[2] != "!=" {
+		return constraint{}, fmt.Errorf("bad value in constraint %q: %s", str, err)
+	}
+
+	return constraint{
+		metric:  m[1],
+		op:      m[2],
+		value:   value,
+		str:     m[3],
+		numeric: err == nil,
+	}, nil
+}
+
+// parseValue parses a plain number or a byte size (i.e. "100GB").
+func parseValue(str string) (float64, error) {
+	v, err := strconv.ParseFloat(str, 64)
+	if err == nil {
+		return v, nil
+	}
+	b, err := humanize.ParseBytes(str)
+	if err != nil {
+		return 0, err
+	}
+	return float64(b), nil
+}
+
+// allowsString returns true when the given non-numeric value meets the
+// constraint.
+func (c constraint) allowsString(v string) bool {
+	switch c.op {
+	case "==":
+		return v == c.str
+	case "!=":
+		return v != c.str
+	default:
+		return false
+	}
+}
+
+// allows returns true when the given value meets the constraint.
+func (c constraint) allows(v float64) bool {
+	switch c.op {
+	case ">":
+		return v > c.value
+	case ">=":
+		return v >= c.value
+	case "<":
+		return v < c.value
+	case "<=":
+		return v <= c.value
+	case "==":
+		return v == c.value
+	case "!=":
+		return v != c.value
+	default:
+		return false
+	}
+}
@@ -0,0 +1,188 @@
+// Package weightalloc implements an ipfscluster.PinAllocator which combines
+// the metrics from several informers. Peers which do not meet the
+// configured constraints are discarded, and the rest are sorted by a score
+// obtained from the weighted sum of their normalized metric values.
+package weightalloc
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/informer/tags"
+
+	cid "github.com/ipfs/go-cid"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// WeightAllocator is a PinAllocator and a MultiMetricAllocator which
+// scores peers using the weighted metrics from several informers.
+type WeightAllocator struct {
+	config      *Config
+	constraints []constraint
+}
+
+// NewAllocator returns an initialized WeightAllocator.
+func NewAllocator(cfg *Config) (*WeightAllocator, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	constraints := make([]constraint, 0, len(cfg.Constraints))
+	for _, str := range cfg.Constraints {
+		c, err := parseConstraint(str)
+		if err != nil {
+			return nil, err
+		}
+		constraints = append(constraints, c)
+	}
+
+	return &WeightAllocator{
+		config:      cfg,
+		constraints: constraints,
+	}, nil
+}
+
+// SetClient does nothing in this allocator
+func (alloc *WeightAllocator) SetClient(c *rpc.Client) {}
+
+// Shutdown does nothing in this allocator
+func (alloc *WeightAllocator) Shutdown() error { return nil }
+
+// Allocate returns where to allocate a pin request when only one metric
+// is available for each peer. See AllocateMetrics.
+func (alloc *WeightAllocator) Allocate(c cid.Cid, current,
+	candidates, priority map[peer.ID]api.Metric) ([]peer.ID, error) {
+	toSets := func(metrics map[peer.ID]api.Metric) map[peer.ID]api.MetricsSet {
+		sets := make(map[peer.ID]api.MetricsSet, len(metrics))
+		for p, m := range metrics {
+			sets[p] = api.MetricsSet{m.Name: m}
+		}
+		return sets
+	}
+	return alloc.AllocateMetrics(c, toSets(current), toSets(candidates), toSets(priority))
+}
+
+// AllocateMetrics returns where to allocate a pin request. Candidates
+// which do not meet the constraints are discarded. The rest are sorted by
+// score, from highest to lowest, with priority peers first.
+func (alloc *WeightAllocator) AllocateMetrics(c cid.Cid, current,
+	candidates, priority map[peer.ID]api.MetricsSet) ([]peer.ID, error) {
+	first := alloc.sort(priority)
+	last := alloc.sort(candidates)
+	return append(first, last...), nil
+}
+
+// values returns the numeric values of the valid metrics in a set.
+func values(set api.MetricsSet) map[string]float64 {
+	vals := make(map[string]float64)
+	for name, m := range set {
+		if m.Discard() {
+			continue
+		}
+		v, err := strconv.ParseFloat(m.Value, 64)
+		if err != nil {
+			continue
+		}
+		vals[name] = v
+	}
+	return vals
+}
+
+// stringValue returns the value of a valid metric in a set. Names like
+// "tags.region" refer to the labels carried by the tags metric.
+func stringValue(set api.MetricsSet, name string) (string, bool) {
+	if strings.HasPrefix(name, tags.MetricName+".") {
+		m, ok := set[tags.MetricName]
+		if !ok || m.Discard() {
+			return "", false
+		}
+		v, ok := tags.ParseMetric(m)[strings.TrimPrefix(name, tags.MetricName+".")]
+		return v, ok
+	}
+
+	m, ok := set[name]
+	if !ok || m.Discard() {
+		return "", false
+	}
+	return m.Value, true
+}
+
+// allows returns true when the metrics in a set (and their numeric
+// values) meet all the constraints. Missing values never meet them.
+func (alloc *WeightAllocator) allows(set api.MetricsSet, vals map[string]float64) bool {
+	for _, c := range alloc.constraints {
+		if !c.numeric {
+			v, ok := stringValue(set, c.metric)
+			if !ok || !c.allowsString(v) {
+				return false
+			}
+			continue
+		}
+		v, ok := vals[c.metric]
+		if !ok || !c.allows(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// sort discards the peers which do not meet the constraints and sorts the
+// rest by score.
+func (alloc *WeightAllocator) sort(sets map[peer.ID]api.MetricsSet) []peer.ID {
+	peers := make([]peer.ID, 0, len(sets))
+	peerVals := make(map[peer.ID]map[string]float64)
+	for p, set := range sets {
+		vals := values(set)
+		if len(vals) == 0 || !alloc.allows(set, vals) {
+			continue
+		}
+		peers = append(peers, p)
+		peerVals[p] = vals
+	}
+
+	// find the range of every weighted metric to normalize values
+	min := make(map[string]float64)
+	max := make(map[string]float64)
+	for name := range alloc.config.Weights {
+		min[name] = math.Inf(1)
+		max[name] = math.Inf(-1)
+		for _, vals := range peerVals {
+			v, ok := vals[name]
+			if !ok {
+				continue
+			}
+			min[name] = math.Min(min[name], v)
+			max[name] = math.Max(max[name], v)
+		}
+	}
+
+	scores := make(map[peer.ID]float64)
+	for p, vals := range peerVals {
+		var score float64
+		for name, w := range alloc.config.Weights {
+			v, ok := vals[name]
+			switch {
+			case !ok: // a missing metric counts as the worst value
+				score += math.Min(w, 0)
+			case max[name] > min[name]:
+				score += w * (v - min[name]) / (max[name] - min[name])
+			}
+		}
+		scores[p] = score
+	}
+
+	sort.Slice(peers, func(i, j int) bool {
+		si := scores[peers[i]]
+		sj := scores[peers[j]]
+		if si != sj {
+			return si > sj
+		}
+		return peers[i] < peers[j]
+	})
+	return peers
+}
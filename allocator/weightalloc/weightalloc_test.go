@@ -0,0 +1,183 @@
+package weightalloc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/informer/tags"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var (
+	peer0      = peer.ID("QmUQ6Nsejt1SuZAu8yL8WgqQZHHAYreLVYYa4VPsLUCed7")
+	peer1      = peer.ID("QmUZ13osndQ5uL4tPWHXe3iBgBgq9gfewcBMSCAuMBsDJ6")
+	peer2      = peer.ID("QmPrSBATWGAN56fiiEWEhKX3L1F3mTghEQR7vQwaeo7zHi")
+	peer3      = peer.ID("QmPGDFvBkgWhvzEK9qaTWrWurSwqXNmhnK3hgELPdZZNPa")
+	testCid, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq")
+)
+
+var inAMinute = time.Now().Add(time.Minute).UnixNano()
+
+func metrics(freespace, numpin string) api.MetricsSet {
+	return api.MetricsSet{
+		"freespace": {
+			Name:   "freespace",
+			Value:  freespace,
+			Expire: inAMinute,
+			Valid:  true,
+		},
+		"numpin": {
+			Name:   "numpin",
+			Value:  numpin,
+			Expire: inAMinute,
+			Valid:  true,
+		},
+	}
+}
+
+func testAllocator(t *testing.T, constraints ...string) *WeightAllocator {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Constraints = constraints
+	alloc, err := NewAllocator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return alloc
+}
+
+func TestAllocateMetricsBalance(t *testing.T) {
+	alloc := testAllocator(t)
+	candidates := map[peer.ID]api.MetricsSet{
+		peer0: metrics("1000", "100"), // most space, most pins
+		peer1: metrics("900", "0"),    // a bit less space, no pins
+		peer2: metrics("0", "0"),      // no space, no pins
+		peer3: metrics("500", "100"),
+	}
+
+	res, err := alloc.AllocateMetrics(testCid, nil, candidates, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 4 {
+		t.Fatal("expected all peers to be returned")
+	}
+	if res[0] != peer1 || res[3] != peer3 {
+		t.Error("unexpected allocation order:", res)
+	}
+}
+
+func TestAllocateMetricsConstraints(t *testing.T) {
+	alloc := testAllocator(t, "freespace > 1KB", "numpin <= 50")
+	candidates := map[peer.ID]api.MetricsSet{
+		peer0: metrics("5000", "100"),
+		peer1: metrics("2000", "10"),
+		peer2: metrics("500", "0"),
+	}
+	candidates[peer3] = api.MetricsSet{
+		"freespace": candidates[peer0]["freespace"],
+	}
+
+	res, err := alloc.AllocateMetrics(testCid, nil, candidates, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0] != peer1 {
+		t.Error("only peer1 meets the constraints:", res)
+	}
+}
+
+func TestAllocateMetricsTagConstraints(t *testing.T) {
+	alloc := testAllocator(t, "tags.tier == ssd", "tags.region != us-east")
+	withTags := func(set api.MetricsSet, tagsMap map[string]string) api.MetricsSet {
+		set[tags.MetricName] = api.Metric{
+			Name:   tags.MetricName,
+			Value:  tags.EncodeTags(tagsMap),
+			Expire: inAMinute,
+			Valid:  true,
+		}
+		return set
+	}
+	candidates := map[peer.ID]api.MetricsSet{
+		peer0: withTags(metrics("1000", "0"), map[string]string{"tier": "ssd", "region": "us-east"}),
+		peer1: withTags(metrics("1000", "0"), map[string]string{"tier": "ssd", "region": "eu-west"}),
+		peer2: withTags(metrics("1000", "0"), map[string]string{"tier": "hdd", "region": "eu-west"}),
+		peer3: metrics("1000", "0"),
+	}
+
+	res, err := alloc.AllocateMetrics(testCid, nil, candidates, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0] != peer1 {
+		t.Error("only peer1 meets the constraints:", res)
+	}
+}
+
+func TestAllocateMetricsPriority(t *testing.T) {
+	alloc := testAllocator(t)
+	priority := map[peer.ID]api.MetricsSet{
+		peer0: metrics("0", "100"),
+	}
+	candidates := map[peer.ID]api.MetricsSet{
+		peer1: metrics("1000", "0"),
+	}
+
+	res, err := alloc.AllocateMetrics(testCid, nil, candidates, priority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0] != peer0 {
+		t.Error("priority peers should come first:", res)
+	}
+}
+
+func TestAllocateSingleMetric(t *testing.T) {
+	alloc := testAllocator(t)
+	candidates := map[peer.ID]api.Metric{
+		peer0: metrics("100", "0")["freespace"],
+		peer1: metrics("200", "0")["freespace"],
+	}
+	invalid := metrics("300", "0")["freespace"]
+	invalid.Valid = false
+	candidates[peer2] = invalid
+
+	res, err := alloc.Allocate(testCid, nil, candidates, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0] != peer1 {
+		t.Error("unexpected allocation order:", res)
+	}
+}
+
+func TestParseConstraint(t *testing.T) {
+	c, err := parseConstraint("freespace>=1GB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.metric != "freespace" || c.op != ">=" || c.value != 1000000000 {
+		t.Error("constraint not parsed correctly")
+	}
+	if !c.allows(1000000000) || c.allows(1) {
+		t.Error("constraint not applied correctly")
+	}
+
+	c, err = parseConstraint("tags.tier == ssd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.numeric || c.metric != "tags.tier" || !c.allowsString("ssd") || c.allowsString("hdd") {
+		t.Error("string constraint not parsed correctly")
+	}
+
+	for _, bad := range []string{"", "freespace", "> 3", "numpin < abc"} {
+		_, err := parseConstraint(bad)
+		if err == nil {
+			t.Errorf("expected error parsing %q", bad)
+		}
+	}
+}
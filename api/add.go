@@ -98,6 +98,7 @@ func AddParamsFromQuery(query url.Values) (*AddParams, error) {
 	params.Chunker = chunker
 	name := query.Get("name")
 	params.Name = name
+	params.Metadata = MetadataFromQuery(query)
 
 	hashF := query.Get("hash")
 	if hashF != "" {
@@ -173,6 +174,7 @@ func (p *AddParams) ToQueryString() string {
 	query.Set("progress", fmt.Sprintf("%t", p.Progress))
 	query.Set("cid-version", fmt.Sprintf("%d", p.CidVersion))
 	query.Set("hash", p.HashFun)
+	metadataToQuery(query, p.Metadata)
 	return query.Encode()
 }
 
@@ -190,5 +192,7 @@ func (p *AddParams) Equals(p2 *AddParams) bool {
 		p.Hidden == p2.Hidden &&
 		p.Wrap == p2.Wrap &&
 		p.CidVersion == p2.CidVersion &&
-		p.HashFun == p2.HashFun
+		p.HashFun == p2.HashFun &&
+		len(p.Metadata) == len(p2.Metadata) &&
+		p.MatchesMetadata(p2.Metadata)
 }
@@ -6,7 +6,7 @@ import (
 )
 
 func TestAddParams_FromQuery(t *testing.T) {
-	qStr := "layout=balanced&chunker=size-262144&name=test&raw-leaves=true&hidden=true&shard=true&replication-min=2&replication-max=4&shard-size=1"
+	qStr := "layout=balanced&chunker=size-262144&name=test&raw-leaves=true&hidden=true&shard=true&replication-min=2&replication-max=4&shard-size=1&meta.project=abc"
 
 	q, err := url.ParseQuery(qStr)
 	if err != nil {
@@ -23,7 +23,8 @@ func TestAddParams_FromQuery(t *testing.T) {
 		!p.RawLeaves || !p.Hidden || !p.Shard ||
 		p.ReplicationFactorMin != 2 ||
 		p.ReplicationFactorMax != 4 ||
-		p.ShardSize != 1 {
+		p.ShardSize != 1 ||
+		p.Metadata["project"] != "abc" {
 		t.Fatal("did not parse the query correctly")
 	}
 }
@@ -35,6 +36,7 @@ func TestAddParams_ToQueryString(t *testing.T) {
 	p.Name = "something"
 	p.RawLeaves = true
 	p.ShardSize = 1020
+	p.Metadata = map[string]string{"project": "abc"}
 	qstr := p.ToQueryString()
 
 	q, err := url.ParseQuery(qstr)
@@ -236,11 +236,16 @@ func (proxy *Server) pinOpHandler(op string, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Cluster-specific metadata can be set with "meta.key=value"
+	// query arguments. They are ignored when unpinning.
+	pin := api.PinCid(c)
+	pin.Metadata = api.MetadataFromQuery(r.URL.Query())
+
 	err = proxy.rpcClient.Call(
 		"",
 		"Cluster",
 		op,
-		api.PinCid(c).ToSerial(),
+		pin.ToSerial(),
 		&struct{}{},
 	)
 	if err != nil {
@@ -111,6 +111,16 @@ func TestIPFSProxyPin(t *testing.T) {
 			test.TestCid1,
 			false,
 		},
+		{
+			"pin good cid with metadata",
+			args{
+				"/pin/add?meta.project=abc&arg=",
+				test.TestCid1,
+				http.StatusOK,
+			},
+			test.TestCid1,
+			false,
+		},
 		{
 			"pin bad cid query arg",
 			args{
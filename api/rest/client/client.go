@@ -43,27 +43,51 @@ type Client interface {
 
 	// Peers requests ID information for all cluster peers.
 	Peers() ([]api.ID, error)
-	// PeerAdd adds a new peer to the cluster.
-	PeerAdd(pid peer.ID) (api.ID, error)
+	// PeerAdd adds a new peer to the cluster with the given role.
+	PeerAdd(pid peer.ID, role api.PeerRole) (api.ID, error)
 	// PeerRm removes a current peer from the cluster
 	PeerRm(pid peer.ID) error
+	// PeerDrain marks a peer as draining and starts moving its pins
+	// elsewhere.
+	PeerDrain(pid peer.ID) (api.DrainStatus, error)
+	// PeerDrainStatus returns the progress of draining a peer.
+	PeerDrainStatus(pid peer.ID) (api.DrainStatus, error)
+	// PeerUndrain removes the drain mark of a peer.
+	PeerUndrain(pid peer.ID) error
 
 	// Add imports files to the cluster from the given paths.
 	Add(paths []string, params *api.AddParams, out chan<- *api.AddedOutput) error
 	// AddMultiFile imports new files from a MultiFileReader.
 	AddMultiFile(multiFileR *files.MultiFileReader, params *api.AddParams, out chan<- *api.AddedOutput) error
 
-	// Pin tracks a Cid with the given replication factor and a name for
-	// human-friendliness.
-	Pin(ci cid.Cid, replicationFactorMin, replicationFactorMax int, name string) error
+	// Pin tracks a Cid with the given options (replication factors,
+	// name, expiration...).
+	Pin(ci cid.Cid, opts api.PinOptions) error
+	// PinDepth tracks a Cid which is pinned up to the given depth
+	// (-1 means recursively, 0 means directly) with the given options.
+	PinDepth(ci cid.Cid, maxDepth int, opts api.PinOptions) error
+	// PinPath resolves a mutable path (/ipns/<name>) and tracks the
+	// resulting Cid with the given options. The path is re-resolved
+	// periodically by cluster. It returns the pin.
+	PinPath(path string, opts api.PinOptions) (api.Pin, error)
+	// PinUpdate replaces the pin for the "from" Cid with a pin for the
+	// "to" Cid, keeping its allocations and options. It returns the
+	// new pin.
+	PinUpdate(from, to cid.Cid) (api.Pin, error)
 	// Unpin untracks a Cid from cluster.
 	Unpin(ci cid.Cid) error
+	// PinBatch tracks and untracks several Cids as a single operation.
+	// Only the Cid of unpins is used.
+	PinBatch(batch api.PinBatch) error
 
 	// Allocations returns the consensus state listing all tracked items
 	// and the peers that should be pinning them.
 	Allocations(filter api.PinType) ([]api.Pin, error)
 	// Allocation returns the current allocations for a given Cid.
 	Allocation(ci cid.Cid) (api.Pin, error)
+	// SimulateAllocation runs the allocation process for a pin without
+	// committing it and explains which peers would be chosen and why.
+	SimulateAllocation(ci cid.Cid, opts api.PinOptions) (api.AllocationSimulation, error)
 
 	// Status returns the current ipfs state for a given Cid. If local is true,
 	// the information affects only the current peer, otherwise the information
@@ -106,6 +130,18 @@ type Client interface {
 	// Metrics returns a map with the latest metrics of matching name
 	// for the current cluster peers.
 	Metrics(name string) ([]api.Metric, error)
+
+	// MetricHistory returns the metrics of matching name kept for the
+	// given peer, or for all peers if empty, from newest to oldest.
+	MetricHistory(name string, pid peer.ID) ([]api.Metric, error)
+
+	// Events streams the events emitted by the peer, optionally only
+	// those of the given types, into the out channel until the context
+	// is cancelled. A since sequence number other than 0 resumes a
+	// previous stream. The out channel is closed when Events returns.
+	// Events are local to the peer: pin_status events only cover the
+	// pins that it tracks.
+	Events(ctx context.Context, types []string, since uint64, out chan<- api.Event) error
 }
 
 // Config allows to configure the parameters to connect
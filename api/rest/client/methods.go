@@ -6,10 +6,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -40,12 +42,13 @@ func (c *defaultClient) Peers() ([]api.ID, error) {
 
 type peerAddBody struct {
 	PeerID string `json:"peer_id"`
+	Role   string `json:"role,omitempty"`
 }
 
-// PeerAdd adds a new peer to the cluster.
-func (c *defaultClient) PeerAdd(pid peer.ID) (api.ID, error) {
+// PeerAdd adds a new peer to the cluster with the given role.
+func (c *defaultClient) PeerAdd(pid peer.ID, role api.PeerRole) (api.ID, error) {
 	pidStr := peer.IDB58Encode(pid)
-	body := peerAddBody{pidStr}
+	body := peerAddBody{pidStr, string(role)}
 
 	var buf bytes.Buffer
 	enc := json.NewEncoder(&buf)
@@ -61,18 +64,43 @@ func (c *defaultClient) PeerRm(id peer.ID) error {
 	return c.do("DELETE", fmt.Sprintf("/peers/%s", id.Pretty()), nil, nil, nil)
 }
 
-// Pin tracks a Cid with the given replication factor and a name for
-// human-friendliness.
-func (c *defaultClient) Pin(ci cid.Cid, replicationFactorMin, replicationFactorMax int, name string) error {
-	escName := url.QueryEscape(name)
+// PeerDrain marks a peer as draining. Its pins start being re-allocated
+// to other peers, and it does not receive new ones.
+func (c *defaultClient) PeerDrain(id peer.ID) (api.DrainStatus, error) {
+	var status api.DrainStatus
+	err := c.do("POST", fmt.Sprintf("/peers/%s/drain", id.Pretty()), nil, nil, &status)
+	return status, err
+}
+
+// PeerDrainStatus returns the progress of draining a peer.
+func (c *defaultClient) PeerDrainStatus(id peer.ID) (api.DrainStatus, error) {
+	var status api.DrainStatus
+	err := c.do("GET", fmt.Sprintf("/peers/%s/drain", id.Pretty()), nil, nil, &status)
+	return status, err
+}
+
+// PeerUndrain removes the drain mark of a peer, which can receive new
+// pins again.
+func (c *defaultClient) PeerUndrain(id peer.ID) error {
+	return c.do("DELETE", fmt.Sprintf("/peers/%s/drain", id.Pretty()), nil, nil, nil)
+}
+
+// Pin tracks a Cid with the given options (replication factors,
+// name, expiration...).
+func (c *defaultClient) Pin(ci cid.Cid, opts api.PinOptions) error {
+	return c.PinDepth(ci, -1, opts)
+}
+
+// PinDepth tracks a Cid which is pinned up to the given depth
+// (-1 means recursively, 0 means directly) with the given options.
+func (c *defaultClient) PinDepth(ci cid.Cid, maxDepth int, opts api.PinOptions) error {
 	err := c.do(
 		"POST",
 		fmt.Sprintf(
-			"/pins/%s?replication-min=%d&replication-max=%d&name=%s",
+			"/pins/%s?max-depth=%d&%s",
 			ci.String(),
-			replicationFactorMin,
-			replicationFactorMax,
-			escName,
+			maxDepth,
+			opts.ToQueryString(),
 		),
 		nil,
 		nil,
@@ -81,11 +109,61 @@ func (c *defaultClient) Pin(ci cid.Cid, replicationFactorMin, replicationFactorM
 	return err
 }
 
+// PinPath resolves a mutable path (/ipns/<name>) and tracks the
+// resulting Cid with the given options. The path is re-resolved
+// periodically by cluster. It returns the pin.
+func (c *defaultClient) PinPath(p string, opts api.PinOptions) (api.Pin, error) {
+	if !strings.HasPrefix(p, "/ipns/") {
+		return api.Pin{}, fmt.Errorf("bad path %q: it should be /ipns/<name>", p)
+	}
+
+	var pin api.PinSerial
+	err := c.do(
+		"POST",
+		fmt.Sprintf(
+			"/pins%s?%s",
+			p,
+			opts.ToQueryString(),
+		),
+		nil,
+		nil,
+		&pin,
+	)
+	return pin.ToPin(), err
+}
+
+// PinUpdate replaces the pin for the "from" Cid with a pin for the
+// "to" Cid, keeping its allocations and options. It returns the
+// new pin.
+func (c *defaultClient) PinUpdate(from, to cid.Cid) (api.Pin, error) {
+	var pin api.PinSerial
+	err := c.do(
+		"POST",
+		fmt.Sprintf("/pins/%s/update/%s", from.String(), to.String()),
+		nil,
+		nil,
+		&pin,
+	)
+	return pin.ToPin(), err
+}
+
 // Unpin untracks a Cid from cluster.
 func (c *defaultClient) Unpin(ci cid.Cid) error {
 	return c.do("DELETE", fmt.Sprintf("/pins/%s", ci.String()), nil, nil, nil)
 }
 
+// PinBatch tracks and untracks several Cids as a single operation.
+// Only the Cid of unpins is used.
+func (c *defaultClient) PinBatch(batch api.PinBatch) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	err := enc.Encode(batch.ToSerial())
+	if err != nil {
+		return err
+	}
+	return c.do("POST", "/pins/batch", nil, &buf, nil)
+}
+
 // Allocations returns the consensus state listing all tracked items and
 // the peers that should be pinning them.
 func (c *defaultClient) Allocations(filter api.PinType) ([]api.Pin, error) {
@@ -126,6 +204,26 @@ func (c *defaultClient) Allocation(ci cid.Cid) (api.Pin, error) {
 	return pin.ToPin(), err
 }
 
+// SimulateAllocation runs the allocation process for a hypothetical pin
+// of the given Cid with the given options, without pinning anything. It
+// returns the peers that would be allocated and the reasons why the rest
+// were not.
+func (c *defaultClient) SimulateAllocation(ci cid.Cid, opts api.PinOptions) (api.AllocationSimulation, error) {
+	var sim api.AllocationSimulation
+	err := c.do(
+		"POST",
+		fmt.Sprintf(
+			"/allocations/simulate?cid=%s&%s",
+			ci.String(),
+			opts.ToQueryString(),
+		),
+		nil,
+		nil,
+		&sim,
+	)
+	return sim, err
+}
+
 // Status returns the current ipfs state for a given Cid. If local is true,
 // the information affects only the current peer, otherwise the information
 // is fetched from all cluster peers.
@@ -217,6 +315,64 @@ func (c *defaultClient) Metrics(name string) ([]api.Metric, error) {
 	return metrics, err
 }
 
+// MetricHistory returns the metrics of the given name kept by the peer
+// for the given peer (or for all peers when empty), from the newest to
+// the oldest, including expired ones.
+func (c *defaultClient) MetricHistory(name string, pid peer.ID) ([]api.Metric, error) {
+	if name == "" {
+		return nil, errors.New("bad metric name")
+	}
+	path := fmt.Sprintf("/monitor/metrics/%s/history", name)
+	if pid != "" {
+		path += "?peer=" + pid.Pretty()
+	}
+	var metrics []api.Metric
+	err := c.do("GET", path, nil, nil, &metrics)
+	return metrics, err
+}
+
+// Events streams the events emitted by the peer into the out channel
+// until the context is cancelled. Only events of the given types are
+// received, or all of them when types is empty. When since is not 0, the
+// events after that sequence number still kept by the peer are received
+// first. The out channel is closed when Events returns. Events are local
+// to the peer: the pin status changes in other peers are not received.
+func (c *defaultClient) Events(ctx context.Context, types []string, since uint64, out chan<- api.Event) error {
+	defer close(out)
+
+	query := url.Values{}
+	if len(types) > 0 {
+		query.Set("type", strings.Join(types, ","))
+	}
+	if since > 0 {
+		query.Set("since", strconv.FormatUint(since, 10))
+	}
+	path := "/events"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	handler := func(dec *json.Decoder) error {
+		var e api.Event
+		err := dec.Decode(&e)
+		if err != nil {
+			return err
+		}
+		select {
+		case out <- e:
+			return nil
+		case <-ctx.Done():
+			return io.EOF
+		}
+	}
+
+	err := c.doStreamContext(ctx, "GET", path, nil, nil, handler)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
 // WaitFor is a utility function that allows for a caller to wait for a
 // paticular status for a CID (as defined by StatusFilterParams).
 // It returns the final status for that CID and an error, if there was.
@@ -105,13 +105,16 @@ func TestPeerAdd(t *testing.T) {
 	defer shutdown(api)
 
 	testF := func(t *testing.T, c Client) {
-		id, err := c.PeerAdd(test.TestPeerID1)
+		id, err := c.PeerAdd(test.TestPeerID1, types.PeerRoleNonVoter)
 		if err != nil {
 			t.Fatal(err)
 		}
 		if id.ID != test.TestPeerID1 {
 			t.Error("bad peer")
 		}
+		if id.Role != types.PeerRoleNonVoter {
+			t.Error("bad role")
+		}
 	}
 
 	testClients(t, api, testF)
@@ -131,13 +134,49 @@ func TestPeerRm(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestPeerDrain(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		status, err := c.PeerDrain(test.TestPeerID1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !status.Draining || status.Peer != test.TestPeerID1.Pretty() {
+			t.Error("expected the peer to be draining")
+		}
+
+		status, err = c.PeerDrainStatus(test.TestPeerID1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Remaining != 1 {
+			t.Error("expected one remaining pin")
+		}
+
+		err = c.PeerUndrain(test.TestPeerID1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestPin(t *testing.T) {
 	api := testAPI(t)
 	defer shutdown(api)
 
 	testF := func(t *testing.T, c Client) {
 		ci, _ := cid.Decode(test.TestCid1)
-		err := c.Pin(ci, 6, 7, "hello there")
+		opts := types.PinOptions{
+			ReplicationFactorMin: 6,
+			ReplicationFactorMax: 7,
+			Name:                 "hello there",
+			ExpireAt:             time.Now().Add(time.Hour),
+		}
+		err := c.Pin(ci, opts)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -146,6 +185,62 @@ func TestPin(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestPinDepth(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		ci, _ := cid.Decode(test.TestCid1)
+		err := c.PinDepth(ci, 2, types.PinOptions{Name: "depth"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestPinPath(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		pin, err := c.PinPath(test.TestIPNSPath, types.PinOptions{Name: "path"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pin.Cid.String() != test.TestCid1 || pin.Path != test.TestIPNSPath {
+			t.Error("unexpected pin")
+		}
+
+		_, err = c.PinPath("/ipfs/"+test.TestCid1, types.PinOptions{})
+		if err == nil {
+			t.Error("expected an error with a non-mutable path")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestPinUpdate(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		from, _ := cid.Decode(test.TestCid1)
+		to, _ := cid.Decode(test.TestCid2)
+		pin, err := c.PinUpdate(from, to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pin.Cid.Equals(to) || pin.PinUpdate != test.TestCid1 {
+			t.Error("unexpected pin")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestUnpin(t *testing.T) {
 	api := testAPI(t)
 	defer shutdown(api)
@@ -161,6 +256,33 @@ func TestUnpin(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestPinBatch(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		ci1, _ := cid.Decode(test.TestCid1)
+		ci2, _ := cid.Decode(test.TestCid2)
+		err := c.PinBatch(types.PinBatch{
+			Pins:   []types.Pin{types.PinCid(ci1)},
+			Unpins: []types.Pin{types.PinCid(ci2)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errCid, _ := cid.Decode(test.ErrorCid)
+		err = c.PinBatch(types.PinBatch{
+			Pins: []types.Pin{types.PinCid(errCid)},
+		})
+		if err == nil {
+			t.Error("expected an error")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestAllocations(t *testing.T) {
 	api := testAPI(t)
 	defer shutdown(api)
@@ -196,6 +318,34 @@ func TestAllocation(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestSimulateAllocation(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		ci, _ := cid.Decode(test.TestCid1)
+		opts := types.PinOptions{
+			ReplicationFactorMin: 1,
+			ReplicationFactorMax: 1,
+		}
+		sim, err := c.SimulateAllocation(ci, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sim.Cid != test.TestCid1 || len(sim.Allocations) != 1 {
+			t.Error("unexpected simulation:", sim)
+		}
+
+		ci, _ = cid.Decode(test.ErrorCid)
+		_, err = c.SimulateAllocation(ci, opts)
+		if err == nil {
+			t.Error("expected an error")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestStatus(t *testing.T) {
 	api := testAPI(t)
 	defer shutdown(api)
@@ -318,6 +468,71 @@ func TestGetConnectGraph(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestMetricHistory(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		metrics, err := c.MetricHistory("freespace", test.TestPeerID1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(metrics) != 3 || metrics[0].Peer != test.TestPeerID1 {
+			t.Error("unexpected history")
+		}
+
+		_, err = c.MetricHistory("", "")
+		if err == nil {
+			t.Error("expected an error with an empty name")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestEvents(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		ctx, cancel := context.WithCancel(context.Background())
+		out := make(chan types.Event, 10)
+		done := make(chan error)
+		go func() {
+			done <- c.Events(ctx, nil, 0, out)
+		}()
+
+		var events []types.Event
+		for i := 0; i < 2; i++ {
+			select {
+			case e := <-out:
+				events = append(events, e)
+			case <-time.After(10 * time.Second):
+				t.Fatal("timed out waiting for events")
+			}
+		}
+		if events[0].Type != types.EventPeerJoined || events[1].Type != types.EventPinStatus {
+			t.Errorf("unexpected events: %+v", events)
+		}
+
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		if _, ok := <-out; ok {
+			t.Error("out channel should be closed")
+		}
+
+		out = make(chan types.Event)
+		err := c.Events(context.Background(), []string{"abc"}, 0, out)
+		if err == nil {
+			t.Error("expected an error with an unknown event type")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 type waitService struct {
 	l        sync.Mutex
 	pinStart time.Time
@@ -420,7 +635,7 @@ func TestWaitFor(t *testing.T) {
 				}
 			}
 		}()
-		err := c.Pin(ci, 0, 0, "test")
+		err := c.Pin(ci, api.PinOptions{Name: "test"})
 		if err != nil {
 			t.Fatal(err)
 		}
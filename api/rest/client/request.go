@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"io/ioutil"
@@ -40,11 +41,37 @@ func (c *defaultClient) doStream(
 	return c.handleStreamResponse(resp, outHandler)
 }
 
+// doStreamContext is like doStream, but the request is aborted when
+// the given context is cancelled.
+func (c *defaultClient) doStreamContext(
+	ctx context.Context,
+	method, path string,
+	headers map[string]string,
+	body io.Reader,
+	outHandler responseDecoder,
+) error {
+
+	resp, err := c.doRequestContext(ctx, method, path, headers, body)
+	if err != nil {
+		return &api.Error{Code: 0, Message: err.Error()}
+	}
+	return c.handleStreamResponse(resp, outHandler)
+}
+
 func (c *defaultClient) doRequest(
 	method, path string,
 	headers map[string]string,
 	body io.Reader,
 ) (*http.Response, error) {
+	return c.doRequestContext(context.Background(), method, path, headers, body)
+}
+
+func (c *defaultClient) doRequestContext(
+	ctx context.Context,
+	method, path string,
+	headers map[string]string,
+	body io.Reader,
+) (*http.Response, error) {
 
 	urlpath := c.net + "://" + c.hostname + "/" + strings.TrimPrefix(path, "/")
 	logger.Debugf("%s: %s", method, urlpath)
@@ -53,6 +80,7 @@ func (c *defaultClient) doRequest(
 	if err != nil {
 		return nil, err
 	}
+	r = r.WithContext(ctx)
 	if c.config.DisableKeepAlives {
 		r.Close = true
 	}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/ipfs/ipfs-cluster/adder/adderutils"
 	types "github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/observations"
 
 	mux "github.com/gorilla/mux"
 	gostream "github.com/hsanjuan/go-libp2p-gostream"
@@ -93,6 +94,7 @@ type route struct {
 
 type peerAddBody struct {
 	PeerID string `json:"peer_id"`
+	Role   string `json:"role,omitempty"`
 }
 
 // NewAPI creates a new REST API component with the given configuration.
@@ -313,6 +315,24 @@ func (api *API) routes() []route {
 			"/peers/{peer}",
 			api.peerRemoveHandler,
 		},
+		{
+			"PeerDrain",
+			"POST",
+			"/peers/{peer}/drain",
+			api.peerDrainHandler,
+		},
+		{
+			"PeerDrainStatus",
+			"GET",
+			"/peers/{peer}/drain",
+			api.peerDrainStatusHandler,
+		},
+		{
+			"PeerUndrain",
+			"DELETE",
+			"/peers/{peer}/drain",
+			api.peerUndrainHandler,
+		},
 		{
 			"Add",
 			"POST",
@@ -325,6 +345,12 @@ func (api *API) routes() []route {
 			"/allocations",
 			api.allocationsHandler,
 		},
+		{
+			"SimulateAllocation",
+			"POST",
+			"/allocations/simulate",
+			api.simulateAllocationHandler,
+		},
 		{
 			"Allocation",
 			"GET",
@@ -349,6 +375,18 @@ func (api *API) routes() []route {
 			"/pins/recover",
 			api.recoverAllHandler,
 		},
+		{
+			"PinBatch",
+			"POST",
+			"/pins/batch",
+			api.pinBatchHandler,
+		},
+		{
+			"PinPath",
+			"POST",
+			"/pins/ipns/{path:.+}",
+			api.pinPathHandler,
+		},
 		{
 			"Status",
 			"GET",
@@ -367,6 +405,12 @@ func (api *API) routes() []route {
 			"/pins/{hash}",
 			api.unpinHandler,
 		},
+		{
+			"PinUpdate",
+			"POST",
+			"/pins/{from}/update/{to}",
+			api.pinUpdateHandler,
+		},
 		{
 			"Sync",
 			"POST",
@@ -391,6 +435,24 @@ func (api *API) routes() []route {
 			"/monitor/metrics/{name}",
 			api.metricsHandler,
 		},
+		{
+			"MetricHistory",
+			"GET",
+			"/monitor/metrics/{name}/history",
+			api.metricHistoryHandler,
+		},
+		{
+			"Observations",
+			"GET",
+			"/metrics",
+			api.observationsHandler,
+		},
+		{
+			"Events",
+			"GET",
+			"/events",
+			api.eventsHandler,
+		},
 	}
 }
 
@@ -525,6 +587,125 @@ func (api *API) metricsHandler(w http.ResponseWriter, r *http.Request) {
 	api.sendResponse(w, autoStatus, err, metrics)
 }
 
+func (api *API) metricHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	req := types.MetricHistoryRequest{
+		Name:   vars["name"],
+		PeerID: r.URL.Query().Get("peer"),
+	}
+	if req.PeerID != "" {
+		if _, err := peer.IDB58Decode(req.PeerID); err != nil {
+			api.sendResponse(w, http.StatusBadRequest, errors.New("error decoding Peer ID: "+err.Error()), nil)
+			return
+		}
+	}
+
+	var metrics []types.Metric
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"PeerMonitorMetricHistory",
+		req,
+		&metrics)
+	api.sendResponse(w, autoStatus, err, metrics)
+}
+
+// observationsHandler exports the internals of the peer in the
+// Prometheus text format.
+func (api *API) observationsHandler(w http.ResponseWriter, r *http.Request) {
+	var text []byte
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"Observations",
+		struct{}{},
+		&text)
+	if err != nil {
+		api.sendResponse(w, autoStatus, err, nil)
+		return
+	}
+
+	api.setHeadersWithContentType(w, observations.ContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(text)
+}
+
+// eventsHandler streams the events emitted by this peer, one JSON object
+// per line, until the client goes away. Events are not relayed between
+// peers: pin_status events only cover the pins tracked by this peer. Events can be filtered by type
+// with a comma-separated "type" parameter. "since" allows resuming a
+// stream after the given event sequence number.
+func (api *API) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	queryValues := r.URL.Query()
+
+	var req types.EventsRequest
+	if t := queryValues.Get("type"); t != "" {
+		for _, et := range strings.Split(t, ",") {
+			if !types.IsValidEventType(et) {
+				api.sendResponse(w, http.StatusBadRequest, fmt.Errorf("unknown event type: %s", et), nil)
+				return
+			}
+			req.Types = append(req.Types, et)
+		}
+	}
+	if since := queryValues.Get("since"); since != "" {
+		n, err := strconv.ParseUint(since, 10, 64)
+		if err != nil {
+			api.sendResponse(w, http.StatusBadRequest, errors.New("error decoding since: "+err.Error()), nil)
+			return
+		}
+		req.Since = n
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-api.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	api.setHeaders(w)
+	w.Header().Set("X-Chunked-Output", "1")
+	w.Header().Set("Trailer", "X-Stream-Error")
+	w.WriteHeader(http.StatusOK)
+	flusher, flush := w.(http.Flusher)
+	if flush {
+		flusher.Flush()
+	}
+
+	enc := json.NewEncoder(w)
+	for {
+		var resp types.EventsResponse
+		err := api.rpcClient.CallContext(
+			ctx,
+			"",
+			"Cluster",
+			"Events",
+			req,
+			&resp,
+		)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			w.Header().Set("X-Stream-Error", err.Error())
+			return
+		}
+
+		for _, e := range resp.Events {
+			if err := enc.Encode(e); err != nil {
+				logger.Error(err)
+				return
+			}
+		}
+		if flush && len(resp.Events) > 0 {
+			flusher.Flush()
+		}
+		req.Since = resp.Last
+	}
+}
+
 func (api *API) addHandler(w http.ResponseWriter, r *http.Request) {
 	reader, err := r.MultipartReader()
 	if err != nil {
@@ -581,11 +762,20 @@ func (api *API) peerAddHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	role, err := types.PeerRoleFromString(addInfo.Role)
+	if err != nil {
+		api.sendResponse(w, http.StatusBadRequest, err, nil)
+		return
+	}
+
 	var ids types.IDSerial
 	err = api.rpcClient.Call("",
 		"Cluster",
 		"PeerAdd",
-		addInfo.PeerID,
+		types.PeerAddRequest{
+			PeerID: addInfo.PeerID,
+			Role:   role,
+		},
 		&ids)
 	api.sendResponse(w, autoStatus, err, ids)
 }
@@ -601,6 +791,41 @@ func (api *API) peerRemoveHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (api *API) peerDrainHandler(w http.ResponseWriter, r *http.Request) {
+	if p := api.parsePidOrError(w, r); p != "" {
+		var status types.DrainStatus
+		err := api.rpcClient.Call("",
+			"Cluster",
+			"PeerDrain",
+			p,
+			&status)
+		api.sendResponse(w, http.StatusAccepted, err, status)
+	}
+}
+
+func (api *API) peerDrainStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if p := api.parsePidOrError(w, r); p != "" {
+		var status types.DrainStatus
+		err := api.rpcClient.Call("",
+			"Cluster",
+			"PeerDrainStatus",
+			p,
+			&status)
+		api.sendResponse(w, autoStatus, err, status)
+	}
+}
+
+func (api *API) peerUndrainHandler(w http.ResponseWriter, r *http.Request) {
+	if p := api.parsePidOrError(w, r); p != "" {
+		err := api.rpcClient.Call("",
+			"Cluster",
+			"PeerUndrain",
+			p,
+			&struct{}{})
+		api.sendResponse(w, autoStatus, err, nil)
+	}
+}
+
 func (api *API) pinHandler(w http.ResponseWriter, r *http.Request) {
 	if ps := api.parseCidOrError(w, r); ps.Cid != "" {
 		logger.Debugf("rest api pinHandler: %s", ps.Cid)
@@ -615,6 +840,130 @@ func (api *API) pinHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (api *API) pinPathHandler(w http.ResponseWriter, r *http.Request) {
+	pin := types.PinSerial{
+		Type: uint64(types.DataType),
+	}
+	pin.Path = "/ipns/" + mux.Vars(r)["path"]
+	if ps, ok := api.parsePinOptionsOrError(w, r, pin); ok {
+		logger.Debugf("rest api pinPathHandler: %s", ps.Path)
+
+		var pinned types.PinSerial
+		err := api.rpcClient.Call("",
+			"Cluster",
+			"PinPath",
+			ps,
+			&pinned)
+		api.sendResponse(w, autoStatus, err, pinned)
+		logger.Debug("rest api pinPathHandler done")
+	}
+}
+
+func (api *API) simulateAllocationHandler(w http.ResponseWriter, r *http.Request) {
+	c, err := cid.Decode(r.URL.Query().Get("cid"))
+	if err != nil {
+		api.sendResponse(w, http.StatusBadRequest, errors.New("error decoding Cid: "+err.Error()), nil)
+		return
+	}
+	pin := types.PinSerial{
+		Cid:  c.String(),
+		Type: uint64(types.DataType),
+	}
+	if ps, ok := api.parsePinOptionsOrError(w, r, pin); ok {
+		logger.Debugf("rest api simulateAllocationHandler: %s", ps.Cid)
+
+		var sim types.AllocationSimulation
+		err := api.rpcClient.Call("",
+			"Cluster",
+			"SimulateAllocation",
+			ps,
+			&sim)
+		api.sendResponse(w, autoStatus, err, sim)
+		logger.Debug("rest api simulateAllocationHandler done")
+	}
+}
+
+func (api *API) pinUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	from, err := cid.Decode(vars["from"])
+	if err != nil {
+		api.sendResponse(w, http.StatusBadRequest, errors.New("error decoding Cid: "+err.Error()), nil)
+		return
+	}
+	to, err := cid.Decode(vars["to"])
+	if err != nil {
+		api.sendResponse(w, http.StatusBadRequest, errors.New("error decoding Cid: "+err.Error()), nil)
+		return
+	}
+	logger.Debugf("rest api pinUpdateHandler: %s -> %s", from, to)
+
+	in := types.PinSerial{
+		Cid: to.String(),
+	}
+	in.PinUpdate = from.String()
+
+	var pin types.PinSerial
+	err = api.rpcClient.Call("",
+		"Cluster",
+		"PinUpdate",
+		in,
+		&pin)
+	api.sendResponse(w, autoStatus, err, pin)
+	logger.Debug("rest api pinUpdateHandler done")
+}
+
+func (api *API) pinBatchHandler(w http.ResponseWriter, r *http.Request) {
+	dec := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	var batch types.PinBatchSerial
+	err := dec.Decode(&batch)
+	if err != nil {
+		api.sendResponse(w, http.StatusBadRequest, errors.New("error decoding request body"), nil)
+		return
+	}
+
+	for i := range batch.Pins {
+		_, err := cid.Decode(batch.Pins[i].Cid)
+		if err != nil {
+			api.sendResponse(w, http.StatusBadRequest, errors.New("error decoding Cid: "+err.Error()), nil)
+			return
+		}
+		err = checkPinOptions(batch.Pins[i].PinOptions)
+		if err != nil {
+			api.sendResponse(w, http.StatusBadRequest, err, nil)
+			return
+		}
+		// Only recursive data pins can be requested in
+		// batches. Allocations and sizes are decided by
+		// the cluster, and paths and updates are set by
+		// their own endpoints.
+		batch.Pins[i].Type = uint64(types.DataType)
+		batch.Pins[i].MaxDepth = -1
+		batch.Pins[i].Reference = ""
+		batch.Pins[i].Allocations = nil
+		batch.Pins[i].Size = 0
+		batch.Pins[i].Path = ""
+		batch.Pins[i].PinUpdate = ""
+	}
+	for _, unpin := range batch.Unpins {
+		_, err := cid.Decode(unpin.Cid)
+		if err != nil {
+			api.sendResponse(w, http.StatusBadRequest, errors.New("error decoding Cid: "+err.Error()), nil)
+			return
+		}
+	}
+
+	logger.Debugf("rest api pinBatchHandler: %d pins, %d unpins", len(batch.Pins), len(batch.Unpins))
+	err = api.rpcClient.Call("",
+		"Cluster",
+		"PinBatch",
+		batch,
+		&struct{}{})
+	api.sendResponse(w, http.StatusAccepted, err, nil)
+	logger.Debug("rest api pinBatchHandler done")
+}
+
 func (api *API) unpinHandler(w http.ResponseWriter, r *http.Request) {
 	if ps := api.parseCidOrError(w, r); ps.Cid != "" {
 		logger.Debugf("rest api unpinHandler: %s", ps.Cid)
@@ -639,18 +988,14 @@ func (api *API) allocationsHandler(w http.ResponseWriter, r *http.Request) {
 	err := api.rpcClient.Call(
 		"",
 		"Cluster",
-		"Pins",
-		struct{}{},
+		"PinsFiltered",
+		types.PinsFilter{
+			Type:     filter,
+			Metadata: types.MetadataFromQuery(queryValues),
+		},
 		&pins,
 	)
-	outPins := make([]types.PinSerial, 0)
-	for _, pinS := range pins {
-		if uint64(filter)&pinS.Type > 0 {
-			// add this pin to output
-			outPins = append(outPins, pinS)
-		}
-	}
-	api.sendResponse(w, autoStatus, err, outPins)
+	api.sendResponse(w, autoStatus, err, pins)
 }
 
 func (api *API) allocationHandler(w http.ResponseWriter, r *http.Request) {
@@ -821,9 +1166,18 @@ func (api *API) parseCidOrError(w http.ResponseWriter, r *http.Request) types.Pi
 		Type: uint64(types.DataType),
 	}
 
+	pin, _ = api.parsePinOptionsOrError(w, r, pin)
+	return pin
+}
+
+// parsePinOptionsOrError sets the pin options given as query arguments
+// in the given pin. When they are not valid, it sends an error response
+// and returns false, along with a pin with an empty Cid.
+func (api *API) parsePinOptionsOrError(w http.ResponseWriter, r *http.Request, pin types.PinSerial) (types.PinSerial, bool) {
 	queryValues := r.URL.Query()
 	name := queryValues.Get("name")
 	pin.Name = name
+	pin.Metadata = types.MetadataFromQuery(queryValues)
 	pin.MaxDepth = -1 // For now, all pins are recursive
 	rplStr := queryValues.Get("replication")
 	if rplStr == "" { // compat <= 0.4.0
@@ -848,7 +1202,56 @@ func (api *API) parseCidOrError(w http.ResponseWriter, r *http.Request) types.Pi
 		pin.ReplicationFactorMax = rpl
 	}
 
-	return pin
+	if depthStr := queryValues.Get("max-depth"); depthStr != "" {
+		depth, err := strconv.Atoi(depthStr)
+		if err != nil || depth < -1 {
+			api.sendResponse(w, http.StatusBadRequest, errors.New("error parsing max-depth: must be an integer >= -1"), nil)
+			return types.PinSerial{Cid: ""}, false
+		}
+		pin.MaxDepth = depth
+	}
+
+	if userAllocs := queryValues.Get("user-allocations"); userAllocs != "" {
+		pin.UserAllocations = strings.Split(userAllocs, ",")
+	}
+
+	if expireAt := queryValues.Get("expire-at"); expireAt != "" {
+		t, err := time.Parse(time.RFC3339, expireAt)
+		if err != nil {
+			api.sendResponse(w, http.StatusBadRequest, errors.New("error parsing expire-at: "+err.Error()), nil)
+			return types.PinSerial{Cid: ""}, false
+		}
+		pin.ExpireAt = t
+	}
+	if expireIn := queryValues.Get("expire-in"); expireIn != "" { // override
+		d, err := time.ParseDuration(expireIn)
+		if err != nil {
+			api.sendResponse(w, http.StatusBadRequest, errors.New("error parsing expire-in: "+err.Error()), nil)
+			return types.PinSerial{Cid: ""}, false
+		}
+		pin.ExpireAt = time.Now().Add(d)
+	}
+
+	err := checkPinOptions(pin.PinOptions)
+	if err != nil {
+		api.sendResponse(w, http.StatusBadRequest, err, nil)
+		return types.PinSerial{Cid: ""}, false
+	}
+	return pin, true
+}
+
+// checkPinOptions validates the pin options which the cluster does not
+// check by itself.
+func checkPinOptions(po types.PinOptions) error {
+	for _, pidStr := range po.UserAllocations {
+		if _, err := peer.IDB58Decode(pidStr); err != nil {
+			return errors.New("error decoding user-allocations: " + err.Error())
+		}
+	}
+	if !po.ExpireAt.IsZero() && po.ExpireAt.Before(time.Now()) {
+		return errors.New("expire-at is in the past")
+	}
+	return nil
 }
 
 func (api *API) parsePidOrError(w http.ResponseWriter, r *http.Request) peer.ID {
@@ -938,11 +1341,15 @@ func (api *API) sendResponse(
 // this sets all the headers that are common to all responses
 // from this API. Called from sendResponse() and /add.
 func (api *API) setHeaders(w http.ResponseWriter) {
+	api.setHeadersWithContentType(w, "application/json")
+}
+
+func (api *API) setHeadersWithContentType(w http.ResponseWriter, contentType string) {
 	for header, values := range api.config.Headers {
 		for _, val := range values {
 			w.Header().Add(header, val)
 		}
 	}
 
-	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Content-Type", contentType)
 }
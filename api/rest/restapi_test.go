@@ -338,6 +338,16 @@ func TestAPIPeerAddEndpoint(t *testing.T) {
 		if id.Error != "" {
 			t.Error("did not expect an error")
 		}
+		if id.Role != string(api.PeerRoleVoter) {
+			t.Error("peers should be added as voters by default")
+		}
+
+		// post with a role
+		body = fmt.Sprintf("{\"peer_id\":\"%s\", \"role\":\"non-voter\"}", test.TestPeerID1.Pretty())
+		makePost(t, rest, url(rest)+"/peers", []byte(body), &id)
+		if id.Role != string(api.PeerRoleNonVoter) {
+			t.Error("expected a non-voter")
+		}
 
 		// Send invalid body
 		errResp := api.Error{}
@@ -350,6 +360,13 @@ func TestAPIPeerAddEndpoint(t *testing.T) {
 		if errResp.Code != 400 {
 			t.Error("expected error with bad peer_id")
 		}
+		// Send invalid role
+		errResp = api.Error{}
+		body = fmt.Sprintf("{\"peer_id\":\"%s\", \"role\":\"abc\"}", test.TestPeerID1.Pretty())
+		makePost(t, rest, url(rest)+"/peers", []byte(body), &errResp)
+		if errResp.Code != 400 {
+			t.Error("expected error with bad role")
+		}
 	}
 
 	testBothEndpoints(t, tf)
@@ -439,6 +456,126 @@ func TestAPIPeerRemoveEndpoint(t *testing.T) {
 	testBothEndpoints(t, tf)
 }
 
+func TestAPIPeerDrainEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var status api.DrainStatus
+		makePost(t, rest, url(rest)+"/peers/"+test.TestPeerID1.Pretty()+"/drain", []byte{}, &status)
+		if status.Peer != test.TestPeerID1.Pretty() || !status.Draining {
+			t.Error("expected the peer to be draining")
+		}
+
+		status = api.DrainStatus{}
+		makeGet(t, rest, url(rest)+"/peers/"+test.TestPeerID1.Pretty()+"/drain", &status)
+		if status.Remaining != 1 || !status.InProgress {
+			t.Error("expected the drain progress")
+		}
+
+		makeDelete(t, rest, url(rest)+"/peers/"+test.TestPeerID1.Pretty()+"/drain", &struct{}{})
+
+		errResp := api.Error{}
+		makeGet(t, rest, url(rest)+"/peers/abc/drain", &errResp)
+		if errResp.Code != 400 {
+			t.Error("expected an error with a bad peer ID")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIMetricHistoryEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var metrics []api.Metric
+		makeGet(t, rest, url(rest)+"/monitor/metrics/freespace/history?peer="+test.TestPeerID1.Pretty(), &metrics)
+		if len(metrics) != 3 {
+			t.Fatal("expected 3 metrics")
+		}
+		if metrics[0].Name != "freespace" || metrics[0].Peer != test.TestPeerID1 {
+			t.Error("unexpected metric")
+		}
+
+		errResp := api.Error{}
+		makeGet(t, rest, url(rest)+"/monitor/metrics/freespace/history?peer=abc", &errResp)
+		if errResp.Code != 400 {
+			t.Error("expected an error with a bad peer ID")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIObservationsEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		h := makeHost(t, rest)
+		defer h.Close()
+		c := httpClient(t, h, isHTTPS(url(rest)))
+		httpResp, err := c.Get(url(rest) + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer httpResp.Body.Close()
+		body, err := ioutil.ReadAll(httpResp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(httpResp.Header.Get("Content-Type"), "text/plain") {
+			t.Error("expected the prometheus text format")
+		}
+		if !strings.Contains(string(body), "cluster_pins{") {
+			t.Errorf("unexpected body: %s", body)
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIEventsEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		h := makeHost(t, rest)
+		defer h.Close()
+		c := httpClient(t, h, isHTTPS(url(rest)))
+
+		httpResp, err := c.Get(url(rest) + "/events?type=pin_status")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer httpResp.Body.Close()
+		if httpResp.StatusCode != http.StatusOK {
+			t.Fatal("unexpected status:", httpResp.StatusCode)
+		}
+		var e api.Event
+		err = json.NewDecoder(httpResp.Body).Decode(&e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Type != api.EventPinStatus || e.Cid != test.TestCid1 || e.Seq != 2 {
+			t.Errorf("unexpected event: %+v", e)
+		}
+
+		httpResp2, err := c.Get(url(rest) + "/events?type=pin_status,abc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpResp2.Body.Close()
+		if httpResp2.StatusCode != http.StatusBadRequest {
+			t.Error("expected bad request for an unknown event type")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
 func TestConnectGraphEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
@@ -495,6 +632,169 @@ func TestAPIPinEndpoint(t *testing.T) {
 	testBothEndpoints(t, tf)
 }
 
+func TestAPIPinEndpointMaxDepth(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?max-depth=2", []byte{}, &struct{}{})
+
+		for _, depth := range []string{"-2", "abc"} {
+			errResp := api.Error{}
+			makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?max-depth="+depth, []byte{}, &errResp)
+			if errResp.Code != 400 {
+				t.Error("should fail with bad max-depth:", depth)
+			}
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIPinPathEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var pin api.PinSerial
+		makePost(t, rest, url(rest)+"/pins"+test.TestDNSLinkPath+"?name=dnslink", []byte{}, &pin)
+		if pin.Cid != test.TestCid2 || pin.Path != test.TestDNSLinkPath || pin.Name != "dnslink" {
+			t.Error("unexpected pin:", pin)
+		}
+
+		errResp := api.Error{}
+		makePost(t, rest, url(rest)+"/pins/ipns/unknown", []byte{}, &errResp)
+		if errResp.Code != 500 {
+			t.Error("should fail to resolve an unknown path")
+		}
+
+		errResp = api.Error{}
+		makePost(t, rest, url(rest)+"/pins"+test.TestIPNSPath+"?max-depth=abc", []byte{}, &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail with bad max-depth")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIPinUpdateEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var pin api.PinSerial
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"/update/"+test.TestCid2, []byte{}, &pin)
+		if pin.Cid != test.TestCid2 || pin.PinUpdate != test.TestCid1 {
+			t.Error("unexpected pin:", pin)
+		}
+
+		errResp := api.Error{}
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"/update/abc", []byte{}, &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail with a bad cid")
+		}
+
+		errResp = api.Error{}
+		makePost(t, rest, url(rest)+"/pins/"+test.ErrorCid+"/update/"+test.TestCid2, []byte{}, &errResp)
+		if errResp.Code != 500 {
+			t.Error("expected an error from the rpc call")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIPinEndpointUserAllocations(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		allocs := test.TestPeerID1.Pretty() + "," + test.TestPeerID2.Pretty()
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?user-allocations="+allocs, []byte{}, &struct{}{})
+
+		errResp := api.Error{}
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?user-allocations=abc", []byte{}, &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail with bad user-allocations")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIPinEndpointExpiration(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?expire-in=1h", []byte{}, &struct{}{})
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?expire-at=2050-01-01T00:00:00Z", []byte{}, &struct{}{})
+
+		errResp := api.Error{}
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?expire-in=abc", []byte{}, &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail with bad expire-in")
+		}
+
+		errResp = api.Error{}
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?expire-at=tomorrow", []byte{}, &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail with bad expire-at")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIPinBatchEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		body := fmt.Sprintf(
+			`{"pins":[{"cid":"%s","name":"a"},{"cid":"%s"}],"unpins":[{"cid":"%s"}]}`,
+			test.TestCid1, test.TestCid2, test.TestCid3,
+		)
+		makePost(t, rest, url(rest)+"/pins/batch", []byte(body), &struct{}{})
+
+		errResp := api.Error{}
+		body = fmt.Sprintf(`{"pins":[{"cid":"%s"}]}`, test.ErrorCid)
+		makePost(t, rest, url(rest)+"/pins/batch", []byte(body), &errResp)
+		if errResp.Message != test.ErrBadCid.Error() {
+			t.Error("expected different error: ", errResp.Message)
+		}
+
+		errResp = api.Error{}
+		body = fmt.Sprintf(`{"pins":[{"cid":"%s","user_allocations":["abc"]}]}`, test.TestCid1)
+		makePost(t, rest, url(rest)+"/pins/batch", []byte(body), &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail with bad user allocations")
+		}
+
+		errResp = api.Error{}
+		body = fmt.Sprintf(`{"pins":[{"cid":"%s","expire_at":"2000-01-01T00:00:00Z"}]}`, test.TestCid1)
+		makePost(t, rest, url(rest)+"/pins/batch", []byte(body), &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail with a past expiration date")
+		}
+
+		errResp = api.Error{}
+		makePost(t, rest, url(rest)+"/pins/batch", []byte(`{"unpins":[{"cid":"abcd"}]}`), &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail with bad Cid")
+		}
+
+		errResp = api.Error{}
+		makePost(t, rest, url(rest)+"/pins/batch", []byte("abcd"), &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail with bad body")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
 func TestAPIUnpinEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
@@ -530,6 +830,17 @@ func TestAPIAllocationsEndpoint(t *testing.T) {
 			resp[2].Cid != test.TestCid3 {
 			t.Error("unexpected pin list: ", resp)
 		}
+
+		makeGet(t, rest, url(rest)+"/allocations?filter=pin,meta-pin&meta.project=test", &resp)
+		if len(resp) != 1 || resp[0].Cid != test.TestCid3 ||
+			resp[0].Metadata["project"] != "test" {
+			t.Error("unexpected pin list: ", resp)
+		}
+
+		makeGet(t, rest, url(rest)+"/allocations?filter=pin,meta-pin&meta.project=other", &resp)
+		if len(resp) != 0 {
+			t.Error("unexpected pin list: ", resp)
+		}
 	}
 
 	testBothEndpoints(t, tf)
@@ -556,6 +867,36 @@ func TestAPIAllocationEndpoint(t *testing.T) {
 	testBothEndpoints(t, tf)
 }
 
+func TestAPISimulateAllocationEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var sim api.AllocationSimulation
+		makePost(t, rest, url(rest)+"/allocations/simulate?cid="+test.TestCid1+"&replication=1", []byte{}, &sim)
+		if sim.Cid != test.TestCid1 || len(sim.Allocations) != 1 || len(sim.Candidates) != 2 {
+			t.Error("unexpected simulation:", sim)
+		}
+		if sim.Candidates[1].Allocated || sim.Candidates[1].Reason == "" {
+			t.Error("excluded candidates should have a reason")
+		}
+
+		errResp := api.Error{}
+		makePost(t, rest, url(rest)+"/allocations/simulate?cid="+test.ErrorCid, []byte{}, &errResp)
+		if errResp.Message != test.ErrBadCid.Error() {
+			t.Error("expected different error: ", errResp.Message)
+		}
+
+		errResp = api.Error{}
+		makePost(t, rest, url(rest)+"/allocations/simulate?cid=abcd", []byte{}, &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail with bad Cid")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
 func TestAPIStatusAllEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
@@ -12,8 +12,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -94,7 +96,6 @@ func TrackerStatusFromString(str string) TrackerStatus {
 }
 
 // IPFSPinStatus values
-// FIXME include maxdepth
 const (
 	IPFSPinStatusBug IPFSPinStatus = iota
 	IPFSPinStatusError
@@ -104,9 +105,33 @@ const (
 	IPFSPinStatusUnpinned
 )
 
+// IPFSPinStatusMaxDepth is the base value for the status of items pinned
+// recursively up to a limited depth. The depth is added to this value.
+// Use IPFSPinStatusWithMaxDepth() and MaxDepth() rather than doing so
+// directly.
+const IPFSPinStatusMaxDepth IPFSPinStatus = 1 << 16
+
 // IPFSPinStatus represents the status of a pin in IPFS (direct, recursive etc.)
 type IPFSPinStatus int
 
+// IPFSPinStatusWithMaxDepth returns the IPFSPinStatus for an item
+// pinned recursively up to the given depth. Negative depths mean
+// fully recursive and 0 means direct.
+func IPFSPinStatusWithMaxDepth(maxDepth int) IPFSPinStatus {
+	switch {
+	case maxDepth < 0:
+		return IPFSPinStatusRecursive
+	case maxDepth == 0:
+		return IPFSPinStatusDirect
+	default:
+		return IPFSPinStatusMaxDepth + IPFSPinStatus(maxDepth)
+	}
+}
+
+// IPFS daemons supporting depth-limited pins list them with a "recursive"
+// type followed by the depth (i.e. "recursive (2)").
+var maxDepthPinTypeRegexp = regexp.MustCompile(`^recursive\D*(\d+)`)
+
 // IPFSPinStatusFromString parses a string and returns the matching
 // IPFSPinStatus.
 func IPFSPinStatusFromString(t string) IPFSPinStatus {
@@ -118,8 +143,15 @@ func IPFSPinStatusFromString(t string) IPFSPinStatus {
 	case ind:
 		return IPFSPinStatusIndirect
 	case rec:
-		// FIXME: Maxdepth?
-		return IPFSPinStatusRecursive
+		m := maxDepthPinTypeRegexp.FindStringSubmatch(t)
+		if m == nil {
+			return IPFSPinStatusRecursive
+		}
+		depth, err := strconv.Atoi(m[1])
+		if err != nil || depth <= 0 {
+			return IPFSPinStatusBug
+		}
+		return IPFSPinStatusWithMaxDepth(depth)
 	case t == "direct":
 		return IPFSPinStatusDirect
 	default:
@@ -127,24 +159,46 @@ func IPFSPinStatusFromString(t string) IPFSPinStatus {
 	}
 }
 
+// MaxDepth returns the depth to which an item is pinned: -1 for recursive
+// pins, 0 for direct pins and the depth for depth-limited pins. It returns
+// 0 for any other status.
+func (ips IPFSPinStatus) MaxDepth() int {
+	switch {
+	case ips == IPFSPinStatusRecursive:
+		return -1
+	case ips > IPFSPinStatusMaxDepth:
+		return int(ips - IPFSPinStatusMaxDepth)
+	default:
+		return 0
+	}
+}
+
+// IsRecursive returns true for fully recursive and depth-limited pins.
+func (ips IPFSPinStatus) IsRecursive() bool {
+	return ips == IPFSPinStatusRecursive || ips > IPFSPinStatusMaxDepth
+}
+
 // IsPinned returns true if the item is pinned as expected by the
-// maxDepth parameter.
+// maxDepth parameter. An item pinned to a larger depth than the
+// given one (i.e. recursively) is pinned as expected too, since
+// IPFS does not support pinning the same item in several ways.
 func (ips IPFSPinStatus) IsPinned(maxDepth int) bool {
 	switch {
 	case maxDepth < 0:
 		return ips == IPFSPinStatusRecursive
 	case maxDepth == 0:
-		return ips == IPFSPinStatusDirect
-	case maxDepth > 0:
-		// FIXME: when we know how ipfs returns partial pins.
-		return ips == IPFSPinStatusRecursive
+		return ips == IPFSPinStatusDirect || ips.IsRecursive()
+	default:
+		return ips.IsRecursive() && (ips.MaxDepth() < 0 || ips.MaxDepth() >= maxDepth)
 	}
-	return false
 }
 
 // ToTrackerStatus converts the IPFSPinStatus value to the
 // appropriate TrackerStatus value.
 func (ips IPFSPinStatus) ToTrackerStatus() TrackerStatus {
+	if ips.IsRecursive() {
+		return TrackerStatusPinned
+	}
 	return ipfsPinStatus2TrackerStatusMap[ips]
 }
 
@@ -330,6 +384,9 @@ type ConnectGraph struct {
 	IPFSLinks     map[peer.ID][]peer.ID // ipfs to ipfs links
 	ClusterLinks  map[peer.ID][]peer.ID // cluster to cluster links
 	ClustertoIPFS map[peer.ID]peer.ID   // cluster to ipfs links
+	// round-trip times measured by each cluster peer to the others,
+	// when they run the latency informer.
+	ClusterLatencies map[peer.ID]map[peer.ID]time.Duration
 }
 
 // ConnectGraphSerial is the serializable ConnectGraph counterpart for RPC requests
@@ -338,6 +395,8 @@ type ConnectGraphSerial struct {
 	IPFSLinks     map[string][]string `json:"ipfs_links"`
 	ClusterLinks  map[string][]string `json:"cluster_links"`
 	ClustertoIPFS map[string]string   `json:"cluster_to_ipfs"`
+	// ClusterLatencies are in nanoseconds.
+	ClusterLatencies map[string]map[string]time.Duration `json:"cluster_latencies,omitempty"`
 }
 
 // ToSerial converts a ConnectGraph to its Go-serializable version
@@ -348,11 +407,16 @@ func (cg ConnectGraph) ToSerial() ConnectGraphSerial {
 	for k, v := range cg.ClustertoIPFS {
 		ClustertoIPFSSerial[peer.IDB58Encode(k)] = peer.IDB58Encode(v)
 	}
+	ClusterLatenciesSerial := make(map[string]map[string]time.Duration)
+	for k, v := range cg.ClusterLatencies {
+		ClusterLatenciesSerial[peer.IDB58Encode(k)] = LatenciesToSerial(v)
+	}
 	return ConnectGraphSerial{
-		ClusterID:     peer.IDB58Encode(cg.ClusterID),
-		IPFSLinks:     IPFSLinksSerial,
-		ClusterLinks:  ClusterLinksSerial,
-		ClustertoIPFS: ClustertoIPFSSerial,
+		ClusterID:        peer.IDB58Encode(cg.ClusterID),
+		IPFSLinks:        IPFSLinksSerial,
+		ClusterLinks:     ClusterLinksSerial,
+		ClustertoIPFS:    ClustertoIPFSSerial,
+		ClusterLatencies: ClusterLatenciesSerial,
 	}
 }
 
@@ -364,13 +428,43 @@ func (cgs ConnectGraphSerial) ToConnectGraph() ConnectGraph {
 		pid2, _ := peer.IDB58Decode(v)
 		ClustertoIPFS[pid1] = pid2
 	}
+	ClusterLatencies := make(map[peer.ID]map[peer.ID]time.Duration)
+	for k, v := range cgs.ClusterLatencies {
+		pid, _ := peer.IDB58Decode(k)
+		ClusterLatencies[pid] = SerialToLatencies(v)
+	}
 	pid, _ := peer.IDB58Decode(cgs.ClusterID)
 	return ConnectGraph{
-		ClusterID:     pid,
-		IPFSLinks:     deserializeLinkMap(cgs.IPFSLinks),
-		ClusterLinks:  deserializeLinkMap(cgs.ClusterLinks),
-		ClustertoIPFS: ClustertoIPFS,
+		ClusterID:        pid,
+		IPFSLinks:        deserializeLinkMap(cgs.IPFSLinks),
+		ClusterLinks:     deserializeLinkMap(cgs.ClusterLinks),
+		ClustertoIPFS:    ClustertoIPFS,
+		ClusterLatencies: ClusterLatencies,
+	}
+}
+
+// LatenciesToSerial converts round-trip times by peer to their
+// serializable form.
+func LatenciesToSerial(latencies map[peer.ID]time.Duration) map[string]time.Duration {
+	serial := make(map[string]time.Duration, len(latencies))
+	for p, rtt := range latencies {
+		serial[peer.IDB58Encode(p)] = rtt
+	}
+	return serial
+}
+
+// SerialToLatencies converts serialized round-trip times by peer back to
+// their original form. Invalid peer IDs are ignored.
+func SerialToLatencies(serial map[string]time.Duration) map[peer.ID]time.Duration {
+	latencies := make(map[peer.ID]time.Duration, len(serial))
+	for k, rtt := range serial {
+		p, err := peer.IDB58Decode(k)
+		if err != nil {
+			continue
+		}
+		latencies[p] = rtt
 	}
+	return latencies
 }
 
 func serializeLinkMap(Links map[peer.ID][]peer.ID) map[string][]string {
@@ -407,6 +501,77 @@ func (swarmS SwarmPeersSerial) ToSwarmPeers() SwarmPeers {
 	return StringsToPeers(swarmS)
 }
 
+// PeerRole identifies the role of a peer in the consensus peerset.
+type PeerRole string
+
+// Peer roles in the consensus peerset
+const (
+	// PeerRoleVoter peers take part in consensus decisions.
+	PeerRoleVoter PeerRole = "voter"
+	// PeerRoleNonVoter peers receive every update to the shared state
+	// but do not take part in consensus decisions nor count towards
+	// quorum.
+	PeerRoleNonVoter PeerRole = "non-voter"
+)
+
+// PeerRoleFromString parses a PeerRole. An empty string is parsed
+// as PeerRoleVoter.
+func PeerRoleFromString(str string) (PeerRole, error) {
+	switch PeerRole(str) {
+	case "", PeerRoleVoter:
+		return PeerRoleVoter, nil
+	case PeerRoleNonVoter:
+		return PeerRoleNonVoter, nil
+	default:
+		return "", fmt.Errorf("invalid peer role: %s", str)
+	}
+}
+
+// PeerAddRequest holds the ID of a peer to be added to the
+// cluster peerset and the role it should take. It is used in
+// RPC requests.
+type PeerAddRequest struct {
+	PeerID string   `json:"peer_id"`
+	Role   PeerRole `json:"role,omitempty"`
+}
+
+// PeerDrainRequest holds the ID of a peer to be marked as
+// draining, or to have the mark removed. It is used in RPC requests.
+type PeerDrainRequest struct {
+	PeerID   string `json:"peer_id"`
+	Draining bool   `json:"draining"`
+}
+
+// DrainStatus reports the progress of draining a peer. Remaining is
+// the number of pins which are still allocated to it. InProgress is set
+// while the peer answering is re-allocating those pins, and Total and
+// Failed then refer to that re-allocation round.
+type DrainStatus struct {
+	Peer       string `json:"peer"`
+	Draining   bool   `json:"draining"`
+	Remaining  int    `json:"remaining"`
+	InProgress bool   `json:"in_progress"`
+	Total      int    `json:"total"`
+	Failed     int    `json:"failed"`
+}
+
+// TrackerBacklog counts the pin operations of a peer's tracker which
+// have not completed yet: those waiting in the queue, those being pinned
+// and those which failed. PendingSize is the total size of the pins
+// which are queued or being pinned, when known.
+type TrackerBacklog struct {
+	PinQueued   int    `json:"pin_queued"`
+	Pinning     int    `json:"pinning"`
+	PinError    int    `json:"pin_error"`
+	PendingSize uint64 `json:"pending_size"`
+}
+
+// Pending returns the number of pin operations which are queued or
+// being pinned. Failed ones are not counted.
+func (b TrackerBacklog) Pending() int {
+	return b.PinQueued + b.Pinning
+}
+
 // ID holds information about the Cluster peer
 type ID struct {
 	ID                    peer.ID
@@ -419,21 +584,26 @@ type ID struct {
 	Error                 string
 	IPFS                  IPFSID
 	Peername              string
+	Role                  PeerRole
+	// Tags are the labels published by the tags informer, if any.
+	Tags map[string]string
 	//PublicKey          crypto.PubKey
 }
 
 // IDSerial is the serializable ID counterpart for RPC requests
 type IDSerial struct {
-	ID                    string           `json:"id"`
-	Addresses             MultiaddrsSerial `json:"addresses"`
-	ClusterPeers          []string         `json:"cluster_peers"`
-	ClusterPeersAddresses MultiaddrsSerial `json:"cluster_peers_addresses"`
-	Version               string           `json:"version"`
-	Commit                string           `json:"commit"`
-	RPCProtocolVersion    string           `json:"rpc_protocol_version"`
-	Error                 string           `json:"error"`
-	IPFS                  IPFSIDSerial     `json:"ipfs"`
-	Peername              string           `json:"peername"`
+	ID                    string            `json:"id"`
+	Addresses             MultiaddrsSerial  `json:"addresses"`
+	ClusterPeers          []string          `json:"cluster_peers"`
+	ClusterPeersAddresses MultiaddrsSerial  `json:"cluster_peers_addresses"`
+	Version               string            `json:"version"`
+	Commit                string            `json:"commit"`
+	RPCProtocolVersion    string            `json:"rpc_protocol_version"`
+	Error                 string            `json:"error"`
+	IPFS                  IPFSIDSerial      `json:"ipfs"`
+	Peername              string            `json:"peername"`
+	Role                  string            `json:"role,omitempty"`
+	Tags                  map[string]string `json:"tags,omitempty"`
 	//PublicKey          []byte
 }
 
@@ -460,6 +630,8 @@ func (id ID) ToSerial() IDSerial {
 		Error:                 id.Error,
 		IPFS:                  id.IPFS.ToSerial(),
 		Peername:              id.Peername,
+		Role:                  string(id.Role),
+		Tags:                  id.Tags,
 		//PublicKey:          pkey,
 	}
 }
@@ -487,6 +659,8 @@ func (ids IDSerial) ToID() ID {
 	id.Error = ids.Error
 	id.IPFS = ids.IPFS.ToIPFSID()
 	id.Peername = ids.Peername
+	id.Role = PeerRole(ids.Role)
+	id.Tags = ids.Tags
 	return id
 }
 
@@ -644,10 +818,115 @@ func (pT PinType) String() string {
 
 // PinOptions wraps user-defined options for Pins
 type PinOptions struct {
-	ReplicationFactorMin int    `json:"replication_factor_min"`
-	ReplicationFactorMax int    `json:"replication_factor_max"`
-	Name                 string `json:"name"`
-	ShardSize            uint64 `json:"shard_size"`
+	ReplicationFactorMin int               `json:"replication_factor_min"`
+	ReplicationFactorMax int               `json:"replication_factor_max"`
+	Name                 string            `json:"name"`
+	ShardSize            uint64            `json:"shard_size"`
+	ExpireAt             time.Time         `json:"expire_at"`
+	Metadata             map[string]string `json:"metadata"`
+	// UserAllocations are peer IDs (b58-encoded) which are allocated
+	// with priority when pinning.
+	UserAllocations []string `json:"user_allocations"`
+	// Path is the mutable path (i.e. /ipns/<name>) which resolved to
+	// the pinned Cid, for pins made by path. It is re-resolved
+	// periodically and the pin updated when it changes.
+	Path string `json:"path"`
+	// PinUpdate is the Cid (string) of the pin which is replaced by
+	// this one, when it results from an update. IPFS daemons use it to
+	// fetch only the blocks that differ. It is handed to the PinTracker
+	// but not kept in the shared state.
+	PinUpdate string `json:"pin_update"`
+}
+
+// MetadataQueryPrefix is prepended to metadata keys when they are
+// passed as query arguments (i.e. "meta.key=value").
+const MetadataQueryPrefix = "meta."
+
+// MetadataFromQuery extracts the metadata key/values from query
+// arguments prefixed with MetadataQueryPrefix. It returns nil when
+// there are none.
+func MetadataFromQuery(query url.Values) map[string]string {
+	var meta map[string]string
+	for k := range query {
+		if !strings.HasPrefix(k, MetadataQueryPrefix) {
+			continue
+		}
+		key := strings.TrimPrefix(k, MetadataQueryPrefix)
+		if key == "" {
+			continue
+		}
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		meta[key] = query.Get(k)
+	}
+	return meta
+}
+
+func metadataToQuery(query url.Values, meta map[string]string) {
+	for k, v := range meta {
+		query.Set(MetadataQueryPrefix+k, v)
+	}
+}
+
+func copyStrings(strs []string) []string {
+	if strs == nil {
+		return nil
+	}
+	new := make([]string, len(strs))
+	copy(new, strs)
+	return new
+}
+
+func copyMetadata(meta map[string]string) map[string]string {
+	if meta == nil {
+		return nil
+	}
+	new := make(map[string]string, len(meta))
+	for k, v := range meta {
+		new[k] = v
+	}
+	return new
+}
+
+// ToQueryString returns a url query string (key=value&key2=value2&...)
+// with the pin options, as understood by the REST API.
+func (po PinOptions) ToQueryString() string {
+	query := url.Values{}
+	query.Set("replication-min", fmt.Sprintf("%d", po.ReplicationFactorMin))
+	query.Set("replication-max", fmt.Sprintf("%d", po.ReplicationFactorMax))
+	query.Set("name", po.Name)
+	if !po.ExpireAt.IsZero() {
+		query.Set("expire-at", po.ExpireAt.Format(time.RFC3339))
+	}
+	if len(po.UserAllocations) > 0 {
+		query.Set("user-allocations", strings.Join(po.UserAllocations, ","))
+	}
+	metadataToQuery(query, po.Metadata)
+	return query.Encode()
+}
+
+// MatchesMetadata returns true when all the key/values in the given
+// filter are part of the metadata.
+func (po PinOptions) MatchesMetadata(filter map[string]string) bool {
+	for k, v := range filter {
+		if val, ok := po.Metadata[k]; !ok || val != v {
+			return false
+		}
+	}
+	return true
+}
+
+// PinsFilter selects the pins of the given types which carry the given
+// metadata.
+type PinsFilter struct {
+	Type     PinType           `json:"type"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// Matches returns true when the pin is selected by the filter.
+func (f PinsFilter) Matches(pin Pin) bool {
+	return f.Type&pin.Type > 0 && pin.MatchesMetadata(f.Metadata)
 }
 
 // Pin carries all the information associated to a CID that is pinned
@@ -672,6 +951,10 @@ type Pin struct {
 	// MetaPin it is the ClusterDAG CID. For Shards,
 	// it is the previous shard CID.
 	Reference cid.Cid
+
+	// Size is the cumulative size of the DAG in bytes, or 0 when
+	// unknown. Peers which cannot fit it are not allocated.
+	Size uint64
 }
 
 // PinCid is a shortcut to create a Pin only with a Cid.  Default is for pin to
@@ -693,6 +976,11 @@ func PinWithOpts(c cid.Cid, opts PinOptions) Pin {
 	p.ReplicationFactorMax = opts.ReplicationFactorMax
 	p.Name = opts.Name
 	p.ShardSize = opts.ShardSize
+	p.ExpireAt = opts.ExpireAt
+	p.Metadata = copyMetadata(opts.Metadata)
+	p.UserAllocations = copyStrings(opts.UserAllocations)
+	p.Path = opts.Path
+	p.PinUpdate = opts.PinUpdate
 	return p
 }
 
@@ -705,6 +993,7 @@ type PinSerial struct {
 	Allocations []string `json:"allocations"`
 	MaxDepth    int      `json:"max_depth"`
 	Reference   string   `json:"reference"`
+	Size        uint64   `json:"size"`
 }
 
 // ToSerial converts a Pin to PinSerial.
@@ -727,11 +1016,17 @@ func (pin Pin) ToSerial() PinSerial {
 		Type:        uint64(pin.Type),
 		MaxDepth:    pin.MaxDepth,
 		Reference:   ref,
+		Size:        pin.Size,
 		PinOptions: PinOptions{
 			Name:                 n,
 			ReplicationFactorMin: pin.ReplicationFactorMin,
 			ReplicationFactorMax: pin.ReplicationFactorMax,
 			ShardSize:            pin.ShardSize,
+			ExpireAt:             pin.ExpireAt,
+			Metadata:             copyMetadata(pin.Metadata),
+			UserAllocations:      copyStrings(pin.UserAllocations),
+			Path:                 pin.Path,
+			PinUpdate:            pin.PinUpdate,
 		},
 	}
 }
@@ -782,9 +1077,39 @@ func (pin Pin) Equals(pin2 Pin) bool {
 		return false
 	}
 
+	if !pin1s.ExpireAt.Equal(pin2s.ExpireAt) {
+		return false
+	}
+
+	if len(pin1s.Metadata) != len(pin2s.Metadata) ||
+		!pin1s.MatchesMetadata(pin2s.Metadata) {
+		return false
+	}
+
+	if strings.Join(pin1s.UserAllocations, ",") != strings.Join(pin2s.UserAllocations, ",") {
+		return false
+	}
+
+	if pin1s.Path != pin2s.Path {
+		return false
+	}
+
+	if pin1s.Size != pin2s.Size {
+		return false
+	}
+
 	return true
 }
 
+// ExpiredAt returns true when the pin has an expiration date and it
+// is before the given time.
+func (pin Pin) ExpiredAt(t time.Time) bool {
+	if pin.ExpireAt.IsZero() {
+		return false
+	}
+	return pin.ExpireAt.Before(t)
+}
+
 // IsRemotePin determines whether a Pin's ReplicationFactor has
 // been met, so as to either pin or unpin it from the peer.
 func (pin Pin) IsRemotePin(pid peer.ID) bool {
@@ -820,11 +1145,17 @@ func (pins PinSerial) ToPin() Pin {
 		Type:        PinType(pins.Type),
 		MaxDepth:    pins.MaxDepth,
 		Reference:   ref,
+		Size:        pins.Size,
 		PinOptions: PinOptions{
 			Name:                 pins.Name,
 			ReplicationFactorMin: pins.ReplicationFactorMin,
 			ReplicationFactorMax: pins.ReplicationFactorMax,
 			ShardSize:            pins.ShardSize,
+			ExpireAt:             pins.ExpireAt,
+			Metadata:             copyMetadata(pins.Metadata),
+			UserAllocations:      copyStrings(pins.UserAllocations),
+			Path:                 pins.Path,
+			PinUpdate:            pins.PinUpdate,
 		},
 	}
 }
@@ -835,6 +1166,8 @@ func (pins PinSerial) Clone() PinSerial {
 	// slices are pointers. We need to explicitally copy them.
 	new.Allocations = make([]string, len(pins.Allocations))
 	copy(new.Allocations, pins.Allocations)
+	new.Metadata = copyMetadata(pins.Metadata)
+	new.UserAllocations = copyStrings(pins.UserAllocations)
 	return new
 }
 
@@ -848,6 +1181,51 @@ func (pins PinSerial) DecodeCid() cid.Cid {
 	return c
 }
 
+// PinBatch groups several pin and unpin operations so that they
+// can be submitted as a single one. Unpins only need their Cid set.
+type PinBatch struct {
+	Pins   []Pin
+	Unpins []Pin
+}
+
+// PinBatchSerial is the serializable version of PinBatch.
+type PinBatchSerial struct {
+	Pins   []PinSerial `json:"pins"`
+	Unpins []PinSerial `json:"unpins"`
+}
+
+// ToSerial converts a PinBatch to PinBatchSerial.
+func (b PinBatch) ToSerial() PinBatchSerial {
+	return PinBatchSerial{
+		Pins:   pinsToSerial(b.Pins),
+		Unpins: pinsToSerial(b.Unpins),
+	}
+}
+
+// ToPinBatch converts a PinBatchSerial to its native form.
+func (bs PinBatchSerial) ToPinBatch() PinBatch {
+	return PinBatch{
+		Pins:   serialToPins(bs.Pins),
+		Unpins: serialToPins(bs.Unpins),
+	}
+}
+
+func pinsToSerial(pins []Pin) []PinSerial {
+	pinsS := make([]PinSerial, len(pins), len(pins))
+	for i, p := range pins {
+		pinsS[i] = p.ToSerial()
+	}
+	return pinsS
+}
+
+func serialToPins(pinsS []PinSerial) []Pin {
+	pins := make([]Pin, len(pinsS), len(pinsS))
+	for i, p := range pinsS {
+		pins[i] = p.ToPin()
+	}
+	return pins
+}
+
 // NodeWithMeta specifies a block of data and a set of optional metadata fields
 // carrying information about the encoded ipld node
 type NodeWithMeta struct {
@@ -942,12 +1320,106 @@ func (m *Metric) UnmarshalJSON(j []byte) error {
 	return nil
 }
 
+// MetricHistoryRequest asks for the metric history of the given type
+// and peer. An empty PeerID means all peers. It is used in RPC requests.
+type MetricHistoryRequest struct {
+	Name   string `json:"name"`
+	PeerID string `json:"peer_id,omitempty"`
+}
+
+// MetricsSet groups several metrics for the same peer, indexed by
+// metric name.
+type MetricsSet map[string]Metric
+
+// AllocationCandidate describes how a cluster peer was considered when
+// simulating the allocation of a pin.
+type AllocationCandidate struct {
+	Peer      string   `json:"peer"`
+	Metrics   []Metric `json:"metrics"`
+	Allocated bool     `json:"allocated"`
+	Reason    string   `json:"reason"`
+}
+
+// AllocationSimulation is the result of running the allocation process
+// for a pin without committing it. Allocations lists the peers that would
+// be chosen and Candidates explains the decision for every peer. Error is
+// set when the allocation would fail.
+type AllocationSimulation struct {
+	Cid         string                `json:"cid"`
+	Allocations []string              `json:"allocations"`
+	Candidates  []AllocationCandidate `json:"candidates"`
+	Error       string                `json:"error,omitempty"`
+}
+
 // Alert carries alerting information about a peer. WIP.
 type Alert struct {
 	Peer       peer.ID
 	MetricName string
 }
 
+// Event types.
+const (
+	// EventAlert is emitted when the peer monitor raises an alert.
+	EventAlert = "alert"
+	// EventPeerJoined is emitted when a peer is added to the peerset.
+	EventPeerJoined = "peer_joined"
+	// EventPeerLeft is emitted when a peer is removed from the peerset.
+	EventPeerLeft = "peer_left"
+	// EventLeaderChanged is emitted when the consensus leader changes.
+	EventLeaderChanged = "leader_changed"
+	// EventPinStatus is emitted when the status of a pin tracked by
+	// the peer changes. It is not relayed to other peers.
+	EventPinStatus = "pin_status"
+)
+
+// EventTypes lists all the valid event types.
+var EventTypes = []string{
+	EventAlert,
+	EventPeerJoined,
+	EventPeerLeft,
+	EventLeaderChanged,
+	EventPinStatus,
+}
+
+// IsValidEventType returns true if t is a known event type.
+func IsValidEventType(t string) bool {
+	for _, et := range EventTypes {
+		if t == et {
+			return true
+		}
+	}
+	return false
+}
+
+// Event describes something that happened in the cluster, as observed by
+// a peer. Seq increases with every event emitted by that peer. Depending on
+// the Type, only some of the fields are set.
+type Event struct {
+	Seq       uint64    `json:"seq"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Peer      string    `json:"peer,omitempty"`
+	Cid       string    `json:"cid,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	Metric    string    `json:"metric,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// EventsRequest asks for the events after the Since sequence number,
+// optionally restricted to the given Types. A Since of 0 means only
+// events emitted from now on.
+type EventsRequest struct {
+	Since uint64
+	Types []string
+}
+
+// EventsResponse carries the events matching an EventsRequest and the
+// sequence number to use as Since in the next request.
+type EventsResponse struct {
+	Events []Event
+	Last   uint64
+}
+
 // Error can be used by APIs to return errors.
 type Error struct {
 	Code    int    `json:"code"`
@@ -2,6 +2,7 @@ package api
 
 import (
 	"fmt"
+	"net/url"
 	"reflect"
 	"testing"
 	"time"
@@ -44,6 +45,45 @@ func TestIPFSPinStatusFromString(t *testing.T) {
 	}
 }
 
+func TestIPFSPinStatusMaxDepth(t *testing.T) {
+	ips := IPFSPinStatusFromString("recursive (2)")
+	if ips.MaxDepth() != 2 || !ips.IsRecursive() {
+		t.Fatal("expected a depth-limited pin with depth 2")
+	}
+	if ips != IPFSPinStatusWithMaxDepth(2) {
+		t.Error("statuses should match")
+	}
+	if ips.ToTrackerStatus() != TrackerStatusPinned {
+		t.Error("depth-limited pins should be pinned")
+	}
+
+	if !ips.IsPinned(0) || !ips.IsPinned(1) || !ips.IsPinned(2) {
+		t.Error("should be pinned to depths 0 to 2")
+	}
+	if ips.IsPinned(3) || ips.IsPinned(-1) {
+		t.Error("should not be pinned to depth 3 or recursively")
+	}
+
+	rec := IPFSPinStatusRecursive
+	if rec.MaxDepth() != -1 || !rec.IsPinned(-1) || !rec.IsPinned(0) || !rec.IsPinned(5) {
+		t.Error("recursive pins cover any depth")
+	}
+
+	direct := IPFSPinStatusDirect
+	if direct.MaxDepth() != 0 || !direct.IsPinned(0) || direct.IsPinned(1) || direct.IsPinned(-1) {
+		t.Error("direct pins only cover depth 0")
+	}
+
+	if IPFSPinStatusUnpinned.IsPinned(0) || IPFSPinStatusIndirect.IsPinned(1) {
+		t.Error("unpinned and indirect items are not pinned")
+	}
+
+	if IPFSPinStatusWithMaxDepth(-1) != IPFSPinStatusRecursive ||
+		IPFSPinStatusWithMaxDepth(0) != IPFSPinStatusDirect {
+		t.Error("unexpected statuses for special depths")
+	}
+}
+
 func TestGlobalPinInfoConv(t *testing.T) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -92,6 +132,8 @@ func TestIDConv(t *testing.T) {
 		Commit:                "ab",
 		RPCProtocolVersion:    "testp",
 		Error:                 "teste",
+		Role:                  PeerRoleNonVoter,
+		Tags:                  map[string]string{"region": "eu-west"},
 		IPFS: IPFSID{
 			ID:        testPeerID2,
 			Addresses: []ma.Multiaddr{testMAddr3},
@@ -120,7 +162,9 @@ func TestIDConv(t *testing.T) {
 	if id.Version != newid.Version ||
 		id.Commit != newid.Commit ||
 		id.RPCProtocolVersion != newid.RPCProtocolVersion ||
-		id.Error != newid.Error {
+		id.Error != newid.Error ||
+		id.Role != newid.Role ||
+		newid.Tags["region"] != "eu-west" {
 		t.Error("some field didn't survive")
 	}
 
@@ -136,6 +180,23 @@ func TestIDConv(t *testing.T) {
 	}
 }
 
+func TestPeerRoleFromString(t *testing.T) {
+	role, err := PeerRoleFromString("")
+	if err != nil || role != PeerRoleVoter {
+		t.Error("empty role should be a voter")
+	}
+
+	role, err = PeerRoleFromString("non-voter")
+	if err != nil || role != PeerRoleNonVoter {
+		t.Error("expected a non-voter")
+	}
+
+	_, err = PeerRoleFromString("learner")
+	if err == nil {
+		t.Error("expected an error with an invalid role")
+	}
+}
+
 func TestConnectGraphConv(t *testing.T) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -159,6 +220,9 @@ func TestConnectGraphConv(t *testing.T) {
 			testPeerID2: testPeerID5,
 			testPeerID3: testPeerID6,
 		},
+		ClusterLatencies: map[peer.ID]map[peer.ID]time.Duration{
+			testPeerID1: {testPeerID2: time.Millisecond},
+		},
 	}
 
 	cgNew := cg.ToSerial().ToConnectGraph()
@@ -193,10 +257,14 @@ func TestPinConv(t *testing.T) {
 		Allocations: []peer.ID{testPeerID1},
 		Reference:   testCid2,
 		MaxDepth:    -1,
+		Size:        1024,
 		PinOptions: PinOptions{
 			ReplicationFactorMax: -1,
 			ReplicationFactorMin: -1,
 			Name:                 "A test pin",
+			ExpireAt:             time.Now().Add(time.Hour),
+			Metadata:             map[string]string{"a": "b"},
+			UserAllocations:      []string{testPeerID2.Pretty()},
 		},
 	}
 
@@ -206,8 +274,13 @@ func TestPinConv(t *testing.T) {
 		c.ReplicationFactorMin != newc.ReplicationFactorMin ||
 		c.ReplicationFactorMax != newc.ReplicationFactorMax ||
 		c.MaxDepth != newc.MaxDepth ||
+		c.Size != newc.Size ||
 		!c.Reference.Equals(newc.Reference) ||
-		c.Name != newc.Name || c.Type != newc.Type {
+		c.Name != newc.Name || c.Type != newc.Type ||
+		!c.ExpireAt.Equal(newc.ExpireAt) ||
+		newc.Metadata["a"] != "b" ||
+		len(newc.UserAllocations) != 1 ||
+		newc.UserAllocations[0] != c.UserAllocations[0] {
 
 		fmt.Printf("c: %+v\ncnew: %+v\n", c, newc)
 		t.Fatal("mismatch")
@@ -216,6 +289,108 @@ func TestPinConv(t *testing.T) {
 	if !c.Equals(newc) {
 		t.Error("all pin fields are equal but Equals returns false")
 	}
+
+	newc.Metadata["a"] = "c"
+	if c.Metadata["a"] != "b" {
+		t.Error("metadata should have been copied")
+	}
+	if c.Equals(newc) {
+		t.Error("pins with different metadata should not be equal")
+	}
+}
+
+func TestMetadataFromQuery(t *testing.T) {
+	q, _ := url.ParseQuery("name=abc&meta.project=p1&meta.version=2&meta.=x")
+	meta := MetadataFromQuery(q)
+	if len(meta) != 2 || meta["project"] != "p1" || meta["version"] != "2" {
+		t.Error("unexpected metadata:", meta)
+	}
+
+	q, _ = url.ParseQuery("name=abc")
+	if MetadataFromQuery(q) != nil {
+		t.Error("expected no metadata")
+	}
+}
+
+func TestPinOptionsMatchesMetadata(t *testing.T) {
+	po := PinOptions{
+		Metadata: map[string]string{"project": "p1", "version": "2"},
+	}
+	if !po.MatchesMetadata(nil) {
+		t.Error("an empty filter should match")
+	}
+	if !po.MatchesMetadata(map[string]string{"project": "p1"}) {
+		t.Error("filter should match")
+	}
+	if po.MatchesMetadata(map[string]string{"project": "p2"}) {
+		t.Error("filter should not match a different value")
+	}
+	if po.MatchesMetadata(map[string]string{"source": "p1"}) {
+		t.Error("filter should not match a missing key")
+	}
+}
+
+func TestPinExpiredAt(t *testing.T) {
+	now := time.Now()
+	p := PinCid(testCid1)
+	if p.ExpiredAt(now) {
+		t.Error("pins without expiration date should not expire")
+	}
+
+	p.ExpireAt = now.Add(-time.Second)
+	if !p.ExpiredAt(now) {
+		t.Error("pin should have expired")
+	}
+
+	p.ExpireAt = now.Add(time.Second)
+	if p.ExpiredAt(now) {
+		t.Error("pin should not have expired yet")
+	}
+}
+
+func TestPinOptionsToQueryString(t *testing.T) {
+	expire, _ := time.Parse(time.RFC3339, "2019-01-01T00:00:00Z")
+	po := PinOptions{
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 2,
+		Name:                 "abc",
+		ExpireAt:             expire,
+		Metadata:             map[string]string{"project": "p1"},
+		UserAllocations:      []string{"a", "b"},
+	}
+	q, err := url.ParseQuery(po.ToQueryString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Get("replication-min") != "1" ||
+		q.Get("replication-max") != "2" ||
+		q.Get("name") != "abc" ||
+		q.Get("expire-at") != "2019-01-01T00:00:00Z" ||
+		q.Get("meta.project") != "p1" ||
+		q.Get("user-allocations") != "a,b" {
+		t.Error("unexpected query:", q.Encode())
+	}
+
+	po.ExpireAt = time.Time{}
+	q, _ = url.ParseQuery(po.ToQueryString())
+	if _, ok := q["expire-at"]; ok {
+		t.Error("expire-at should not be set")
+	}
+}
+
+func TestPinBatchConv(t *testing.T) {
+	b := PinBatch{
+		Pins:   []Pin{PinCid(testCid1)},
+		Unpins: []Pin{PinCid(testCid2)},
+	}
+
+	newb := b.ToSerial().ToPinBatch()
+	if len(newb.Pins) != 1 || !newb.Pins[0].Equals(b.Pins[0]) {
+		t.Error("pins mismatch")
+	}
+	if len(newb.Unpins) != 1 || !newb.Unpins[0].Cid.Equals(testCid2) {
+		t.Error("unpins mismatch")
+	}
 }
 
 func TestMetric(t *testing.T) {
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"mime/multipart"
+	"strings"
 	"sync"
 	"time"
 
@@ -33,6 +34,10 @@ var ReadyTimeout = 30 * time.Second
 
 var pingMetricName = "ping"
 
+// dagSizeWorkers is the number of concurrent requests made to IPFS to
+// obtain the sizes of the pins in a batch.
+var dagSizeWorkers = 8
+
 // Cluster is the main IPFS cluster component. It provides
 // the go-API for it and orchestrates the components that make up the system.
 type Cluster struct {
@@ -54,7 +59,7 @@ type Cluster struct {
 	tracker   PinTracker
 	monitor   PeerMonitor
 	allocator PinAllocator
-	informer  Informer
+	informers []Informer
 
 	doneCh  chan struct{}
 	readyCh chan struct{}
@@ -64,6 +69,20 @@ type Cluster struct {
 	// peerAdd
 	paMux sync.Mutex
 
+	// drains started by this peer
+	drainsMux sync.Mutex
+	drains    map[peer.ID]*drainProgress
+
+	// allocations not yet reflected in the free space metrics
+	pendingMux sync.Mutex
+	pending    map[peer.ID][]pendingAllocation
+
+	// metrics about the internals of this peer
+	observations *clusterObservations
+
+	// events emitted by this peer
+	events *eventLog
+
 	// shutdown function and related variables
 	shutdownLock sync.Mutex
 	shutdownB    bool
@@ -76,6 +95,9 @@ type Cluster struct {
 // The new cluster peer may still be performing initialization tasks when
 // this call returns (consensus may still be bootstrapping). Use Cluster.Ready()
 // if you need to wait until the peer is fully up.
+//
+// At least one informer must be provided. The metrics of the first one
+// decide which peers are candidates for allocations.
 func NewCluster(
 	host host.Host,
 	cfg *Config,
@@ -86,13 +108,17 @@ func NewCluster(
 	tracker PinTracker,
 	monitor PeerMonitor,
 	allocator PinAllocator,
-	informer Informer,
+	informers []Informer,
 ) (*Cluster, error) {
 	err := cfg.Validate()
 	if err != nil {
 		return nil, err
 	}
 
+	if len(informers) == 0 {
+		return nil, errors.New("at least one informer is needed")
+	}
+
 	if host == nil {
 		return nil, errors.New("cluster host is nil")
 	}
@@ -139,14 +165,19 @@ func NewCluster(
 		tracker:     tracker,
 		monitor:     monitor,
 		allocator:   allocator,
-		informer:    informer,
+		informers:   informers,
 		peerManager: peerManager,
 		shutdownB:   false,
 		removed:     false,
 		doneCh:      make(chan struct{}),
 		readyCh:     make(chan struct{}),
 		readyB:      false,
+		drains:      make(map[peer.ID]*drainProgress),
+		pending:     make(map[peer.ID][]pendingAllocation),
+		events:      newEventLog(),
 	}
+	c.observations = newClusterObservations()
+	c.observations.registry.OnCollect(c.collectObservations)
 
 	err = c.setupRPC()
 	if err != nil {
@@ -182,7 +213,9 @@ func (c *Cluster) setupRPCClients() {
 	c.consensus.SetClient(c.rpcClient)
 	c.monitor.SetClient(c.rpcClient)
 	c.allocator.SetClient(c.rpcClient)
-	c.informer.SetClient(c.rpcClient)
+	for _, informer := range c.informers {
+		informer.SetClient(c.rpcClient)
+	}
 }
 
 // syncWatcher loops and triggers StateSync and SyncAllLocal from time to time
@@ -205,16 +238,28 @@ func (c *Cluster) syncWatcher() {
 	}
 }
 
-func (c *Cluster) sendInformerMetric() (api.Metric, error) {
-	metric := c.informer.GetMetric()
+func (c *Cluster) sendInformerMetric(informer Informer) (api.Metric, error) {
+	metric := informer.GetMetric()
 	metric.Peer = c.id
 	return metric, c.monitor.PublishMetric(metric)
 }
 
-// pushInformerMetrics loops and publishes informers metrics using the
-// cluster monitor. Metrics are pushed normally at a TTL/2 rate. If an error
-// occurs, they are pushed at a TTL/4 rate.
-func (c *Cluster) pushInformerMetrics() {
+// sendInformersMetrics publishes the current metrics of all informers.
+func (c *Cluster) sendInformersMetrics() error {
+	var lastErr error
+	for _, informer := range c.informers {
+		_, err := c.sendInformerMetric(informer)
+		if err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// pushInformerMetrics loops and publishes the metrics of an informer using
+// the cluster monitor. Metrics are pushed normally at a TTL/2 rate. If an
+// error occurs, they are pushed at a TTL/4 rate.
+func (c *Cluster) pushInformerMetrics(informer Informer) {
 	timer := time.NewTimer(0) // fire immediately first
 
 	// retries counts how many retries we have made
@@ -233,7 +278,7 @@ func (c *Cluster) pushInformerMetrics() {
 			// wait
 		}
 
-		metric, err := c.sendInformerMetric()
+		metric, err := c.sendInformerMetric(informer)
 
 		if err != nil {
 			if (retries % retryWarnMod) == 0 {
@@ -277,6 +322,12 @@ func (c *Cluster) alertsHandler() {
 		case <-c.ctx.Done():
 			return
 		case alrt := <-c.monitor.Alerts():
+			c.observations.alerts.Inc(alrt.MetricName, peer.IDB58Encode(alrt.Peer))
+			c.publishEvent(api.Event{
+				Type:   api.EventAlert,
+				Peer:   peer.IDB58Encode(alrt.Peer),
+				Metric: alrt.MetricName,
+			})
 			// only the leader handles alerts
 			leader, err := c.consensus.Leader()
 			if err == nil && leader == c.id {
@@ -298,6 +349,7 @@ func (c *Cluster) alertsHandler() {
 func (c *Cluster) watchPeers() {
 	ticker := time.NewTicker(c.config.PeerWatchInterval)
 
+	var lastPeers []peer.ID
 	for {
 		select {
 		case <-c.ctx.Done():
@@ -310,6 +362,10 @@ func (c *Cluster) watchPeers() {
 				logger.Error(err)
 				continue
 			}
+			if lastPeers != nil {
+				c.publishPeersetChanges(lastPeers, peers)
+			}
+			lastPeers = peers
 			for _, p := range peers {
 				if p == c.id {
 					hasMe = true
@@ -329,6 +385,83 @@ func (c *Cluster) watchPeers() {
 	}
 }
 
+// pathResolveWatcher triggers the re-resolution of the paths of pins
+// made by path every PathResolveInterval.
+func (c *Cluster) pathResolveWatcher() {
+	ticker := time.NewTicker(c.config.PathResolveInterval)
+	for {
+		select {
+		case <-c.ctx.Done():
+			ticker.Stop()
+			return
+		case <-ticker.C:
+			logger.Debug("auto-triggering path re-resolution")
+			c.resolvePaths()
+		}
+	}
+}
+
+// resolvePaths re-resolves the paths of the pins made by path and
+// updates those pointing to a new Cid. Only the leader does it, so that
+// every update results in a single operation.
+func (c *Cluster) resolvePaths() {
+	leader, err := c.consensus.Leader()
+	if err != nil || leader != c.id {
+		return
+	}
+
+	cState, err := c.consensus.State()
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+
+	var pins []api.Pin
+	for pin := range cState.Stream(c.ctx) {
+		if pin.Path != "" {
+			pins = append(pins, pin)
+		}
+	}
+
+	for _, pin := range pins {
+		ci, err := c.ipfs.Resolve(c.ctx, pin.Path)
+		if err != nil {
+			logger.Warningf("error resolving %s: %s", pin.Path, err)
+			continue
+		}
+		if ci.Equals(pin.Cid) {
+			continue
+		}
+		err = c.updatePathPin(pin, ci)
+		if err != nil {
+			logger.Errorf("error updating %s to %s: %s", pin.Path, ci, err)
+		}
+	}
+}
+
+// updatePathPin pins the new Cid that the path of the given pin points
+// to and sets the old pin to expire after the PathUnpinGracePeriod, in a
+// single batch. The new pin keeps the options of the old one and is
+// allocated, when possible, to the same peers.
+func (c *Cluster) updatePathPin(old api.Pin, ci cid.Cid) error {
+	logger.Infof("%s now points to %s (was %s)", old.Path, ci, old.Cid)
+	newPin := api.PinWithOpts(ci, old.PinOptions)
+	newPin.MaxDepth = old.MaxDepth
+	newPin.Allocations = old.Allocations // used as priority list
+	// the old pin stays during the grace period: update from it
+	newPin.PinUpdate = old.Cid.String()
+
+	old.Path = ""
+	expireAt := time.Now().Add(c.config.PathUnpinGracePeriod)
+	if old.ExpireAt.IsZero() || expireAt.Before(old.ExpireAt) {
+		old.ExpireAt = expireAt
+	}
+
+	return c.PinBatch(api.PinBatch{
+		Pins: []api.Pin{old, newPin},
+	})
+}
+
 // find all Cids pinned to a given peer and triggers re-pins on them.
 func (c *Cluster) repinFromPeer(p peer.ID) {
 	if c.config.DisableRepinning {
@@ -341,13 +474,16 @@ func (c *Cluster) repinFromPeer(p peer.ID) {
 		logger.Warning(err)
 		return
 	}
-	list := cState.List()
-	for _, pin := range list {
+	var pins []api.Pin
+	for pin := range cState.Stream(c.ctx) {
 		if containsPeer(pin.Allocations, p) {
-			ok, err := c.pin(pin, []peer.ID{p}, []peer.ID{}) // pin blacklisting this peer
-			if ok && err == nil {
-				logger.Infof("repinned %s out of %s", pin.Cid, p.Pretty())
-			}
+			pins = append(pins, pin)
+		}
+	}
+	for _, pin := range pins {
+		ok, err := c.pin(pin, []peer.ID{p}, []peer.ID{}) // pin blacklisting this peer
+		if ok && err == nil {
+			logger.Infof("repinned %s out of %s", pin.Cid, p.Pretty())
 		}
 	}
 }
@@ -356,9 +492,15 @@ func (c *Cluster) repinFromPeer(p peer.ID) {
 func (c *Cluster) run() {
 	go c.syncWatcher()
 	go c.pushPingMetrics()
-	go c.pushInformerMetrics()
+	for _, informer := range c.informers {
+		go c.pushInformerMetrics(informer)
+	}
 	go c.watchPeers()
 	go c.alertsHandler()
+	go c.pathResolveWatcher()
+	go c.rebalanceWatcher()
+	go c.leaderWatcher()
+	go c.pinStatusWatcher()
 }
 
 func (c *Cluster) ready(timeout time.Duration) {
@@ -528,10 +670,20 @@ func (c *Cluster) ID() api.ID {
 	}
 
 	peers := []peer.ID{}
+	var role api.PeerRole
 	// This method might get called very early by a remote peer
 	// and might catch us when consensus is not set
 	if c.consensus != nil {
 		peers, _ = c.consensus.Peers()
+		role = c.consensus.Role()
+	}
+
+	var tags map[string]string
+	for _, informer := range c.informers {
+		if tinf, ok := informer.(TagsInformer); ok {
+			tags = tinf.Tags()
+			break
+		}
 	}
 
 	return api.ID{
@@ -544,9 +696,23 @@ func (c *Cluster) ID() api.ID {
 		RPCProtocolVersion:    RPCProtocol,
 		IPFS:                  ipfsID,
 		Peername:              c.config.Peername,
+		Role:                  role,
+		Tags:                  tags,
 	}
 }
 
+// PeerLatencies returns the latest round-trip times from this peer to
+// the other cluster peers, as measured by the first informer which keeps
+// them. It is empty when no informer measures latencies.
+func (c *Cluster) PeerLatencies() map[peer.ID]time.Duration {
+	for _, informer := range c.informers {
+		if linf, ok := informer.(LatencyInformer); ok {
+			return linf.Latencies()
+		}
+	}
+	return map[peer.ID]time.Duration{}
+}
+
 // PeerAdd adds a new peer to this Cluster.
 //
 // For it to work well, the new peer should be discoverable
@@ -556,17 +722,19 @@ func (c *Cluster) ID() api.ID {
 // new peer instead.
 //
 // The new peer ID will be passed to the consensus
-// component to be added to the peerset.
-func (c *Cluster) PeerAdd(pid peer.ID) (api.ID, error) {
+// component to be added to the peerset with the given role.
+// Non-voting peers receive the shared state and track pins, but
+// do not take part in consensus decisions.
+func (c *Cluster) PeerAdd(pid peer.ID, role api.PeerRole) (api.ID, error) {
 	// starting 10 nodes on the same box for testing
 	// causes deadlock and a global lock here
 	// seems to help.
 	c.paMux.Lock()
 	defer c.paMux.Unlock()
-	logger.Debugf("peerAdd called with %s", pid.Pretty())
+	logger.Debugf("peerAdd called with %s (%s)", pid.Pretty(), role)
 
 	// Log the new peer in the log so everyone gets it.
-	err := c.consensus.AddPeer(pid)
+	err := c.consensus.AddPeer(pid, role)
 	if err != nil {
 		logger.Error(err)
 		id := api.ID{ID: pid, Error: err.Error()}
@@ -604,7 +772,7 @@ func (c *Cluster) PeerAdd(pid peer.ID) (api.ID, error) {
 		logger.Debugf("%s addPeer: retrying to get ID from %s",
 			c.id.Pretty(), pid.Pretty())
 	}
-	logger.Info("Peer added ", pid.Pretty())
+	logger.Infof("Peer added as %s: %s", role, pid.Pretty())
 	return id, nil
 }
 
@@ -618,6 +786,14 @@ func (c *Cluster) PeerRemove(pid peer.ID) error {
 	logger.Infof("re-allocating all CIDs directly associated to %s", pid)
 	c.repinFromPeer(pid)
 
+	// A removed peer is no longer draining
+	if containsPeer(c.drainingPeers(), pid) {
+		err := c.logDrain(pid, false)
+		if err != nil {
+			logger.Warningf("error clearing the drain mark of %s: %s", pid.Pretty(), err)
+		}
+	}
+
 	err := c.consensus.RmPeer(pid)
 	if err != nil {
 		logger.Error(err)
@@ -630,7 +806,7 @@ func (c *Cluster) PeerRemove(pid peer.ID) error {
 // Join adds this peer to an existing cluster by bootstrapping to a
 // given multiaddress. It works by calling PeerAdd on the destination
 // cluster and making sure that the new peer is ready to discover and contact
-// the rest.
+// the rest. The peer requests the role given by its consensus component.
 func (c *Cluster) Join(addr ma.Multiaddr) error {
 	logger.Debugf("Join(%s)", addr)
 
@@ -655,7 +831,10 @@ func (c *Cluster) Join(addr ma.Multiaddr) error {
 	err = c.rpcClient.Call(pid,
 		"Cluster",
 		"PeerAdd",
-		peer.IDB58Encode(c.id),
+		api.PeerAddRequest{
+			PeerID: peer.IDB58Encode(c.id),
+			Role:   c.consensus.Role(),
+		},
 		&myID)
 	if err != nil {
 		logger.Error(err)
@@ -700,7 +879,8 @@ func (c *Cluster) Join(addr ma.Multiaddr) error {
 
 // StateSync syncs the consensus state to the Pin Tracker, ensuring
 // that every Cid in the shared state is tracked and that the Pin Tracker
-// is not tracking more Cids than it should.
+// is not tracking more Cids than it should. When this peer is the
+// leader, it also unpins any expired items.
 func (c *Cluster) StateSync() error {
 	cState, err := c.consensus.State()
 	if err != nil {
@@ -708,8 +888,6 @@ func (c *Cluster) StateSync() error {
 	}
 
 	logger.Debug("syncing state to tracker")
-	clusterPins := cState.List()
-
 	trackedPins := c.tracker.StatusAll()
 	trackedPinsMap := make(map[string]int)
 	for i, tpin := range trackedPins {
@@ -717,7 +895,12 @@ func (c *Cluster) StateSync() error {
 	}
 
 	// Track items which are not tracked
-	for _, pin := range clusterPins {
+	now := time.Now()
+	var expired []api.Pin
+	for pin := range cState.Stream(c.ctx) {
+		if pin.ExpiredAt(now) {
+			expired = append(expired, pin)
+		}
 		_, tracked := trackedPinsMap[pin.Cid.String()]
 		if !tracked {
 			logger.Debugf("StateSync: tracking %s, part of the shared state", pin.Cid)
@@ -725,6 +908,8 @@ func (c *Cluster) StateSync() error {
 		}
 	}
 
+	c.unpinExpired(expired)
+
 	// a. Untrack items which should not be tracked
 	// b. Track items which should not be remote as local
 	// c. Track items which should not be local as remote
@@ -749,6 +934,29 @@ func (c *Cluster) StateSync() error {
 	return nil
 }
 
+// unpinExpired unpins, through consensus, the given pins, whose expiration
+// date has passed. Only the leader does it, so that every expired pin
+// results in a single unpin operation. Expired pins are thus removed with
+// the granularity of the state_sync_interval.
+func (c *Cluster) unpinExpired(expired []api.Pin) {
+	if len(expired) == 0 {
+		return
+	}
+
+	leader, err := c.consensus.Leader()
+	if err != nil || leader != c.id {
+		return
+	}
+
+	for _, pin := range expired {
+		logger.Infof("unpinning %s: expired at %s", pin.Cid, pin.ExpireAt)
+		err := c.Unpin(pin.Cid)
+		if err != nil {
+			logger.Errorf("error unpinning expired pin %s: %s", pin.Cid, err)
+		}
+	}
+}
+
 // StatusAll returns the GlobalPinInfo for all tracked Cids in all peers.
 // If an error happens, the slice will contain as much information as
 // could be fetched from other peers.
@@ -865,6 +1073,24 @@ func (c *Cluster) Pins() []api.Pin {
 
 }
 
+// PinsFiltered returns the pins in the current global state which match
+// the given filter. Unlike Pins, it does not hold the whole state in
+// memory.
+func (c *Cluster) PinsFiltered(filter api.PinsFilter) []api.Pin {
+	cState, err := c.consensus.State()
+	if err != nil {
+		logger.Error(err)
+		return []api.Pin{}
+	}
+	pins := []api.Pin{}
+	for pin := range cState.Stream(c.ctx) {
+		if filter.Matches(pin) {
+			pins = append(pins, pin)
+		}
+	}
+	return pins
+}
+
 // PinGet returns information for a single Cid managed by Cluster.
 // The information is obtained from the current global state. The
 // returned api.Pin provides information about the allocations
@@ -899,11 +1125,62 @@ func (c *Cluster) PinGet(h cid.Cid) (api.Pin, error) {
 // this set then the remaining peers are allocated in order from the rest of
 // the cluster.  Priority allocations are best effort.  If any priority peers
 // are unavailable then Pin will simply allocate from the rest of the cluster.
+//
+// The UserAllocations option works in the same way, with the difference
+// that it is stored with the pin and therefore also considered when the
+// pin is re-allocated. When the replication factors are not set,
+// they default to the number of user allocations.
 func (c *Cluster) Pin(pin api.Pin) error {
 	_, err := c.pin(pin, []peer.ID{}, pin.Allocations)
 	return err
 }
 
+// SimulateAllocation runs the allocation process for the given pin, as Pin
+// would, but without committing anything to the shared state. It returns
+// the peers that would be allocated along with the metrics of every
+// cluster peer and the reason why they were allocated or excluded. An
+// error is returned when the pin itself is not valid. Allocation failures
+// are reported in the returned object.
+func (c *Cluster) SimulateAllocation(pin api.Pin) (api.AllocationSimulation, error) {
+	if pin.Cid == cid.Undef {
+		return api.AllocationSimulation{}, errors.New("bad pin object")
+	}
+
+	err := c.setupPin(&pin)
+	if err != nil {
+		return api.AllocationSimulation{}, err
+	}
+	if pin.Type != api.DataType {
+		return api.AllocationSimulation{}, errors.New("allocations can only be simulated for data pins")
+	}
+	// as in preparePin, so that peers without space are excluded
+	if c.needsSize(pin) {
+		pin.Size = c.dagSize(pin.Cid)
+	}
+	return c.simulateAllocation(pin, nil), nil
+}
+
+// PinPath resolves the mutable path in the given pin (an IPNS name or a
+// DNSLink, as /ipns/<name>) using the IPFS daemon and pins the Cid that
+// it points to. The path is stored with the pin and the leader
+// re-resolves it every PathResolveInterval. When the path points to a new
+// Cid, it is pinned with the same options, and the previous one is
+// unpinned after the PathUnpinGracePeriod. It returns the pin with the
+// resolved Cid.
+func (c *Cluster) PinPath(pin api.Pin) (api.Pin, error) {
+	name := strings.TrimPrefix(pin.Path, "/ipns/")
+	if name == pin.Path || name == "" {
+		return pin, fmt.Errorf("bad path %q: it should be /ipns/<name>", pin.Path)
+	}
+
+	ci, err := c.ipfs.Resolve(c.ctx, pin.Path)
+	if err != nil {
+		return pin, fmt.Errorf("error resolving %s: %s", pin.Path, err)
+	}
+	pin.Cid = ci
+	return pin, c.Pin(pin)
+}
+
 // sets the default replication factor in a pin when it's set to 0
 func (c *Cluster) setupReplicationFactor(pin *api.Pin) error {
 	rplMin := pin.ReplicationFactorMin
@@ -927,6 +1204,9 @@ func checkPinType(pin *api.Pin) error {
 		if pin.Reference != cid.Undef {
 			return errors.New("data pins should not reference other pins")
 		}
+		if pin.MaxDepth < -1 {
+			return errors.New("max depth must be -1 (recursive) or greater")
+		}
 	case api.ShardType:
 		if pin.MaxDepth != 1 {
 			return errors.New("must pin shards go depth 1")
@@ -959,11 +1239,37 @@ func checkPinType(pin *api.Pin) error {
 	return nil
 }
 
+// checks that the user allocations are valid peer IDs and sets the
+// replication factors to the number of user allocations when they
+// are not set.
+func setupUserAllocations(pin *api.Pin) error {
+	if len(pin.UserAllocations) == 0 {
+		return nil
+	}
+
+	for _, p := range pin.UserAllocations {
+		if _, err := peer.IDB58Decode(p); err != nil {
+			return fmt.Errorf("bad user allocation %s: %s", p, err)
+		}
+	}
+
+	if pin.ReplicationFactorMin == 0 && pin.ReplicationFactorMax == 0 {
+		pin.ReplicationFactorMin = len(pin.UserAllocations)
+		pin.ReplicationFactorMax = len(pin.UserAllocations)
+	}
+	return nil
+}
+
 // setupPin ensures that the Pin object is fit for pinning. We check
 // and set the replication factors and ensure that the pinType matches the
 // metadata consistently.
 func (c *Cluster) setupPin(pin *api.Pin) error {
-	err := c.setupReplicationFactor(pin)
+	err := setupUserAllocations(pin)
+	if err != nil {
+		return err
+	}
+
+	err = c.setupReplicationFactor(pin)
 	if err != nil {
 		return err
 	}
@@ -972,44 +1278,127 @@ func (c *Cluster) setupPin(pin *api.Pin) error {
 	if err == nil && existing.Type != pin.Type { // it exists
 		return errors.New("cannot repin CID with different tracking method, clear state with pin rm to proceed")
 	}
+	if pin.Size == 0 {
+		pin.Size = existing.Size
+	}
 	return checkPinType(pin)
 }
 
+// dagSize asks IPFS for the cumulative size of a DAG. It returns 0 when
+// the size cannot be obtained (i.e. the content is not reachable yet).
+func (c *Cluster) dagSize(h cid.Cid) uint64 {
+	ctx, cancel := context.WithTimeout(c.ctx, c.config.DagSizeTimeout)
+	defer cancel()
+	size, err := c.ipfs.DagSize(ctx, h)
+	if err != nil {
+		logger.Warningf("could not obtain the size of %s: %s", h, err)
+		return 0
+	}
+	return size
+}
+
+// needsSize returns whether the size of the given pin should be obtained
+// before allocating it, so that peers which cannot fit the content are
+// not allocated. This is only done for new pins: re-pinning an existing
+// one (i.e. when rebalancing or draining peers) keeps its current size
+// rather than waiting on IPFS.
+func (c *Cluster) needsSize(pin api.Pin) bool {
+	if pin.Size != 0 || pin.Type != api.DataType || pin.ReplicationFactorMin <= 0 {
+		return false
+	}
+	_, err := c.PinGet(pin.Cid)
+	return err != nil
+}
+
+// setSizes obtains the sizes of the given pins which need them using
+// several concurrent requests to IPFS.
+func (c *Cluster) setSizes(pins []api.Pin) {
+	idxs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < dagSizeWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idxs {
+				pins[i].Size = c.dagSize(pins[i].Cid)
+			}
+		}()
+	}
+
+	for i := range pins {
+		if c.needsSize(pins[i]) {
+			idxs <- i
+		}
+	}
+	close(idxs)
+	wg.Wait()
+}
+
 // pin performs the actual pinning and supports a blacklist to be
 // able to evacuate a node and returns whether the pin was submitted
 // to the consensus layer or skipped (due to error or to the fact
 // that it was already valid).
 func (c *Cluster) pin(pin api.Pin, blacklist []peer.ID, prioritylist []peer.ID) (bool, error) {
+	pin, ok, err := c.preparePin(pin, blacklist, prioritylist)
+	if err != nil || !ok {
+		return false, err
+	}
+	start := time.Now()
+	err = c.consensus.LogPin(pin)
+	c.observeCommit("pin", start)
+	return true, err
+}
+
+// preparePin sets up the given pin and its allocations and returns it
+// along with whether it should be submitted to the consensus layer
+// or skipped (because it is already valid).
+func (c *Cluster) preparePin(pin api.Pin, blacklist []peer.ID, prioritylist []peer.ID) (api.Pin, bool, error) {
 	if pin.Cid == cid.Undef {
-		return false, errors.New("bad pin object")
+		return pin, false, errors.New("bad pin object")
 	}
 
 	// setup pin might produce some side-effects to our pin
 	err := c.setupPin(&pin)
 	if err != nil {
-		return false, err
+		return pin, false, err
+	}
+	if c.needsSize(pin) {
+		pin.Size = c.dagSize(pin.Cid)
 	}
+	return c.allocatePin(pin, blacklist, prioritylist)
+}
+
+// allocatePin sets the allocations of a pin which has been set up and
+// returns it along with whether it should be submitted to the consensus
+// layer.
+func (c *Cluster) allocatePin(pin api.Pin, blacklist []peer.ID, prioritylist []peer.ID) (api.Pin, bool, error) {
 	if pin.Type == api.MetaType {
-		return true, c.consensus.LogPin(pin)
+		return pin, true, nil
 	}
 
+	// User allocations go first in the priority list.
+	prioritylist = append(api.StringsToPeers(pin.UserAllocations), prioritylist...)
+
 	allocs, err := c.allocate(
 		pin.Cid,
+		pin.Size,
 		pin.ReplicationFactorMin,
 		pin.ReplicationFactorMax,
 		blacklist,
 		prioritylist,
 	)
 	if err != nil {
-		return false, err
+		return pin, false, err
 	}
 	pin.Allocations = allocs
 
-	if curr, _ := c.PinGet(pin.Cid); curr.Equals(pin) {
+	curr, _ := c.PinGet(pin.Cid)
+	if curr.Equals(pin) {
 		// skip pinning
 		logger.Debugf("pinning %s skipped: already correctly allocated", pin.Cid)
-		return false, nil
+		return pin, false, nil
 	}
+	c.addPendingAllocations(pin, curr.Allocations)
 
 	if len(pin.Allocations) == 0 {
 		logger.Infof("IPFS cluster pinning %s everywhere:", pin.Cid)
@@ -1017,7 +1406,7 @@ func (c *Cluster) pin(pin api.Pin, blacklist []peer.ID, prioritylist []peer.ID)
 		logger.Infof("IPFS cluster pinning %s on %s:", pin.Cid, pin.Allocations)
 	}
 
-	return true, c.consensus.LogPin(pin)
+	return pin, true, nil
 }
 
 // Unpin makes the cluster Unpin a Cid. This implies adding the Cid
@@ -1028,51 +1417,218 @@ func (c *Cluster) pin(pin api.Pin, blacklist []peer.ID, prioritylist []peer.ID)
 // of underlying IPFS daemon unpinning operations.
 func (c *Cluster) Unpin(h cid.Cid) error {
 	logger.Info("IPFS cluster unpinning:", h)
+	unpins, err := c.prepareUnpin(h)
+	if err != nil {
+		return err
+	}
+
+	for _, pin := range unpins {
+		start := time.Now()
+		err = c.consensus.LogUnpin(pin)
+		c.observeCommit("unpin", start)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareUnpin returns the pins that need to be removed from the
+// shared state in order to unpin the given Cid. For meta pins, these
+// include the clusterDAG and the shards it references.
+func (c *Cluster) prepareUnpin(h cid.Cid) ([]api.Pin, error) {
 	pin, err := c.PinGet(h)
 	if err != nil {
-		return fmt.Errorf("cannot unpin pin uncommitted to state: %s", err)
+		return nil, fmt.Errorf("cannot unpin pin uncommitted to state: %s", err)
 	}
 
 	switch pin.Type {
 	case api.DataType:
-		return c.consensus.LogUnpin(pin)
+		return []api.Pin{pin}, nil
 	case api.ShardType:
 		err := "cannot unpin a shard direclty. Unpin content root CID instead."
-		return errors.New(err)
+		return nil, errors.New(err)
 	case api.MetaType:
 		// Unpin cluster dag and referenced shards
-		err := c.unpinClusterDag(pin)
+		unpins, err := c.unpinClusterDag(pin)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		return c.consensus.LogUnpin(pin)
+		return append(unpins, pin), nil
 	case api.ClusterDAGType:
 		err := "cannot unpin a Cluster DAG directly. Unpin content root CID instead."
-		return errors.New(err)
+		return nil, errors.New(err)
 	default:
-		return errors.New("unrecognized pin type")
+		return nil, errors.New("unrecognized pin type")
 	}
 }
 
-// unpinClusterDag unpins the clusterDAG metadata node and the shard metadata
-// nodes that it references.  It handles the case where multiple parents
-// reference the same metadata node, only unpinning those nodes without
-// existing references
-func (c *Cluster) unpinClusterDag(metaPin api.Pin) error {
-	cids, err := c.cidsFromMetaPin(metaPin.Cid)
+// PinUpdate replaces the pin for the "from" Cid with a pin for the "to"
+// Cid, which keeps the allocations, name and options of the original one,
+// as a single consensus operation. The size is obtained again for the new
+// Cid and the path is not kept, since it does not resolve to it. The peers
+// holding the original pin use the IPFS "pin update" operation so that
+// only the blocks which differ are fetched. It returns the new pin.
+//
+// As with Pin, PinUpdate does not reflect the success or failure of the
+// underlying IPFS daemon operations.
+func (c *Cluster) PinUpdate(from, to cid.Cid) (api.Pin, error) {
+	if from.Equals(to) {
+		return api.Pin{}, errors.New("cannot update a pin to the same Cid")
+	}
+
+	existing, err := c.PinGet(from)
+	if err != nil {
+		return api.Pin{}, fmt.Errorf("cannot update pin uncommitted to state: %s", err)
+	}
+	if existing.Type != api.DataType {
+		return api.Pin{}, errors.New("only data pins can be updated")
+	}
+	if _, err := c.PinGet(to); err == nil {
+		return api.Pin{}, fmt.Errorf("%s is already pinned", to)
+	}
+
+	pin := existing
+	pin.Cid = to
+	pin.PinUpdate = from.String()
+	pin.Path = ""
+	pin.Size = 0
+	if c.needsSize(pin) {
+		pin.Size = c.dagSize(pin.Cid)
+	}
+	logger.Infof("IPFS cluster updating %s to %s", from, to)
+	start := time.Now()
+	err = c.consensus.LogUpdate(pin)
+	c.observeCommit("update", start)
+	return pin, err
+}
+
+// untrackUpdated is used instead of Untrack for a pin which has been
+// replaced by an update. The new pin keeps its allocations, so when it is
+// allocated to this peer, the replaced pin stays tracked until the new one
+// is pinned (see untrackReplaced). This way it is not unpinned first and
+// IPFS can update it in place. Otherwise it is untracked right away.
+func (c *Cluster) untrackUpdated(pin api.Pin) error {
+	allocatedHere := containsPeer(pin.Allocations, c.id) || pin.ReplicationFactorMin == -1
+	if allocatedHere {
+		return nil
+	}
+	return c.tracker.Untrack(pin.Cid)
+}
+
+// ipfsPin pins the given pin in IPFS. Pins which replace another one
+// (PinUpdate option set) are pinned with the IPFS "pin update" operation
+// when they are recursive, falling back to a regular pin when it fails.
+// The replaced pin is then untracked (see untrackReplaced).
+func (c *Cluster) ipfsPin(ctx context.Context, pin api.Pin) error {
+	if pin.PinUpdate == "" {
+		return c.ipfs.Pin(ctx, pin.Cid, pin.MaxDepth)
+	}
+
+	from, err := cid.Decode(pin.PinUpdate)
 	if err != nil {
 		return err
 	}
+	if pin.MaxDepth != -1 {
+		err = c.ipfs.Pin(ctx, pin.Cid, pin.MaxDepth)
+	} else if err = c.ipfs.PinUpdate(ctx, from, pin.Cid); err != nil {
+		logger.Debugf("pin update from %s failed. Pinning %s: %s", from, pin.Cid, err)
+		err = c.ipfs.Pin(ctx, pin.Cid, pin.MaxDepth)
+	}
+	if err != nil {
+		return err
+	}
+	c.untrackReplaced(from)
+	return nil
+}
+
+// untrackReplaced untracks a pin replaced by an update once the new pin
+// has been pinned, unless it is still part of the shared state (i.e.
+// during the grace period of updated path pins). If the new pin cannot
+// be pinned, the replaced one is untracked by StateSync.
+func (c *Cluster) untrackReplaced(from cid.Cid) {
+	if _, err := c.PinGet(from); err == nil {
+		return
+	}
+	err := c.tracker.Untrack(from)
+	if err != nil {
+		logger.Errorf("error untracking %s after an update: %s", from, err)
+	}
+}
+
+// PinBatch pins and unpins several Cids at once. All the operations
+// are prepared (allocations are selected, pins are checked) before
+// anything is submitted, and then they are committed to the shared
+// state as a single consensus operation. Unpins are applied before
+// pins. If any of the operations cannot be prepared, nothing is
+// committed and an error is returned.
+//
+// As with Pin and Unpin, PinBatch does not reflect the success or
+// failure of the underlying IPFS daemon operations.
+func (c *Cluster) PinBatch(b api.PinBatch) error {
+	batch := api.PinBatch{}
+	for _, unpin := range b.Unpins {
+		unpins, err := c.prepareUnpin(unpin.Cid)
+		if err != nil {
+			return fmt.Errorf("%s: %s", unpin.Cid, err)
+		}
+		batch.Unpins = append(batch.Unpins, unpins...)
+	}
+
+	pins := make([]api.Pin, len(b.Pins))
+	for i, pin := range b.Pins {
+		if pin.Cid == cid.Undef {
+			return errors.New("bad pin object")
+		}
+		err := c.setupPin(&pin)
+		if err != nil {
+			return fmt.Errorf("%s: %s", pin.Cid, err)
+		}
+		pins[i] = pin
+	}
+
+	// Sizes are obtained for all the new pins at once rather than
+	// one by one.
+	c.setSizes(pins)
+
+	for i, pin := range pins {
+		pin, ok, err := c.allocatePin(pin, []peer.ID{}, b.Pins[i].Allocations)
+		if err != nil {
+			return fmt.Errorf("%s: %s", pin.Cid, err)
+		}
+		if ok {
+			batch.Pins = append(batch.Pins, pin)
+		}
+	}
+
+	if len(batch.Pins) == 0 && len(batch.Unpins) == 0 {
+		return nil
+	}
+	logger.Infof("IPFS cluster committing batch: %d pins, %d unpins",
+		len(batch.Pins), len(batch.Unpins))
+	start := time.Now()
+	err := c.consensus.LogBatch(batch)
+	c.observeCommit("batch", start)
+	return err
+}
+
+// unpinClusterDag returns the pins for the clusterDAG metadata node and the
+// shard metadata nodes that it references, so that they can be unpinned.
+// It handles the case where multiple parents reference the same metadata
+// node, only unpinning those nodes without existing references
+func (c *Cluster) unpinClusterDag(metaPin api.Pin) ([]api.Pin, error) {
+	cids, err := c.cidsFromMetaPin(metaPin.Cid)
+	if err != nil {
+		return nil, err
+	}
 
 	// TODO: FIXME: potentially unpinning shards which are referenced
 	// by other clusterDAGs.
+	unpins := make([]api.Pin, 0, len(cids))
 	for _, ci := range cids {
-		err = c.consensus.LogUnpin(api.PinCid(ci))
-		if err != nil {
-			return err
-		}
+		unpins = append(unpins, api.PinCid(ci))
 	}
-	return nil
+	return unpins, nil
 }
 
 // AddFile adds a file to the ipfs daemons of the cluster.  The ipfs importer
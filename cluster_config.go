@@ -32,6 +32,13 @@ const (
 	DefaultIPFSSyncInterval    = 130 * time.Second
 	DefaultMonitorPingInterval = 15 * time.Second
 	DefaultPeerWatchInterval   = 5 * time.Second
+	DefaultPathResolveInterval = 10 * time.Minute
+	DefaultPathUnpinGrace      = time.Hour
+	DefaultRebalanceInterval   = 0
+	DefaultRebalanceMaxMoves   = 10
+	DefaultRebalanceThreshold  = 0.2
+	DefaultRebalanceDryRun     = false
+	DefaultDagSizeTimeout      = 10 * time.Second
 	DefaultReplicationFactor   = -1
 	DefaultLeaveOnShutdown     = false
 	DefaultDisableRepinning    = false
@@ -120,6 +127,38 @@ type Config struct {
 	// Peerstore file specifies the file on which we persist the
 	// libp2p host peerstore addresses. This file is regularly saved.
 	PeerstoreFile string
+
+	// PathResolveInterval is the frequency with which the leader
+	// re-resolves the paths (i.e. IPNS names) of the pins made by path
+	// and updates them when they point to a new Cid.
+	PathResolveInterval time.Duration
+
+	// PathUnpinGracePeriod is how long the Cid previously pointed by
+	// a path stays pinned after the path has been updated to a new one.
+	PathUnpinGracePeriod time.Duration
+
+	// RebalanceInterval is the frequency with which the leader looks
+	// for skewed allocations and moves pins from over-full peers to
+	// under-used ones. 0 disables rebalancing.
+	RebalanceInterval time.Duration
+
+	// RebalanceMaxMoves is the maximum number of pins moved on every
+	// rebalancing round.
+	RebalanceMaxMoves int
+
+	// RebalanceThreshold is how far, as a fraction of the average,
+	// the number of allocations of a peer must be from the average
+	// for the peer to be considered over-full or under-used.
+	RebalanceThreshold float64
+
+	// RebalanceDryRun makes rebalancing only log the moves that
+	// would be performed.
+	RebalanceDryRun bool
+
+	// DagSizeTimeout is how long to wait for IPFS to provide the
+	// size of the content being pinned. When it cannot be obtained,
+	// the content is allocated without checking the free space.
+	DagSizeTimeout time.Duration
 }
 
 // configJSON represents a Cluster configuration as it will look when it is
@@ -143,6 +182,13 @@ type configJSON struct {
 	PeerWatchInterval    string   `json:"peer_watch_interval"`
 	DisableRepinning     bool     `json:"disable_repinning"`
 	PeerstoreFile        string   `json:"peerstore_file,omitempty"`
+	PathResolveInterval  string   `json:"path_resolve_interval"`
+	PathUnpinGracePeriod string   `json:"path_unpin_grace_period"`
+	RebalanceInterval    string   `json:"rebalance_interval"`
+	RebalanceMaxMoves    int      `json:"rebalance_max_moves"`
+	RebalanceThreshold   *float64 `json:"rebalance_threshold,omitempty"`
+	RebalanceDryRun      bool     `json:"rebalance_dry_run"`
+	DagSizeTimeout       string   `json:"dag_size_timeout"`
 }
 
 // ConfigKey returns a human-readable string to identify
@@ -218,6 +264,30 @@ func (cfg *Config) Validate() error {
 		return errors.New("cluster.peer_watch_interval is invalid")
 	}
 
+	if cfg.PathResolveInterval <= 0 {
+		return errors.New("cluster.path_resolve_interval is invalid")
+	}
+
+	if cfg.PathUnpinGracePeriod <= 0 {
+		return errors.New("cluster.path_unpin_grace_period is invalid")
+	}
+
+	if cfg.RebalanceInterval < 0 {
+		return errors.New("cluster.rebalance_interval is invalid")
+	}
+
+	if cfg.RebalanceMaxMoves <= 0 {
+		return errors.New("cluster.rebalance_max_moves is invalid")
+	}
+
+	if cfg.RebalanceThreshold < 0 || cfg.RebalanceThreshold >= 1 {
+		return errors.New("cluster.rebalance_threshold must be between 0 and 1")
+	}
+
+	if cfg.DagSizeTimeout <= 0 {
+		return errors.New("cluster.dag_size_timeout is invalid")
+	}
+
 	rfMax := cfg.ReplicationFactorMax
 	rfMin := cfg.ReplicationFactorMin
 
@@ -267,6 +337,13 @@ func (cfg *Config) setDefaults() {
 	cfg.PeerWatchInterval = DefaultPeerWatchInterval
 	cfg.DisableRepinning = DefaultDisableRepinning
 	cfg.PeerstoreFile = "" // empty so it gets ommited.
+	cfg.PathResolveInterval = DefaultPathResolveInterval
+	cfg.PathUnpinGracePeriod = DefaultPathUnpinGrace
+	cfg.RebalanceInterval = DefaultRebalanceInterval
+	cfg.RebalanceMaxMoves = DefaultRebalanceMaxMoves
+	cfg.RebalanceThreshold = DefaultRebalanceThreshold
+	cfg.RebalanceDryRun = DefaultRebalanceDryRun
+	cfg.DagSizeTimeout = DefaultDagSizeTimeout
 }
 
 // LoadJSON receives a raw json-formatted configuration and
@@ -366,14 +443,30 @@ for more information.`)
 	ipfsSyncInterval := parseDuration(jcfg.IPFSSyncInterval)
 	monitorPingInterval := parseDuration(jcfg.MonitorPingInterval)
 	peerWatchInterval := parseDuration(jcfg.PeerWatchInterval)
+	pathResolveInterval := parseDuration(jcfg.PathResolveInterval)
+	pathUnpinGracePeriod := parseDuration(jcfg.PathUnpinGracePeriod)
+	rebalanceInterval := parseDuration(jcfg.RebalanceInterval)
+	dagSizeTimeout := parseDuration(jcfg.DagSizeTimeout)
 
 	config.SetIfNotDefault(stateSyncInterval, &cfg.StateSyncInterval)
 	config.SetIfNotDefault(ipfsSyncInterval, &cfg.IPFSSyncInterval)
 	config.SetIfNotDefault(monitorPingInterval, &cfg.MonitorPingInterval)
 	config.SetIfNotDefault(peerWatchInterval, &cfg.PeerWatchInterval)
+	config.SetIfNotDefault(pathResolveInterval, &cfg.PathResolveInterval)
+	config.SetIfNotDefault(pathUnpinGracePeriod, &cfg.PathUnpinGracePeriod)
+	config.SetIfNotDefault(rebalanceInterval, &cfg.RebalanceInterval)
+	config.SetIfNotDefault(jcfg.RebalanceMaxMoves, &cfg.RebalanceMaxMoves)
+	config.SetIfNotDefault(dagSizeTimeout, &cfg.DagSizeTimeout)
 
 	cfg.LeaveOnShutdown = jcfg.LeaveOnShutdown
 	cfg.DisableRepinning = jcfg.DisableRepinning
+	cfg.RebalanceDryRun = jcfg.RebalanceDryRun
+
+	// 0 is a valid threshold, so it is only left as default when
+	// missing.
+	if jcfg.RebalanceThreshold != nil {
+		cfg.RebalanceThreshold = *jcfg.RebalanceThreshold
+	}
 
 	return cfg.Validate()
 }
@@ -411,6 +504,13 @@ func (cfg *Config) ToJSON() (raw []byte, err error) {
 	jcfg.PeerWatchInterval = cfg.PeerWatchInterval.String()
 	jcfg.DisableRepinning = cfg.DisableRepinning
 	jcfg.PeerstoreFile = cfg.PeerstoreFile
+	jcfg.PathResolveInterval = cfg.PathResolveInterval.String()
+	jcfg.PathUnpinGracePeriod = cfg.PathUnpinGracePeriod.String()
+	jcfg.RebalanceInterval = cfg.RebalanceInterval.String()
+	jcfg.RebalanceMaxMoves = cfg.RebalanceMaxMoves
+	jcfg.RebalanceThreshold = &cfg.RebalanceThreshold
+	jcfg.RebalanceDryRun = cfg.RebalanceDryRun
+	jcfg.DagSizeTimeout = cfg.DagSizeTimeout.String()
 
 	raw, err = json.MarshalIndent(jcfg, "", "    ")
 	return
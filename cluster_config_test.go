@@ -188,6 +188,25 @@ func TestLoadJSON(t *testing.T) {
 		}
 	})
 
+	t.Run("rebalance threshold", func(t *testing.T) {
+		cfg, err := loadJSON2(t, func(j *configJSON) { j.RebalanceThreshold = nil })
+		if err != nil {
+			t.Error(err)
+		}
+		if cfg.RebalanceThreshold != DefaultRebalanceThreshold {
+			t.Error("expected default rebalance_threshold")
+		}
+
+		zero := 0.0
+		cfg, err = loadJSON2(t, func(j *configJSON) { j.RebalanceThreshold = &zero })
+		if err != nil {
+			t.Error(err)
+		}
+		if cfg.RebalanceThreshold != 0 {
+			t.Error("expected a rebalance_threshold of 0")
+		}
+	})
+
 	t.Run("env var override", func(t *testing.T) {
 		os.Setenv("CLUSTER_PEERNAME", "envsetpeername")
 		cfg := &Config{}
@@ -246,4 +265,22 @@ func TestValidate(t *testing.T) {
 	if cfg.Validate() == nil {
 		t.Fatal("expected error validating")
 	}
+
+	cfg.Default()
+	cfg.PathResolveInterval = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.RebalanceThreshold = 1.5
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.DagSizeTimeout = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
 }
@@ -1,11 +1,13 @@
 package ipfscluster
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -50,6 +52,7 @@ type mockConnector struct {
 
 	pins   sync.Map
 	blocks sync.Map
+	names  sync.Map
 }
 
 func (ipfs *mockConnector) ID() (api.IPFSID, error) {
@@ -63,6 +66,14 @@ func (ipfs *mockConnector) Pin(ctx context.Context, c cid.Cid, maxDepth int) err
 	return nil
 }
 
+func (ipfs *mockConnector) PinUpdate(ctx context.Context, from, to cid.Cid) error {
+	if _, ok := ipfs.pins.Load(from.String()); !ok {
+		return errors.New("from is not pinned")
+	}
+	ipfs.pins.Store(to.String(), -1)
+	return nil
+}
+
 func (ipfs *mockConnector) Unpin(ctx context.Context, c cid.Cid) error {
 	ipfs.pins.Delete(c.String())
 	return nil
@@ -73,25 +84,13 @@ func (ipfs *mockConnector) PinLsCid(ctx context.Context, c cid.Cid) (api.IPFSPin
 	if !ok {
 		return api.IPFSPinStatusUnpinned, nil
 	}
-	depth := dI.(int)
-	if depth == 0 {
-		return api.IPFSPinStatusDirect, nil
-	}
-	return api.IPFSPinStatusRecursive, nil
+	return api.IPFSPinStatusWithMaxDepth(dI.(int)), nil
 }
 
 func (ipfs *mockConnector) PinLs(ctx context.Context, filter string) (map[string]api.IPFSPinStatus, error) {
 	m := make(map[string]api.IPFSPinStatus)
-	var st api.IPFSPinStatus
 	ipfs.pins.Range(func(k, v interface{}) bool {
-		switch v.(int) {
-		case 0:
-			st = api.IPFSPinStatusDirect
-		default:
-			st = api.IPFSPinStatusRecursive
-		}
-
-		m[k.(string)] = st
+		m[k.(string)] = api.IPFSPinStatusWithMaxDepth(v.(int))
 		return true
 	})
 
@@ -122,6 +121,18 @@ func (ipfs *mockConnector) BlockGet(c cid.Cid) ([]byte, error) {
 	return d.([]byte), nil
 }
 
+func (ipfs *mockConnector) Resolve(ctx context.Context, path string) (cid.Cid, error) {
+	c, ok := ipfs.names.Load(path)
+	if !ok {
+		return cid.Undef, errors.New("cannot resolve path")
+	}
+	return c.(cid.Cid), nil
+}
+
+func (ipfs *mockConnector) DagSize(ctx context.Context, c cid.Cid) (uint64, error) {
+	return 1000, nil
+}
+
 func testingCluster(t *testing.T) (*Cluster, *mockAPI, *mockConnector, state.State, PinTracker) {
 	clusterCfg, _, _, _, consensusCfg, maptrackerCfg, statelesstrackerCfg, bmonCfg, psmonCfg, _ := testingConfigs()
 
@@ -159,7 +170,7 @@ func testingCluster(t *testing.T) (*Cluster, *mockAPI, *mockConnector, state.Sta
 		tracker,
 		mon,
 		alloc,
-		inf,
+		[]Informer{inf},
 	)
 	if err != nil {
 		t.Fatal("cannot create cluster:", err)
@@ -219,6 +230,208 @@ func TestClusterStateSync(t *testing.T) {
 	}
 }
 
+func TestClusterPinBadUserAllocations(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	pin := api.PinCid(c)
+	pin.UserAllocations = []string{"abc"}
+	err := cl.Pin(pin)
+	if err == nil {
+		t.Error("expected an error with bad user allocations")
+	}
+}
+
+func TestClusterStateSyncExpiredPins(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	expired := api.PinCid(c1)
+	expired.ExpireAt = time.Now().Add(-time.Minute)
+	notExpired := api.PinCid(c2)
+	notExpired.ExpireAt = time.Now().Add(time.Hour)
+
+	for _, p := range []api.Pin{expired, notExpired} {
+		err := cl.Pin(p)
+		if err != nil {
+			t.Fatal("pin should have worked:", err)
+		}
+	}
+
+	err := cl.StateSync()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cl.PinGet(c1); err == nil {
+		t.Error("expired pin should have been unpinned")
+	}
+	if _, err := cl.PinGet(c2); err != nil {
+		t.Error("pin should not have expired")
+	}
+}
+
+func TestClusterPinPath(t *testing.T) {
+	cl, _, ipfs, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	ipfs.names.Store(test.TestIPNSPath, c1)
+
+	pin := api.PinCid(cid.Undef)
+	pin.Path = test.TestIPNSPath
+	pin, err := cl.PinPath(pin)
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+	if !pin.Cid.Equals(c1) {
+		t.Error("the path should have been resolved to the cid")
+	}
+
+	stored, err := cl.PinGet(c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Path != test.TestIPNSPath {
+		t.Error("the path should be stored with the pin")
+	}
+
+	pin.Path = "/ipns/unknown"
+	_, err = cl.PinPath(pin)
+	if err == nil {
+		t.Error("expected an error resolving the path")
+	}
+
+	pin.Path = "/ipfs/" + test.TestCid1
+	_, err = cl.PinPath(pin)
+	if err == nil {
+		t.Error("expected an error for a non-mutable path")
+	}
+}
+
+func TestClusterResolvePaths(t *testing.T) {
+	cl, _, ipfs, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	ipfs.names.Store(test.TestIPNSPath, c1)
+
+	pin := api.PinCid(cid.Undef)
+	pin.Path = test.TestIPNSPath
+	_, err := cl.PinPath(pin)
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+
+	// nothing changes when the path points to the same cid
+	cl.resolvePaths()
+	if pins := cl.Pins(); len(pins) != 1 {
+		t.Fatal("expected a single pin")
+	}
+
+	ipfs.names.Store(test.TestIPNSPath, c2)
+	cl.resolvePaths()
+
+	newPin, err := cl.PinGet(c2)
+	if err != nil {
+		t.Fatal("the new cid should have been pinned:", err)
+	}
+	if newPin.Path != test.TestIPNSPath {
+		t.Error("the new pin should carry the path")
+	}
+
+	oldPin, err := cl.PinGet(c1)
+	if err != nil {
+		t.Fatal("the old cid should be kept during the grace period:", err)
+	}
+	if oldPin.Path != "" {
+		t.Error("the old pin should no longer carry the path")
+	}
+	if oldPin.ExpireAt.IsZero() || oldPin.ExpiredAt(time.Now()) {
+		t.Error("the old pin should expire after the grace period")
+	}
+	if !oldPin.ExpiredAt(time.Now().Add(cl.config.PathUnpinGracePeriod + time.Second)) {
+		t.Error("the old pin should expire at the end of the grace period")
+	}
+}
+
+func TestClusterPinUpdate(t *testing.T) {
+	cl, _, ipfs, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+
+	_, err := cl.PinUpdate(c1, c2)
+	if err == nil {
+		t.Error("expected an error updating an unpinned cid")
+	}
+
+	pin := api.PinCid(c1)
+	pin.Name = "updated"
+	pin.Metadata = map[string]string{"a": "b"}
+	pin.Path = "/ipns/example.org"
+	pin.Size = 50
+	pin.ReplicationFactorMin = 1
+	pin.ReplicationFactorMax = 1
+	err = cl.Pin(pin)
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+	original, _ := cl.PinGet(c1)
+	pinDelay()
+
+	_, err = cl.PinUpdate(c1, c1)
+	if err == nil {
+		t.Error("expected an error updating to the same cid")
+	}
+
+	_, err = cl.PinUpdate(c1, c2)
+	if err != nil {
+		t.Fatal("update should have worked:", err)
+	}
+
+	if _, err := cl.PinGet(c1); err == nil {
+		t.Error("the original pin should have been removed")
+	}
+	updated, err := cl.PinGet(c2)
+	if err != nil {
+		t.Fatal("the new pin should be in the state:", err)
+	}
+	if updated.Name != "updated" || updated.Metadata["a"] != "b" {
+		t.Error("the new pin should keep the options of the original one")
+	}
+	if updated.PinUpdate != "" {
+		t.Error("the PinUpdate option should not be kept in the state")
+	}
+	if updated.Path != "" {
+		t.Error("the path of the original pin should not be kept")
+	}
+	if updated.Size != 1000 {
+		t.Error("the size of the new pin should have been obtained:", updated.Size)
+	}
+	if len(updated.Allocations) != len(original.Allocations) {
+		t.Error("the new pin should keep the allocations of the original one")
+	}
+
+	pinDelay()
+	if _, ok := ipfs.pins.Load(test.TestCid2); !ok {
+		t.Error("the new pin should have been pinned")
+	}
+	if _, ok := ipfs.pins.Load(test.TestCid1); ok {
+		t.Error("the original pin should have been unpinned")
+	}
+}
+
 func TestClusterID(t *testing.T) {
 	cl, _, _, _, _ := testingCluster(t)
 	defer cleanRaft()
@@ -260,6 +473,248 @@ func TestClusterPin(t *testing.T) {
 	}
 }
 
+func TestClusterObservations(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cl.Pin(api.PinCid(c))
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+	var id api.IDSerial
+	err = cl.rpcClient.Call("", "Cluster", "ID", struct{}{}, &id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, _ := cid.Decode(test.TestCid2)
+	err = cl.rpcClient.Call("", "Cluster", "Unpin", api.PinCid(c2).ToSerial(), &struct{}{})
+	if err == nil {
+		t.Fatal("expected an error unpinning something not pinned")
+	}
+	c3, _ := cid.Decode(test.TestCid3)
+	err = cl.PinBatch(api.PinBatch{Pins: []api.Pin{api.PinCid(c3)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = cl.WriteObservations(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		`cluster_consensus_commit_duration_seconds_count{op="pin"} 1`,
+		`cluster_consensus_commit_duration_seconds_count{op="batch"} 1`,
+		`cluster_rpc_calls_total{method="ID"}`,
+		`cluster_rpc_errors_total{method="Unpin"} 1`,
+		`cluster_pintracker_operations{status="pin_queued"}`,
+		`cluster_consensus_leader_changes_total 0`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %s in:\n%s", expected, out)
+		}
+	}
+}
+
+func TestClusterPinSize(t *testing.T) {
+	cl, _, _, st, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	pinWithSize := func(c cid.Cid) error {
+		pin := api.PinCid(c)
+		pin.ReplicationFactorMin = 1
+		pin.ReplicationFactorMax = 1
+		return cl.Pin(pin)
+	}
+
+	c1, _ := cid.Decode(test.TestCid1)
+	err := pinWithSize(c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pin, _ := st.Get(c1)
+	if pin.Size != 1000 {
+		t.Errorf("expected the size of the pin to be set: %d", pin.Size)
+	}
+
+	freeSpace := func(v string) {
+		m := api.Metric{
+			Name:  freeSpaceMetricName,
+			Peer:  cl.id,
+			Value: v,
+			Valid: true,
+		}
+		m.SetTTL(time.Minute)
+		cl.monitor.LogMetric(m)
+	}
+
+	freeSpace("500")
+	c2, _ := cid.Decode(test.TestCid2)
+	err = pinWithSize(c2)
+	if err == nil {
+		t.Error("the only peer should not have enough space")
+	}
+
+	freeSpace("1500")
+	err = pinWithSize(c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the pending allocation of c2 leaves 500 bytes
+	c3, _ := cid.Decode(test.TestCid3)
+	err = pinWithSize(c3)
+	if err == nil {
+		t.Error("pending allocations should be discounted")
+	}
+
+	freeSpace("1500")
+	err = pinWithSize(c3)
+	if err != nil {
+		t.Error("a newer metric should replace pending allocations:", err)
+	}
+
+	// simulations look up the size too
+	freeSpace("500")
+	c4, _ := cid.Decode(test.TestCid4)
+	pin = api.PinCid(c4)
+	pin.ReplicationFactorMin = 1
+	pin.ReplicationFactorMax = 1
+	sim, err := cl.SimulateAllocation(pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sim.Error == "" || len(sim.Candidates) != 1 ||
+		!strings.Contains(sim.Candidates[0].Reason, "not enough free space") {
+		t.Errorf("the only peer should not have enough space: %+v", sim)
+	}
+}
+
+func TestClusterSimulateAllocation(t *testing.T) {
+	cl, _, _, st, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	sim, err := cl.SimulateAllocation(api.PinCid(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sim.Allocations) != 0 || sim.Error != "" {
+		t.Error("expected to allocate everywhere")
+	}
+	if len(sim.Candidates) != 1 || !sim.Candidates[0].Allocated {
+		t.Error("this peer should be allocated")
+	}
+
+	pin := api.PinCid(c)
+	pin.ReplicationFactorMin = 2
+	pin.ReplicationFactorMax = 2
+	sim, err = cl.SimulateAllocation(pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sim.Error == "" {
+		t.Error("expected an allocation error with a single peer")
+	}
+	if len(sim.Candidates) != 1 || sim.Candidates[0].Allocated || sim.Candidates[0].Reason == "" {
+		t.Error("the candidate should be explained")
+	}
+
+	if st.Has(c) {
+		t.Error("simulations should not pin anything")
+	}
+
+	_, err = cl.SimulateAllocation(api.PinCid(cid.Undef))
+	if err == nil {
+		t.Error("expected an error with a bad pin")
+	}
+}
+
+func TestClusterPeerDrain(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	pin := api.PinCid(c)
+	pin.ReplicationFactorMin = 1
+	pin.ReplicationFactorMax = 1
+	err := cl.Pin(pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := cl.PeerDrain(cl.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Draining || status.Remaining != 1 {
+		t.Error("the peer should be draining with one pin")
+	}
+
+	// there is nowhere else to move the pin
+	for i := 0; status.InProgress && i < 50; i++ {
+		time.Sleep(100 * time.Millisecond)
+		status, _ = cl.PeerDrainStatus(cl.id)
+	}
+	if status.InProgress || status.Total != 1 || status.Failed != 1 || status.Remaining != 1 {
+		t.Errorf("unexpected drain status: %+v", status)
+	}
+
+	sim, err := cl.SimulateAllocation(pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sim.Error == "" || sim.Candidates[0].Reason != "draining" {
+		t.Error("draining peers should not be allocated")
+	}
+
+	err = cl.PeerUndrain(cl.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _ = cl.PeerDrainStatus(cl.id)
+	if status.Draining {
+		t.Error("the drain mark should have been removed")
+	}
+}
+
+func TestClusterPinMaxDepth(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	pin := api.PinCid(c)
+	pin.MaxDepth = 2
+	err := cl.Pin(pin)
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+
+	pinDelay()
+
+	pinfo := cl.StatusLocal(c)
+	if pinfo.Status != api.TrackerStatusPinned {
+		t.Error("cid should be pinned:", pinfo.Status)
+	}
+	ips, _ := cl.ipfs.PinLsCid(context.Background(), c)
+	if ips.MaxDepth() != 2 {
+		t.Error("cid should have been pinned with depth 2")
+	}
+
+	pin.MaxDepth = -2
+	err = cl.Pin(pin)
+	if err == nil {
+		t.Error("expected an error with a bad max depth")
+	}
+}
+
 func TestAddFile(t *testing.T) {
 	cl, _, _, _, _ := testingCluster(t)
 	defer cleanRaft()
@@ -756,6 +1211,58 @@ func TestClusterUnpin(t *testing.T) {
 	}
 }
 
+func TestClusterPinBatch(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+
+	// Unpinning something not in the state fails the whole batch
+	err := cl.PinBatch(api.PinBatch{
+		Pins:   []api.Pin{api.PinCid(c2)},
+		Unpins: []api.Pin{api.PinCid(c1)},
+	})
+	if err == nil {
+		t.Error("batch should have failed")
+	}
+	if _, err := cl.PinGet(c2); err == nil {
+		t.Error("nothing should have been pinned")
+	}
+
+	err = cl.Pin(api.PinCid(c1))
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+
+	err = cl.PinBatch(api.PinBatch{
+		Pins:   []api.Pin{api.PinCid(c2)},
+		Unpins: []api.Pin{api.PinCid(c1)},
+	})
+	if err != nil {
+		t.Fatal("batch should have worked:", err)
+	}
+
+	pins := cl.Pins()
+	if len(pins) != 1 || !pins[0].Cid.Equals(c2) {
+		t.Error("the batch was not applied")
+	}
+
+	c3, _ := cid.Decode(test.TestCid3)
+	pin := api.PinCid(c3)
+	pin.ReplicationFactorMin = 1
+	pin.ReplicationFactorMax = 1
+	err = cl.PinBatch(api.PinBatch{Pins: []api.Pin{pin}})
+	if err != nil {
+		t.Fatal("batch should have worked:", err)
+	}
+	pin, _ = cl.PinGet(c3)
+	if pin.Size != 1000 {
+		t.Errorf("expected the size of the pin to be set: %d", pin.Size)
+	}
+}
+
 func TestClusterPeers(t *testing.T) {
 	cl, _, _, _, _ := testingCluster(t)
 	defer cleanRaft()
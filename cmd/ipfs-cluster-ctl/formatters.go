@@ -31,6 +31,10 @@ func jsonFormatObject(resp interface{}) {
 		textFormatPrintMetric(&serial)
 	case api.Error:
 		jsonFormatPrint(resp.(api.Error))
+	case api.AllocationSimulation:
+		jsonFormatPrint(resp.(api.AllocationSimulation))
+	case api.DrainStatus:
+		jsonFormatPrint(resp.(api.DrainStatus))
 	case []api.ID:
 		r := resp.([]api.ID)
 		serials := make([]api.IDSerial, len(r), len(r))
@@ -95,6 +99,15 @@ func textFormatObject(resp interface{}) {
 	case api.Metric:
 		serial := resp.(api.Metric)
 		textFormatPrintMetric(&serial)
+	case api.AllocationSimulation:
+		serial := resp.(api.AllocationSimulation)
+		textFormatPrintAllocationSimulation(&serial)
+	case api.DrainStatus:
+		serial := resp.(api.DrainStatus)
+		textFormatPrintDrainStatus(&serial)
+	case api.Event:
+		serial := resp.(api.Event)
+		textFormatPrintEvent(&serial)
 	case []api.ID:
 		for _, item := range resp.([]api.ID) {
 			textFormatObject(item)
@@ -127,6 +140,20 @@ func textFormatPrintIDSerial(obj *api.IDSerial) {
 	}
 
 	fmt.Printf("%s | %s | Sees %d other peers\n", obj.ID, obj.Peername, len(obj.ClusterPeers)-1)
+	if obj.Role != "" {
+		fmt.Printf("  > Role: %s\n", obj.Role)
+	}
+	if len(obj.Tags) > 0 {
+		keys := make(sort.StringSlice, 0, len(obj.Tags))
+		for k := range obj.Tags {
+			keys = append(keys, k)
+		}
+		keys.Sort()
+		fmt.Println("  > Tags:")
+		for _, k := range keys {
+			fmt.Printf("    - %s: %s\n", k, obj.Tags[k])
+		}
+	}
 	addrs := make(sort.StringSlice, 0, len(obj.Addresses))
 	for _, a := range obj.Addresses {
 		addrs = append(addrs, string(a))
@@ -200,6 +227,10 @@ func textFormatPrintPin(obj *api.PinSerial) {
 			obj.ReplicationFactorMin, obj.ReplicationFactorMax,
 			sortAlloc)
 	}
+
+	if len(obj.UserAllocations) > 0 {
+		fmt.Printf(" | User allocations: %s", obj.UserAllocations)
+	}
 	var recStr string
 	switch obj.MaxDepth {
 	case 0:
@@ -210,7 +241,33 @@ func textFormatPrintPin(obj *api.PinSerial) {
 		recStr = fmt.Sprintf("Recursive-%d", obj.MaxDepth)
 	}
 
-	fmt.Printf(" | %s\n", recStr)
+	fmt.Printf(" | %s", recStr)
+
+	if obj.Size > 0 {
+		fmt.Printf(" | Size: %d", obj.Size)
+	}
+
+	if !obj.ExpireAt.IsZero() {
+		fmt.Printf(" | Exp: %s", obj.ExpireAt.UTC().Format(time.RFC3339))
+	}
+
+	if obj.Path != "" {
+		fmt.Printf(" | Path: %s", obj.Path)
+	}
+
+	if obj.PinUpdate != "" {
+		fmt.Printf(" | Updated from: %s", obj.PinUpdate)
+	}
+
+	if len(obj.Metadata) > 0 {
+		var meta sort.StringSlice
+		for k, v := range obj.Metadata {
+			meta = append(meta, k+"="+v)
+		}
+		meta.Sort()
+		fmt.Printf(" | Metadata: %s", strings.Join(meta, ","))
+	}
+	fmt.Printf("\n")
 }
 
 func textFormatPrintAddedOutput(obj *api.AddedOutput) {
@@ -222,6 +279,55 @@ func textFormatPrintMetric(obj *api.Metric) {
 	fmt.Printf("%s: %s | Expire: %s\n", peer.IDB58Encode(obj.Peer), obj.Value, date)
 }
 
+func textFormatPrintEvent(obj *api.Event) {
+	date := obj.Timestamp.UTC().Format(time.RFC3339)
+	fmt.Printf("%d %s %s", obj.Seq, date, obj.Type)
+	switch obj.Type {
+	case api.EventAlert:
+		fmt.Printf(" | %s: %s", obj.Peer, obj.Metric)
+	case api.EventPinStatus:
+		fmt.Printf(" | %s: %s %s", obj.Peer, obj.Cid, strings.ToUpper(obj.Status))
+		if obj.Error != "" {
+			fmt.Printf(": %s", obj.Error)
+		}
+	default:
+		fmt.Printf(" | %s", obj.Peer)
+	}
+	fmt.Printf("\n")
+}
+
+func textFormatPrintAllocationSimulation(obj *api.AllocationSimulation) {
+	fmt.Printf("%s:\n", obj.Cid)
+	if obj.Error != "" {
+		fmt.Printf("  Allocation would fail: %s\n", obj.Error)
+	} else if len(obj.Allocations) == 0 {
+		fmt.Printf("  Allocations: [everywhere]\n")
+	} else {
+		fmt.Printf("  Allocations: [%s]\n", strings.Join(obj.Allocations, ", "))
+	}
+	fmt.Printf("  Candidates:\n")
+	for _, cand := range obj.Candidates {
+		mark := "-"
+		if cand.Allocated {
+			mark = "+"
+		}
+		fmt.Printf("    %s %s: %s\n", mark, cand.Peer, cand.Reason)
+		for _, m := range cand.Metrics {
+			fmt.Printf("        %s: %s\n", m.Name, m.Value)
+		}
+	}
+}
+
+func textFormatPrintDrainStatus(obj *api.DrainStatus) {
+	fmt.Printf("%s:\n", obj.Peer)
+	fmt.Printf("  > Draining: %t\n", obj.Draining)
+	fmt.Printf("  > Remaining pins: %d\n", obj.Remaining)
+	if obj.InProgress || obj.Total > 0 {
+		fmt.Printf("  > Re-allocation in progress: %t (total: %d, failed: %d)\n",
+			obj.InProgress, obj.Total, obj.Failed)
+	}
+}
+
 func textFormatPrintError(obj *api.Error) {
 	fmt.Printf("An error occurred:\n")
 	fmt.Printf("  Code: %d\n", obj.Code)
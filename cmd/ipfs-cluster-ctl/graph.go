@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"time"
 
 	peer "github.com/libp2p/go-libp2p-peer"
 	dot "github.com/zenground0/go-dot"
@@ -23,7 +24,9 @@ import (
    consists of moving IPFS swarm peers not connected to any cluster peer to
    the IPFSLinks map in the event that the function was invoked with the
    allIpfs flag.  This allows all IPFS peers connected to the cluster to be
-   rendered as nodes in the final graph.
+   rendered as nodes in the final graph. When cluster peers measure the
+   latency among them, the round-trip times of the cluster edges are
+   written as comments next to them.
 */
 
 // nodeType specifies the type of node being represented in the dot file:
@@ -63,6 +66,7 @@ func makeDot(cg api.ConnectGraphSerial, w io.Writer, allIpfs bool) error {
 		ipfsEdges:        ipfsEdges,
 		clusterEdges:     cg.ClusterLinks,
 		clusterIpfsEdges: cg.ClustertoIPFS,
+		clusterLatencies: cg.ClusterLatencies,
 		clusterNodes:     make(map[string]*dot.VertexDescription),
 		ipfsNodes:        make(map[string]*dot.VertexDescription),
 	}
@@ -79,6 +83,7 @@ type dotWriter struct {
 	ipfsEdges        map[string][]string
 	clusterEdges     map[string][]string
 	clusterIpfsEdges map[string]string
+	clusterLatencies map[string]map[string]time.Duration
 }
 
 // writes nodes to dot file output and creates and stores an ordering over nodes
@@ -136,6 +141,25 @@ func (dW *dotWriter) print() error {
 	}
 	dW.dotGraph.AddNewLine()
 
+	if len(dW.clusterLatencies) > 0 {
+		dW.dotGraph.AddComment("The round-trip times among cluster-service peers")
+		for k, v := range dW.clusterEdges {
+			for _, id := range v {
+				rtt, ok := dW.clusterLatencies[k][id]
+				if !ok {
+					continue
+				}
+				dW.dotGraph.AddComment(fmt.Sprintf(
+					"%s -> %s: %s",
+					dW.clusterNodes[k].ID,
+					dW.clusterNodes[id].ID,
+					rtt,
+				))
+			}
+		}
+		dW.dotGraph.AddNewLine()
+	}
+
 	dW.dotGraph.AddComment("The connections between cluster peers and their ipfs daemons")
 	// Write cluster to ipfs edges
 	for k, id := range dW.clusterIpfsEdges {
@@ -6,6 +6,7 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
 )
@@ -214,3 +215,35 @@ func TestIpfsAllGraphs(t *testing.T) {
 	}
 	verifyOutput(t, buf.String(), allIpfs)
 }
+
+func TestLatencyGraph(t *testing.T) {
+	cg := api.ConnectGraphSerial{
+		ClusterID: "QmUBuxVHoNNjfmNpTad36UeaFQv3gXAtCv9r6KhmeqhEhD",
+		ClusterLinks: map[string][]string{
+			"QmUBuxVHoNNjfmNpTad36UeaFQv3gXAtCv9r6KhmeqhEhD": []string{
+				"QmV35LjbEGPfN7KfMAJp43VV2enwXqqQf5esx4vUcgHDQJ",
+			},
+			"QmV35LjbEGPfN7KfMAJp43VV2enwXqqQf5esx4vUcgHDQJ": []string{
+				"QmUBuxVHoNNjfmNpTad36UeaFQv3gXAtCv9r6KhmeqhEhD",
+			},
+		},
+		IPFSLinks:     map[string][]string{},
+		ClustertoIPFS: map[string]string{},
+		ClusterLatencies: map[string]map[string]time.Duration{
+			"QmUBuxVHoNNjfmNpTad36UeaFQv3gXAtCv9r6KhmeqhEhD": {
+				"QmV35LjbEGPfN7KfMAJp43VV2enwXqqQf5esx4vUcgHDQJ": 3 * time.Millisecond,
+			},
+		},
+	}
+	buf := new(bytes.Buffer)
+	err := makeDot(cg, buf, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "/* C0 -> C1: 3ms */") {
+		t.Error("expected the latency of the edge in the output:", buf.String())
+	}
+	if strings.Contains(buf.String(), "C1 -> C0:") {
+		t.Error("edges without latency should not be annotated")
+	}
+}
@@ -2,6 +2,7 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/hex"
 	"errors"
@@ -231,6 +232,78 @@ cluster peers.
 						return nil
 					},
 				},
+				{
+					Name:  "drain",
+					Usage: "move all the content out of a peer",
+					Description: `
+This command marks a peer as draining. Draining peers do not receive new
+allocations, and all the pins allocated to them are re-allocated to other
+peers. The command returns right away with the progress of the operation,
+unless --wait or --rm are given.
+
+With --wait, the command polls the progress until no pins are allocated to the
+peer. With --rm, the peer is then removed from the cluster (see "peers rm").
+Removing a peer clears its drain mark.
+
+Use --status to check the progress of an ongoing drain, and --cancel to
+remove the drain mark. Pins already moved stay where they are.
+`,
+					ArgsUsage: "<peer ID>",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "status, s",
+							Usage: "only show the progress of draining the peer",
+						},
+						cli.BoolFlag{
+							Name:  "cancel",
+							Usage: "remove the drain mark of the peer",
+						},
+						cli.BoolFlag{
+							Name:  "wait, w",
+							Usage: "wait until no pins are allocated to the peer",
+						},
+						cli.DurationFlag{
+							Name:  "wait-timeout, wt",
+							Value: 0,
+							Usage: "How long to --wait (in seconds), default is indefinitely",
+						},
+						cli.BoolFlag{
+							Name:  "rm",
+							Usage: "remove the peer from the cluster once drained (implies --wait)",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						pid := c.Args().First()
+						p, err := peer.IDB58Decode(pid)
+						checkErr("parsing peer ID", err)
+
+						if c.Bool("cancel") {
+							cerr := globalClient.PeerUndrain(p)
+							formatResponse(c, nil, cerr)
+							return nil
+						}
+						if c.Bool("status") {
+							resp, cerr := globalClient.PeerDrainStatus(p)
+							formatResponse(c, resp, cerr)
+							return nil
+						}
+
+						resp, cerr := globalClient.PeerDrain(p)
+						if cerr != nil || !(c.Bool("wait") || c.Bool("rm")) {
+							formatResponse(c, resp, cerr)
+							return nil
+						}
+
+						resp, err = waitForDrain(p, c.Duration("wait-timeout"))
+						checkErr("waiting for the peer to drain", err)
+						formatResponse(c, resp, nil)
+						if c.Bool("rm") {
+							cerr = globalClient.PeerRm(p)
+							formatResponse(c, nil, cerr)
+						}
+						return nil
+					},
+				},
 			},
 		},
 		{
@@ -314,6 +387,10 @@ If you prefer faster adding, add directly to the local IPFS and trigger a
 					Value: defaultAddParams.Name,
 					Usage: "Sets a name for this pin",
 				},
+				cli.StringSliceFlag{
+					Name:  "metadata",
+					Usage: "Sets metadata for this pin in key=value form. Can be repeated",
+				},
 				cli.IntFlag{
 					Name:  "replication-min, rmin",
 					Value: defaultAddParams.ReplicationFactorMin,
@@ -368,6 +445,7 @@ If you prefer faster adding, add directly to the local IPFS and trigger a
 				p.ReplicationFactorMin = c.Int("replication-min")
 				p.ReplicationFactorMax = c.Int("replication-max")
 				p.Name = name
+				p.Metadata = parseMetadata(c.StringSlice("metadata"))
 				//p.Shard = shard
 				//p.ShardSize = c.Uint64("shard-size")
 				p.Shard = false
@@ -444,9 +522,42 @@ in the cluster and should be part of the list offered by "pin ls".
 An optional replication factor can be provided: -1 means "pin everywhere"
 and 0 means use cluster's default setting. Positive values indicate how many
 peers should pin this content.
+
+With --max-depth, only the given number of levels of the DAG below the CID
+are pinned: 0 pins only the root block, while the default (-1) pins the whole
+DAG recursively. This requires support in the IPFS daemons.
+
+With --allocations, the given peers are allocated with priority. If the
+replication factor is not set, it defaults to the number of given peers.
+Otherwise, any remaining allocations are chosen by the cluster as usual.
+
+With --expire-in, the pin is automatically removed from the cluster once
+the given duration (i.e. "24h") has passed.
+
+Arbitrary metadata can be attached to the pin with one or several
+--metadata key=value flags. It is stored in the shared state and can be
+used to filter the pinset.
+
+Instead of a CID, an IPNS name or a DNSLink can be given as /ipns/<name>.
+The cluster resolves it and pins the resulting CID. The path is then
+re-resolved periodically: when it points to a new CID, the new CID is pinned
+and the previous one is unpinned after a grace period.
+
+With --from-file, the CIDs are read from the given file (or stdin when "-"),
+one per line, and are pinned with the same options as a single batch
+operation. Empty lines and lines starting with "#" are ignored. Pin statuses
+are not printed in this mode.
+
+With --dry-run, nothing is pinned. Instead, the command shows which peers
+would be allocated to the CID with the given options, along with the metrics
+of every peer and the reason why it was chosen or excluded.
 `,
-					ArgsUsage: "<CID>",
+					ArgsUsage: "<CID|/ipns/name>",
 					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "from-file, f",
+							Usage: "Pin all the CIDs listed in a file in a single batch",
+						},
 						cli.IntFlag{
 							Name:  "replication, r",
 							Value: 0,
@@ -467,6 +578,27 @@ peers should pin this content.
 							Value: "",
 							Usage: "Sets a name for this pin",
 						},
+						cli.StringSliceFlag{
+							Name:  "metadata",
+							Usage: "Sets metadata for this pin in key=value form. Can be repeated",
+						},
+						cli.IntFlag{
+							Name:  "max-depth",
+							Value: -1,
+							Usage: "Pin only up to this depth (-1 means recursively, 0 means only the root)",
+						},
+						cli.StringFlag{
+							Name:  "allocations, allocs",
+							Usage: "Optional comma-separated list of peer IDs to allocate the pin to with priority",
+						},
+						cli.DurationFlag{
+							Name:  "expire-in",
+							Usage: "Duration after which the pin is automatically removed",
+						},
+						cli.BoolFlag{
+							Name:  "dry-run",
+							Usage: "Show the allocations that would be made without pinning",
+						},
 						cli.BoolFlag{
 							Name:  "no-status, ns",
 							Usage: "Prevents fetching pin status after pinning (faster, quieter)",
@@ -482,10 +614,6 @@ peers should pin this content.
 						},
 					},
 					Action: func(c *cli.Context) error {
-						cidStr := c.Args().First()
-						ci, err := cid.Decode(cidStr)
-						checkErr("parsing cid", err)
-
 						rpl := c.Int("replication")
 						rplMin := c.Int("replication-min")
 						rplMax := c.Int("replication-max")
@@ -494,12 +622,67 @@ peers should pin this content.
 							rplMax = rpl
 						}
 
-						cerr := globalClient.Pin(ci, rplMin, rplMax, c.String("name"))
-						if cerr != nil {
-							formatResponse(c, nil, cerr)
+						opts := api.PinOptions{
+							ReplicationFactorMin: rplMin,
+							ReplicationFactorMax: rplMax,
+							Name:                 c.String("name"),
+							Metadata:             parseMetadata(c.StringSlice("metadata")),
+						}
+						if allocs := c.String("allocations"); allocs != "" {
+							opts.UserAllocations = strings.Split(allocs, ",")
+						}
+						if expireIn := c.Duration("expire-in"); expireIn > 0 {
+							opts.ExpireAt = time.Now().Add(expireIn)
+						}
+
+						maxDepth := c.Int("max-depth")
+						if maxDepth < -1 {
+							checkErr("", errors.New("max-depth must be -1 or greater"))
+						}
+
+						if c.Bool("dry-run") {
+							if c.String("from-file") != "" {
+								checkErr("", errors.New("--dry-run cannot be used with --from-file"))
+							}
+							ci, err := cid.Decode(c.Args().First())
+							checkErr("parsing cid", err)
+							sim, cerr := globalClient.SimulateAllocation(ci, opts)
+							formatResponse(c, sim, cerr)
+							return nil
+						}
+
+						if path := c.String("from-file"); path != "" {
+							if maxDepth != -1 {
+								checkErr("", errors.New("--max-depth cannot be used with --from-file"))
+							}
+							pinFromFile(c, path, opts)
 							return nil
 						}
 
+						var ci cid.Cid
+						arg := c.Args().First()
+						if strings.HasPrefix(arg, "/ipns/") {
+							if maxDepth != -1 {
+								checkErr("", errors.New("--max-depth cannot be used with /ipns/ paths"))
+							}
+							pin, cerr := globalClient.PinPath(arg, opts)
+							if cerr != nil {
+								formatResponse(c, nil, cerr)
+								return nil
+							}
+							ci = pin.Cid
+						} else {
+							var err error
+							ci, err = cid.Decode(arg)
+							checkErr("parsing cid", err)
+
+							cerr := globalClient.PinDepth(ci, maxDepth, opts)
+							if cerr != nil {
+								formatResponse(c, nil, cerr)
+								return nil
+							}
+						}
+
 						handlePinResponseFormatFlags(
 							c,
 							ci,
@@ -553,6 +736,58 @@ although unpinning operations in the cluster may take longer or fail.
 						return nil
 					},
 				},
+				{
+					Name:  "update",
+					Usage: "Replace a pinned CID with a new one",
+					Description: `
+This command tells IPFS Cluster to replace the pin for a CID with a pin for
+a new CID. The new pin keeps the allocations, name and options of the
+original one, and the original CID is unpinned. This is done as a single
+operation.
+
+The IPFS daemons holding the original CID use "ipfs pin update", which only
+fetches the blocks that differ. This is useful when a new version of a DAG
+only differs slightly from the previous one.
+
+When the request has succeeded, the command returns the status of the new
+CID in the cluster.
+`,
+					ArgsUsage: "<from-CID> <to-CID>",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "no-status, ns",
+							Usage: "Prevents fetching pin status after updating (faster, quieter)",
+						},
+						cli.BoolFlag{
+							Name:  "wait, w",
+							Usage: "Wait for all nodes to report a status of pinned before returning",
+						},
+						cli.DurationFlag{
+							Name:  "wait-timeout, wt",
+							Value: 0,
+							Usage: "How long to --wait (in seconds), default is indefinitely",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						from, err := cid.Decode(c.Args().Get(0))
+						checkErr("parsing from cid", err)
+						to, err := cid.Decode(c.Args().Get(1))
+						checkErr("parsing to cid", err)
+
+						_, cerr := globalClient.PinUpdate(from, to)
+						if cerr != nil {
+							formatResponse(c, nil, cerr)
+							return nil
+						}
+
+						handlePinResponseFormatFlags(
+							c,
+							to,
+							api.TrackerStatusPinned,
+						)
+						return nil
+					},
+				},
 				{
 					Name:  "ls",
 					Usage: "List items in the cluster pinset",
@@ -728,6 +963,8 @@ to check that it matches the CLI version (shown by -v).
 					Description: `
 This command queries all connected cluster peers and their ipfs peers to generate a
 graph of the connections.  Output is a dot file encoding the cluster's connection state.
+When the peers run the "latency" informer, the round-trip times among cluster
+peers are included as comments next to the edges.
 `,
 					Flags: []cli.Flag{
 						cli.StringFlag{
@@ -769,26 +1006,116 @@ graph of the connections.  Output is a dot file encoding the cluster's connectio
 This commands displays the latest valid metrics of the given type logged
 by this peer for all current cluster peers.
 
-Currently supported metrics depend on the informer component used,
-but usually are:
+Currently supported metrics depend on the informers run by the peers
+(the ones used by the allocator and those enabled in the "composite"
+informer configuration), but usually are:
 
 - freespace
+- numpin
 - ping
+
+With --history, all the metrics of the given type kept by this peer are
+displayed instead, from the newest to the oldest, including expired ones
+and those of peers which left the cluster. How many are kept is set by the
+"window_cap" option of the monitor. Use --peer to limit them to a single
+peer.
 `,
 					ArgsUsage: "<metric name>",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "history",
+							Usage: "display the metric history",
+						},
+						cli.StringFlag{
+							Name:  "peer",
+							Usage: "only display the history of the given peer ID",
+						},
+					},
 					Action: func(c *cli.Context) error {
 						metric := c.Args().First()
 						if metric == "" {
 							checkErr("", errors.New("provide a metric name"))
 						}
 
-						resp, cerr := globalClient.Metrics(metric)
+						if !c.Bool("history") {
+							resp, cerr := globalClient.Metrics(metric)
+							formatResponse(c, resp, cerr)
+							return nil
+						}
+
+						var pid peer.ID
+						if p := c.String("peer"); p != "" {
+							var err error
+							pid, err = peer.IDB58Decode(p)
+							checkErr("parsing peer ID", err)
+						}
+						resp, cerr := globalClient.MetricHistory(metric, pid)
 						formatResponse(c, resp, cerr)
 						return nil
 					},
 				},
 			},
 		},
+		{
+			Name:  "watch",
+			Usage: "Display the events emitted by a cluster peer as they happen",
+			Description: `
+This command streams the events emitted by the cluster peer and prints them
+until it is interrupted. The available event types are:
+
+- alert: the peer monitor raised an alert for a peer's metric
+- peer_joined: a peer was added to the peerset
+- peer_left: a peer was removed from the peerset
+- leader_changed: the consensus leader changed
+- pin_status: the status of a pin tracked by the peer changed
+
+Events are not relayed between peers: pin_status events are only emitted
+for the pins tracked by the peer that the command connects to. Watch
+several peers to follow the status of pins allocated elsewhere.
+
+Use --type to only display events of the given types (comma-separated).
+Every event carries a sequence number, which can be given to --since in
+order to resume watching after an interruption without missing the events
+still kept by the peer.
+`,
+			ArgsUsage: " ",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "type",
+					Usage: "comma-separated list of event types to display",
+				},
+				cli.Uint64Flag{
+					Name:  "since",
+					Usage: "display the events after the given sequence number first",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				var types []string
+				if t := c.String("type"); t != "" {
+					for _, et := range strings.Split(t, ",") {
+						if !api.IsValidEventType(et) {
+							checkErr("", fmt.Errorf("unknown event type: %s", et))
+						}
+						types = append(types, et)
+					}
+				}
+
+				out := make(chan api.Event, 100)
+				var wg sync.WaitGroup
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for e := range out {
+						formatResponse(c, e, nil)
+					}
+				}()
+
+				cerr := globalClient.Events(context.Background(), types, c.Uint64("since"), out)
+				wg.Wait()
+				formatResponse(c, nil, cerr)
+				return nil
+			},
+		},
 		{
 			Name:      "commands",
 			Usage:     "List all commands",
@@ -882,6 +1209,75 @@ func parseCredentials(userInput string) (string, string) {
 	}
 }
 
+// pinFromFile pins all the CIDs listed in a file with a single
+// batch request.
+func pinFromFile(c *cli.Context, path string, opts api.PinOptions) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		checkErr("opening file", err)
+		defer f.Close()
+		r = f
+	}
+
+	cids, err := readCids(r)
+	checkErr("reading cids", err)
+
+	pins := make([]api.Pin, 0, len(cids))
+	for _, ci := range cids {
+		pins = append(pins, api.PinWithOpts(ci, opts))
+	}
+
+	cerr := globalClient.PinBatch(api.PinBatch{Pins: pins})
+	if cerr != nil {
+		formatResponse(c, nil, cerr)
+		return
+	}
+
+	if c.Bool("wait") {
+		for _, ci := range cids {
+			_, cerr = waitFor(ci, api.TrackerStatusPinned, c.Duration("wait-timeout"))
+			checkErr("waiting for pin status", cerr)
+		}
+	}
+}
+
+// parseMetadata parses a list of key=value pairs as given with the
+// --metadata flag.
+func parseMetadata(kvs []string) map[string]string {
+	if len(kvs) == 0 {
+		return nil
+	}
+	meta := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			checkErr("parsing metadata", fmt.Errorf("%q is not in key=value form", kv))
+		}
+		meta[parts[0]] = parts[1]
+	}
+	return meta
+}
+
+// readCids parses one CID per line, ignoring empty lines and
+// lines starting with "#".
+func readCids(r io.Reader) ([]cid.Cid, error) {
+	var cids []cid.Cid
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ci, err := cid.Decode(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", line, err)
+		}
+		cids = append(cids, ci)
+	}
+	return cids, scanner.Err()
+}
+
 func handlePinResponseFormatFlags(
 	c *cli.Context,
 	ci cid.Cid,
@@ -907,6 +1303,44 @@ func handlePinResponseFormatFlags(
 	formatResponse(c, status, cerr)
 }
 
+// waitForDrain polls the progress of draining the given peer, reporting
+// it as it changes, until no pins are allocated to the peer.
+func waitForDrain(p peer.ID, timeout time.Duration) (api.DrainStatus, error) {
+	var deadline <-chan time.Time
+	if timeout > defaultWaitCheckFreq {
+		deadline = time.After(timeout)
+	}
+
+	ticker := time.NewTicker(defaultWaitCheckFreq)
+	defer ticker.Stop()
+	last := -1
+	for {
+		status, cerr := globalClient.PeerDrainStatus(p)
+		if cerr != nil {
+			return status, cerr
+		}
+		if status.Remaining != last {
+			out("%d pins remaining in %s (total: %d, failed: %d)\n",
+				status.Remaining, status.Peer, status.Total, status.Failed)
+			last = status.Remaining
+		}
+		switch {
+		case status.Remaining == 0:
+			return status, nil
+		case !status.Draining:
+			return status, errors.New("the peer is no longer draining")
+		case !status.InProgress:
+			return status, fmt.Errorf("%d pins could not be moved out of the peer", status.Remaining)
+		}
+
+		select {
+		case <-deadline:
+			return status, errors.New("timed out")
+		case <-ticker.C:
+		}
+	}
+}
+
 func waitFor(
 	ci cid.Cid,
 	target api.TrackerStatus,
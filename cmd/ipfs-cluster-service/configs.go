@@ -5,12 +5,20 @@ import (
 	"path/filepath"
 
 	ipfscluster "github.com/ipfs/ipfs-cluster"
+	"github.com/ipfs/ipfs-cluster/allocator/topoalloc"
+	"github.com/ipfs/ipfs-cluster/allocator/weightalloc"
 	"github.com/ipfs/ipfs-cluster/api/ipfsproxy"
 	"github.com/ipfs/ipfs-cluster/api/rest"
 	"github.com/ipfs/ipfs-cluster/config"
+	"github.com/ipfs/ipfs-cluster/consensus/crdt"
 	"github.com/ipfs/ipfs-cluster/consensus/raft"
+	"github.com/ipfs/ipfs-cluster/informer/composite"
 	"github.com/ipfs/ipfs-cluster/informer/disk"
+	"github.com/ipfs/ipfs-cluster/informer/external"
+	"github.com/ipfs/ipfs-cluster/informer/latency"
 	"github.com/ipfs/ipfs-cluster/informer/numpin"
+	"github.com/ipfs/ipfs-cluster/informer/pinqueue"
+	"github.com/ipfs/ipfs-cluster/informer/tags"
 	"github.com/ipfs/ipfs-cluster/ipfsconn/ipfshttp"
 	"github.com/ipfs/ipfs-cluster/monitor/basic"
 	"github.com/ipfs/ipfs-cluster/monitor/pubsubmon"
@@ -24,12 +32,20 @@ type cfgs struct {
 	ipfsproxyCfg        *ipfsproxy.Config
 	ipfshttpCfg         *ipfshttp.Config
 	consensusCfg        *raft.Config
+	crdtCfg             *crdt.Config
 	maptrackerCfg       *maptracker.Config
 	statelessTrackerCfg *stateless.Config
 	monCfg              *basic.Config
 	pubsubmonCfg        *pubsubmon.Config
 	diskInfCfg          *disk.Config
 	numpinInfCfg        *numpin.Config
+	tagsInfCfg          *tags.Config
+	compositeInfCfg     *composite.Config
+	latencyInfCfg       *latency.Config
+	externalInfCfg      *external.Config
+	pinqueueInfCfg      *pinqueue.Config
+	topoAllocCfg        *topoalloc.Config
+	weightAllocCfg      *weightalloc.Config
 }
 
 func makeConfigs() (*config.Manager, *cfgs) {
@@ -39,35 +55,59 @@ func makeConfigs() (*config.Manager, *cfgs) {
 	ipfsproxyCfg := &ipfsproxy.Config{}
 	ipfshttpCfg := &ipfshttp.Config{}
 	consensusCfg := &raft.Config{}
+	crdtCfg := &crdt.Config{}
 	maptrackerCfg := &maptracker.Config{}
 	statelessCfg := &stateless.Config{}
 	monCfg := &basic.Config{}
 	pubsubmonCfg := &pubsubmon.Config{}
 	diskInfCfg := &disk.Config{}
 	numpinInfCfg := &numpin.Config{}
+	tagsInfCfg := &tags.Config{}
+	compositeInfCfg := &composite.Config{}
+	latencyInfCfg := &latency.Config{}
+	externalInfCfg := &external.Config{}
+	pinqueueInfCfg := &pinqueue.Config{}
+	topoAllocCfg := &topoalloc.Config{}
+	weightAllocCfg := &weightalloc.Config{}
 	cfg.RegisterComponent(config.Cluster, clusterCfg)
 	cfg.RegisterComponent(config.API, apiCfg)
 	cfg.RegisterComponent(config.API, ipfsproxyCfg)
 	cfg.RegisterComponent(config.IPFSConn, ipfshttpCfg)
 	cfg.RegisterComponent(config.Consensus, consensusCfg)
+	cfg.RegisterComponent(config.Consensus, crdtCfg)
 	cfg.RegisterComponent(config.PinTracker, maptrackerCfg)
 	cfg.RegisterComponent(config.PinTracker, statelessCfg)
 	cfg.RegisterComponent(config.Monitor, monCfg)
 	cfg.RegisterComponent(config.Monitor, pubsubmonCfg)
 	cfg.RegisterComponent(config.Informer, diskInfCfg)
 	cfg.RegisterComponent(config.Informer, numpinInfCfg)
+	cfg.RegisterComponent(config.Informer, tagsInfCfg)
+	cfg.RegisterComponent(config.Informer, compositeInfCfg)
+	cfg.RegisterComponent(config.Informer, latencyInfCfg)
+	cfg.RegisterComponent(config.Informer, externalInfCfg)
+	cfg.RegisterComponent(config.Informer, pinqueueInfCfg)
+	cfg.RegisterComponent(config.Allocator, topoAllocCfg)
+	cfg.RegisterComponent(config.Allocator, weightAllocCfg)
 	return cfg, &cfgs{
 		clusterCfg,
 		apiCfg,
 		ipfsproxyCfg,
 		ipfshttpCfg,
 		consensusCfg,
+		crdtCfg,
 		maptrackerCfg,
 		statelessCfg,
 		monCfg,
 		pubsubmonCfg,
 		diskInfCfg,
 		numpinInfCfg,
+		tagsInfCfg,
+		compositeInfCfg,
+		latencyInfCfg,
+		externalInfCfg,
+		pinqueueInfCfg,
+		topoAllocCfg,
+		weightAllocCfg,
 	}
 }
 
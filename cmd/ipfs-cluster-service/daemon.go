@@ -8,24 +8,35 @@ import (
 	"syscall"
 	"time"
 
+	ds "github.com/ipfs/go-datastore"
 	host "github.com/libp2p/go-libp2p-host"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/urfave/cli"
 
 	ipfscluster "github.com/ipfs/ipfs-cluster"
 	"github.com/ipfs/ipfs-cluster/allocator/ascendalloc"
 	"github.com/ipfs/ipfs-cluster/allocator/descendalloc"
+	"github.com/ipfs/ipfs-cluster/allocator/topoalloc"
+	"github.com/ipfs/ipfs-cluster/allocator/weightalloc"
 	"github.com/ipfs/ipfs-cluster/api/ipfsproxy"
 	"github.com/ipfs/ipfs-cluster/api/rest"
+	"github.com/ipfs/ipfs-cluster/consensus/crdt"
 	"github.com/ipfs/ipfs-cluster/consensus/raft"
+	"github.com/ipfs/ipfs-cluster/informer/composite"
 	"github.com/ipfs/ipfs-cluster/informer/disk"
+	"github.com/ipfs/ipfs-cluster/informer/external"
+	"github.com/ipfs/ipfs-cluster/informer/latency"
 	"github.com/ipfs/ipfs-cluster/informer/numpin"
+	"github.com/ipfs/ipfs-cluster/informer/pinqueue"
+	"github.com/ipfs/ipfs-cluster/informer/tags"
 	"github.com/ipfs/ipfs-cluster/ipfsconn/ipfshttp"
 	"github.com/ipfs/ipfs-cluster/monitor/basic"
 	"github.com/ipfs/ipfs-cluster/monitor/pubsubmon"
 	"github.com/ipfs/ipfs-cluster/pintracker/maptracker"
 	"github.com/ipfs/ipfs-cluster/pintracker/stateless"
 	"github.com/ipfs/ipfs-cluster/pstoremgr"
-	"github.com/ipfs/ipfs-cluster/state/mapstate"
+	"github.com/ipfs/ipfs-cluster/state"
+	"github.com/ipfs/ipfs-cluster/state/dsstate"
 
 	ma "github.com/multiformats/go-multiaddr"
 )
@@ -68,9 +79,10 @@ func daemon(c *cli.Context) error {
 	err = cfgMgr.LoadJSONFromFile(configPath)
 	checkErr("loading configuration", err)
 
-	// Cleanup state if bootstrapping
+	// Cleanup state if bootstrapping. CRDT states are merged
+	// with those of the rest of the cluster instead.
 	raftStaging := false
-	if len(bootstraps) > 0 {
+	if len(bootstraps) > 0 && c.String("consensus") == "raft" {
 		cleanupState(cfgs.consensusCfg)
 		raftStaging = true
 	}
@@ -82,7 +94,11 @@ func daemon(c *cli.Context) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	cluster, err := createCluster(ctx, c, cfgs, raftStaging)
+	store, err := openStateDatastore(cfgs.clusterCfg)
+	checkErr("opening state datastore", err)
+	defer store.Close()
+
+	cluster, err := createCluster(ctx, c, cfgs, store, raftStaging)
 	checkErr("starting cluster", err)
 
 	// noop if no bootstraps
@@ -99,6 +115,7 @@ func createCluster(
 	ctx context.Context,
 	c *cli.Context,
 	cfgs *cfgs,
+	store ds.Datastore,
 	raftStaging bool,
 ) (*ipfscluster.Cluster, error) {
 
@@ -119,36 +136,34 @@ func createCluster(
 	connector, err := ipfshttp.NewConnector(cfgs.ipfshttpCfg)
 	checkErr("creating IPFS Connector component", err)
 
-	state := mapstate.NewMapState()
-
-	err = validateVersion(cfgs.clusterCfg, cfgs.consensusCfg)
-	checkErr("validating version", err)
+	state := dsstate.New(store, stateNamespace)
+	if c.String("consensus") == "crdt" {
+		// The crdt datastore holds the pinset, which is loaded
+		// into the state when the component starts.
+		err = state.Clear()
+		checkErr("clearing the state", err)
+	}
 
-	raftcon, err := raft.NewConsensus(
-		host,
-		cfgs.consensusCfg,
-		state,
-		raftStaging,
-	)
-	checkErr("creating consensus component", err)
+	psub, err := pubsub.NewGossipSub(ctx, host)
+	checkErr("creating PubSub", err)
 
+	cons := setupConsensus(c.String("consensus"), host, psub, cfgs, state, raftStaging)
 	tracker := setupPinTracker(c.String("pintracker"), host, cfgs.maptrackerCfg, cfgs.statelessTrackerCfg, cfgs.clusterCfg.Peername)
-	mon := setupMonitor(c.String("monitor"), host, cfgs.monCfg, cfgs.pubsubmonCfg)
-	informer, alloc := setupAllocation(c.String("alloc"), cfgs.diskInfCfg, cfgs.numpinInfCfg)
-
-	ipfscluster.ReadyTimeout = cfgs.consensusCfg.WaitForLeaderTimeout + 5*time.Second
+	mon := setupMonitor(c.String("monitor"), host, psub, cfgs.monCfg, cfgs.pubsubmonCfg)
+	informers, alloc := setupAllocation(c.String("alloc"), cfgs)
+	informers = setupInformers(host, informers, cfgs)
 
 	return ipfscluster.NewCluster(
 		host,
 		cfgs.clusterCfg,
-		raftcon,
+		cons,
 		apis,
 		connector,
 		state,
 		tracker,
 		mon,
 		alloc,
-		informer,
+		informers,
 	)
 }
 
@@ -212,22 +227,39 @@ Note that this may corrupt the local cluster state.
 
 func setupAllocation(
 	name string,
-	diskInfCfg *disk.Config,
-	numpinInfCfg *numpin.Config,
-) (ipfscluster.Informer, ipfscluster.PinAllocator) {
+	cfgs *cfgs,
+) ([]ipfscluster.Informer, ipfscluster.PinAllocator) {
 	switch name {
 	case "disk", "disk-freespace":
-		informer, err := disk.NewInformer(diskInfCfg)
+		informer, err := disk.NewInformer(cfgs.diskInfCfg)
 		checkErr("creating informer", err)
-		return informer, descendalloc.NewAllocator()
+		return []ipfscluster.Informer{informer}, descendalloc.NewAllocator()
 	case "disk-reposize":
-		informer, err := disk.NewInformer(diskInfCfg)
+		informer, err := disk.NewInformer(cfgs.diskInfCfg)
 		checkErr("creating informer", err)
-		return informer, ascendalloc.NewAllocator()
+		return []ipfscluster.Informer{informer}, ascendalloc.NewAllocator()
 	case "numpin", "pincount":
-		informer, err := numpin.NewInformer(numpinInfCfg)
+		informer, err := numpin.NewInformer(cfgs.numpinInfCfg)
 		checkErr("creating informer", err)
-		return informer, ascendalloc.NewAllocator()
+		return []ipfscluster.Informer{informer}, ascendalloc.NewAllocator()
+	case "pinqueue":
+		informer, err := pinqueue.NewInformer(cfgs.pinqueueInfCfg)
+		checkErr("creating informer", err)
+		return []ipfscluster.Informer{informer}, ascendalloc.NewAllocator()
+	case "topology":
+		informer, err := tags.NewInformer(cfgs.tagsInfCfg)
+		checkErr("creating informer", err)
+		alloc, err := topoalloc.NewAllocator(cfgs.topoAllocCfg)
+		checkErr("creating allocator", err)
+		return []ipfscluster.Informer{informer}, alloc
+	case "weighted":
+		diskInf, err := disk.NewInformer(cfgs.diskInfCfg)
+		checkErr("creating informer", err)
+		numpinInf, err := numpin.NewInformer(cfgs.numpinInfCfg)
+		checkErr("creating informer", err)
+		alloc, err := weightalloc.NewAllocator(cfgs.weightAllocCfg)
+		checkErr("creating allocator", err)
+		return []ipfscluster.Informer{diskInf, numpinInf}, alloc
 	default:
 		err := errors.New("unknown allocation strategy")
 		checkErr("", err)
@@ -235,9 +267,48 @@ func setupAllocation(
 	}
 }
 
+// setupInformers adds the informers enabled in the composite informer
+// configuration to those used by the allocator.
+func setupInformers(h host.Host, allocInformers []ipfscluster.Informer, cfgs *cfgs) []ipfscluster.Informer {
+	builders := map[string]composite.Builder{
+		"disk": func() (composite.Informer, error) {
+			return disk.NewInformer(cfgs.diskInfCfg)
+		},
+		"numpin": func() (composite.Informer, error) {
+			return numpin.NewInformer(cfgs.numpinInfCfg)
+		},
+		"tags": func() (composite.Informer, error) {
+			return tags.NewInformer(cfgs.tagsInfCfg)
+		},
+		"latency": func() (composite.Informer, error) {
+			return latency.NewInformer(cfgs.latencyInfCfg, h)
+		},
+		"external": func() (composite.Informer, error) {
+			return external.NewInformer(cfgs.externalInfCfg)
+		},
+		"pinqueue": func() (composite.Informer, error) {
+			return pinqueue.NewInformer(cfgs.pinqueueInfCfg)
+		},
+	}
+
+	base := make([]composite.Informer, 0, len(allocInformers))
+	for _, inf := range allocInformers {
+		base = append(base, inf)
+	}
+	all, err := composite.Informers(cfgs.compositeInfCfg, base, builders)
+	checkErr("creating informers", err)
+
+	informers := make([]ipfscluster.Informer, 0, len(all))
+	for _, inf := range all {
+		informers = append(informers, inf)
+	}
+	return informers
+}
+
 func setupMonitor(
 	name string,
 	h host.Host,
+	psub *pubsub.PubSub,
 	basicCfg *basic.Config,
 	pubsubCfg *pubsubmon.Config,
 ) ipfscluster.PeerMonitor {
@@ -248,7 +319,7 @@ func setupMonitor(
 		logger.Debug("basic monitor loaded")
 		return mon
 	case "pubsub":
-		mon, err := pubsubmon.New(h, pubsubCfg)
+		mon, err := pubsubmon.NewWithPubSub(h, psub, pubsubCfg)
 		checkErr("creating monitor", err)
 		logger.Debug("pubsub monitor loaded")
 		return mon
@@ -282,3 +353,46 @@ func setupPinTracker(
 		return nil
 	}
 }
+
+func setupConsensus(
+	name string,
+	h host.Host,
+	psub *pubsub.PubSub,
+	cfgs *cfgs,
+	st state.State,
+	raftStaging bool,
+) ipfscluster.Consensus {
+	switch name {
+	case "raft":
+		err := validateVersion(cfgs.clusterCfg, cfgs.consensusCfg)
+		checkErr("validating version", err)
+
+		raftcon, err := raft.NewConsensus(
+			h,
+			cfgs.consensusCfg,
+			st,
+			raftStaging,
+		)
+		checkErr("creating consensus component", err)
+		logger.Debug("raft consensus loaded")
+		ipfscluster.ReadyTimeout = cfgs.consensusCfg.WaitForLeaderTimeout + 5*time.Second
+		return raftcon
+	case "crdt":
+		crdtcon, err := crdt.NewConsensus(
+			h,
+			psub,
+			cfgs.crdtCfg,
+			st,
+		)
+		checkErr("creating consensus component", err)
+		logger.Debug("crdt consensus loaded")
+		// The initial sync from the connected peers is bounded
+		// by the peer timeout.
+		ipfscluster.ReadyTimeout = cfgs.crdtCfg.PeerTimeout + 5*time.Second
+		return crdtcon
+	default:
+		err := errors.New("unknown consensus component")
+		checkErr("", err)
+		return nil
+	}
+}
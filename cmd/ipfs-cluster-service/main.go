@@ -12,7 +12,7 @@ import (
 	//	_ "net/http/pprof"
 
 	ipfscluster "github.com/ipfs/ipfs-cluster"
-	"github.com/ipfs/ipfs-cluster/state/mapstate"
+	"github.com/ipfs/ipfs-cluster/state/dsstate"
 
 	semver "github.com/blang/semver"
 	logging "github.com/ipfs/go-log"
@@ -25,6 +25,7 @@ const programName = `ipfs-cluster-service`
 // flag defaults
 const (
 	defaultAllocation = "disk-freespace"
+	defaultConsensus  = "raft"
 	defaultMonitor    = "pubsub"
 	defaultPinTracker = "map"
 	defaultLogLevel   = "info"
@@ -238,6 +239,9 @@ configuration.
 
 					err = cleanupState(cfgs.consensusCfg)
 					checkErr("Cleaning up consensus data", err)
+
+					err = cleanupCRDTState(cfgs.crdtCfg)
+					checkErr("Cleaning up crdt data", err)
 				}
 
 				// Generate defaults for all registered components
@@ -274,7 +278,12 @@ configuration.
 				cli.StringFlag{
 					Name:  "alloc, a",
 					Value: defaultAllocation,
-					Usage: "allocation strategy to use [disk-freespace,disk-reposize,numpin].",
+					Usage: "allocation strategy to use [disk-freespace,disk-reposize,numpin,pinqueue,topology,weighted].",
+				},
+				cli.StringFlag{
+					Name:  "consensus",
+					Value: defaultConsensus,
+					Usage: "consensus component to use [raft,crdt].",
 				},
 				cli.StringFlag{
 					Name:   "monitor",
@@ -299,7 +308,7 @@ configuration.
 					Name:  "version",
 					Usage: "display the shared state format version",
 					Action: func(c *cli.Context) error {
-						fmt.Printf("%d\n", mapstate.Version)
+						fmt.Printf("%d\n", dsstate.Version)
 						return nil
 					},
 				},
@@ -437,6 +446,9 @@ the mth data folder (m currently defaults to 5)
 
 						err = cleanupState(cfgs.consensusCfg)
 						checkErr("Cleaning up consensus data", err)
+
+						err = cleanupCRDTState(cfgs.crdtCfg)
+						checkErr("Cleaning up crdt data", err)
 						return nil
 					},
 				},
@@ -1,21 +1,35 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
-	"io/ioutil"
+	"os"
+	"path/filepath"
 
 	ipfscluster "github.com/ipfs/ipfs-cluster"
 	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/consensus/crdt"
 	"github.com/ipfs/ipfs-cluster/consensus/raft"
 	"github.com/ipfs/ipfs-cluster/pstoremgr"
-	"github.com/ipfs/ipfs-cluster/state/mapstate"
+	"github.com/ipfs/ipfs-cluster/state/dsstate"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	leveldb "github.com/ipfs/go-ds-leveldb"
 )
 
 var errNoSnapshot = errors.New("no snapshot found")
 
+// The cluster state is stored in a datastore inside this subfolder
+// of the configuration folder, under stateNamespace.
+const (
+	stateDataSubFolder = "state"
+	stateNamespace     = "/pins"
+)
+
 func upgrade() error {
 	newState, current, err := restoreStateFromDisk()
 	if err != nil {
@@ -48,10 +62,10 @@ func export(w io.Writer) error {
 	return exportState(stateToExport, w)
 }
 
-// restoreStateFromDisk returns a mapstate containing the latest
+// restoreStateFromDisk returns a state containing the latest
 // snapshot, a flag set to true when the state format has the
 // current version and an error
-func restoreStateFromDisk() (*mapstate.MapState, bool, error) {
+func restoreStateFromDisk() (*dsstate.State, bool, error) {
 	cfgMgr, cfgs := makeConfigs()
 
 	err := cfgMgr.LoadJSONFromFile(configPath)
@@ -67,23 +81,23 @@ func restoreStateFromDisk() (*mapstate.MapState, bool, error) {
 		return nil, false, err
 	}
 
-	stateFromSnap := mapstate.NewMapState()
-	// duplicate reader to both check version and migrate
-	var buf bytes.Buffer
-	r2 := io.TeeReader(r, &buf)
-	raw, err := ioutil.ReadAll(r2)
-	if err != nil {
-		return nil, false, err
-	}
-	err = stateFromSnap.Unmarshal(raw)
+	// peek the version so that the snapshot is only read once
+	br := bufio.NewReader(r)
+	v, err := br.Peek(1)
 	if err != nil {
 		return nil, false, err
 	}
-	if stateFromSnap.GetVersion() == mapstate.Version {
+
+	stateFromSnap := newMemoryState()
+	if int(v[0]) == dsstate.Version {
+		err = stateFromSnap.UnmarshalFrom(br)
+		if err != nil {
+			return nil, false, err
+		}
 		return stateFromSnap, true, nil
 	}
 
-	err = stateFromSnap.Migrate(&buf)
+	err = stateFromSnap.Migrate(br)
 	if err != nil {
 		return nil, false, err
 	}
@@ -99,20 +113,28 @@ func stateImport(r io.Reader) error {
 		return err
 	}
 
-	pinSerials := make([]api.PinSerial, 0)
+	// Decode pins one by one rather than the whole array
+	stateToImport := newMemoryState()
 	dec := json.NewDecoder(r)
-	err = dec.Decode(&pinSerials)
+	_, err = dec.Token() // opening bracket
 	if err != nil {
 		return err
 	}
-
-	stateToImport := mapstate.NewMapState()
-	for _, pS := range pinSerials {
+	for dec.More() {
+		var pS api.PinSerial
+		err = dec.Decode(&pS)
+		if err != nil {
+			return err
+		}
 		err = stateToImport.Add(pS.ToPin())
 		if err != nil {
 			return err
 		}
 	}
+	_, err = dec.Token() // closing bracket
+	if err != nil {
+		return err
+	}
 
 	pm := pstoremgr.New(nil, cfgs.clusterCfg.GetPeerstorePath())
 	raftPeers := append(ipfscluster.PeersFromMultiaddrs(pm.LoadPeerstore()), cfgs.clusterCfg.ID)
@@ -120,23 +142,20 @@ func stateImport(r io.Reader) error {
 }
 
 func validateVersion(cfg *ipfscluster.Config, cCfg *raft.Config) error {
-	state := mapstate.NewMapState()
 	r, snapExists, err := raft.LastStateRaw(cCfg)
 	if !snapExists && err != nil {
 		logger.Error("error before reading latest snapshot.")
 	} else if snapExists && err != nil {
 		logger.Error("error after reading last snapshot. Snapshot potentially corrupt.")
 	} else if snapExists && err == nil {
-		raw, err2 := ioutil.ReadAll(r)
-		if err2 != nil {
-			return err2
-		}
-		err2 = state.Unmarshal(raw)
+		// The first byte of a snapshot is the state version
+		v := make([]byte, 1)
+		_, err2 := io.ReadFull(r, v)
 		if err2 != nil {
-			logger.Error("error unmarshalling snapshot. Snapshot potentially corrupt.")
+			logger.Error("error reading snapshot. Snapshot potentially corrupt.")
 			return err2
 		}
-		if state.GetVersion() != mapstate.Version {
+		if int(v[0]) != dsstate.Version {
 			logger.Error("!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!")
 			logger.Error("Out of date ipfs-cluster state is saved.")
 			logger.Error("To migrate to the new version, run ipfs-cluster-service state upgrade.")
@@ -149,19 +168,47 @@ func validateVersion(cfg *ipfscluster.Config, cCfg *raft.Config) error {
 	return err
 }
 
-// ExportState saves a json representation of a state
-func exportState(state *mapstate.MapState, w io.Writer) error {
-	// Serialize pins
-	pins := state.List()
-	pinSerials := make([]api.PinSerial, len(pins), len(pins))
-	for i, pin := range pins {
-		pinSerials[i] = pin.ToSerial()
+// ExportState saves a json representation of a state. Pins are
+// written as they are read from the state.
+func exportState(state *dsstate.State, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("[")
+	empty := true
+	for pin := range state.Stream(context.Background()) {
+		j, err := json.MarshalIndent(pin.ToSerial(), "    ", "    ")
+		if err != nil {
+			return err
+		}
+		if !empty {
+			bw.WriteString(",")
+		}
+		empty = false
+		bw.WriteString("\n    ")
+		bw.Write(j)
+	}
+	if !empty {
+		bw.WriteString("\n")
 	}
+	bw.WriteString("]\n")
+	return bw.Flush()
+}
+
+// newMemoryState returns a datastore-backed state which is kept in
+// memory. It is used to read and write snapshots offline.
+func newMemoryState() *dsstate.State {
+	return dsstate.New(dssync.MutexWrap(ds.NewMapDatastore()), stateNamespace)
+}
 
-	// Write json to output file
-	enc := json.NewEncoder(w)
-	enc.SetIndent("", "    ")
-	return enc.Encode(pinSerials)
+// openStateDatastore opens the datastore backing the cluster state. Its
+// contents are kept across restarts: the Raft consensus resumes from
+// them when they match the Raft log and rebuilds them otherwise.
+func openStateDatastore(cfg *ipfscluster.Config) (*leveldb.Datastore, error) {
+	folder := filepath.Join(cfg.BaseDir, stateDataSubFolder)
+	err := os.MkdirAll(folder, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return leveldb.NewDatastore(folder, nil)
 }
 
 // CleanupState cleans the state
@@ -173,3 +220,17 @@ func cleanupState(cCfg *raft.Config) error {
 
 	return err
 }
+
+// cleanupCRDTState removes the CRDT datastore, if any.
+func cleanupCRDTState(cCfg *crdt.Config) error {
+	folder := cCfg.GetDataFolder()
+	if _, err := os.Stat(folder); os.IsNotExist(err) {
+		return nil
+	}
+
+	err := os.RemoveAll(folder)
+	if err == nil {
+		logger.Warningf("the %s folder has been removed.  Next start will use an empty state", folder)
+	}
+	return err
+}
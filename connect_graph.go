@@ -1,6 +1,8 @@
 package ipfscluster
 
 import (
+	"time"
+
 	peer "github.com/libp2p/go-libp2p-peer"
 
 	"github.com/ipfs/ipfs-cluster/api"
@@ -8,12 +10,14 @@ import (
 )
 
 // ConnectGraph returns a description of which cluster peers and ipfs
-// daemons are connected to each other
+// daemons are connected to each other, along with the latencies among
+// cluster peers when they are measured.
 func (c *Cluster) ConnectGraph() (api.ConnectGraph, error) {
 	cg := api.ConnectGraph{
-		IPFSLinks:     make(map[peer.ID][]peer.ID),
-		ClusterLinks:  make(map[peer.ID][]peer.ID),
-		ClustertoIPFS: make(map[peer.ID]peer.ID),
+		IPFSLinks:        make(map[peer.ID][]peer.ID),
+		ClusterLinks:     make(map[peer.ID][]peer.ID),
+		ClustertoIPFS:    make(map[peer.ID]peer.ID),
+		ClusterLatencies: make(map[peer.ID]map[peer.ID]time.Duration),
 	}
 	members, err := c.consensus.Peers()
 	if err != nil {
@@ -43,6 +47,7 @@ func (c *Cluster) ConnectGraph() (api.ConnectGraph, error) {
 		}
 
 		selfConnection, pID := c.recordClusterLinks(&cg, p, peersSerials[i])
+		c.recordClusterLatencies(&cg, p)
 
 		// IPFS connections
 		if !selfConnection {
@@ -74,6 +79,20 @@ func (c *Cluster) recordClusterLinks(cg *api.ConnectGraph, p peer.ID, sPeers []a
 	return selfConnection, pID
 }
 
+func (c *Cluster) recordClusterLatencies(cg *api.ConnectGraph, p peer.ID) {
+	var latencies map[string]time.Duration
+	err := c.rpcClient.Call(p,
+		"Cluster",
+		"PeerLatencies",
+		struct{}{},
+		&latencies,
+	)
+	if err != nil || len(latencies) == 0 {
+		return
+	}
+	cg.ClusterLatencies[p] = api.SerialToLatencies(latencies)
+}
+
 func (c *Cluster) recordIPFSLinks(cg *api.ConnectGraph, pID api.ID) {
 	ipfsID := pID.IPFS.ID
 	if pID.IPFS.Error != "" { // Only setting ipfs connections when no error occurs
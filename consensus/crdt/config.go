@@ -0,0 +1,134 @@
+package crdt
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+var configKey = "crdt"
+
+// Configuration defaults
+var (
+	DefaultDataSubFolder       = "crdt"
+	DefaultTopicName           = "ipfs-cluster-crdt"
+	DefaultRebroadcastInterval = 10 * time.Second
+	DefaultPeerTimeout         = 30 * time.Second
+)
+
+// Config allows to configure the CRDT Consensus component for ipfs-cluster.
+// It implements the ComponentConfig interface.
+type Config struct {
+	config.Saver
+
+	// will shutdown libp2p host on shutdown. Useful for testing
+	hostShutdown bool
+
+	// A folder to store the local datastore holding the pinset.
+	DataFolder string
+
+	// TopicName is the PubSub topic used to broadcast pinset updates
+	// and heartbeats among cluster peers.
+	TopicName string
+
+	// RebroadcastInterval specifies how often a peer announces itself
+	// (and the latest version of its pinset) to the rest of the cluster.
+	RebroadcastInterval time.Duration
+
+	// PeerTimeout specifies how long after the last heartbeat a peer
+	// is no longer considered part of the peerset.
+	PeerTimeout time.Duration
+}
+
+type jsonConfig struct {
+	DataFolder          string `json:"data_folder,omitempty"`
+	TopicName           string `json:"topic_name"`
+	RebroadcastInterval string `json:"rebroadcast_interval"`
+	PeerTimeout         string `json:"peer_timeout"`
+}
+
+// ConfigKey returns a human-friendly indentifier for this Config.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Validate checks that this configuration has working values,
+// at least in appearance.
+func (cfg *Config) Validate() error {
+	if cfg.TopicName == "" {
+		return errors.New("crdt.topic_name is empty")
+	}
+
+	if cfg.RebroadcastInterval <= 0 {
+		return errors.New("crdt.rebroadcast_interval is invalid")
+	}
+
+	if cfg.PeerTimeout <= cfg.RebroadcastInterval {
+		return errors.New("crdt.peer_timeout should be larger than crdt.rebroadcast_interval")
+	}
+	return nil
+}
+
+// LoadJSON parses a json-encoded configuration (see jsonConfig).
+// The Config will have default values for all fields not explicited
+// in the given json object.
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Error("Error unmarshaling crdt config")
+		return err
+	}
+
+	cfg.Default()
+
+	parseDuration := func(txt string) time.Duration {
+		d, _ := time.ParseDuration(txt)
+		if txt != "" && d == 0 {
+			logger.Warningf("%s is not a valid duration. Default will be used", txt)
+		}
+		return d
+	}
+
+	rebroadcastInterval := parseDuration(jcfg.RebroadcastInterval)
+	peerTimeout := parseDuration(jcfg.PeerTimeout)
+
+	config.SetIfNotDefault(jcfg.DataFolder, &cfg.DataFolder)
+	config.SetIfNotDefault(jcfg.TopicName, &cfg.TopicName)
+	config.SetIfNotDefault(rebroadcastInterval, &cfg.RebroadcastInterval)
+	config.SetIfNotDefault(peerTimeout, &cfg.PeerTimeout)
+
+	return cfg.Validate()
+}
+
+// ToJSON returns the pretty JSON representation of a Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{
+		DataFolder:          cfg.DataFolder,
+		TopicName:           cfg.TopicName,
+		RebroadcastInterval: cfg.RebroadcastInterval.String(),
+		PeerTimeout:         cfg.PeerTimeout.String(),
+	}
+
+	return config.DefaultJSONMarshal(jcfg)
+}
+
+// Default initializes this configuration with working defaults.
+func (cfg *Config) Default() error {
+	cfg.DataFolder = "" // empty so it gets omitted
+	cfg.TopicName = DefaultTopicName
+	cfg.RebroadcastInterval = DefaultRebroadcastInterval
+	cfg.PeerTimeout = DefaultPeerTimeout
+	return nil
+}
+
+// GetDataFolder returns the folder used to store the CRDT datastore.
+func (cfg *Config) GetDataFolder() string {
+	if cfg.DataFolder == "" {
+		return filepath.Join(cfg.BaseDir, DefaultDataSubFolder)
+	}
+	return cfg.DataFolder
+}
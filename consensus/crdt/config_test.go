@@ -0,0 +1,88 @@
+package crdt
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+var cfgJSON = []byte(`
+{
+    "topic_name": "crdt-test",
+    "rebroadcast_interval": "5s",
+    "peer_timeout": "20s"
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.TopicName != "crdt-test" ||
+		cfg.RebroadcastInterval != 5*time.Second ||
+		cfg.PeerTimeout != 20*time.Second {
+		t.Error("wrong values loaded")
+	}
+
+	j := &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.RebroadcastInterval = "-1s"
+	tst, _ := json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding rebroadcast_interval")
+	}
+
+	json.Unmarshal(cfgJSON, j)
+	j.PeerTimeout = "abc"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PeerTimeout != DefaultPeerTimeout {
+		t.Error("expected default peer_timeout")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.TopicName = ""
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.RebroadcastInterval = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.PeerTimeout = cfg.RebroadcastInterval
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
@@ -0,0 +1,1017 @@
+// Package crdt implements a Consensus component for IPFS Cluster which
+// replicates the shared pinset as a CRDT (a last-writer-wins map) using
+// libp2p PubSub and persists it in a local datastore.
+//
+// Unlike Raft, this component does not need a quorum of peers to accept
+// updates: every peer can modify the pinset at any time and all peers
+// eventually converge to the same state. Peers which miss updates (i.e.
+// because they were offline) notice it thanks to the regular heartbeats
+// sent by other peers and fetch the entries they miss directly from them.
+//
+// Removed pins are kept as tombstones until every peer in the peerset has
+// announced the same pinset as ours, which acknowledges them. From then
+// on, peers hold every entry (or its removal) up to the clock of the
+// removed tombstones, so older entries which they do not know about are
+// ignored. Peers which are offline for longer than the peer timeout are
+// not part of the peerset. When they come back, they drop their entries
+// which the rest of the peerset has removed in the meantime, along with
+// any new pins they added while offline which are not newer than them.
+package crdt
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	leveldb "github.com/ipfs/go-ds-leveldb"
+	logging "github.com/ipfs/go-log"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+	host "github.com/libp2p/go-libp2p-host"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	protocol "github.com/libp2p/go-libp2p-protocol"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	msgpack "github.com/multiformats/go-multicodec/msgpack"
+)
+
+var logger = logging.Logger("consensus")
+
+// SyncProtocol is the libp2p protocol used by peers to fetch the pinset
+// from other peers when they detect that they have diverged.
+var SyncProtocol protocol.ID = "/ipfs-cluster/crdt/sync/1.0.0"
+
+var pinsNamespace = ds.NewKey("/pins")
+var drainNamespace = ds.NewKey("/draining")
+var gcClockKey = ds.NewKey("/gcclock")
+
+// maxDeltaEntries is the maximum number of entries sent in a single
+// delta message. Larger batches are broadcasted in several messages.
+var maxDeltaEntries = 1000
+
+// syncQueueSize is the number of peers which can be waiting to be synced
+// from after their heartbeats show that our pinsets have diverged.
+var syncQueueSize = 16
+
+// Consensus implements the Consensus interface by replicating the
+// pinset as a CRDT among all peers which subscribe to the same
+// PubSub topic.
+type Consensus struct {
+	ctx    context.Context
+	cancel func()
+	config *Config
+
+	host         host.Host
+	pubsub       *pubsub.PubSub
+	subscription *pubsub.Subscription
+	store        ds.Batching
+
+	// entriesMux protects the datastore entries, the state
+	// and the following values
+	entriesMux sync.Mutex
+	state      state.State
+	clock      uint64
+	digest     uint64
+	count      int
+	// tombstones holds the deleted entries, which are removed
+	// once their clock is not higher than gcClock. We hold every
+	// entry, or its removal, up to gcClock.
+	tombstones map[ds.Key]tombstone
+	gcClock    uint64
+
+	// acked holds, for every peer, our clock when the peer last
+	// announced the same pinset as ours.
+	peersMux sync.RWMutex
+	peers    map[peer.ID]time.Time
+	acked    map[peer.ID]uint64
+	started  time.Time
+
+	syncingMux sync.Mutex
+	syncing    map[peer.ID]struct{}
+	syncCh     chan peer.ID
+
+	rpcClient *rpc.Client
+	rpcReady  chan struct{}
+	readyCh   chan struct{}
+
+	shutdownLock sync.RWMutex
+	shutdown     bool
+	wg           sync.WaitGroup
+}
+
+// NewConsensus builds a new CRDT Consensus component. The given PubSub
+// instance is used to exchange updates with other peers. The given state
+// is filled with the pinset persisted in the datastore and kept up to date
+// from then on.
+func NewConsensus(
+	h host.Host,
+	psub *pubsub.PubSub,
+	cfg *Config,
+	st state.State,
+) (*Consensus, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(cfg.GetDataFolder(), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := leveldb.NewDatastore(cfg.GetDataFolder(), nil)
+	if err != nil {
+		logger.Error("error opening crdt datastore: ", err)
+		return nil, err
+	}
+
+	subscription, err := psub.Subscribe(cfg.TopicName)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cc := &Consensus{
+		ctx:          ctx,
+		cancel:       cancel,
+		config:       cfg,
+		host:         h,
+		pubsub:       psub,
+		subscription: subscription,
+		store:        store,
+		state:        st,
+		tombstones:   make(map[ds.Key]tombstone),
+		peers:        make(map[peer.ID]time.Time),
+		acked:        make(map[peer.ID]uint64),
+		started:      time.Now(),
+		syncing:      make(map[peer.ID]struct{}),
+		syncCh:       make(chan peer.ID, syncQueueSize),
+		rpcReady:     make(chan struct{}, 1),
+		readyCh:      make(chan struct{}, 1),
+	}
+
+	err = cc.loadState()
+	if err != nil {
+		logger.Error("error loading state from crdt datastore: ", err)
+		subscription.Cancel()
+		store.Close()
+		cancel()
+		return nil, err
+	}
+
+	h.SetStreamHandler(SyncProtocol, cc.handleSyncStream)
+
+	go cc.finishBootstrap()
+	return cc, nil
+}
+
+// loadState fills the state with the entries in the datastore.
+func (cc *Consensus) loadState() error {
+	entries, err := cc.entries()
+	if err != nil {
+		return err
+	}
+
+	cc.entriesMux.Lock()
+	defer cc.entriesMux.Unlock()
+
+	b, err := cc.store.Get(gcClockKey)
+	switch err {
+	case nil:
+		cc.gcClock = binary.BigEndian.Uint64(b)
+		cc.clock = cc.gcClock
+	case ds.ErrNotFound:
+	default:
+		return err
+	}
+
+	for _, e := range entries {
+		cc.count++
+		cc.digest ^= e.hash()
+		if e.Clock > cc.clock {
+			cc.clock = e.Clock
+		}
+		if e.Deleted {
+			cc.tombstones[e.key()] = tombstone{e.Clock, e.hash()}
+			continue
+		}
+		if e.Drain != "" {
+			err = cc.setDraining(e)
+		} else {
+			err = cc.state.Add(e.Pin.ToPin())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	logger.Infof("crdt: %d entries loaded from datastore", len(entries))
+	return nil
+}
+
+// waits until we have RPC and syncs the pinset from the peers we
+// are connected to, then signals the component as Ready.
+func (cc *Consensus) finishBootstrap() {
+	select {
+	case <-cc.ctx.Done():
+		return
+	case <-cc.rpcReady:
+	}
+
+	// Do not shutdown while launching threads
+	cc.shutdownLock.RLock()
+	if cc.shutdown {
+		cc.shutdownLock.RUnlock()
+		return
+	}
+	cc.wg.Add(3)
+	go cc.handlePubsub()
+	go cc.syncWorker()
+	go cc.rebroadcast()
+	cc.shutdownLock.RUnlock()
+
+	cc.WaitForSync()
+	logger.Debug("consensus ready")
+	cc.readyCh <- struct{}{}
+}
+
+// Shutdown stops the component so it will not process any
+// more updates.
+func (cc *Consensus) Shutdown() error {
+	cc.shutdownLock.Lock()
+	defer cc.shutdownLock.Unlock()
+
+	if cc.shutdown {
+		logger.Debug("already shutdown")
+		return nil
+	}
+
+	logger.Info("stopping Consensus component")
+
+	cc.cancel()
+	cc.host.RemoveStreamHandler(SyncProtocol)
+	cc.subscription.Cancel()
+	cc.wg.Wait()
+
+	err := cc.store.Close()
+	if err != nil {
+		logger.Error(err)
+	}
+
+	if cc.config.hostShutdown {
+		cc.host.Close()
+	}
+
+	cc.shutdown = true
+	close(cc.rpcReady)
+	return nil
+}
+
+// SetClient makes the component ready to perform RPC requets
+func (cc *Consensus) SetClient(c *rpc.Client) {
+	cc.rpcClient = c
+	cc.rpcReady <- struct{}{}
+}
+
+// Ready returns a channel which is signaled when the Consensus
+// component has loaded its state and is ready to use.
+func (cc *Consensus) Ready() <-chan struct{} {
+	return cc.readyCh
+}
+
+// LogPin adds a pin to the shared state and broadcasts the update to
+// the rest of the peers.
+func (cc *Consensus) LogPin(pin api.Pin) error {
+	err := cc.commit(api.PinBatch{Pins: []api.Pin{pin}})
+	if err != nil {
+		return err
+	}
+	logger.Infof("pin committed to global state: %s", pin.Cid)
+	return nil
+}
+
+// LogUnpin removes a pin from the shared state and broadcasts the update
+// to the rest of the peers.
+func (cc *Consensus) LogUnpin(pin api.Pin) error {
+	err := cc.commit(api.PinBatch{Unpins: []api.Pin{pin}})
+	if err != nil {
+		return err
+	}
+	logger.Infof("unpin committed to global state: %s", pin.Cid)
+	return nil
+}
+
+// LogBatch adds and removes several pins from the shared state and
+// broadcasts the updates to the rest of the peers. Unpins are applied
+// before pins.
+func (cc *Consensus) LogBatch(b api.PinBatch) error {
+	err := cc.commit(b)
+	if err != nil {
+		return err
+	}
+	logger.Infof("batch of %d operations committed to global state",
+		len(b.Pins)+len(b.Unpins))
+	return nil
+}
+
+// LogUpdate adds the given pin and removes the one it replaces (set in
+// its PinUpdate option), in that order, and broadcasts both updates
+// together.
+func (cc *Consensus) LogUpdate(pin api.Pin) error {
+	from, err := cid.Decode(pin.PinUpdate)
+	if err != nil {
+		return fmt.Errorf("error decoding the updated Cid: %s", err)
+	}
+
+	err = cc.commitEntries([]entry{
+		{Pin: pin.ToSerial()},
+		{Pin: api.PinCid(from).ToSerial(), Deleted: true, Replaced: true},
+	})
+	if err != nil {
+		return err
+	}
+	logger.Infof("update committed to global state: %s", pin.Cid)
+	return nil
+}
+
+// LogDrain marks a peer as draining in the shared state, or removes the
+// mark, and broadcasts the update to the rest of the peers.
+func (cc *Consensus) LogDrain(pid peer.ID, draining bool) error {
+	err := cc.commitEntries([]entry{
+		{Drain: peer.IDB58Encode(pid), Deleted: !draining},
+	})
+	if err != nil {
+		return err
+	}
+	logger.Infof("drain mark (%t) committed to global state: %s", draining, pid.Pretty())
+	return nil
+}
+
+// commit commits new entries for the unpins and the pins in the given
+// batch, in that order.
+func (cc *Consensus) commit(b api.PinBatch) error {
+	entries := make([]entry, 0, len(b.Unpins)+len(b.Pins))
+	for _, pin := range b.Unpins {
+		entries = append(entries, entry{Pin: pin.ToSerial(), Deleted: true})
+	}
+	for _, pin := range b.Pins {
+		entries = append(entries, entry{Pin: pin.ToSerial()})
+	}
+	return cc.commitEntries(entries)
+}
+
+// commitEntries stamps the given entries, applies them locally in order
+// and broadcasts them.
+func (cc *Consensus) commitEntries(entries []entry) error {
+	cc.shutdownLock.RLock() // do not shut down while committing
+	defer cc.shutdownLock.RUnlock()
+	if cc.shutdown {
+		return errors.New("consensus is shutdown")
+	}
+
+	self := peer.IDB58Encode(cc.host.ID())
+
+	// Entries applied before a failure are still broadcasted,
+	// as they are already part of our state.
+	var applyErr error
+	cc.entriesMux.Lock()
+	for i := range entries {
+		entries[i].Clock = cc.clock + 1
+		entries[i].Peer = self
+		applyErr = cc.applyEntry(entries[i])
+		if applyErr != nil {
+			entries = entries[:i]
+			break
+		}
+	}
+	cc.entriesMux.Unlock()
+
+	for len(entries) > 0 {
+		n := len(entries)
+		if n > maxDeltaEntries {
+			n = maxDeltaEntries
+		}
+		err := cc.publish(&message{
+			Type:    msgDelta,
+			Entries: entries[:n],
+		})
+		if err != nil {
+			return err
+		}
+		entries = entries[n:]
+	}
+	return applyErr
+}
+
+// AddPeer marks a peer as part of the peerset. There is no membership
+// in CRDT consensus: any peer subscribed to the topic is part of the
+// cluster, so this only saves waiting until it sends its first heartbeat.
+// Roles do not apply either: every peer can commit updates.
+func (cc *Consensus) AddPeer(pid peer.ID, role api.PeerRole) error {
+	cc.seen(pid)
+	logger.Infof("peer added to the crdt peerset: %s", pid.Pretty())
+	return nil
+}
+
+// RmPeer removes a peer from the peerset. If the peer keeps sending
+// heartbeats, it will be considered part of the peerset again.
+func (cc *Consensus) RmPeer(pid peer.ID) error {
+	cc.peersMux.Lock()
+	delete(cc.peers, pid)
+	delete(cc.acked, pid)
+	cc.peersMux.Unlock()
+	logger.Infof("peer removed from the crdt peerset: %s", pid.Pretty())
+	return nil
+}
+
+// Role returns PeerRoleVoter, since every peer can commit updates
+// to the shared state.
+func (cc *Consensus) Role() api.PeerRole {
+	return api.PeerRoleVoter
+}
+
+// State returns the current state as known by this peer.
+func (cc *Consensus) State() (state.State, error) {
+	return cc.state, nil
+}
+
+// Leader returns the peer with the lowest ID among the current peerset.
+// CRDT consensus does not need a leader, but this allows to pick a single
+// peer to perform tasks that should not run everywhere. Since peers may
+// have slightly different views of the peerset, several peers may
+// believe to be the leader for short periods of time.
+func (cc *Consensus) Leader() (peer.ID, error) {
+	peers, err := cc.Peers()
+	if err != nil {
+		return "", err
+	}
+	return peers[0], nil
+}
+
+// WaitForSync fetches the pinset from all the peers this host is
+// connected to, in parallel, and merges it with the local one. Failing
+// to sync from a peer is not an error.
+func (cc *Consensus) WaitForSync() error {
+	var wg sync.WaitGroup
+	for _, p := range cc.host.Network().Peers() {
+		wg.Add(1)
+		go func(p peer.ID) {
+			defer wg.Done()
+			cc.syncFrom(p)
+		}(p)
+	}
+	wg.Wait()
+	return nil
+}
+
+// Clean removes all the CRDT data from disk. Next time a new, empty,
+// datastore will be created.
+func (cc *Consensus) Clean() error {
+	cc.shutdownLock.RLock()
+	defer cc.shutdownLock.RUnlock()
+	if !cc.shutdown {
+		return errors.New("consensus component is not shutdown")
+	}
+
+	return os.RemoveAll(cc.config.GetDataFolder())
+}
+
+// Peers returns this peer along with the peers from which we have
+// received a heartbeat recently. The list will be sorted alphabetically.
+func (cc *Consensus) Peers() ([]peer.ID, error) {
+	cc.shutdownLock.RLock() // prevent shutdown while here
+	defer cc.shutdownLock.RUnlock()
+
+	if cc.shutdown {
+		return nil, errors.New("consensus is shutdown")
+	}
+
+	peers := []peer.ID{cc.host.ID()}
+	now := time.Now()
+	cc.peersMux.RLock()
+	for p, lastSeen := range cc.peers {
+		if p != cc.host.ID() && now.Sub(lastSeen) < cc.config.PeerTimeout {
+			peers = append(peers, p)
+		}
+	}
+	cc.peersMux.RUnlock()
+
+	sort.Slice(peers, func(i, j int) bool {
+		return peer.IDB58Encode(peers[i]) < peer.IDB58Encode(peers[j])
+	})
+	return peers, nil
+}
+
+func (cc *Consensus) seen(pid peer.ID) {
+	cc.peersMux.Lock()
+	cc.peers[pid] = time.Now()
+	cc.peersMux.Unlock()
+}
+
+// handlePubsub processes the messages received on the PubSub topic.
+func (cc *Consensus) handlePubsub() {
+	defer cc.wg.Done()
+	for {
+		msg, err := cc.subscription.Next(cc.ctx)
+		if err != nil { // context cancelled or subscription closed
+			return
+		}
+
+		from := msg.GetFrom()
+		if from == cc.host.ID() {
+			continue
+		}
+
+		var m message
+		err = decode(msg.GetData(), &m)
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+
+		cc.seen(from)
+
+		switch m.Type {
+		case msgDelta:
+			logger.Debugf("received %d crdt entries from %s", len(m.Entries), from.Pretty())
+			cc.merge(m.Entries)
+		case msgHeartbeat:
+			cc.handleHeartbeat(from, m)
+		default:
+			logger.Error("unknown crdt message type. Ignoring")
+		}
+	}
+}
+
+// handleHeartbeat compares the sender's pinset with ours, leaving out
+// our tombstones that the sender has removed already. When they are the
+// same, we remove those tombstones too and the sender has acknowledged
+// all our entries. Otherwise, we sync from it.
+func (cc *Consensus) handleHeartbeat(from peer.ID, m message) {
+	cc.entriesMux.Lock()
+	// our next entries must win over the ones the sender removed
+	if m.GCClock > cc.clock {
+		cc.clock = m.GCClock
+	}
+	digest, count := cc.digest, cc.count
+	if m.GCClock > cc.gcClock {
+		for _, t := range cc.tombstones {
+			if t.clock <= m.GCClock {
+				digest ^= t.hash
+				count--
+			}
+		}
+	}
+	diverged := digest != m.Digest || count != m.Count
+	if !diverged {
+		cc.setGCClock(m.GCClock)
+	}
+	clock := cc.clock
+	cc.entriesMux.Unlock()
+
+	if !diverged {
+		cc.peersMux.Lock()
+		cc.acked[from] = clock
+		cc.peersMux.Unlock()
+		return
+	}
+
+	logger.Debugf("pinset differs from %s's. Syncing", from.Pretty())
+	select {
+	case cc.syncCh <- from:
+	default:
+		logger.Debugf("sync queue is full. Not syncing from %s", from.Pretty())
+	}
+}
+
+// syncWorker syncs from the peers queued by handleHeartbeat.
+func (cc *Consensus) syncWorker() {
+	defer cc.wg.Done()
+	for {
+		select {
+		case <-cc.ctx.Done():
+			return
+		case p := <-cc.syncCh:
+			cc.syncFrom(p)
+		}
+	}
+}
+
+// collectTombstones removes the tombstones which all the peers in the
+// peerset have acknowledged. Tombstones are only needed to win over the
+// older entries for the same pins, which those peers do not have anymore.
+// Nothing is removed until the peerset is known, one peer timeout after
+// starting.
+func (cc *Consensus) collectTombstones() {
+	if time.Since(cc.started) < cc.config.PeerTimeout {
+		return
+	}
+
+	cc.entriesMux.Lock()
+	acked := cc.clock
+	cc.entriesMux.Unlock()
+
+	now := time.Now()
+	cc.peersMux.RLock()
+	for p, lastSeen := range cc.peers {
+		if p == cc.host.ID() || now.Sub(lastSeen) >= cc.config.PeerTimeout {
+			continue
+		}
+		if cc.acked[p] < acked {
+			acked = cc.acked[p]
+		}
+	}
+	cc.peersMux.RUnlock()
+
+	cc.entriesMux.Lock()
+	cc.setGCClock(acked)
+	cc.entriesMux.Unlock()
+}
+
+// setGCClock raises the gcClock and removes the tombstones which are not
+// needed anymore. It must be called with the entriesMux lock held.
+func (cc *Consensus) setGCClock(clock uint64) {
+	if clock <= cc.gcClock {
+		return
+	}
+
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, clock)
+	err := cc.store.Put(gcClockKey, b)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	cc.gcClock = clock
+	if clock > cc.clock {
+		cc.clock = clock
+	}
+	cc.removeTombstones()
+}
+
+// removeTombstones deletes the tombstones whose clock is not higher than
+// the gcClock. It must be called with the entriesMux lock held.
+func (cc *Consensus) removeTombstones() {
+	n := 0
+	for key, t := range cc.tombstones {
+		if t.clock > cc.gcClock {
+			continue
+		}
+		err := cc.store.Delete(key)
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		delete(cc.tombstones, key)
+		cc.digest ^= t.hash
+		cc.count--
+		n++
+	}
+	if n > 0 {
+		logger.Debugf("%d crdt tombstones removed", n)
+	}
+}
+
+// rebroadcast regularly sends heartbeats with the pinset digest.
+func (cc *Consensus) rebroadcast() {
+	defer cc.wg.Done()
+
+	ticker := time.NewTicker(cc.config.RebroadcastInterval)
+	defer ticker.Stop()
+
+	for {
+		cc.collectTombstones()
+
+		cc.entriesMux.Lock()
+		hb := &message{
+			Type:    msgHeartbeat,
+			Digest:  cc.digest,
+			Count:   cc.count,
+			GCClock: cc.gcClock,
+		}
+		cc.entriesMux.Unlock()
+
+		err := cc.publish(hb)
+		if err != nil {
+			logger.Error(err)
+		}
+
+		select {
+		case <-cc.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cc *Consensus) publish(m *message) error {
+	b, err := encode(m)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	return cc.pubsub.Publish(cc.config.TopicName, b)
+}
+
+// syncFrom fetches all the entries from the given peer and merges them.
+func (cc *Consensus) syncFrom(p peer.ID) {
+	cc.syncingMux.Lock()
+	if _, ok := cc.syncing[p]; ok {
+		cc.syncingMux.Unlock()
+		return
+	}
+	cc.syncing[p] = struct{}{}
+	cc.syncingMux.Unlock()
+
+	defer func() {
+		cc.syncingMux.Lock()
+		delete(cc.syncing, p)
+		cc.syncingMux.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(cc.ctx, cc.config.PeerTimeout)
+	defer cancel()
+
+	s, err := cc.host.NewStream(ctx, p, SyncProtocol)
+	if err != nil {
+		logger.Debugf("cannot sync from %s: %s", p.Pretty(), err)
+		return
+	}
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(cc.config.PeerTimeout))
+
+	var resp syncResponse
+	dec := msgpack.Multicodec(msgpackHandle).Decoder(s)
+	err = dec.Decode(&resp)
+	if err != nil {
+		logger.Errorf("error syncing from %s: %s", p.Pretty(), err)
+		return
+	}
+	logger.Debugf("received %d crdt entries from %s during sync", len(resp.Entries), p.Pretty())
+	cc.mergeSync(resp)
+}
+
+// handleSyncStream sends all our entries to the requesting peer.
+func (cc *Consensus) handleSyncStream(s inet.Stream) {
+	defer s.Close()
+
+	// the entries must include everything up to the gcClock
+	cc.entriesMux.Lock()
+	gcClock := cc.gcClock
+	entries, err := cc.entries()
+	cc.entriesMux.Unlock()
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	enc := msgpack.Multicodec(msgpackHandle).Encoder(s)
+	err = enc.Encode(syncResponse{
+		Entries: entries,
+		GCClock: gcClock,
+	})
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// entries returns all the entries in the datastore, drain marks
+// included.
+func (cc *Consensus) entries() ([]entry, error) {
+	var entries []entry
+	for _, ns := range []ds.Key{pinsNamespace, drainNamespace} {
+		results, err := cc.store.Query(query.Query{
+			Prefix: ns.String(),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for r := range results.Next() {
+			if r.Error != nil {
+				results.Close()
+				return nil, r.Error
+			}
+			var e entry
+			err = decode(r.Value, &e)
+			if err != nil {
+				results.Close()
+				return nil, err
+			}
+			entries = append(entries, e)
+		}
+		results.Close()
+	}
+	return entries, nil
+}
+
+func (cc *Consensus) merge(entries []entry) {
+	cc.entriesMux.Lock()
+	defer cc.entriesMux.Unlock()
+	for _, e := range entries {
+		err := cc.applyEntry(e)
+		if err != nil {
+			logger.Error(err)
+		}
+	}
+}
+
+// mergeSync merges the entries obtained from a peer. The peer holds
+// every entry, or its removal, up to its gcClock. Our entries up to that
+// clock which the peer does not have were removed by the rest of the
+// peerset while we were not part of it, so we remove them too, after
+// which we can adopt its gcClock.
+func (cc *Consensus) mergeSync(resp syncResponse) {
+	cc.entriesMux.Lock()
+	defer cc.entriesMux.Unlock()
+
+	remote := make(map[ds.Key]struct{}, len(resp.Entries))
+	for _, e := range resp.Entries {
+		remote[e.key()] = struct{}{}
+		err := cc.applyEntry(e)
+		if err != nil {
+			logger.Error(err)
+		}
+	}
+
+	if resp.GCClock <= cc.gcClock {
+		return
+	}
+
+	local, err := cc.entries()
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	n := 0
+	for _, e := range local {
+		if _, ok := remote[e.key()]; ok || e.Clock > resp.GCClock {
+			continue
+		}
+		err := cc.removeEntry(e)
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+		n++
+	}
+	if n > 0 {
+		logger.Infof("%d crdt entries removed by the rest of the peerset were dropped", n)
+	}
+	cc.setGCClock(resp.GCClock)
+}
+
+// removeEntry removes an entry from the datastore and undoes its effects
+// on the state. It must be called with the entriesMux lock held.
+func (cc *Consensus) removeEntry(e entry) error {
+	key := e.key()
+	err := cc.store.Delete(key)
+	if err != nil {
+		return err
+	}
+	cc.digest ^= e.hash()
+	cc.count--
+	delete(cc.tombstones, key)
+
+	switch {
+	case e.Deleted:
+		return nil
+	case e.Drain != "":
+		e.Deleted = true
+		return cc.setDraining(e)
+	}
+
+	err = cc.state.Rm(e.Pin.DecodeCid())
+	if err != nil {
+		return err
+	}
+	cc.rpcClient.Go(
+		"",
+		"Cluster",
+		"Untrack",
+		e.Pin,
+		&struct{}{},
+		nil,
+	)
+	return nil
+}
+
+// applyEntry stores the given entry when it is newer than the one we
+// have and updates the state and the tracker accordingly. It must be
+// called with the entriesMux lock held.
+func (cc *Consensus) applyEntry(e entry) error {
+	key := e.key()
+
+	var old entry
+	found := false
+	b, err := cc.store.Get(key)
+	switch err {
+	case nil:
+		err = decode(b, &old)
+		if err != nil {
+			return err
+		}
+		found = true
+	case ds.ErrNotFound:
+	default:
+		return err
+	}
+
+	if found && !e.newerThan(old) {
+		return nil
+	}
+	if !found && e.Clock <= cc.gcClock {
+		// We hold everything up to the gcClock, so this is an
+		// already removed tombstone or an entry it replaced.
+		return nil
+	}
+
+	b, err = encode(e)
+	if err != nil {
+		return err
+	}
+	err = cc.store.Put(key, b)
+	if err != nil {
+		return err
+	}
+
+	if found {
+		cc.digest ^= old.hash()
+	} else {
+		cc.count++
+	}
+	cc.digest ^= e.hash()
+	if e.Clock > cc.clock {
+		cc.clock = e.Clock
+	}
+	if e.Deleted {
+		cc.tombstones[key] = tombstone{e.Clock, e.hash()}
+	} else {
+		delete(cc.tombstones, key)
+	}
+
+	if e.Drain != "" {
+		return cc.setDraining(e)
+	}
+
+	// Async, we let the PinTracker take care of any problems
+	switch {
+	case !e.Deleted:
+		// The PinUpdate option is only relevant to the PinTracker.
+		pin := e.Pin.ToPin()
+		pin.PinUpdate = ""
+		err = cc.state.Add(pin)
+		if err != nil {
+			return err
+		}
+		cc.rpcClient.Go(
+			"",
+			"Cluster",
+			"Track",
+			e.Pin,
+			&struct{}{},
+			nil,
+		)
+	case found && !old.Deleted:
+		err = cc.state.Rm(e.Pin.DecodeCid())
+		if err != nil {
+			return err
+		}
+		// Pins replaced by an update are not unpinned before
+		// the new pin.
+		method := "Untrack"
+		if e.Replaced {
+			method = "UntrackUpdated"
+		}
+		cc.rpcClient.Go(
+			"",
+			"Cluster",
+			method,
+			old.Pin,
+			&struct{}{},
+			nil,
+		)
+	}
+	return nil
+}
+
+// setDraining applies the drain mark carried by the given entry.
+func (cc *Consensus) setDraining(e entry) error {
+	pid, err := peer.IDB58Decode(e.Drain)
+	if err != nil {
+		return err
+	}
+	return cc.state.SetDraining(pid, !e.Deleted)
+}
@@ -0,0 +1,466 @@
+package crdt
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state/mapstate"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+	libp2p "github.com/libp2p/go-libp2p"
+	host "github.com/libp2p/go-libp2p-host"
+	peerstore "github.com/libp2p/go-libp2p-peerstore"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+func cleanCRDT(idn int) {
+	os.RemoveAll(fmt.Sprintf("crdtFolderFromTests-%d", idn))
+}
+
+func testPin(c cid.Cid) api.Pin {
+	p := api.PinCid(c)
+	p.ReplicationFactorMin = -1
+	p.ReplicationFactorMax = -1
+	return p
+}
+
+func makeTestingHost(t *testing.T) host.Host {
+	h, err := libp2p.New(
+		context.Background(),
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func testingConsensusWithHost(t *testing.T, idn int, h host.Host) *Consensus {
+	psub, err := pubsub.NewGossipSub(context.Background(), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.DataFolder = fmt.Sprintf("crdtFolderFromTests-%d", idn)
+	cfg.RebroadcastInterval = 200 * time.Millisecond
+	cfg.PeerTimeout = time.Second
+	cfg.hostShutdown = true
+
+	cc, err := NewConsensus(h, psub, cfg, mapstate.NewMapState())
+	if err != nil {
+		t.Fatal("cannot create Consensus:", err)
+	}
+	cc.SetClient(test.NewMockRPCClientWithHost(t, h))
+	<-cc.Ready()
+	return cc
+}
+
+func testingConsensus(t *testing.T, idn int) *Consensus {
+	cleanCRDT(idn)
+	return testingConsensusWithHost(t, idn, makeTestingHost(t))
+}
+
+func connect(t *testing.T, h1, h2 host.Host) {
+	h1.Peerstore().AddAddrs(h2.ID(), h2.Addrs(), peerstore.PermanentAddrTTL)
+	_, err := h1.Network().DialPeer(context.Background(), h2.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShutdownConsensus(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanCRDT(1)
+	err := cc.Shutdown()
+	if err != nil {
+		t.Fatal("Consensus cannot shutdown:", err)
+	}
+	err = cc.Shutdown() // should be fine to shutdown twice
+	if err != nil {
+		t.Fatal("Consensus should be able to shutdown several times")
+	}
+}
+
+func TestConsensusPin(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanCRDT(1) // Remember defer runs in LIFO order
+	defer cc.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cc.LogPin(testPin(c))
+	if err != nil {
+		t.Error("the operation did not make it to the state:", err)
+	}
+
+	st, err := cc.State()
+	if err != nil {
+		t.Fatal("error getting state:", err)
+	}
+
+	pins := st.List()
+	if len(pins) != 1 || pins[0].Cid.String() != test.TestCid1 {
+		t.Error("the added pin should be in the state")
+	}
+}
+
+func TestConsensusUnpin(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanCRDT(1)
+	defer cc.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cc.LogPin(testPin(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cc.LogUnpin(api.PinCid(c))
+	if err != nil {
+		t.Error("the operation did not make it to the state:", err)
+	}
+
+	st, _ := cc.State()
+	if st.Has(c) {
+		t.Error("the pin should have been removed")
+	}
+}
+
+func TestConsensusLogBatch(t *testing.T) {
+	defer func(n int) { maxDeltaEntries = n }(maxDeltaEntries)
+	maxDeltaEntries = 1
+
+	cleanCRDT(1)
+	cleanCRDT(2)
+	defer cleanCRDT(1)
+	defer cleanCRDT(2)
+
+	h1 := makeTestingHost(t)
+	h2 := makeTestingHost(t)
+	connect(t, h1, h2)
+
+	cc1 := testingConsensusWithHost(t, 1, h1)
+	defer cc1.Shutdown()
+	cc2 := testingConsensusWithHost(t, 2, h2)
+	defer cc2.Shutdown()
+
+	time.Sleep(time.Second)
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	err := cc1.LogPin(testPin(c1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// c1 is unpinned and pinned again: the pin wins
+	err = cc1.LogBatch(api.PinBatch{
+		Pins:   []api.Pin{testPin(c1), testPin(c2)},
+		Unpins: []api.Pin{api.PinCid(c1)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	for _, cc := range []*Consensus{cc1, cc2} {
+		st, _ := cc.State()
+		if !st.Has(c1) || !st.Has(c2) {
+			t.Error("the batch was not applied correctly")
+		}
+	}
+}
+
+func TestConsensusLogUpdate(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanCRDT(1)
+	defer cc.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	err := cc.LogPin(testPin(c1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pin := testPin(c2)
+	pin.PinUpdate = c1.String()
+	err = cc.LogUpdate(pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, _ := cc.State()
+	if st.Has(c1) || !st.Has(c2) {
+		t.Error("the update was not applied correctly")
+	}
+}
+
+func TestConsensusLogDrain(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanCRDT(1)
+
+	err := cc.LogDrain(test.TestPeerID1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, _ := cc.State()
+	d := st.Draining()
+	if len(d) != 1 || d[0] != test.TestPeerID1 {
+		t.Fatal("the peer should be draining")
+	}
+	cc.Shutdown()
+
+	cc = testingConsensusWithHost(t, 1, makeTestingHost(t))
+	defer cc.Shutdown()
+	st, _ = cc.State()
+	if len(st.Draining()) != 1 {
+		t.Fatal("the drain mark was not restored from the datastore")
+	}
+
+	err = cc.LogDrain(test.TestPeerID1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Draining()) != 0 {
+		t.Error("the drain mark should have been removed")
+	}
+}
+
+func TestConsensusPersistence(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanCRDT(1)
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	cc.LogPin(testPin(c1))
+	cc.LogPin(testPin(c2))
+	cc.LogUnpin(api.PinCid(c2))
+	cc.Shutdown()
+
+	cc = testingConsensusWithHost(t, 1, makeTestingHost(t))
+	defer cc.Shutdown()
+	st, _ := cc.State()
+	if !st.Has(c1) || st.Has(c2) {
+		t.Error("the state was not restored from the datastore")
+	}
+}
+
+func TestConsensusPeersAndLeader(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanCRDT(1)
+	defer cc.Shutdown()
+
+	peers, err := cc.Peers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || peers[0] != cc.host.ID() {
+		t.Fatal("expected only ourselves in the peerset")
+	}
+
+	cc.AddPeer(test.TestPeerID1, api.PeerRoleNonVoter)
+	peers, _ = cc.Peers()
+	if len(peers) != 2 {
+		t.Fatal("expected two peers in the peerset")
+	}
+
+	leader, err := cc.Leader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leader != peers[0] {
+		t.Error("the leader should be the first peer")
+	}
+
+	cc.RmPeer(test.TestPeerID1)
+	peers, _ = cc.Peers()
+	if len(peers) != 1 {
+		t.Fatal("expected one peer in the peerset")
+	}
+}
+
+func TestConsensusReplication(t *testing.T) {
+	cleanCRDT(1)
+	cleanCRDT(2)
+	defer cleanCRDT(1)
+	defer cleanCRDT(2)
+
+	h1 := makeTestingHost(t)
+	h2 := makeTestingHost(t)
+	connect(t, h1, h2)
+
+	cc1 := testingConsensusWithHost(t, 1, h1)
+	defer cc1.Shutdown()
+	cc2 := testingConsensusWithHost(t, 2, h2)
+	defer cc2.Shutdown()
+
+	// let pubsub meshes and heartbeats settle
+	time.Sleep(time.Second)
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cc1.LogPin(testPin(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	st2, _ := cc2.State()
+	if !st2.Has(c) {
+		t.Error("the pin should have been replicated")
+	}
+
+	peers, _ := cc2.Peers()
+	if len(peers) != 2 {
+		t.Error("both peers should be in the peerset")
+	}
+}
+
+func TestConsensusSyncOnHeartbeat(t *testing.T) {
+	cleanCRDT(1)
+	cleanCRDT(2)
+	defer cleanCRDT(1)
+	defer cleanCRDT(2)
+
+	h1 := makeTestingHost(t)
+	cc1 := testingConsensusWithHost(t, 1, h1)
+	defer cc1.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cc1.LogPin(testPin(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// peer 2 connects after the pin was broadcasted
+	h2 := makeTestingHost(t)
+	cc2 := testingConsensusWithHost(t, 2, h2)
+	defer cc2.Shutdown()
+	connect(t, h2, h1)
+
+	time.Sleep(2 * time.Second)
+	st2, _ := cc2.State()
+	if !st2.Has(c) {
+		t.Error("peer 2 should have synced the pin")
+	}
+}
+
+func TestConsensusTombstones(t *testing.T) {
+	cleanCRDT(1)
+	cleanCRDT(2)
+	defer cleanCRDT(1)
+	defer cleanCRDT(2)
+
+	h1 := makeTestingHost(t)
+	h2 := makeTestingHost(t)
+	cc1 := testingConsensusWithHost(t, 1, h1)
+	defer cc1.Shutdown()
+	cc2 := testingConsensusWithHost(t, 2, h2)
+	defer cc2.Shutdown()
+	connect(t, h1, h2)
+	time.Sleep(time.Second)
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cc1.LogPin(testPin(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cc1.LogUnpin(api.PinCid(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both peers announce the same pinset and remove the tombstone
+	time.Sleep(2 * time.Second)
+	for _, cc := range []*Consensus{cc1, cc2} {
+		cc.entriesMux.Lock()
+		if len(cc.tombstones) != 0 || cc.count != 0 || cc.digest != 0 {
+			t.Error("the tombstone should have been removed")
+		}
+		cc.entriesMux.Unlock()
+	}
+
+	// An old copy of the tombstone is not stored again
+	cc2.merge([]entry{{
+		Pin:     api.PinCid(c).ToSerial(),
+		Deleted: true,
+		Clock:   2,
+		Peer:    h1.ID().Pretty(),
+	}})
+	cc2.entriesMux.Lock()
+	if cc2.count != 0 {
+		t.Error("a removed tombstone should be ignored")
+	}
+	cc2.entriesMux.Unlock()
+}
+
+func TestConsensusTombstonesPartition(t *testing.T) {
+	cleanCRDT(1)
+	cleanCRDT(2)
+	defer cleanCRDT(1)
+	defer cleanCRDT(2)
+
+	h1 := makeTestingHost(t)
+	h2 := makeTestingHost(t)
+	cc1 := testingConsensusWithHost(t, 1, h1)
+	defer cc1.Shutdown()
+	cc2 := testingConsensusWithHost(t, 2, h2)
+	defer cc2.Shutdown()
+	connect(t, h1, h2)
+	time.Sleep(time.Second)
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cc1.LogPin(testPin(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	st2, _ := cc2.State()
+	if !st2.Has(c) {
+		t.Fatal("the pin should have been replicated")
+	}
+
+	// peer 2 is partitioned and misses the unpin
+	h1.Peerstore().ClearAddrs(h2.ID())
+	h2.Peerstore().ClearAddrs(h1.ID())
+	h1.Network().ClosePeer(h2.ID())
+	err = cc1.LogUnpin(api.PinCid(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// peer 2 times out and peer 1 removes the tombstone alone
+	time.Sleep(2 * time.Second)
+	cc1.entriesMux.Lock()
+	if len(cc1.tombstones) != 0 {
+		t.Error("the tombstone should have been removed")
+	}
+	cc1.entriesMux.Unlock()
+	if !st2.Has(c) {
+		t.Fatal("peer 2 should not have seen the unpin")
+	}
+
+	connect(t, h2, h1)
+	time.Sleep(2 * time.Second)
+
+	st1, _ := cc1.State()
+	if st1.Has(c) {
+		t.Error("the unpinned Cid should not have come back")
+	}
+	if st2.Has(c) {
+		t.Error("peer 2 should have dropped the unpinned Cid")
+	}
+	cc1.entriesMux.Lock()
+	cc2.entriesMux.Lock()
+	if cc1.digest != cc2.digest || cc1.count != 0 || cc2.count != 0 {
+		t.Error("both pinsets should be empty")
+	}
+	cc2.entriesMux.Unlock()
+	cc1.entriesMux.Unlock()
+}
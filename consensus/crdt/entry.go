@@ -0,0 +1,111 @@
+package crdt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	ds "github.com/ipfs/go-datastore"
+	msgpack "github.com/multiformats/go-multicodec/msgpack"
+)
+
+var msgpackHandle = msgpack.DefaultMsgpackHandle()
+
+// entry is the unit of replication of the shared pinset. The pinset is a
+// last-writer-wins map keyed by Cid: for every Cid, the entry with the
+// highest (Clock, Peer) pair is the one that prevails. Removals are kept
+// as tombstones (Deleted entries) so that they can win over older pins,
+// until all peers have acknowledged them.
+//
+// Entries with a Drain peer carry the drain mark of that peer instead of
+// a pin, and are keyed by it. Deleted drain entries remove the mark.
+type entry struct {
+	Pin     api.PinSerial
+	Drain   string
+	Deleted bool
+	// Replaced is set on the removal of a pin replaced by an update.
+	Replaced bool
+	// Clock is a Lamport clock. Local writes are always stamped with
+	// a clock higher than any other clock seen so far.
+	Clock uint64
+	// Peer is the peer that produced the entry and breaks ties among
+	// entries with the same Clock.
+	Peer string
+}
+
+// key returns the datastore key of the entry.
+func (e entry) key() ds.Key {
+	if e.Drain != "" {
+		return drainNamespace.ChildString(e.Drain)
+	}
+	return pinsNamespace.ChildString(e.Pin.Cid)
+}
+
+// newerThan returns true when e should replace other.
+func (e entry) newerThan(other entry) bool {
+	if e.Clock != other.Clock {
+		return e.Clock > other.Clock
+	}
+	return e.Peer > other.Peer
+}
+
+// hash returns a short hash identifying this version of the entry.
+// Hashes of all entries are XOR-ed together to obtain a digest of
+// the pinset which can be cheaply compared among peers.
+func (e entry) hash() uint64 {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s/%s/%d/%s/%t", e.Pin.Cid, e.Drain, e.Clock, e.Peer, e.Deleted)
+	return binary.BigEndian.Uint64(h.Sum(nil)[:8])
+}
+
+// Type of message sent on the PubSub topic
+const (
+	msgDelta = iota + 1
+	msgHeartbeat
+)
+
+// msgType identifies the type of a message
+type msgType int
+
+// tombstone identifies a deleted entry waiting to be removed.
+type tombstone struct {
+	clock uint64
+	hash  uint64
+}
+
+// message is what peers broadcast on the PubSub topic. Deltas carry
+// new entries. Heartbeats announce the sender and a digest of its
+// pinset, so that peers which have diverged can notice and sync, along
+// with the clock up to which the sender has removed tombstones.
+type message struct {
+	Type    msgType
+	Entries []entry
+	Digest  uint64
+	Count   int
+	GCClock uint64
+}
+
+// syncResponse is what peers send when others sync from them: all their
+// entries and the clock up to which they hold every entry or its removal.
+type syncResponse struct {
+	Entries []entry
+	GCClock uint64
+}
+
+func encode(obj interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.Multicodec(msgpackHandle).Encoder(&buf)
+	err := enc.Encode(obj)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decode(data []byte, obj interface{}) error {
+	dec := msgpack.Multicodec(msgpackHandle).Decoder(bytes.NewReader(data))
+	return dec.Decode(obj)
+}
@@ -0,0 +1,65 @@
+package crdt
+
+import (
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func TestEntryNewerThan(t *testing.T) {
+	pin := api.PinCid(test.MustDecodeCid(test.TestCid1)).ToSerial()
+	e1 := entry{Pin: pin, Clock: 1, Peer: "a"}
+	e2 := entry{Pin: pin, Clock: 2, Peer: "a"}
+	e3 := entry{Pin: pin, Clock: 2, Peer: "b", Deleted: true}
+
+	if !e2.newerThan(e1) || e1.newerThan(e2) {
+		t.Error("higher clocks should win")
+	}
+
+	if !e3.newerThan(e2) || e2.newerThan(e3) {
+		t.Error("ties should be broken by peer")
+	}
+
+	if e3.newerThan(e3) {
+		t.Error("an entry should not be newer than itself")
+	}
+}
+
+func TestEntryHash(t *testing.T) {
+	pin := api.PinCid(test.MustDecodeCid(test.TestCid1)).ToSerial()
+	e1 := entry{Pin: pin, Clock: 1, Peer: "a"}
+	e2 := entry{Pin: pin, Clock: 1, Peer: "a", Deleted: true}
+
+	if e1.hash() != e1.hash() {
+		t.Error("hash should be deterministic")
+	}
+
+	if e1.hash() == e2.hash() {
+		t.Error("different entries should have different hashes")
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	pin := api.PinCid(test.MustDecodeCid(test.TestCid1)).ToSerial()
+	m := &message{
+		Type:    msgDelta,
+		Entries: []entry{{Pin: pin, Clock: 3, Peer: "a"}},
+	}
+
+	b, err := encode(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m2 message
+	err = decode(b, &m2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m2.Type != msgDelta || len(m2.Entries) != 1 ||
+		m2.Entries[0].Clock != 3 || m2.Entries[0].Pin.Cid != test.TestCid1 {
+		t.Error("message not decoded correctly")
+	}
+}
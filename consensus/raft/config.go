@@ -44,6 +44,10 @@ type Config struct {
 	// peers (with no prior state). It is ignored when Raft was already
 	// initialized or when starting in staging mode.
 	InitPeerset []peer.ID
+	// NonVoter makes this peer request to be added as a non-voter when
+	// joining a cluster. Non-voters receive the log but do not count
+	// towards quorum. It has no effect when starting from InitPeerset.
+	NonVoter bool
 	// LeaderTimeout specifies how long to wait for a leader before
 	// failing an operation.
 	WaitForLeaderTimeout time.Duration
@@ -79,6 +83,9 @@ type jsonConfig struct {
 	// initialized or when starting in staging mode.
 	InitPeerset []string `json:"init_peerset"`
 
+	// NonVoter makes this peer join clusters as a non-voter
+	NonVoter bool `json:"non_voter,omitempty"`
+
 	// How long to wait for a leader before failing
 	WaitForLeaderTimeout string `json:"wait_for_leader_timeout"`
 
@@ -221,6 +228,7 @@ func (cfg *Config) LoadJSON(raw []byte) error {
 	config.SetIfNotDefault(leaderLeaseTimeout, &cfg.RaftConfig.LeaderLeaseTimeout)
 
 	cfg.InitPeerset = api.StringsToPeers(jcfg.InitPeerset)
+	cfg.NonVoter = jcfg.NonVoter
 	return cfg.Validate()
 }
 
@@ -229,6 +237,7 @@ func (cfg *Config) ToJSON() ([]byte, error) {
 	jcfg := &jsonConfig{
 		DataFolder:           cfg.DataFolder,
 		InitPeerset:          api.PeersToStrings(cfg.InitPeerset),
+		NonVoter:             cfg.NonVoter,
 		WaitForLeaderTimeout: cfg.WaitForLeaderTimeout.String(),
 		NetworkTimeout:       cfg.NetworkTimeout.String(),
 		CommitRetries:        cfg.CommitRetries,
@@ -251,6 +260,7 @@ func (cfg *Config) ToJSON() ([]byte, error) {
 func (cfg *Config) Default() error {
 	cfg.DataFolder = "" // empty so it gets omitted
 	cfg.InitPeerset = []peer.ID{}
+	cfg.NonVoter = false
 	cfg.WaitForLeaderTimeout = DefaultWaitForLeaderTimeout
 	cfg.NetworkTimeout = DefaultNetworkTimeout
 	cfg.CommitRetries = DefaultCommitRetries
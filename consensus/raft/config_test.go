@@ -10,6 +10,7 @@ import (
 var cfgJSON = []byte(`
 {
     "init_peerset": [],
+    "non_voter": true,
     "wait_for_leader_timeout": "15s",
     "network_timeout": "1s",
     "commit_retries": 1,
@@ -33,6 +34,10 @@ func TestLoadJSON(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	if !cfg.NonVoter {
+		t.Error("expected non_voter to be set")
+	}
+
 	j := &jsonConfig{}
 	json.Unmarshal(cfgJSON, j)
 	j.HeartbeatTimeout = "1us"
@@ -13,6 +13,7 @@ import (
 	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/state"
 
+	cid "github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log"
 	consensus "github.com/libp2p/go-libp2p-consensus"
 	rpc "github.com/libp2p/go-libp2p-gorpc"
@@ -37,6 +38,7 @@ type Consensus struct {
 	consensus consensus.OpLogConsensus
 	actor     consensus.Actor
 	baseOp    *LogOp
+	fsm       *fsm
 	raft      *raftWrapper
 
 	rpcClient *rpc.Client
@@ -67,7 +69,8 @@ func NewConsensus(
 
 	logger.Debug("starting Consensus and waiting for a leader...")
 	consensus := libp2praft.NewOpLog(state, baseOp)
-	raft, err := newRaftWrapper(host, cfg, consensus.FSM(), staging)
+	stateFSM := newFSM(consensus.FSM(), state)
+	raft, err := newRaftWrapper(host, cfg, stateFSM, staging)
 	if err != nil {
 		logger.Error("error creating raft: ", err)
 		return nil, err
@@ -85,6 +88,7 @@ func NewConsensus(
 		consensus: consensus,
 		actor:     actor,
 		baseOp:    baseOp,
+		fsm:       stateFSM,
 		raft:      raft,
 		rpcReady:  make(chan struct{}, 1),
 		readyCh:   make(chan struct{}, 1),
@@ -104,17 +108,12 @@ func (cc *Consensus) WaitForSync() error {
 	defer cancel()
 
 	// 1 - wait for leader
-	// 2 - wait until we are a Voter
+	// 2 - wait until we are part of the peerset
 	// 3 - wait until last index is applied
 
-	// From raft docs:
-
-	// once a staging server receives enough log entries to be sufficiently
-	// caught up to the leader's log, the leader will invoke a  membership
-	// change to change the Staging server to a Voter
-
-	// Thus, waiting to be a Voter is a guarantee that we have a reasonable
-	// up to date state. Otherwise, we might return too early (see
+	// Being part of the peerset (as a Voter or as a Nonvoter) means the
+	// leader is replicating the log to us, so the last index we see
+	// is a reasonable target. Otherwise, we might return too early (see
 	// https://github.com/ipfs/ipfs-cluster/issues/378)
 
 	_, err := cc.raft.WaitForLeader(leaderCtx)
@@ -122,9 +121,9 @@ func (cc *Consensus) WaitForSync() error {
 		return errors.New("error waiting for leader: " + err.Error())
 	}
 
-	err = cc.raft.WaitForVoter(cc.ctx)
+	err = cc.raft.WaitForMember(cc.ctx)
 	if err != nil {
-		return errors.New("error waiting to become a Voter: " + err.Error())
+		return errors.New("error waiting to join the peerset: " + err.Error())
 	}
 
 	err = cc.raft.WaitForUpdates(cc.ctx)
@@ -301,6 +300,12 @@ func (cc *Consensus) commit(op *LogOp, rpcOp string, redirectArg interface{}) er
 			logger.Infof("pin committed to global state: %s", op.Cid.Cid)
 		case LogOpUnpin:
 			logger.Infof("unpin committed to global state: %s", op.Cid.Cid)
+		case LogOpBatch:
+			logger.Infof("batch of %d operations committed to global state", len(op.Batch))
+		case LogOpUpdate:
+			logger.Infof("update committed to global state: %s", op.Batch[0].Cid.Cid)
+		case LogOpDrain:
+			logger.Infof("drain mark (%t) committed to global state: %s", op.Draining, op.Peer)
 		}
 		break
 
@@ -331,28 +336,91 @@ func (cc *Consensus) LogUnpin(pin api.Pin) error {
 	return nil
 }
 
-// AddPeer adds a new peer to participate in this consensus. It will
+// LogBatch submits several pins and unpins to the shared state of the
+// cluster as a single log entry. Unpins are applied before pins. It will
 // forward the operation to the leader if this is not it.
-func (cc *Consensus) AddPeer(pid peer.ID) error {
+func (cc *Consensus) LogBatch(b api.PinBatch) error {
+	ops := make([]LogOp, 0, len(b.Unpins)+len(b.Pins))
+	for _, pin := range b.Unpins {
+		ops = append(ops, *cc.op(pin, LogOpUnpin))
+	}
+	for _, pin := range b.Pins {
+		ops = append(ops, *cc.op(pin, LogOpPin))
+	}
+
+	op := &LogOp{
+		Type:  LogOpBatch,
+		Batch: ops,
+	}
+	return cc.commit(op, "ConsensusLogBatch", b.ToSerial())
+}
+
+// LogUpdate submits an update to the shared state of the cluster as a
+// single log entry: the given pin is added and then the pin it replaces
+// (set in its PinUpdate option) is removed. Adding the new pin first
+// lets the peers update the IPFS pin in place. It will forward the
+// operation to the leader if this is not it.
+func (cc *Consensus) LogUpdate(pin api.Pin) error {
+	from, err := cid.Decode(pin.PinUpdate)
+	if err != nil {
+		return fmt.Errorf("error decoding the updated Cid: %s", err)
+	}
+
+	op := &LogOp{
+		Type: LogOpUpdate,
+		Batch: []LogOp{
+			*cc.op(pin, LogOpPin),
+			*cc.op(api.PinCid(from), LogOpUnpin),
+		},
+	}
+	return cc.commit(op, "ConsensusLogUpdate", pin.ToSerial())
+}
+
+// LogDrain marks a peer as draining in the shared state of the cluster,
+// or removes the mark. It will forward the operation to the leader if
+// this is not it.
+func (cc *Consensus) LogDrain(pid peer.ID, draining bool) error {
+	op := &LogOp{
+		Type:     LogOpDrain,
+		Peer:     peer.IDB58Encode(pid),
+		Draining: draining,
+	}
+	req := api.PeerDrainRequest{
+		PeerID:   op.Peer,
+		Draining: draining,
+	}
+	return cc.commit(op, "ConsensusLogDrain", req)
+}
+
+// AddPeer adds a new peer to participate in this consensus with the
+// given role. Non-voters receive the log but do not count towards
+// quorum. It will forward the operation to the leader if this is not it.
+func (cc *Consensus) AddPeer(pid peer.ID, role api.PeerRole) error {
 	var finalErr error
 	for i := 0; i <= cc.config.CommitRetries; i++ {
-		logger.Debugf("attempt #%d: AddPeer %s", i, pid.Pretty())
+		logger.Debugf("attempt #%d: AddPeer %s (%s)", i, pid.Pretty(), role)
 		if finalErr != nil {
 			logger.Errorf("retrying to add peer. Attempt #%d failed: %s", i, finalErr)
 		}
-		ok, err := cc.redirectToLeader("ConsensusAddPeer", pid)
+		ok, err := cc.redirectToLeader(
+			"ConsensusAddPeer",
+			api.PeerAddRequest{
+				PeerID: peer.IDB58Encode(pid),
+				Role:   role,
+			},
+		)
 		if err != nil || ok {
 			return err
 		}
 		// Being here means we are the leader and can commit
 		cc.shutdownLock.RLock() // do not shutdown while committing
-		finalErr = cc.raft.AddPeer(peer.IDB58Encode(pid))
+		finalErr = cc.raft.AddPeer(peer.IDB58Encode(pid), role)
 		cc.shutdownLock.RUnlock()
 		if finalErr != nil {
 			time.Sleep(cc.config.CommitRetryDelay)
 			continue
 		}
-		logger.Infof("peer added to Raft: %s", pid.Pretty())
+		logger.Infof("peer added to Raft as %s: %s", role, pid.Pretty())
 		break
 	}
 	return finalErr
@@ -388,8 +456,12 @@ func (cc *Consensus) RmPeer(pid peer.ID) error {
 // State retrieves the current consensus State. It may error
 // if no State has been agreed upon or the state is not
 // consistent. The returned State is the last agreed-upon
-// State known by this node.
+// State known by this node. Persistent states are always
+// returned.
 func (cc *Consensus) State() (state.State, error) {
+	if st, ok := cc.fsm.persistent(); ok {
+		return st, nil
+	}
 	st, err := cc.consensus.GetLogHead()
 	if err != nil {
 		return nil, err
@@ -462,6 +534,26 @@ func (cc *Consensus) Peers() ([]peer.ID, error) {
 	return peers, nil
 }
 
+// Role returns the role of this peer in the Raft peerset. When
+// this peer is not part of the peerset yet, it returns the role
+// it will request when joining, as set in the configuration.
+func (cc *Consensus) Role() api.PeerRole {
+	cc.shutdownLock.RLock()
+	defer cc.shutdownLock.RUnlock()
+
+	if !cc.shutdown {
+		role, ok, err := cc.raft.PeerRole(peer.IDB58Encode(cc.host.ID()))
+		if err == nil && ok {
+			return role
+		}
+	}
+
+	if cc.config.NonVoter {
+		return api.PeerRoleNonVoter
+	}
+	return api.PeerRoleVoter
+}
+
 func parsePIDFromMultiaddr(addr ma.Multiaddr) string {
 	pidstr, err := addr.ValueForProtocol(ma.P_IPFS)
 	if err != nil {
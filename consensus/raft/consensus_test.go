@@ -116,6 +116,71 @@ func TestConsensusUnpin(t *testing.T) {
 	}
 }
 
+func TestConsensusLogBatch(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanRaft(1)
+	defer cc.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	c3, _ := cid.Decode(test.TestCid3)
+	err := cc.LogPin(testPin(c1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cc.LogBatch(api.PinBatch{
+		Pins:   []api.Pin{testPin(c2), testPin(c3)},
+		Unpins: []api.Pin{api.PinCid(c1)},
+	})
+	if err != nil {
+		t.Fatal("the operation did not make it to the log:", err)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	st, err := cc.State()
+	if err != nil {
+		t.Fatal("error getting state:", err)
+	}
+	if st.Has(c1) || !st.Has(c2) || !st.Has(c3) {
+		t.Error("the batch was not applied correctly")
+	}
+}
+
+func TestConsensusLogUpdate(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanRaft(1)
+	defer cc.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	err := cc.LogPin(testPin(c1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pin := testPin(c2)
+	pin.PinUpdate = c1.String()
+	err = cc.LogUpdate(pin)
+	if err != nil {
+		t.Fatal("the operation did not make it to the log:", err)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	st, err := cc.State()
+	if err != nil {
+		t.Fatal("error getting state:", err)
+	}
+	if st.Has(c1) || !st.Has(c2) {
+		t.Error("the update was not applied correctly")
+	}
+
+	err = cc.LogUpdate(testPin(c1))
+	if err == nil {
+		t.Error("expected an error without PinUpdate")
+	}
+}
+
 func TestConsensusUpdate(t *testing.T) {
 	cc := testingConsensus(t, 1)
 	defer cleanRaft(1)
@@ -165,7 +230,7 @@ func TestConsensusAddPeer(t *testing.T) {
 	defer cc2.Shutdown()
 
 	cc.host.Peerstore().AddAddrs(cc2.host.ID(), cc2.host.Addrs(), peerstore.PermanentAddrTTL)
-	err := cc.AddPeer(cc2.host.ID())
+	err := cc.AddPeer(cc2.host.ID(), api.PeerRoleVoter)
 	if err != nil {
 		t.Error("the operation did not make it to the log:", err)
 	}
@@ -187,6 +252,63 @@ func TestConsensusAddPeer(t *testing.T) {
 	}
 }
 
+func TestConsensusAddNonVoter(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	cc2 := testingConsensus(t, 2)
+	defer cleanRaft(1)
+	defer cleanRaft(2)
+	defer cc.Shutdown()
+	defer cc2.Shutdown()
+
+	cc.host.Peerstore().AddAddrs(cc2.host.ID(), cc2.host.Addrs(), peerstore.PermanentAddrTTL)
+	err := cc.AddPeer(cc2.host.ID(), api.PeerRoleNonVoter)
+	if err != nil {
+		t.Fatal("the operation did not make it to the log:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = cc2.raft.WaitForPeer(ctx, cc.host.ID().Pretty(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cc.Role() != api.PeerRoleVoter {
+		t.Error("the first peer should be a voter")
+	}
+	if cc2.Role() != api.PeerRoleNonVoter {
+		t.Error("the added peer should be a non-voter")
+	}
+
+	// Non-voters receive the log
+	c, _ := cid.Decode(test.TestCid1)
+	err = cc.LogPin(testPin(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cc2.raft.WaitForUpdates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := cc2.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Has(c) {
+		t.Error("the non-voter should have received the pin")
+	}
+
+	// And can be promoted
+	err = cc.AddPeer(cc2.host.ID(), api.PeerRoleVoter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	role, ok, err := cc.raft.PeerRole(cc2.host.ID().Pretty())
+	if err != nil || !ok || role != api.PeerRoleVoter {
+		t.Error("the peer should have been promoted to voter")
+	}
+}
+
 func TestConsensusRmPeer(t *testing.T) {
 	cc := testingConsensus(t, 1)
 	cc2 := testingConsensus(t, 2)
@@ -197,7 +319,7 @@ func TestConsensusRmPeer(t *testing.T) {
 
 	cc.host.Peerstore().AddAddrs(cc2.host.ID(), cc2.host.Addrs(), peerstore.PermanentAddrTTL)
 
-	err := cc.AddPeer(cc2.host.ID())
+	err := cc.AddPeer(cc2.host.ID(), api.PeerRoleVoter)
 	if err != nil {
 		t.Error("could not add peer:", err)
 	}
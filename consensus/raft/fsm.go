@@ -0,0 +1,193 @@
+package raft
+
+import (
+	"errors"
+	"io"
+
+	"github.com/ipfs/ipfs-cluster/state"
+
+	hraft "github.com/hashicorp/raft"
+)
+
+// persistentState is implemented by states which are kept on disk across
+// restarts (i.e. dsstate). They record the index of the last operation
+// applied to them, which allows to resume from them rather than
+// rebuilding them from the latest snapshot and the Raft log, and they can
+// be serialized and restored without holding the whole state in memory.
+type persistentState interface {
+	state.State
+	AppliedIndex() (uint64, error)
+	SetAppliedIndex(uint64) error
+	Clear() error
+	MarshalTo(io.Writer) error
+	UnmarshalFrom(io.Reader) error
+}
+
+// fsm wraps the FSM provided by libp2p-raft, which applies the operations
+// to the state. When the state is a persistentState, it keeps track of
+// the last applied index, skips the operations which were applied in a
+// previous run, and writes and reads snapshots directly to and from the
+// snapshot store.
+type fsm struct {
+	hraft.FSM
+	state persistentState
+
+	// operations up to this index are already in the state.
+	applied uint64
+	// the snapshot restored when starting is older than the state.
+	skipRestore bool
+	// an operation failed to apply. Snapshots are refused until a
+	// snapshot is restored.
+	inconsistent bool
+}
+
+func newFSM(f hraft.FSM, st state.State) *fsm {
+	ps, _ := st.(persistentState)
+	return &fsm{
+		FSM:   f,
+		state: ps,
+	}
+}
+
+// resume decides whether the persisted state can be used as is. This is
+// the case when it is at least as recent as the latest snapshot and the
+// Raft log includes the last operation applied to it. Otherwise the log
+// is not the one the state was built from (i.e. it has been cleaned or
+// replaced by an imported snapshot), so the state is cleared and rebuilt
+// by Raft. It must be called before Raft is started.
+func (f *fsm) resume(snapshots hraft.SnapshotStore, logs hraft.LogStore) error {
+	if f.state == nil {
+		return nil
+	}
+
+	applied, err := f.state.AppliedIndex()
+	if err != nil {
+		return err
+	}
+
+	var snapIndex uint64
+	metas, err := snapshots.List()
+	if err != nil {
+		return err
+	}
+	if len(metas) > 0 {
+		snapIndex = metas[0].Index
+	}
+
+	lastIndex, err := logs.LastIndex()
+	if err != nil {
+		return err
+	}
+
+	if applied > 0 && applied >= snapIndex && applied <= lastIndex {
+		logger.Infof("resuming from the persisted state (index %d)", applied)
+		f.applied = applied
+		f.skipRestore = snapIndex > 0
+		return nil
+	}
+
+	if applied > 0 {
+		logger.Info("the persisted state does not match the Raft log. Rebuilding it")
+	}
+	return f.state.Clear()
+}
+
+// Apply applies an operation to the state unless it was already applied.
+func (f *fsm) Apply(l *hraft.Log) interface{} {
+	if f.state == nil {
+		return f.FSM.Apply(l)
+	}
+
+	if l.Index <= f.applied {
+		return nil
+	}
+
+	res := f.FSM.Apply(l)
+	if err, ok := res.(error); ok {
+		logger.Error("error applying operation: ", err)
+		f.inconsistent = true
+		return res
+	}
+
+	f.applied = l.Index
+	err := f.state.SetAppliedIndex(l.Index)
+	if err != nil {
+		// Operations are idempotent, so re-applying them
+		// after a restart is harmless.
+		logger.Error("error recording the applied index: ", err)
+	}
+	return res
+}
+
+// Snapshot returns a snapshot which writes the state to the sink as it
+// is read from the datastore. Operations applied while the snapshot is
+// persisted may be included in it. This is harmless, since they are
+// applied again, in order, when restoring it.
+func (f *fsm) Snapshot() (hraft.FSMSnapshot, error) {
+	if f.state == nil {
+		return f.FSM.Snapshot()
+	}
+	if f.inconsistent {
+		return nil, errors.New("cannot snapshot inconsistent state")
+	}
+	return &fsmSnapshot{state: f.state}, nil
+}
+
+// Restore replaces the state with the given snapshot. The snapshot
+// restored when starting is skipped when resuming from the persisted
+// state.
+func (f *fsm) Restore(r io.ReadCloser) error {
+	if f.state == nil {
+		return f.FSM.Restore(r)
+	}
+
+	if f.skipRestore {
+		f.skipRestore = false
+		logger.Debug("skipping the restore of an older snapshot")
+		return r.Close()
+	}
+
+	// The index of the snapshot is unknown here. Until an operation is
+	// applied, the state is rebuilt on the next start.
+	err := f.state.SetAppliedIndex(0)
+	if err != nil {
+		r.Close()
+		return err
+	}
+	f.applied = 0
+
+	defer r.Close()
+	err = f.state.UnmarshalFrom(r)
+	if err != nil {
+		return err
+	}
+	f.inconsistent = false
+	return nil
+}
+
+// persistent returns the persistentState, if any. Since operations and
+// snapshots are applied to it directly, it is valid even when Raft has
+// not applied anything in this run.
+func (f *fsm) persistent() (state.State, bool) {
+	if f.state == nil {
+		return nil, false
+	}
+	return f.state, true
+}
+
+type fsmSnapshot struct {
+	state persistentState
+}
+
+// Persist writes the state to the sink.
+func (snap *fsmSnapshot) Persist(sink hraft.SnapshotSink) error {
+	err := snap.state.MarshalTo(sink)
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+// Release is a no-op.
+func (snap *fsmSnapshot) Release() {}
@@ -0,0 +1,120 @@
+package raft
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/state/dsstate"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	hraft "github.com/hashicorp/raft"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+)
+
+type mockFSM struct {
+	applied []uint64
+}
+
+func (m *mockFSM) Apply(l *hraft.Log) interface{} {
+	m.applied = append(m.applied, l.Index)
+	return nil
+}
+
+func (m *mockFSM) Snapshot() (hraft.FSMSnapshot, error) {
+	return nil, nil
+}
+
+func (m *mockFSM) Restore(r io.ReadCloser) error {
+	return r.Close()
+}
+
+func testLogStore(t *testing.T, last uint64) hraft.LogStore {
+	logs := hraft.NewInmemStore()
+	for i := uint64(1); i <= last; i++ {
+		err := logs.StoreLog(&hraft.Log{Index: i, Type: hraft.LogCommand})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return logs
+}
+
+func testPersistedState(t *testing.T, applied uint64) *dsstate.State {
+	st := dsstate.New(dssync.MutexWrap(ds.NewMapDatastore()), "/pins")
+	st.Add(testPin(test.MustDecodeCid(test.TestCid1)))
+	err := st.SetAppliedIndex(applied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestFSMResume(t *testing.T) {
+	st := testPersistedState(t, 5)
+	inner := &mockFSM{}
+	f := newFSM(inner, st)
+
+	err := f.resume(hraft.NewDiscardSnapshotStore(), testLogStore(t, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Has(test.MustDecodeCid(test.TestCid1)) {
+		t.Fatal("the persisted state should have been kept")
+	}
+
+	for i := uint64(1); i <= 7; i++ {
+		f.Apply(&hraft.Log{Index: i, Type: hraft.LogCommand})
+	}
+	if len(inner.applied) != 2 || inner.applied[0] != 6 {
+		t.Errorf("only operations after the applied index should be applied: %v", inner.applied)
+	}
+	applied, _ := st.AppliedIndex()
+	if applied != 7 {
+		t.Error("the applied index should have been updated")
+	}
+}
+
+func TestFSMResumeCleanedLog(t *testing.T) {
+	st := testPersistedState(t, 5)
+	inner := &mockFSM{}
+	f := newFSM(inner, st)
+
+	// i.e. the Raft data folder was cleaned
+	err := f.resume(hraft.NewDiscardSnapshotStore(), testLogStore(t, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Has(test.MustDecodeCid(test.TestCid1)) {
+		t.Fatal("the persisted state should have been cleared")
+	}
+
+	f.Apply(&hraft.Log{Index: 1, Type: hraft.LogCommand})
+	if len(inner.applied) != 1 {
+		t.Error("the operation should have been applied")
+	}
+}
+
+func TestFSMRestore(t *testing.T) {
+	b, err := testPersistedState(t, 5).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := dsstate.New(dssync.MutexWrap(ds.NewMapDatastore()), "/pins")
+	inner := &mockFSM{}
+	f := newFSM(inner, st)
+	err = f.Restore(ioutil.NopCloser(bytes.NewReader(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Has(test.MustDecodeCid(test.TestCid1)) {
+		t.Error("the snapshot should have been restored to the state")
+	}
+	applied, _ := st.AppliedIndex()
+	if applied != 0 {
+		t.Error("the applied index is unknown after a restore")
+	}
+}
@@ -7,12 +7,16 @@ import (
 	"github.com/ipfs/ipfs-cluster/state"
 
 	consensus "github.com/libp2p/go-libp2p-consensus"
+	peer "github.com/libp2p/go-libp2p-peer"
 )
 
 // Type of consensus operation
 const (
 	LogOpPin = iota + 1
 	LogOpUnpin
+	LogOpBatch
+	LogOpUpdate
+	LogOpDrain
 )
 
 // LogOpType expresses the type of a consensus Operation
@@ -22,8 +26,14 @@ type LogOpType int
 // It implements the consensus.Op interface and it is used by the
 // Consensus component.
 type LogOp struct {
-	Cid       api.PinSerial
-	Type      LogOpType
+	Cid  api.PinSerial
+	Type LogOpType
+	// Batch carries the pin and unpin operations of a LogOpBatch
+	// or a LogOpUpdate, in the order they are applied.
+	Batch []LogOp
+	// Peer and Draining carry the drain mark set by a LogOpDrain.
+	Peer      string
+	Draining  bool
 	consensus *Consensus
 }
 
@@ -36,18 +46,108 @@ func (op *LogOp) ApplyTo(cstate consensus.State) (consensus.State, error) {
 		panic("received unexpected state type")
 	}
 
+	if op.Type == LogOpDrain {
+		err = op.applyDrain(state)
+		if err != nil {
+			goto ROLLBACK
+		}
+		return state, nil
+	}
+
+	if op.Type == LogOpUpdate {
+		err = op.applyUpdate(state)
+		if err != nil {
+			goto ROLLBACK
+		}
+		return state, nil
+	}
+
+	if op.Type == LogOpBatch {
+		for _, bop := range op.Batch {
+			err = op.apply(state, bop.Type, bop.Cid)
+			if err != nil {
+				goto ROLLBACK
+			}
+		}
+		return state, nil
+	}
+
+	err = op.apply(state, op.Type, op.Cid)
+	if err != nil {
+		goto ROLLBACK
+	}
+	return state, nil
+
+ROLLBACK:
+	// We failed to apply the operation to the state
+	// and therefore we need to request a rollback to the
+	// cluster to the previous state. This operation can only be performed
+	// by the cluster leader.
+	logger.Error("Rollbacks are not implemented")
+	return nil, errors.New("a rollback may be necessary. Reason: " + err.Error())
+}
+
+// applyDrain marks or unmarks a peer as draining.
+func (op *LogOp) applyDrain(state state.State) error {
+	pid, err := peer.IDB58Decode(op.Peer)
+	if err != nil {
+		return err
+	}
+	return state.SetDraining(pid, op.Draining)
+}
+
+// applyUpdate adds the new pin and removes the one it replaces. The
+// replaced pin is untracked with UntrackUpdated, so that it is not
+// unpinned before the new one is pinned.
+func (op *LogOp) applyUpdate(state state.State) error {
+	if len(op.Batch) != 2 {
+		return errors.New("bad update operation")
+	}
+	replaced, _ := state.Get(op.Batch[1].Cid.DecodeCid())
+
+	err := op.apply(state, LogOpPin, op.Batch[0].Cid)
+	if err != nil {
+		return err
+	}
+	err = state.Rm(replaced.Cid)
+	if err != nil {
+		return err
+	}
+	// Async, we let the PinTracker take care of any problems
+	op.consensus.rpcClient.Go(
+		"",
+		"Cluster",
+		"UntrackUpdated",
+		replaced.ToSerial(),
+		&struct{}{},
+		nil,
+	)
+	return nil
+}
+
+// withoutUpdate returns the pin to store in the state. The PinUpdate
+// option is only relevant to the PinTracker.
+func withoutUpdate(pinS api.PinSerial) api.Pin {
+	pin := pinS.ToPin()
+	pin.PinUpdate = ""
+	return pin
+}
+
+// apply performs a single pin or unpin operation on the state and
+// triggers the tracking or untracking of the item.
+func (op *LogOp) apply(state state.State, t LogOpType, pin api.PinSerial) error {
 	// Copy the Cid. We are about to pass it to go-routines
 	// that will make things with it (read its fields). However,
 	// as soon as ApplyTo is done, the next operation will be deserealized
 	// on top of "op". This can cause data races with the slices in
 	// api.PinSerial, which don't get copied when passed.
-	pinS := op.Cid.Clone()
+	pinS := pin.Clone()
 
-	switch op.Type {
+	switch t {
 	case LogOpPin:
-		err = state.Add(pinS.ToPin())
+		err := state.Add(withoutUpdate(pinS))
 		if err != nil {
-			goto ROLLBACK
+			return err
 		}
 		// Async, we let the PinTracker take care of any problems
 		op.consensus.rpcClient.Go(
@@ -59,9 +159,9 @@ func (op *LogOp) ApplyTo(cstate consensus.State) (consensus.State, error) {
 			nil,
 		)
 	case LogOpUnpin:
-		err = state.Rm(pinS.DecodeCid())
+		err := state.Rm(pinS.DecodeCid())
 		if err != nil {
-			goto ROLLBACK
+			return err
 		}
 		// Async, we let the PinTracker take care of any problems
 		op.consensus.rpcClient.Go(
@@ -75,13 +175,5 @@ func (op *LogOp) ApplyTo(cstate consensus.State) (consensus.State, error) {
 	default:
 		logger.Error("unknown LogOp type. Ignoring")
 	}
-	return state, nil
-
-ROLLBACK:
-	// We failed to apply the operation to the state
-	// and therefore we need to request a rollback to the
-	// cluster to the previous state. This operation can only be performed
-	// by the cluster leader.
-	logger.Error("Rollbacks are not implemented")
-	return nil, errors.New("a rollback may be necessary. Reason: " + err.Error())
+	return nil
 }
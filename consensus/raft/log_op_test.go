@@ -48,6 +48,80 @@ func TestApplyToUnpin(t *testing.T) {
 	}
 }
 
+func TestApplyToBatch(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	op := &LogOp{
+		Type: LogOpBatch,
+		Batch: []LogOp{
+			{Cid: api.PinSerial{Cid: test.TestCid1}, Type: LogOpUnpin},
+			{Cid: api.PinSerial{Cid: test.TestCid2}, Type: LogOpPin},
+			{Cid: api.PinSerial{Cid: test.TestCid3}, Type: LogOpPin},
+		},
+		consensus: cc,
+	}
+	defer cleanRaft(1)
+	defer cc.Shutdown()
+
+	st := mapstate.NewMapState()
+	c, _ := cid.Decode(test.TestCid1)
+	st.Add(testPin(c))
+	op.ApplyTo(st)
+	pins := st.List()
+	if len(pins) != 2 || st.Has(c) {
+		t.Error("the state was not modified correctly")
+	}
+}
+
+func TestApplyToUpdate(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	to := api.PinSerial{Cid: test.TestCid2}
+	to.PinUpdate = test.TestCid1
+	op := &LogOp{
+		Type: LogOpUpdate,
+		Batch: []LogOp{
+			{Cid: to, Type: LogOpPin},
+			{Cid: api.PinSerial{Cid: test.TestCid1}, Type: LogOpUnpin},
+		},
+		consensus: cc,
+	}
+	defer cleanRaft(1)
+	defer cc.Shutdown()
+
+	st := mapstate.NewMapState()
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	st.Add(testPin(c1))
+	op.ApplyTo(st)
+	pin, ok := st.Get(c2)
+	if !ok || st.Has(c1) {
+		t.Fatal("the state was not modified correctly")
+	}
+	if pin.PinUpdate != "" {
+		t.Error("the PinUpdate option should not be kept in the state")
+	}
+}
+
+func TestApplyToDrain(t *testing.T) {
+	op := &LogOp{
+		Type:     LogOpDrain,
+		Peer:     test.TestPeerID1.Pretty(),
+		Draining: true,
+	}
+
+	st := mapstate.NewMapState()
+	op.ApplyTo(st)
+	d := st.Draining()
+	if len(d) != 1 || d[0] != test.TestPeerID1 {
+		t.Fatal("the peer should be draining")
+	}
+
+	op.Draining = false
+	op.ApplyTo(st)
+	if len(st.Draining()) != 0 {
+		t.Error("the drain mark should have been removed")
+	}
+}
+
 func TestApplyToBadState(t *testing.T) {
 	defer func() {
 		if r := recover(); r == nil {
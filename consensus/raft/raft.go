@@ -15,6 +15,7 @@ import (
 	peer "github.com/libp2p/go-libp2p-peer"
 	p2praft "github.com/libp2p/go-libp2p-raft"
 
+	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/state"
 )
 
@@ -70,7 +71,7 @@ type raftWrapper struct {
 func newRaftWrapper(
 	host host.Host,
 	cfg *Config,
-	fsm hraft.FSM,
+	fsm *fsm,
 	staging bool,
 ) (*raftWrapper, error) {
 
@@ -99,6 +100,11 @@ func newRaftWrapper(
 		return nil, err
 	}
 
+	err = fsm.resume(raftW.snapshotStore, raftW.logStore)
+	if err != nil {
+		return nil, err
+	}
+
 	logger.Debug("creating Raft")
 	raftW.raft, err = hraft.NewRaft(
 		cfg.RaftConfig,
@@ -300,8 +306,10 @@ func (rw *raftWrapper) WaitForLeader(ctx context.Context) (string, error) {
 	}
 }
 
-func (rw *raftWrapper) WaitForVoter(ctx context.Context) error {
-	logger.Debug("waiting until we are promoted to a voter")
+// WaitForMember holds until we are part of the Raft configuration,
+// either as a voter or as a non-voter.
+func (rw *raftWrapper) WaitForMember(ctx context.Context) error {
+	logger.Debug("waiting until we are added to the peerset")
 
 	pid := hraft.ServerID(peer.IDB58Encode(rw.host.ID()))
 	for {
@@ -314,7 +322,7 @@ func (rw *raftWrapper) WaitForVoter(ctx context.Context) error {
 				return err
 			}
 
-			if isVoter(pid, configFuture.Configuration()) {
+			if _, ok := findServer(pid, configFuture.Configuration()); ok {
 				return nil
 			}
 
@@ -323,13 +331,24 @@ func (rw *raftWrapper) WaitForVoter(ctx context.Context) error {
 	}
 }
 
-func isVoter(srvID hraft.ServerID, cfg hraft.Configuration) bool {
+// findServer returns the server with the given ID from a Raft
+// configuration and whether it was found.
+func findServer(srvID hraft.ServerID, cfg hraft.Configuration) (hraft.Server, bool) {
 	for _, server := range cfg.Servers {
-		if server.ID == srvID && server.Suffrage == hraft.Voter {
-			return true
+		if server.ID == srvID {
+			return server, true
 		}
 	}
-	return false
+	return hraft.Server{}, false
+}
+
+// suffrageToRole converts a Raft suffrage to a PeerRole. Staging
+// servers are considered voters, as they will be promoted.
+func suffrageToRole(s hraft.ServerSuffrage) api.PeerRole {
+	if s == hraft.Nonvoter {
+		return api.PeerRoleNonVoter
+	}
+	return api.PeerRoleVoter
 }
 
 // WaitForUpdates holds until Raft has synced to the last index in the log
@@ -458,24 +477,41 @@ func (rw *raftWrapper) Shutdown() error {
 	return nil
 }
 
-// AddPeer adds a peer to Raft
-func (rw *raftWrapper) AddPeer(peer string) error {
+// AddPeer adds a peer to Raft with the given role. If the peer is
+// already part of the peerset with a different role, it will be
+// promoted or demoted.
+func (rw *raftWrapper) AddPeer(peer string, role api.PeerRole) error {
 	// Check that we don't have it to not waste
 	// log entries if so.
-	peers, err := rw.Peers()
+	current, ok, err := rw.PeerRole(peer)
 	if err != nil {
 		return err
 	}
-	if find(peers, peer) {
-		logger.Infof("%s is already a raft peer", peer)
+	if ok && current == role {
+		logger.Infof("%s is already a raft peer (%s)", peer, role)
 		return nil
 	}
 
-	future := rw.raft.AddVoter(
-		hraft.ServerID(peer),
-		hraft.ServerAddress(peer),
-		0,
-		0) // TODO: Extra cfg value?
+	var future hraft.IndexFuture
+	switch {
+	case role == api.PeerRoleNonVoter && ok:
+		future = rw.raft.DemoteVoter(
+			hraft.ServerID(peer),
+			0,
+			0)
+	case role == api.PeerRoleNonVoter:
+		future = rw.raft.AddNonvoter(
+			hraft.ServerID(peer),
+			hraft.ServerAddress(peer),
+			0,
+			0)
+	default: // also promotes non-voters
+		future = rw.raft.AddVoter(
+			hraft.ServerID(peer),
+			hraft.ServerAddress(peer),
+			0,
+			0) // TODO: Extra cfg value?
+	}
 	err = future.Error()
 	if err != nil {
 		logger.Error("raft cannot add peer: ", err)
@@ -534,6 +570,21 @@ func (rw *raftWrapper) Peers() ([]string, error) {
 	return ids, nil
 }
 
+// PeerRole returns the role of the given peer in the Raft configuration
+// and whether it is part of it.
+func (rw *raftWrapper) PeerRole(peer string) (api.PeerRole, bool, error) {
+	configFuture := rw.raft.GetConfiguration()
+	if err := configFuture.Error(); err != nil {
+		return "", false, err
+	}
+
+	server, ok := findServer(hraft.ServerID(peer), configFuture.Configuration())
+	if !ok {
+		return "", false, nil
+	}
+	return suffrageToRole(server.Suffrage), true, nil
+}
+
 // latestSnapshot looks for the most recent raft snapshot stored at the
 // provided basedir.  It returns the snapshot's metadata, and a reader
 // to the snapshot's bytes
@@ -582,12 +633,8 @@ func LastStateRaw(cfg *Config) (io.Reader, bool, error) {
 // peer ids to include in the snapshot metadata if no snapshot exists
 // from which to copy the raft metadata
 func SnapshotSave(cfg *Config, newState state.State, pids []peer.ID) error {
-	newStateBytes, err := p2praft.EncodeSnapshot(newState)
-	if err != nil {
-		return err
-	}
 	dataFolder := cfg.GetDataFolder()
-	err = makeDataFolder(dataFolder)
+	err := makeDataFolder(dataFolder)
 	if err != nil {
 		return err
 	}
@@ -627,7 +674,7 @@ func SnapshotSave(cfg *Config, newState state.State, pids []peer.ID) error {
 		return err
 	}
 
-	_, err = sink.Write(newStateBytes)
+	err = writeSnapshot(newState, sink)
 	if err != nil {
 		sink.Cancel()
 		return err
@@ -639,6 +686,20 @@ func SnapshotSave(cfg *Config, newState state.State, pids []peer.ID) error {
 	return nil
 }
 
+// writeSnapshot serializes the state to w, without holding the whole
+// serialized state in memory when the state supports it.
+func writeSnapshot(st state.State, w io.Writer) error {
+	if ps, ok := st.(persistentState); ok {
+		return ps.MarshalTo(w)
+	}
+	b, err := p2praft.EncodeSnapshot(st)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
 // CleanupRaft moves the current data folder to a backup location
 func CleanupRaft(dataFolder string, keep int) error {
 	meta, _, err := latestSnapshot(dataFolder)
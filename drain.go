@@ -0,0 +1,171 @@
+package ipfscluster
+
+import (
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// This file gathers the logic to drain peers, that is, to move all the
+// content allocated to a peer elsewhere before removing it:
+//
+// * The peer is marked as draining in the shared state. Draining peers
+//   are left out when allocating, so they do not receive new pins and
+//   they are dropped from the allocations of the pins that are re-pinned.
+// * The peer which received the request re-pins every pin allocated to
+//   the draining peer, with the draining peer blacklisted, keeping track
+//   of the progress.
+// * Once no pins are allocated to the draining peer, it can be removed.
+//   Removing a peer clears its drain mark.
+
+// drainMarkTimeout is how long to wait for the drain mark to be applied
+// to the local state before re-allocating pins.
+var drainMarkTimeout = 10 * time.Second
+
+// drainProgress tracks a re-allocation round started by this peer.
+type drainProgress struct {
+	running bool
+	total   int
+	failed  int
+}
+
+// drainingPeers returns the peers marked as draining in the shared state.
+func (c *Cluster) drainingPeers() []peer.ID {
+	cState, err := c.consensus.State()
+	if err != nil {
+		logger.Warning(err)
+		return nil
+	}
+	return cState.Draining()
+}
+
+// PeerDrain marks the given peer as draining in the shared state and
+// starts re-allocating all the pins allocated to it. It returns right
+// away with the drain status. Use PeerDrainStatus to follow progress.
+func (c *Cluster) PeerDrain(pid peer.ID) (api.DrainStatus, error) {
+	logger.Infof("draining %s", pid.Pretty())
+	err := c.logDrain(pid, true)
+	if err != nil {
+		logger.Error(err)
+		return api.DrainStatus{}, err
+	}
+
+	c.drainsMux.Lock()
+	prog, ok := c.drains[pid]
+	if !ok || !prog.running {
+		prog = &drainProgress{running: true}
+		c.drains[pid] = prog
+		go c.drainPeer(pid, prog)
+	}
+	c.drainsMux.Unlock()
+
+	return c.PeerDrainStatus(pid)
+}
+
+// PeerUndrain removes the drain mark of a peer, which can receive new
+// allocations again. Pins already moved out of it stay where they are.
+func (c *Cluster) PeerUndrain(pid peer.ID) error {
+	logger.Infof("cancelling the draining of %s", pid.Pretty())
+	return c.logDrain(pid, false)
+}
+
+// logDrain commits the drain mark of a peer to the shared state.
+func (c *Cluster) logDrain(pid peer.ID, draining bool) error {
+	start := time.Now()
+	err := c.consensus.LogDrain(pid, draining)
+	c.observeCommit("drain", start)
+	return err
+}
+
+// PeerDrainStatus returns whether a peer is draining and how many pins
+// are still allocated to it.
+func (c *Cluster) PeerDrainStatus(pid peer.ID) (api.DrainStatus, error) {
+	cState, err := c.consensus.State()
+	if err != nil {
+		return api.DrainStatus{}, err
+	}
+
+	status := api.DrainStatus{
+		Peer:     peer.IDB58Encode(pid),
+		Draining: containsPeer(cState.Draining(), pid),
+	}
+	for pin := range cState.Stream(c.ctx) {
+		if containsPeer(pin.Allocations, pid) {
+			status.Remaining++
+		}
+	}
+
+	c.drainsMux.Lock()
+	if prog, ok := c.drains[pid]; ok {
+		status.InProgress = prog.running
+		status.Total = prog.total
+		status.Failed = prog.failed
+	}
+	c.drainsMux.Unlock()
+	return status, nil
+}
+
+// drainPeer re-pins all the pins allocated to the given peer, with the
+// peer blacklisted. It stops when the drain mark is removed.
+func (c *Cluster) drainPeer(pid peer.ID, prog *drainProgress) {
+	defer func() {
+		c.drainsMux.Lock()
+		prog.running = false
+		c.drainsMux.Unlock()
+	}()
+
+	// The mark is committed, but it may take a moment to be
+	// applied to our state.
+	timer := time.NewTimer(drainMarkTimeout)
+	defer timer.Stop()
+	for !containsPeer(c.drainingPeers(), pid) {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-timer.C:
+			logger.Errorf("%s was not marked as draining in time", pid.Pretty())
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	cState, err := c.consensus.State()
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	var pins []api.Pin
+	for pin := range cState.Stream(c.ctx) {
+		if containsPeer(pin.Allocations, pid) {
+			pins = append(pins, pin)
+		}
+	}
+
+	c.drainsMux.Lock()
+	prog.total = len(pins)
+	c.drainsMux.Unlock()
+
+	for i, pin := range pins {
+		select {
+		case <-c.ctx.Done():
+			return
+		default:
+		}
+		if !containsPeer(c.drainingPeers(), pid) {
+			logger.Infof("%s is no longer draining", pid.Pretty())
+			return
+		}
+
+		_, err := c.pin(pin, []peer.ID{pid}, []peer.ID{})
+		if err != nil {
+			logger.Errorf("error moving %s out of %s: %s", pin.Cid, pid.Pretty(), err)
+			c.drainsMux.Lock()
+			prog.failed++
+			c.drainsMux.Unlock()
+			continue
+		}
+		logger.Infof("drain: moved %s out of %s (%d/%d)", pin.Cid, pid.Pretty(), i+1, len(pins))
+	}
+}
@@ -0,0 +1,161 @@
+package ipfscluster
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// eventLogCap is the number of events kept by a peer. Clients which fall
+// further behind miss the oldest events.
+var eventLogCap = 1024
+
+// eventsWaitTimeout is how long a request for events waits for new events
+// before returning an empty response.
+var eventsWaitTimeout = 10 * time.Second
+
+// eventLog keeps the latest events emitted by this peer and lets
+// readers wait for new ones.
+type eventLog struct {
+	mu     sync.Mutex
+	events []api.Event
+	seq    uint64
+	newCh  chan struct{} // closed and replaced on every publish
+}
+
+func newEventLog() *eventLog {
+	return &eventLog{
+		newCh: make(chan struct{}),
+	}
+}
+
+// publish assigns a sequence number to the event and stores it,
+// waking up any waiting readers.
+func (l *eventLog) publish(e api.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	e.Seq = l.seq
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	l.events = append(l.events, e)
+	if len(l.events) > eventLogCap {
+		l.events = l.events[len(l.events)-eventLogCap:]
+	}
+	close(l.newCh)
+	l.newCh = make(chan struct{})
+}
+
+// since returns the events with a sequence number higher than req.Since
+// and matching req.Types. When there are none, it waits for new ones
+// until eventsWaitTimeout expires or the context is cancelled.
+func (l *eventLog) since(ctx context.Context, req api.EventsRequest) api.EventsResponse {
+	timer := time.NewTimer(eventsWaitTimeout)
+	defer timer.Stop()
+
+	l.mu.Lock()
+	last := req.Since
+	if last == 0 || last > l.seq {
+		last = l.seq
+	}
+	for {
+		var events []api.Event
+		for _, e := range l.events {
+			if e.Seq > last && matchesEventTypes(e.Type, req.Types) {
+				events = append(events, e)
+			}
+		}
+		last = l.seq
+		newCh := l.newCh
+		l.mu.Unlock()
+
+		if len(events) > 0 {
+			return api.EventsResponse{Events: events, Last: last}
+		}
+
+		select {
+		case <-ctx.Done():
+			return api.EventsResponse{Last: last}
+		case <-timer.C:
+			return api.EventsResponse{Last: last}
+		case <-newCh:
+		}
+		l.mu.Lock()
+	}
+}
+
+func matchesEventTypes(t string, types []string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, t2 := range types {
+		if t == t2 {
+			return true
+		}
+	}
+	return false
+}
+
+// Events returns the events emitted by this peer which match the request.
+// It blocks for a while when there are none yet.
+func (c *Cluster) Events(ctx context.Context, req api.EventsRequest) api.EventsResponse {
+	return c.events.since(ctx, req)
+}
+
+// publishEvent emits a new event from this peer.
+func (c *Cluster) publishEvent(e api.Event) {
+	c.events.publish(e)
+}
+
+// pinStatusWatcher emits an event for every change of status of the
+// pins tracked by this peer. These are not relayed to other peers, so
+// watching a peer only shows the status of the pins allocated to it.
+func (c *Cluster) pinStatusWatcher() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case pinfo := <-c.tracker.StatusChanges():
+			c.publishEvent(api.Event{
+				Type:      api.EventPinStatus,
+				Timestamp: pinfo.TS,
+				Peer:      peer.IDB58Encode(pinfo.Peer),
+				Cid:       pinfo.Cid.String(),
+				Status:    pinfo.Status.String(),
+				Error:     pinfo.Error,
+			})
+		}
+	}
+}
+
+// publishPeersetChanges emits peer_joined and peer_left events for the
+// differences between two peersets.
+func (c *Cluster) publishPeersetChanges(prev, cur []peer.ID) {
+	prevSet := make(map[peer.ID]struct{}, len(prev))
+	for _, p := range prev {
+		prevSet[p] = struct{}{}
+	}
+	curSet := make(map[peer.ID]struct{}, len(cur))
+	for _, p := range cur {
+		curSet[p] = struct{}{}
+		if _, ok := prevSet[p]; !ok {
+			c.publishEvent(api.Event{
+				Type: api.EventPeerJoined,
+				Peer: peer.IDB58Encode(p),
+			})
+		}
+	}
+	for _, p := range prev {
+		if _, ok := curSet[p]; !ok {
+			c.publishEvent(api.Event{
+				Type: api.EventPeerLeft,
+				Peer: peer.IDB58Encode(p),
+			})
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package ipfscluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+func TestEventLogSince(t *testing.T) {
+	l := newEventLog()
+	l.publish(api.Event{Type: api.EventPeerJoined})
+	l.publish(api.Event{Type: api.EventAlert})
+	l.publish(api.Event{Type: api.EventPeerJoined})
+
+	ctx := context.Background()
+	resp := l.since(ctx, api.EventsRequest{Since: 1})
+	if len(resp.Events) != 2 || resp.Last != 3 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if resp.Events[0].Seq != 2 || resp.Events[0].Timestamp.IsZero() {
+		t.Error("events should have a sequence number and a timestamp")
+	}
+
+	resp = l.since(ctx, api.EventsRequest{
+		Since: 1,
+		Types: []string{api.EventPeerJoined},
+	})
+	if len(resp.Events) != 1 || resp.Events[0].Seq != 3 {
+		t.Errorf("unexpected filtered response: %+v", resp)
+	}
+}
+
+func TestEventLogWait(t *testing.T) {
+	l := newEventLog()
+	l.publish(api.Event{Type: api.EventAlert})
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		l.publish(api.Event{Type: api.EventAlert})
+		l.publish(api.Event{Type: api.EventLeaderChanged})
+	}()
+
+	// Since 0 only returns new events.
+	resp := l.since(context.Background(), api.EventsRequest{
+		Types: []string{api.EventLeaderChanged},
+	})
+	if len(resp.Events) != 1 || resp.Events[0].Seq != 3 || resp.Last != 3 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	resp = l.since(ctx, api.EventsRequest{Since: resp.Last})
+	if len(resp.Events) != 0 || resp.Last != 3 {
+		t.Errorf("expected no events: %+v", resp)
+	}
+}
+
+func TestEventLogCap(t *testing.T) {
+	l := newEventLog()
+	for i := 0; i < eventLogCap+10; i++ {
+		l.publish(api.Event{Type: api.EventAlert})
+	}
+	resp := l.since(context.Background(), api.EventsRequest{Since: 1})
+	if len(resp.Events) != eventLogCap {
+		t.Fatal("the oldest events should have been dropped")
+	}
+	if resp.Events[0].Seq != 11 {
+		t.Error("unexpected first event:", resp.Events[0].Seq)
+	}
+}
+
+func TestPublishPeersetChanges(t *testing.T) {
+	c := &Cluster{events: newEventLog()}
+	c.publishPeersetChanges(
+		[]peer.ID{test.TestPeerID1, test.TestPeerID2},
+		[]peer.ID{test.TestPeerID1, test.TestPeerID3},
+	)
+
+	events := c.events.events
+	if len(events) != 2 {
+		t.Fatal("expected two events")
+	}
+	if events[0].Type != api.EventPeerJoined || events[0].Peer != peer.IDB58Encode(test.TestPeerID3) {
+		t.Error("expected peer 3 to join")
+	}
+	if events[1].Type != api.EventPeerLeft || events[1].Peer != peer.IDB58Encode(test.TestPeerID2) {
+		t.Error("expected peer 2 to leave")
+	}
+}
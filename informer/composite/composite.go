@@ -0,0 +1,65 @@
+// Package composite allows an ipfs-cluster peer to run several informers at
+// once, so that the metrics of all of them are published through the peer
+// monitor regardless of the informers needed by the allocator.
+//
+// Each informer keeps its own configuration and metric TTL, and its
+// metrics are pushed independently by the cluster peer.
+package composite
+
+import (
+	"fmt"
+
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// Informer is the interface the composed informers implement. It matches
+// ipfscluster.Informer.
+type Informer interface {
+	SetClient(*rpc.Client)
+	Shutdown() error
+	Name() string
+	GetMetric() api.Metric
+}
+
+// Builder creates an informer.
+type Builder func() (Informer, error)
+
+// Informers returns the given base informers followed by the informers
+// enabled in the configuration, which are created with the builder of the
+// same name. Enabled informers producing the same metric as one of the
+// base ones are shut down and left out. The base informers (the ones used by
+// the allocator) keep their place, as the first one is the primary.
+func Informers(cfg *Config, base []Informer, builders map[string]Builder) ([]Informer, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	informers := append([]Informer{}, base...)
+	names := make(map[string]bool)
+	for _, inf := range base {
+		names[inf.Name()] = true
+	}
+
+	for _, name := range cfg.Informers {
+		build, ok := builders[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown informer: %s", name)
+		}
+		inf, err := build()
+		if err != nil {
+			return nil, fmt.Errorf("creating %s informer: %s", name, err)
+		}
+		if names[inf.Name()] {
+			// the builder name and the metric name may
+			// differ, so this is only known once built.
+			inf.Shutdown()
+			continue
+		}
+		names[inf.Name()] = true
+		informers = append(informers, inf)
+	}
+	return informers, nil
+}
@@ -0,0 +1,63 @@
+package composite
+
+import (
+	"testing"
+
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+type mockInformer struct {
+	name     string
+	shutdown bool
+}
+
+func (inf *mockInformer) SetClient(c *rpc.Client) {}
+func (inf *mockInformer) Shutdown() error         { inf.shutdown = true; return nil }
+func (inf *mockInformer) Name() string            { return inf.name }
+func (inf *mockInformer) GetMetric() api.Metric {
+	return api.Metric{Name: inf.name, Valid: true}
+}
+
+func builder(name string) Builder {
+	return func() (Informer, error) {
+		return &mockInformer{name: name}, nil
+	}
+}
+
+func TestInformers(t *testing.T) {
+	dup := &mockInformer{name: "numpin"}
+	builders := map[string]Builder{
+		"disk":   builder("freespace"),
+		"numpin": func() (Informer, error) { return dup, nil },
+		"tags":   builder("tags"),
+	}
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Informers = []string{"disk", "numpin", "tags"}
+
+	base := []Informer{&mockInformer{name: "numpin"}}
+	informers, err := Informers(cfg, base, builders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(informers) != 3 {
+		t.Fatalf("expected 3 informers, got %d", len(informers))
+	}
+	if informers[0] != base[0] {
+		t.Error("the base informers should go first")
+	}
+	if informers[1].Name() != "freespace" || informers[2].Name() != "tags" {
+		t.Error("unexpected informers")
+	}
+	if !dup.shutdown {
+		t.Error("the duplicated informer should have been shut down")
+	}
+
+	cfg.Informers = []string{"latency"}
+	_, err = Informers(cfg, base, builders)
+	if err == nil {
+		t.Error("expected an error with an unknown informer")
+	}
+}
@@ -0,0 +1,85 @@
+package composite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+const configKey = "composite"
+
+// These are the default values for a Config.
+var (
+	DefaultInformers = []string{"disk", "numpin"}
+)
+
+// Config allows to initialize the composite informer.
+type Config struct {
+	config.Saver
+
+	// Informers are the names of the informers (i.e. "disk", "numpin",
+	// "tags", "latency", "external", "pinqueue") which run on this peer
+	// in addition to those needed by the allocator. Each of them is
+	// configured in its own section and publishes its metrics according
+	// to its own metric_ttl.
+	Informers []string
+}
+
+type jsonConfig struct {
+	Informers []string `json:"informers"`
+}
+
+// ConfigKey returns a human-friendly identifier for this
+// Config's type.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values.
+func (cfg *Config) Default() error {
+	cfg.Informers = append([]string{}, DefaultInformers...)
+	return nil
+}
+
+// Validate checks that the fields of this configuration have
+// sensible values.
+func (cfg *Config) Validate() error {
+	seen := make(map[string]bool)
+	for _, name := range cfg.Informers {
+		if name == "" {
+			return errors.New("composite.informers cannot have empty names")
+		}
+		if seen[name] {
+			return fmt.Errorf("composite.informers has %s more than once", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		return err
+	}
+
+	cfg.Default()
+	if jcfg.Informers != nil {
+		cfg.Informers = jcfg.Informers
+	}
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{}
+
+	jcfg.Informers = cfg.Informers
+
+	return config.DefaultJSONMarshal(jcfg)
+}
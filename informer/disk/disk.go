@@ -15,7 +15,8 @@ import (
 type MetricType int
 
 const (
-	// MetricFreeSpace provides the available space reported by IPFS
+	// MetricFreeSpace provides the available space reported by IPFS,
+	// minus the size of the pins which are queued or being pinned.
 	MetricFreeSpace = iota
 	// MetricRepoSize provides the used space reported by IPFS
 	MetricRepoSize
@@ -87,6 +88,12 @@ func (disk *Informer) GetMetric() api.Metric {
 		switch disk.config.Type {
 		case MetricFreeSpace:
 			metric = repoStat.StorageMax - repoStat.RepoSize
+			pending := disk.pendingSize()
+			if pending > metric {
+				metric = 0
+			} else {
+				metric -= pending
+			}
 		case MetricRepoSize:
 			metric = repoStat.RepoSize
 		}
@@ -101,3 +108,20 @@ func (disk *Informer) GetMetric() api.Metric {
 	m.SetTTL(disk.config.MetricTTL)
 	return m
 }
+
+// pendingSize returns the total size of the pins which are queued or
+// being pinned by this peer, as they are not accounted for in the repo
+// size yet. Pins with unknown size count as 0.
+func (disk *Informer) pendingSize() uint64 {
+	var backlog api.TrackerBacklog
+	err := disk.rpcClient.Call("",
+		"Cluster",
+		"TrackerBacklog",
+		struct{}{},
+		&backlog)
+	if err != nil {
+		logger.Warning(err)
+		return 0
+	}
+	return backlog.PendingSize
+}
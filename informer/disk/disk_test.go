@@ -28,6 +28,33 @@ func (mock *badRPCService) IPFSRepoStat(ctx context.Context, in struct{}, out *a
 	return errors.New("fake error")
 }
 
+type pendingRPCService struct {
+}
+
+func pendingRPCClient(t *testing.T) *rpc.Client {
+	s := rpc.NewServer(nil, "mock")
+	c := rpc.NewClientWithServer(nil, "mock", s)
+	err := s.RegisterName("Cluster", &pendingRPCService{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (mock *pendingRPCService) IPFSRepoStat(ctx context.Context, in struct{}, out *api.IPFSRepoStat) error {
+	*out = api.IPFSRepoStat{RepoSize: 2000, StorageMax: 100000}
+	return nil
+}
+
+func (mock *pendingRPCService) TrackerBacklog(ctx context.Context, in struct{}, out *api.TrackerBacklog) error {
+	*out = api.TrackerBacklog{
+		PinQueued:   1,
+		Pinning:     1,
+		PendingSize: 10000,
+	}
+	return nil
+}
+
 func Test(t *testing.T) {
 	cfg := &Config{}
 	cfg.Default()
@@ -97,6 +124,27 @@ func TestRepoSize(t *testing.T) {
 	}
 }
 
+func TestFreeSpacePending(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Type = MetricFreeSpace
+
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inf.Shutdown()
+	inf.SetClient(pendingRPCClient(t))
+	m := inf.GetMetric()
+	if !m.Valid {
+		t.Error("metric should be valid")
+	}
+	// 98000 free bytes minus 10000 bytes of pending pins
+	if m.Value != "88000" {
+		t.Error("bad metric value:", m.Value)
+	}
+}
+
 func TestWithErrors(t *testing.T) {
 	cfg := &Config{}
 	cfg.Default()
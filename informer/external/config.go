@@ -0,0 +1,124 @@
+package external
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+const configKey = "external"
+
+// These are the default values for a Config.
+const (
+	DefaultMetricName = "external"
+	DefaultMetricTTL  = 30 * time.Second
+	DefaultTimeout    = 10 * time.Second
+)
+
+// Config allows to initialize an Informer. Either Command or URL must be
+// set for the informer to be created.
+type Config struct {
+	config.Saver
+
+	// MetricName is the name under which the metric is published
+	// (i.e. "smart_health").
+	MetricName string
+
+	MetricTTL time.Duration
+
+	// Command is an executable and its arguments. Its standard output
+	// is the value of the metric.
+	Command []string
+
+	// URL is a local HTTP endpoint. The body of its responses is the
+	// value of the metric.
+	URL string
+
+	// Timeout is how long the command or the request may take.
+	// Metrics are invalid when it is exceeded.
+	Timeout time.Duration
+}
+
+type jsonConfig struct {
+	MetricName string   `json:"metric_name"`
+	MetricTTL  string   `json:"metric_ttl"`
+	Command    []string `json:"command"`
+	URL        string   `json:"url"`
+	Timeout    string   `json:"timeout"`
+}
+
+// ConfigKey returns a human-friendly identifier for this
+// Config's type.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values.
+func (cfg *Config) Default() error {
+	cfg.MetricName = DefaultMetricName
+	cfg.MetricTTL = DefaultMetricTTL
+	cfg.Command = []string{}
+	cfg.URL = ""
+	cfg.Timeout = DefaultTimeout
+	return nil
+}
+
+// Validate checks that the fields of this configuration have
+// sensible values.
+func (cfg *Config) Validate() error {
+	if cfg.MetricName == "" {
+		return errors.New("external.metric_name is empty")
+	}
+
+	if cfg.MetricTTL <= 0 {
+		return errors.New("external.metric_ttl is invalid")
+	}
+
+	if cfg.Timeout <= 0 {
+		return errors.New("external.timeout is invalid")
+	}
+
+	if len(cfg.Command) > 0 && cfg.URL != "" {
+		return errors.New("only one of external.command and external.url can be set")
+	}
+
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		return err
+	}
+
+	cfg.Default()
+
+	config.SetIfNotDefault(jcfg.MetricName, &cfg.MetricName)
+	t, _ := time.ParseDuration(jcfg.MetricTTL)
+	config.SetIfNotDefault(t, &cfg.MetricTTL)
+	t, _ = time.ParseDuration(jcfg.Timeout)
+	config.SetIfNotDefault(t, &cfg.Timeout)
+	if jcfg.Command != nil {
+		cfg.Command = jcfg.Command
+	}
+	cfg.URL = jcfg.URL
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{}
+
+	jcfg.MetricName = cfg.MetricName
+	jcfg.MetricTTL = cfg.MetricTTL.String()
+	jcfg.Command = cfg.Command
+	jcfg.URL = cfg.URL
+	jcfg.Timeout = cfg.Timeout.String()
+
+	return config.DefaultJSONMarshal(jcfg)
+}
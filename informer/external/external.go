@@ -0,0 +1,140 @@
+// Package external implements an ipfs-cluster informer which obtains its
+// metric from a user-provided executable or from a local HTTP endpoint.
+// This allows feeding allocators with information which cluster does not
+// know about (i.e. disk health, power costs or maintenance flags).
+package external
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	logging "github.com/ipfs/go-log"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+var logger = logging.Logger("externalinfo")
+
+// maxValueSize limits how much output is read from the command or the
+// HTTP endpoint.
+const maxValueSize = 4096
+
+// Informer is an ipfscluster.Informer which publishes the output of a
+// command or the response of an HTTP endpoint as its metric.
+type Informer struct {
+	config *Config
+	client *http.Client
+}
+
+// NewInformer returns an initialized Informer. The configuration must
+// provide a command or a URL.
+func NewInformer(cfg *Config) (*Informer, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Command) == 0 && cfg.URL == "" {
+		return nil, errors.New("external.command or external.url must be set")
+	}
+
+	return &Informer{
+		config: cfg,
+		client: &http.Client{},
+	}, nil
+}
+
+// SetClient does nothing in this informer.
+func (inf *Informer) SetClient(c *rpc.Client) {}
+
+// Shutdown does nothing in this informer.
+func (inf *Informer) Shutdown() error {
+	return nil
+}
+
+// Name returns the configured metric name.
+func (inf *Informer) Name() string {
+	return inf.config.MetricName
+}
+
+// GetMetric runs the command or calls the URL and returns a metric with
+// its output, with surrounding whitespace removed. The metric is invalid
+// when the command fails, the endpoint does not return 200, the timeout
+// is exceeded or the output is empty.
+func (inf *Informer) GetMetric() api.Metric {
+	ctx, cancel := context.WithTimeout(context.Background(), inf.config.Timeout)
+	defer cancel()
+
+	var value string
+	var err error
+	if inf.config.URL != "" {
+		value, err = inf.fetch(ctx)
+	} else {
+		value, err = inf.run(ctx)
+	}
+	if err == nil && value == "" {
+		err = errors.New("empty value")
+	}
+	if err != nil {
+		logger.Errorf("error obtaining %s metric: %s", inf.config.MetricName, err)
+	}
+
+	m := api.Metric{
+		Name:  inf.config.MetricName,
+		Value: value,
+		Valid: err == nil,
+	}
+
+	m.SetTTL(inf.config.MetricTTL)
+	return m
+}
+
+func (inf *Informer) run(ctx context.Context) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, inf.config.Command[0], inf.config.Command[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() > maxValueSize {
+		return "", errors.New("output too large")
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (inf *Informer) fetch(ctx context.Context) (string, error) {
+	req, err := http.NewRequest("GET", inf.config.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := inf.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: maxValueSize + 1})
+	if err != nil {
+		return "", err
+	}
+	if len(body) > maxValueSize {
+		return "", errors.New("response too large")
+	}
+	return strings.TrimSpace(string(body)), nil
+}
@@ -0,0 +1,84 @@
+package external
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testInformer(t *testing.T, cmd []string, url string) *Informer {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.MetricName = "test"
+	cfg.Command = cmd
+	cfg.URL = url
+	cfg.Timeout = 500 * time.Millisecond
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inf
+}
+
+func TestNewInformer(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	_, err := NewInformer(cfg)
+	if err == nil {
+		t.Error("expected an error without command or url")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	inf := testInformer(t, []string{"echo", " 42 "}, "")
+	defer inf.Shutdown()
+	m := inf.GetMetric()
+	if !m.Valid || m.Name != "test" || m.Value != "42" {
+		t.Errorf("unexpected metric: %+v", m)
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	for _, cmd := range [][]string{
+		{"false"},
+		{"true"}, // empty output
+		{"sleep", "5"},
+		{"/this/does/not/exist"},
+	} {
+		inf := testInformer(t, cmd, "")
+		m := inf.GetMetric()
+		if m.Valid {
+			t.Errorf("metric should be invalid with %s", cmd)
+		}
+	}
+}
+
+func TestURL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			fmt.Fprintln(w, "maintenance")
+		case "/slow":
+			time.Sleep(2 * time.Second)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	inf := testInformer(t, nil, ts.URL+"/ok")
+	m := inf.GetMetric()
+	if !m.Valid || m.Value != "maintenance" {
+		t.Errorf("unexpected metric: %+v", m)
+	}
+
+	for _, path := range []string{"/slow", "/missing"} {
+		inf := testInformer(t, nil, ts.URL+path)
+		m := inf.GetMetric()
+		if m.Valid {
+			t.Errorf("metric should be invalid with %s", path)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package latency
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+const configKey = "latency"
+
+// These are the default values for a Config.
+const (
+	DefaultMetricTTL   = 30 * time.Second
+	DefaultPingTimeout = 5 * time.Second
+)
+
+// Config allows to initialize an Informer.
+type Config struct {
+	config.Saver
+
+	MetricTTL time.Duration
+
+	// PingTimeout is how long to wait for a ping response from a
+	// peer. Peers which do not answer in time are left out of the
+	// metric.
+	PingTimeout time.Duration
+}
+
+type jsonConfig struct {
+	MetricTTL   string `json:"metric_ttl"`
+	PingTimeout string `json:"ping_timeout"`
+}
+
+// ConfigKey returns a human-friendly identifier for this
+// Config's type.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values.
+func (cfg *Config) Default() error {
+	cfg.MetricTTL = DefaultMetricTTL
+	cfg.PingTimeout = DefaultPingTimeout
+	return nil
+}
+
+// Validate checks that the fields of this configuration have
+// sensible values.
+func (cfg *Config) Validate() error {
+	if cfg.MetricTTL <= 0 {
+		return errors.New("latency.metric_ttl is invalid")
+	}
+
+	if cfg.PingTimeout <= 0 {
+		return errors.New("latency.ping_timeout is invalid")
+	}
+
+	if cfg.PingTimeout >= cfg.MetricTTL {
+		return errors.New("latency.ping_timeout should be smaller than latency.metric_ttl")
+	}
+
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		return err
+	}
+
+	cfg.Default()
+
+	t, _ := time.ParseDuration(jcfg.MetricTTL)
+	config.SetIfNotDefault(t, &cfg.MetricTTL)
+	t, _ = time.ParseDuration(jcfg.PingTimeout)
+	config.SetIfNotDefault(t, &cfg.PingTimeout)
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{}
+
+	jcfg.MetricTTL = cfg.MetricTTL.String()
+	jcfg.PingTimeout = cfg.PingTimeout.String()
+
+	return config.DefaultJSONMarshal(jcfg)
+}
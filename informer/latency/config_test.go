@@ -0,0 +1,61 @@
+package latency
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+var cfgJSON = []byte(`
+{
+      "metric_ttl": "10s",
+      "ping_timeout": "2s"
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PingTimeout != 2*time.Second {
+		t.Error("expected ping_timeout to be loaded")
+	}
+
+	j := &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.PingTimeout = "20s"
+	tst, _ := json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with a ping_timeout larger than the metric_ttl")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.PingTimeout = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
@@ -0,0 +1,187 @@
+// Package latency implements an ipfs-cluster informer which measures the
+// round-trip time from this peer to the rest of cluster peers using the
+// libp2p ping protocol on the cluster host.
+package latency
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+	host "github.com/libp2p/go-libp2p-host"
+	peer "github.com/libp2p/go-libp2p-peer"
+	ping "github.com/libp2p/go-libp2p/p2p/protocol/ping"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+var logger = logging.Logger("latencyinfo")
+
+// MetricName specifies the name of our metric
+var MetricName = "latency"
+
+// Informer is an ipfscluster.Informer which pings the other cluster
+// peers and publishes the average round-trip time, in microseconds, as
+// its metric. The latest round-trip time to every peer is available with
+// Latencies().
+type Informer struct {
+	config    *Config
+	host      host.Host
+	ping      *ping.PingService
+	rpcClient *rpc.Client
+
+	latenciesMux sync.Mutex
+	latencies    map[peer.ID]time.Duration
+}
+
+// NewInformer returns an initialized Informer which pings peers using the
+// given host.
+func NewInformer(cfg *Config, h host.Host) (*Informer, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Informer{
+		config:    cfg,
+		host:      h,
+		ping:      ping.NewPingService(h),
+		latencies: make(map[peer.ID]time.Duration),
+	}, nil
+}
+
+// SetClient provides us with an rpc.Client which allows
+// contacting other components in the cluster.
+func (inf *Informer) SetClient(c *rpc.Client) {
+	inf.rpcClient = c
+}
+
+// Shutdown is called on cluster shutdown. We just invalidate
+// any metrics from this point.
+func (inf *Informer) Shutdown() error {
+	inf.rpcClient = nil
+	return nil
+}
+
+// Name returns the name of this informer.
+func (inf *Informer) Name() string {
+	return MetricName
+}
+
+// GetMetric pings the current cluster peers and returns a metric with the
+// average round-trip time in microseconds. Peers which do not answer are
+// not taken into account. The metric is invalid when no peer answers.
+func (inf *Informer) GetMetric() api.Metric {
+	if inf.rpcClient == nil {
+		return api.Metric{
+			Name:  MetricName,
+			Valid: false,
+		}
+	}
+
+	var peers []peer.ID
+	err := inf.rpcClient.Call("",
+		"Cluster",
+		"ConsensusPeers",
+		struct{}{},
+		&peers)
+	if err != nil {
+		logger.Error(err)
+		return api.Metric{
+			Name:  MetricName,
+			Valid: false,
+		}
+	}
+
+	latencies := inf.measure(peers)
+	inf.latenciesMux.Lock()
+	inf.latencies = latencies
+	inf.latenciesMux.Unlock()
+
+	others := 0
+	for _, p := range peers {
+		if p != inf.host.ID() {
+			others++
+		}
+	}
+
+	var total time.Duration
+	for _, rtt := range latencies {
+		total += rtt
+	}
+	var avg time.Duration
+	if len(latencies) > 0 {
+		avg = total / time.Duration(len(latencies))
+	}
+
+	m := api.Metric{
+		Name:  MetricName,
+		Value: fmt.Sprintf("%d", avg/time.Microsecond),
+		Valid: others == 0 || len(latencies) > 0,
+	}
+
+	m.SetTTL(inf.config.MetricTTL)
+	return m
+}
+
+// Latencies returns the round-trip times to the peers which answered the
+// latest round of pings.
+func (inf *Informer) Latencies() map[peer.ID]time.Duration {
+	inf.latenciesMux.Lock()
+	defer inf.latenciesMux.Unlock()
+	latencies := make(map[peer.ID]time.Duration, len(inf.latencies))
+	for p, rtt := range inf.latencies {
+		latencies[p] = rtt
+	}
+	return latencies
+}
+
+// measure pings the given peers in parallel and returns the round-trip
+// times of those which answered before the timeout.
+func (inf *Informer) measure(peers []peer.ID) map[peer.ID]time.Duration {
+	var wg sync.WaitGroup
+	var mux sync.Mutex
+	latencies := make(map[peer.ID]time.Duration)
+
+	for _, p := range peers {
+		if p == inf.host.ID() {
+			continue
+		}
+		wg.Add(1)
+		go func(p peer.ID) {
+			defer wg.Done()
+			rtt, err := inf.pingPeer(p)
+			if err != nil {
+				logger.Debugf("error pinging %s: %s", p.Pretty(), err)
+				return
+			}
+			mux.Lock()
+			latencies[p] = rtt
+			mux.Unlock()
+		}(p)
+	}
+	wg.Wait()
+	return latencies
+}
+
+func (inf *Informer) pingPeer(p peer.ID) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), inf.config.PingTimeout)
+	defer cancel()
+
+	results, err := inf.ping.Ping(ctx, p)
+	if err != nil {
+		return 0, err
+	}
+	select {
+	case rtt, ok := <-results:
+		if !ok {
+			return 0, fmt.Errorf("no ping response from %s", p.Pretty())
+		}
+		return rtt, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
@@ -0,0 +1,110 @@
+package latency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+	host "github.com/libp2p/go-libp2p-host"
+	peer "github.com/libp2p/go-libp2p-peer"
+	peerstore "github.com/libp2p/go-libp2p-peerstore"
+
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+type mockService struct {
+	peers []peer.ID
+}
+
+func (mock *mockService) ConsensusPeers(ctx context.Context, in struct{}, out *[]peer.ID) error {
+	*out = mock.peers
+	return nil
+}
+
+func mockRPCClient(t *testing.T, peers []peer.ID) *rpc.Client {
+	s := rpc.NewServer(nil, "mock")
+	c := rpc.NewClientWithServer(nil, "mock", s)
+	err := s.RegisterName("Cluster", &mockService{peers: peers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func testHost(t *testing.T) host.Host {
+	h, err := libp2p.New(
+		context.Background(),
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestLatency(t *testing.T) {
+	h1 := testHost(t)
+	defer h1.Close()
+	h2 := testHost(t)
+	defer h2.Close()
+
+	err := h1.Connect(
+		context.Background(),
+		peerstore.PeerInfo{ID: h2.ID(), Addrs: h2.Addrs()},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.PingTimeout = time.Second // for the unreachable peer
+	inf, err := NewInformer(cfg, h1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inf.Shutdown()
+	_, err = NewInformer(cfg, h2) // answers pings
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := inf.GetMetric()
+	if m.Valid {
+		t.Error("metric should be invalid without rpc client")
+	}
+
+	inf.SetClient(mockRPCClient(t, []peer.ID{h1.ID(), h2.ID(), test.TestPeerID3}))
+	m = inf.GetMetric()
+	if !m.Valid || m.Name != MetricName {
+		t.Error("metric should be valid")
+	}
+
+	latencies := inf.Latencies()
+	if len(latencies) != 1 {
+		t.Fatal("expected the latency to the second host only")
+	}
+	if _, ok := latencies[h2.ID()]; !ok {
+		t.Error("expected the latency to the second host")
+	}
+}
+
+func TestLatencyAlone(t *testing.T) {
+	h := testHost(t)
+	defer h.Close()
+
+	cfg := &Config{}
+	cfg.Default()
+	inf, err := NewInformer(cfg, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inf.Shutdown()
+	inf.SetClient(mockRPCClient(t, []peer.ID{h.ID()}))
+	m := inf.GetMetric()
+	if !m.Valid || m.Value != "0" {
+		t.Error("a single peer should have a valid 0 metric")
+	}
+}
@@ -0,0 +1,82 @@
+// Package pinqueue implements an ipfs-cluster informer which reports the
+// backlog of the local pin tracker, that is, how many pins are queued or
+// being pinned. Failed pins are not counted, since they do not keep the
+// peer busy. Used with an ascending allocator, peers which are already
+// busy receive new pins last.
+package pinqueue
+
+import (
+	"fmt"
+
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// MetricName specifies the name of our metric
+var MetricName = "pinqueue"
+
+// Informer is a simple object to implement the ipfscluster.Informer
+// and Component interfaces
+type Informer struct {
+	config    *Config
+	rpcClient *rpc.Client
+}
+
+// NewInformer returns an initialized Informer.
+func NewInformer(cfg *Config) (*Informer, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Informer{
+		config: cfg,
+	}, nil
+}
+
+// SetClient provides us with an rpc.Client which allows
+// contacting other components in the cluster.
+func (pqi *Informer) SetClient(c *rpc.Client) {
+	pqi.rpcClient = c
+}
+
+// Shutdown is called on cluster shutdown. We just invalidate
+// any metrics from this point.
+func (pqi *Informer) Shutdown() error {
+	pqi.rpcClient = nil
+	return nil
+}
+
+// Name returns the name of this informer
+func (pqi *Informer) Name() string {
+	return MetricName
+}
+
+// GetMetric asks the PinTracker for its backlog and returns the number
+// of pin operations which are queued or pinning.
+func (pqi *Informer) GetMetric() api.Metric {
+	if pqi.rpcClient == nil {
+		return api.Metric{
+			Valid: false,
+		}
+	}
+
+	var backlog api.TrackerBacklog
+	err := pqi.rpcClient.Call(
+		"",
+		"Cluster",
+		"TrackerBacklog",
+		struct{}{},
+		&backlog,
+	)
+
+	m := api.Metric{
+		Name:  MetricName,
+		Value: fmt.Sprintf("%d", backlog.Pending()),
+		Valid: err == nil,
+	}
+
+	m.SetTTL(pqi.config.MetricTTL)
+	return m
+}
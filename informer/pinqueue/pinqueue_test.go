@@ -0,0 +1,52 @@
+package pinqueue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+)
+
+type mockService struct{}
+
+func mockRPCClient(t *testing.T) *rpc.Client {
+	s := rpc.NewServer(nil, "mock")
+	c := rpc.NewClientWithServer(nil, "mock", s)
+	err := s.RegisterName("Cluster", &mockService{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (mock *mockService) TrackerBacklog(ctx context.Context, in struct{}, out *api.TrackerBacklog) error {
+	*out = api.TrackerBacklog{
+		PinQueued: 1000,
+		Pinning:   10,
+		PinError:  2,
+	}
+	return nil
+}
+
+func Test(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := inf.GetMetric()
+	if m.Valid {
+		t.Error("metric should be invalid")
+	}
+	inf.SetClient(mockRPCClient(t))
+	m = inf.GetMetric()
+	if !m.Valid {
+		t.Error("metric should be valid")
+	}
+	if m.Value != "1010" {
+		t.Error("bad metric value")
+	}
+}
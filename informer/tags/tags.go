@@ -0,0 +1,93 @@
+// Package tags implements an ipfs-cluster informer which publishes the
+// labels (tags) configured for this peer, such as the region, datacenter or
+// rack where it runs, so that allocators can use them to place content
+// in different failure domains.
+package tags
+
+import (
+	"net/url"
+
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// MetricName specifies the name of our metric
+var MetricName = "tags"
+
+// Informer is a simple object to implement the ipfscluster.Informer
+// and Component interfaces
+type Informer struct {
+	config *Config
+}
+
+// NewInformer returns an initialized Informer.
+func NewInformer(cfg *Config) (*Informer, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Informer{
+		config: cfg,
+	}, nil
+}
+
+// SetClient does nothing in this informer.
+func (tinf *Informer) SetClient(c *rpc.Client) {}
+
+// Shutdown does nothing in this informer.
+func (tinf *Informer) Shutdown() error {
+	return nil
+}
+
+// Name returns the name of this informer
+func (tinf *Informer) Name() string {
+	return MetricName
+}
+
+// GetMetric returns a metric carrying the configured tags. They are
+// encoded in the metric value as a query string (i.e.
+// "rack=r12&region=eu-west"). Use ParseMetric to decode them.
+func (tinf *Informer) GetMetric() api.Metric {
+	m := api.Metric{
+		Name:  MetricName,
+		Value: EncodeTags(tinf.config.Tags),
+		Valid: true,
+	}
+
+	m.SetTTL(tinf.config.MetricTTL)
+	return m
+}
+
+// Tags returns a copy of the configured tags.
+func (tinf *Informer) Tags() map[string]string {
+	tags := make(map[string]string, len(tinf.config.Tags))
+	for k, v := range tinf.config.Tags {
+		tags[k] = v
+	}
+	return tags
+}
+
+// EncodeTags encodes the given tags as a metric value.
+func EncodeTags(tags map[string]string) string {
+	q := url.Values{}
+	for k, v := range tags {
+		q.Set(k, v)
+	}
+	return q.Encode()
+}
+
+// ParseMetric returns the tags carried by a metric produced by this
+// informer. Metrics which cannot be decoded result in no tags.
+func ParseMetric(m api.Metric) map[string]string {
+	tags := make(map[string]string)
+	q, err := url.ParseQuery(m.Value)
+	if err != nil {
+		return tags
+	}
+	for k := range q {
+		tags[k] = q.Get(k)
+	}
+	return tags
+}
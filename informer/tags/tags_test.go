@@ -0,0 +1,40 @@
+package tags
+
+import (
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+func Test(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Tags = map[string]string{
+		"region": "eu west",
+		"rack":   "r1",
+	}
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := inf.GetMetric()
+	if !m.Valid || m.Name != MetricName {
+		t.Fatal("metric should be valid")
+	}
+	if m.Value != "rack=r1&region=eu+west" {
+		t.Error("bad metric value:", m.Value)
+	}
+
+	tags := ParseMetric(m)
+	if len(tags) != 2 || tags["region"] != "eu west" || tags["rack"] != "r1" {
+		t.Error("tags were not decoded correctly")
+	}
+
+	if inf.Tags()["region"] != "eu west" {
+		t.Error("Tags should return the configured tags")
+	}
+
+	if len(ParseMetric(api.Metric{Value: "%zz"})) != 0 {
+		t.Error("bad values should result in no tags")
+	}
+}
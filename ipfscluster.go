@@ -10,6 +10,7 @@ package ipfscluster
 
 import (
 	"context"
+	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/state"
@@ -42,7 +43,16 @@ type Consensus interface {
 	LogPin(c api.Pin) error
 	// Logs an unpin operation
 	LogUnpin(c api.Pin) error
-	AddPeer(p peer.ID) error
+	// Logs several pin and unpin operations at once. Unpins
+	// are applied before pins.
+	LogBatch(b api.PinBatch) error
+	// Logs an update operation: the given pin replaces the one
+	// set in its PinUpdate option.
+	LogUpdate(c api.Pin) error
+	// Logs marking a peer as draining, or removing the mark
+	LogDrain(p peer.ID, draining bool) error
+	// Adds a peer to the peerset with the given role
+	AddPeer(p peer.ID, role api.PeerRole) error
 	RmPeer(p peer.ID) error
 	State() (state.State, error)
 	// Provide a node which is responsible to perform
@@ -55,6 +65,9 @@ type Consensus interface {
 	Clean() error
 	// Peers returns the peerset participating in the Consensus
 	Peers() ([]peer.ID, error)
+	// Role returns the role of this peer in the peerset or, when it
+	// is not part of it yet, the role it will request when joining.
+	Role() api.PeerRole
 }
 
 // API is a component which offers an API for Cluster. This is
@@ -87,6 +100,16 @@ type IPFSConnector interface {
 	BlockPut(api.NodeWithMeta) error
 	// BlockGet retrieves the raw data of an IPFS block
 	BlockGet(cid.Cid) ([]byte, error)
+	// PinUpdate recursively pins the second Cid, fetching only the
+	// blocks which are not part of the first one, which must be
+	// recursively pinned and remains so.
+	PinUpdate(ctx context.Context, from, to cid.Cid) error
+	// Resolve returns the Cid that an IPFS path (i.e. an IPNS name or
+	// a DNSLink) currently points to.
+	Resolve(context.Context, string) (cid.Cid, error)
+	// DagSize returns the cumulative size of the DAG with the given
+	// root, in bytes.
+	DagSize(context.Context, cid.Cid) (uint64, error)
 }
 
 // Peered represents a component which needs to be aware of the peers
@@ -112,6 +135,13 @@ type PinTracker interface {
 	StatusAll() []api.PinInfo
 	// Status returns the local status of a given Cid.
 	Status(cid.Cid) api.PinInfo
+	// Backlog counts the pin operations which have not completed yet.
+	// Unlike StatusAll, it should be cheap to call.
+	Backlog() api.TrackerBacklog
+	// StatusChanges returns a channel on which the local status of a
+	// Cid is sent every time it changes. Changes may be dropped when
+	// they are not consumed fast enough.
+	StatusChanges() <-chan api.PinInfo
 	// SyncAll makes sure that all tracked Cids reflect the real IPFS status.
 	// It returns the list of pins which were updated by the call.
 	SyncAll() ([]api.PinInfo, error)
@@ -134,6 +164,21 @@ type Informer interface {
 	GetMetric() api.Metric
 }
 
+// LatencyInformer is an Informer which also keeps the round-trip times
+// from this peer to the other cluster peers. They are included in the
+// connectivity graph.
+type LatencyInformer interface {
+	Informer
+	Latencies() map[peer.ID]time.Duration
+}
+
+// TagsInformer is an Informer which publishes the tags configured for
+// this peer. They are included in the peer's ID.
+type TagsInformer interface {
+	Informer
+	Tags() map[string]string
+}
+
 // PinAllocator decides where to pin certain content. In order to make such
 // decision, it receives the pin arguments, the peers which are currently
 // allocated to the content and metrics available for all peers which could
@@ -149,6 +194,28 @@ type PinAllocator interface {
 	Allocate(c cid.Cid, current, candidates, priority map[peer.ID]api.Metric) ([]peer.ID, error)
 }
 
+// MultiMetricAllocator is a PinAllocator which takes into account the
+// metrics produced by several informers. When the cluster's allocator
+// implements it, AllocateMetrics is used instead of Allocate.
+type MultiMetricAllocator interface {
+	PinAllocator
+	// AllocateMetrics works like Allocate, but receives the latest
+	// metrics from every informer for each peer, indexed by metric
+	// name. Peers are divided among the maps using the metric from
+	// the first informer, which is always included.
+	AllocateMetrics(c cid.Cid, current, candidates, priority map[peer.ID]api.MetricsSet) ([]peer.ID, error)
+}
+
+// PlacementAllocator is a PinAllocator with requirements on the final
+// allocations of a pin (i.e. spanning several failure domains), which
+// depend on how many of the peers it returns are used. When the
+// cluster's allocator implements it, new allocations are checked with
+// CheckPlacement, which receives the metrics of all the peers.
+type PlacementAllocator interface {
+	PinAllocator
+	CheckPlacement(c cid.Cid, allocs []peer.ID, metrics map[peer.ID]api.Metric) error
+}
+
 // PeerMonitor is a component in charge of publishing a peer's metrics and
 // reading metrics from other peers in the cluster. The PinAllocator will
 // use the metrics provided by the monitor as candidates for Pin allocations.
@@ -167,6 +234,9 @@ type PeerMonitor interface {
 	// LatestMetrics returns a map with the latest metrics of matching name
 	// for the current cluster peers.
 	LatestMetrics(name string) []api.Metric
+	// MetricHistory returns the metrics of matching name kept for the
+	// given peer, or for all peers if empty, from newest to oldest.
+	MetricHistory(name string, pid peer.ID) []api.Metric
 	// Alerts delivers alerts generated when this peer monitor detects
 	// a problem (i.e. metrics not arriving as expected). Alerts can be used
 	// to trigger self-healing measures or re-pinnings of content.
@@ -209,7 +209,7 @@ func makePinTracker(t *testing.T, pid peer.ID, mptCfg *maptracker.Config, sptCfg
 }
 
 func createCluster(t *testing.T, host host.Host, clusterCfg *Config, raftCons *raft.Consensus, apis []API, ipfs IPFSConnector, state state.State, tracker PinTracker, mon PeerMonitor, alloc PinAllocator, inf Informer) *Cluster {
-	cl, err := NewCluster(host, clusterCfg, raftCons, apis, ipfs, state, tracker, mon, alloc, inf)
+	cl, err := NewCluster(host, clusterCfg, raftCons, apis, ipfs, state, tracker, mon, alloc, []Informer{inf})
 	checkErr(t, err)
 	return cl
 }
@@ -1020,6 +1020,68 @@ func TestClustersReplicationFactorMax(t *testing.T) {
 	runF(t, clusters, f)
 }
 
+func TestClustersPinUserAllocations(t *testing.T) {
+	if nClusters < 4 {
+		t.Skip("Need at least 4 peers")
+	}
+
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+	for _, c := range clusters {
+		c.config.ReplicationFactorMin = -1
+		c.config.ReplicationFactorMax = -1
+	}
+
+	ttlDelay()
+
+	// Replication factor defaults to the number of user allocations
+	h1, _ := cid.Decode(test.TestCid1)
+	userAllocs := []peer.ID{clusters[1].id, clusters[2].id}
+	pin1 := api.PinCid(h1)
+	pin1.UserAllocations = api.PeersToStrings(userAllocs)
+	err := clusters[0].Pin(pin1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Remaining allocations are filled by the allocator
+	h2, _ := cid.Decode(test.TestCid2)
+	pin2 := api.PinCid(h2)
+	pin2.ReplicationFactorMin = 3
+	pin2.ReplicationFactorMax = 3
+	pin2.UserAllocations = api.PeersToStrings([]peer.ID{clusters[3].id})
+	err = clusters[0].Pin(pin2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pinDelay()
+
+	f := func(t *testing.T, c *Cluster) {
+		p, err := c.PinGet(h1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.ReplicationFactorMin != 2 || p.ReplicationFactorMax != 2 {
+			t.Error("replication factors should match the user allocations")
+		}
+		if len(p.Allocations) != 2 ||
+			!containsPeer(p.Allocations, userAllocs[0]) ||
+			!containsPeer(p.Allocations, userAllocs[1]) {
+			t.Error("pin should be allocated to the user allocations:", p.Allocations)
+		}
+
+		p, err = c.PinGet(h2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Allocations) != 3 || !containsPeer(p.Allocations, clusters[3].id) {
+			t.Error("pin should be allocated to the user allocation and two more peers:", p.Allocations)
+		}
+	}
+	runF(t, clusters, f)
+}
+
 // This tests checks that repinning something that is overpinned
 // removes some allocations
 func TestClustersReplicationFactorMaxLower(t *testing.T) {
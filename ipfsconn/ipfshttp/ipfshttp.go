@@ -11,6 +11,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
@@ -86,6 +87,14 @@ type ipfsPeer struct {
 	Peer string
 }
 
+type ipfsResolveResp struct {
+	Path string
+}
+
+type ipfsObjectStatResp struct {
+	CumulativeSize uint64
+}
+
 type ipfsStream struct {
 	Protocol string
 }
@@ -279,6 +288,23 @@ func (ipfs *Connector) Pin(ctx context.Context, hash cid.Cid, maxDepth int) erro
 	return err
 }
 
+// PinUpdate performs a "pin update" request against the configured IPFS
+// daemon, which recursively pins "to" fetching only the blocks which are
+// not part of "from". "from" must be recursively pinned and it is not
+// unpinned.
+func (ipfs *Connector) PinUpdate(ctx context.Context, from, to cid.Cid) error {
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.PinTimeout)
+	defer cancel()
+	defer ipfs.updateInformerMetric()
+
+	path := fmt.Sprintf("pin/update?arg=%s&arg=%s&unpin=false", from, to)
+	_, err := ipfs.postCtx(ctx, path, "", nil)
+	if err == nil {
+		logger.Infof("IPFS Pin Update request succeeded: %s -> %s", from, to)
+	}
+	return err
+}
+
 // Unpin performs an unpin request against the configured IPFS
 // daemon.
 func (ipfs *Connector) Unpin(ctx context.Context, hash cid.Cid) error {
@@ -289,7 +315,8 @@ func (ipfs *Connector) Unpin(ctx context.Context, hash cid.Cid) error {
 	if err != nil {
 		return err
 	}
-	if pinStatus.IsPinned(-1) {
+	// Unpin items pinned to any depth (including direct pins).
+	if pinStatus.IsPinned(0) {
 		defer ipfs.updateInformerMetric()
 		path := fmt.Sprintf("pin/rm?arg=%s", hash)
 		_, err := ipfs.postCtx(ctx, path, "", nil)
@@ -615,6 +642,54 @@ func (ipfs *Connector) BlockGet(c cid.Cid) ([]byte, error) {
 	return ipfs.postCtx(ctx, url, "", nil)
 }
 
+// Resolve performs a recursive "resolve" request for the given path (i.e.
+// /ipns/<name> or /ipns/<dnslink-domain>) and returns the Cid that it
+// currently points to.
+func (ipfs *Connector) Resolve(ctx context.Context, path string) (cid.Cid, error) {
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.IPFSRequestTimeout)
+	defer cancel()
+	res, err := ipfs.postCtx(ctx, "resolve?recursive=true&arg="+url.QueryEscape(path), "", nil)
+	if err != nil {
+		logger.Error(err)
+		return cid.Undef, err
+	}
+
+	var resolved ipfsResolveResp
+	err = json.Unmarshal(res, &resolved)
+	if err != nil {
+		logger.Error(err)
+		return cid.Undef, err
+	}
+
+	// The response path has the form /ipfs/<cid>
+	hash := strings.TrimPrefix(resolved.Path, "/ipfs/")
+	if hash == resolved.Path || strings.Contains(hash, "/") {
+		return cid.Undef, fmt.Errorf("unexpected resolved path: %s", resolved.Path)
+	}
+	return cid.Decode(hash)
+}
+
+// DagSize performs an "object/stat" request for the given Cid and returns
+// the cumulative size of the DAG. Only the root block is needed, which may
+// be fetched from the network.
+func (ipfs *Connector) DagSize(ctx context.Context, hash cid.Cid) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.IPFSRequestTimeout)
+	defer cancel()
+	res, err := ipfs.postCtx(ctx, "object/stat?arg="+hash.String(), "", nil)
+	if err != nil {
+		logger.Error(err)
+		return 0, err
+	}
+
+	var stat ipfsObjectStatResp
+	err = json.Unmarshal(res, &stat)
+	if err != nil {
+		logger.Error(err)
+		return 0, err
+	}
+	return stat.CumulativeSize, nil
+}
+
 // Returns true every updateMetricsMod-th time that we
 // call this function.
 func (ipfs *Connector) shouldUpdateMetric() bool {
@@ -634,15 +709,13 @@ func (ipfs *Connector) updateInformerMetric() error {
 		return nil
 	}
 
-	var metric api.Metric
-
 	err := ipfs.rpcClient.GoContext(
 		ipfs.ctx,
 		"",
 		"Cluster",
-		"SendInformerMetric",
+		"SendInformersMetrics",
 		struct{}{},
-		&metric,
+		&struct{}{},
 		nil,
 	)
 	if err != nil {
@@ -103,6 +103,76 @@ func TestIPFSPin(t *testing.T) {
 	t.Run("method=refs", func(t *testing.T) { testPin(t, "refs") })
 }
 
+func TestIPFSPinMaxDepth(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := ipfs.Pin(ctx, c, 2)
+	if err != nil {
+		t.Fatal("expected success pinning cid")
+	}
+	pinSt, err := ipfs.PinLsCid(ctx, c)
+	if err != nil {
+		t.Fatal("expected success doing ls")
+	}
+	if pinSt.MaxDepth() != 2 || !pinSt.IsPinned(2) || pinSt.IsPinned(-1) {
+		t.Error("cid should have been pinned with depth 2")
+	}
+
+	// pinning deeper should work
+	err = ipfs.Pin(ctx, c, -1)
+	if err != nil {
+		t.Fatal("expected success pinning cid")
+	}
+	pinSt, _ = ipfs.PinLsCid(ctx, c)
+	if !pinSt.IsPinned(-1) {
+		t.Error("cid should have been pinned recursively")
+	}
+
+	err = ipfs.Unpin(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinSt, _ = ipfs.PinLsCid(ctx, c)
+	if pinSt != api.IPFSPinStatusUnpinned {
+		t.Error("cid should have been unpinned")
+	}
+}
+
+func TestIPFSPinUpdate(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+
+	err := ipfs.PinUpdate(ctx, c1, c2)
+	if err == nil {
+		t.Error("expected an error updating from an unpinned cid")
+	}
+
+	err = ipfs.Pin(ctx, c1, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ipfs.PinUpdate(ctx, c1, c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []cid.Cid{c1, c2} {
+		pinSt, _ := ipfs.PinLsCid(ctx, c)
+		if !pinSt.IsPinned(-1) {
+			t.Errorf("%s should be pinned", c)
+		}
+	}
+}
+
 func TestIPFSUnpin(t *testing.T) {
 	ctx := context.Background()
 	ipfs, mock := testIPFSConnector(t)
@@ -320,3 +390,53 @@ func TestConfigKey(t *testing.T) {
 		t.Error("should not work with a bad path")
 	}
 }
+
+func TestDagSize(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	size, err := ipfs.DagSize(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 1000 {
+		t.Error("expected 1000 bytes of size")
+	}
+
+	c, _ = cid.Decode(test.ErrorCid)
+	_, err = ipfs.DagSize(ctx, c)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	c, err := ipfs.Resolve(ctx, test.TestIPNSPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.String() != test.TestCid1 {
+		t.Error("resolved the wrong cid")
+	}
+
+	c, err = ipfs.Resolve(ctx, test.TestDNSLinkPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.String() != test.TestCid2 {
+		t.Error("resolved the wrong cid")
+	}
+
+	_, err = ipfs.Resolve(ctx, "/ipns/unknown")
+	if err == nil {
+		t.Error("expected an error resolving an unknown name")
+	}
+}
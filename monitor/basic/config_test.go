@@ -3,6 +3,8 @@ package basic
 import (
 	"encoding/json"
 	"testing"
+
+	"github.com/ipfs/ipfs-cluster/monitor/metrics"
 )
 
 var cfgJSON = []byte(`
@@ -54,4 +56,40 @@ func TestDefault(t *testing.T) {
 	if cfg.Validate() == nil {
 		t.Fatal("expected error validating")
 	}
+
+	cfg.Default()
+	cfg.WindowCap = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating window_cap")
+	}
+
+	cfg.Default()
+	cfg.PhiThreshold = -1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating phi_threshold")
+	}
+}
+
+func TestGetHistoryPath(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	if cfg.WindowCap != metrics.DefaultWindowCap {
+		t.Error("window_cap should default when missing")
+	}
+	if cfg.GetHistoryPath() != "" {
+		t.Error("history should not be persisted by default")
+	}
+	if cfg.PhiThreshold != 0 {
+		t.Error("phi-accrual detection should be disabled by default")
+	}
+
+	cfg.SetBaseDir("/base")
+	cfg.HistoryFile = "history"
+	if cfg.GetHistoryPath() != "/base/history" {
+		t.Error("expected a path relative to the base dir")
+	}
+	cfg.HistoryFile = "/var/history"
+	if cfg.GetHistoryPath() != "/var/history" {
+		t.Error("expected the absolute path")
+	}
 }
@@ -48,8 +48,14 @@ func NewMonitor(cfg *Config) (*Monitor, error) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	mtrs := metrics.NewStore()
-	checker := metrics.NewChecker(mtrs)
+	mtrs := metrics.NewStoreWithCap(cfg.WindowCap)
+	if path := cfg.GetHistoryPath(); path != "" {
+		err := mtrs.LoadFile(path)
+		if err != nil {
+			logger.Warningf("error restoring the metric history: %s", err)
+		}
+	}
+	checker := metrics.NewCheckerWithThreshold(mtrs, cfg.PhiThreshold)
 
 	mon := &Monitor{
 		ctx:      ctx,
@@ -94,6 +100,7 @@ func (mon *Monitor) Shutdown() error {
 	close(mon.rpcReady)
 	mon.cancel()
 	mon.wg.Wait()
+	mon.saveHistory()
 	mon.shutdown = true
 	return nil
 }
@@ -195,6 +202,25 @@ func (mon *Monitor) LatestMetrics(name string) []api.Metric {
 	return metrics.PeersetFilter(latest, peers)
 }
 
+// MetricHistory returns the metrics of the given type kept for the given
+// peer (or for all peers when pid is empty), from the newest to the
+// oldest. Expired metrics and those from former peers are included.
+func (mon *Monitor) MetricHistory(name string, pid peer.ID) []api.Metric {
+	return mon.metrics.History(name, pid)
+}
+
+// saveHistory persists the metric history, when enabled.
+func (mon *Monitor) saveHistory() {
+	path := mon.config.GetHistoryPath()
+	if path == "" {
+		return
+	}
+	err := mon.metrics.SaveFile(path)
+	if err != nil {
+		logger.Errorf("error saving the metric history: %s", err)
+	}
+}
+
 // Alerts returns a channel on which alerts are sent when the
 // monitor detects a failure.
 func (mon *Monitor) Alerts() <-chan api.Alert {
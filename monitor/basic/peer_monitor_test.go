@@ -3,6 +3,9 @@ package basic
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"testing"
@@ -239,3 +242,48 @@ func TestPeerMonitorAlerts(t *testing.T) {
 		}
 	}
 }
+
+func TestPeerMonitorMetricHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monbasic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mock := test.NewMockRPCClient(t)
+	cfg := &Config{}
+	cfg.Default()
+	cfg.WindowCap = 2
+	cfg.HistoryFile = filepath.Join(dir, "history")
+	pm, err := NewMonitor(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm.SetClient(mock)
+
+	mf := newMetricFactory()
+	for i := 0; i < 3; i++ {
+		pm.LogMetric(mf.newMetric("test", test.TestPeerID1))
+	}
+	pm.LogMetric(mf.newMetric("test", test.TestPeerID2))
+
+	hist := pm.MetricHistory("test", test.TestPeerID1)
+	if len(hist) != 2 || hist[0].Value != "2" || hist[1].Value != "1" {
+		t.Fatalf("unexpected history: %+v", hist)
+	}
+
+	pm.Shutdown()
+	pm, err = NewMonitor(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Shutdown()
+	pm.SetClient(mock)
+
+	if len(pm.MetricHistory("test", "")) != 3 {
+		t.Error("the history should have been restored")
+	}
+	if len(pm.LatestMetrics("test")) != 0 {
+		t.Error("restored metrics should not be returned as latest")
+	}
+}
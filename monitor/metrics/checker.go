@@ -19,16 +19,28 @@ var ErrAlertChannelFull = errors.New("alert channel is full")
 // Checker provides utilities to find expired metrics
 // for a given peerset and send alerts if it proceeds to do so.
 type Checker struct {
-	alertCh chan api.Alert
-	metrics *Store
+	alertCh   chan api.Alert
+	metrics   *Store
+	threshold float64
 }
 
 // NewChecker creates a Checker using the given
 // MetricsStore.
 func NewChecker(metrics *Store) *Checker {
+	return NewCheckerWithThreshold(metrics, 0)
+}
+
+// NewCheckerWithThreshold creates a Checker using the given MetricsStore
+// which alerts when the phi-accrual suspicion level of a metric (see
+// Store.Phi) reaches the given threshold, rather than as soon as the
+// metric expires. Metrics without enough history to compute it are
+// still checked for expiration. A threshold of 0 disables phi-accrual
+// detection.
+func NewCheckerWithThreshold(metrics *Store, threshold float64) *Checker {
 	return &Checker{
-		alertCh: make(chan api.Alert, AlertChannelCap),
-		metrics: metrics,
+		alertCh:   make(chan api.Alert, AlertChannelCap),
+		metrics:   metrics,
+		threshold: threshold,
 	}
 }
 
@@ -37,7 +49,7 @@ func NewChecker(metrics *Store) *Checker {
 func (mc *Checker) CheckPeers(peers []peer.ID) error {
 	for _, peer := range peers {
 		for _, metric := range mc.metrics.PeerMetrics(peer) {
-			if metric.Valid && metric.Expired() {
+			if mc.failed(metric) {
 				err := mc.alert(metric.Peer, metric.Name)
 				if err != nil {
 					return err
@@ -48,6 +60,19 @@ func (mc *Checker) CheckPeers(peers []peer.ID) error {
 	return nil
 }
 
+// failed returns true when a metric indicates that its peer is down.
+func (mc *Checker) failed(m api.Metric) bool {
+	if !m.Valid {
+		return false
+	}
+	if mc.threshold > 0 {
+		if phi, ok := mc.metrics.Phi(m.Name, m.Peer); ok {
+			return phi >= mc.threshold
+		}
+	}
+	return m.Expired()
+}
+
 func (mc *Checker) alert(pid peer.ID, metricName string) error {
 	alrt := api.Alert{
 		Peer:       pid,
@@ -81,3 +81,50 @@ func TestCheckerWatch(t *testing.T) {
 		t.Fatal("should have received an alert")
 	}
 }
+
+func TestCheckerPhi(t *testing.T) {
+	metrics := NewStore()
+	checker := NewCheckerWithThreshold(metrics, 8)
+
+	metr := api.Metric{
+		Name:  "test",
+		Peer:  test.TestPeerID1,
+		Value: "1",
+		Valid: true,
+	}
+	// the metric has expired, but arrived regularly until a
+	// moment ago
+	metr.SetTTL(-time.Second)
+	now := time.Now()
+	for i := 4; i >= 0; i-- {
+		metrics.add(metr, now.Add(time.Duration(-i)*time.Second))
+	}
+
+	err := checker.CheckPeers([]peer.ID{test.TestPeerID1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-checker.Alerts():
+		t.Error("there should not be an alert yet")
+	default:
+	}
+
+	// the last metric from another peer arrived long ago
+	metr.Peer = test.TestPeerID2
+	for i := 4; i >= 0; i-- {
+		metrics.add(metr, now.Add(time.Duration(-i-10)*time.Second))
+	}
+	err = checker.CheckPeers([]peer.ID{test.TestPeerID1, test.TestPeerID2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case alrt := <-checker.Alerts():
+		if alrt.Peer != test.TestPeerID2 {
+			t.Error("the alert should be for the second peer")
+		}
+	default:
+		t.Error("an alert should have been triggered")
+	}
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+	msgpack "github.com/multiformats/go-multicodec/msgpack"
+)
+
+// SaveFile writes the history of all the metrics in the Store to the
+// given path, so that it can be restored with LoadFile after a restart.
+func (mtrs *Store) SaveFile(path string) error {
+	mtrs.mux.RLock()
+	names := make(map[string]struct{})
+	for name := range mtrs.byName {
+		names[name] = struct{}{}
+	}
+	for name := range mtrs.restored {
+		names[name] = struct{}{}
+	}
+	all := make([]api.Metric, 0)
+	for name := range names {
+		for _, p := range mtrs.unsafePeers(name) {
+			all = append(all, mtrs.unsafePeerHistory(name, p)...)
+		}
+	}
+	mtrs.mux.RUnlock()
+
+	var buf bytes.Buffer
+	enc := msgpack.Multicodec(msgpack.DefaultMsgpackHandle()).Encoder(&buf)
+	err := enc.Encode(all)
+	if err != nil {
+		return err
+	}
+
+	// write and rename so a failure does not leave a truncated file
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, buf.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadFile restores the history written with SaveFile, replacing any
+// previously restored metrics. Restored metrics are only returned by
+// History. A missing file is not an error.
+func (mtrs *Store) LoadFile(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var all []api.Metric
+	dec := msgpack.Multicodec(msgpack.DefaultMsgpackHandle()).Decoder(bytes.NewReader(b))
+	err = dec.Decode(&all)
+	if err != nil {
+		return err
+	}
+
+	mtrs.mux.Lock()
+	defer mtrs.mux.Unlock()
+	mtrs.restored = make(map[string]map[peer.ID][]api.Metric)
+	for _, m := range all {
+		byPeer, ok := mtrs.restored[m.Name]
+		if !ok {
+			byPeer = make(map[peer.ID][]api.Metric)
+			mtrs.restored[m.Name] = byPeer
+		}
+		if len(byPeer[m.Peer]) < mtrs.windowCap {
+			byPeer[m.Peer] = append(byPeer[m.Peer], m)
+		}
+	}
+	return nil
+}
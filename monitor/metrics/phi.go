@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"math"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// The phi-accrual failure detector (Hayashibara et al.) does not decide
+// whether a peer is down. Instead, it estimates how suspicious it is that
+// no metric has arrived since the last one, given the inter-arrival times
+// seen so far. phi is -log10 of the probability that a metric arrives
+// later than now: a phi of 1 means a 10% chance that the peer is fine,
+// a phi of 2 a 1% chance, and so on.
+
+// phiMinIntervals is the number of inter-arrival times needed before phi
+// can be computed. Until then, metrics are checked against their TTL.
+const phiMinIntervals = 3
+
+// phiMinStdDevRatio is the smallest standard deviation of the
+// inter-arrival times, as a fraction of their mean. It prevents
+// metrics which have arrived very regularly from becoming suspicious
+// after the slightest delay.
+const phiMinStdDevRatio = 0.1
+
+// phi returns the suspicion level for an elapsed time since the last
+// arrival, assuming that the inter-arrival times follow a normal
+// distribution. It returns +Inf when the probability is too small
+// to be represented.
+func phi(intervals []time.Duration, elapsed time.Duration) float64 {
+	var sum float64
+	for _, i := range intervals {
+		sum += i.Seconds()
+	}
+	mean := sum / float64(len(intervals))
+
+	var variance float64
+	for _, i := range intervals {
+		d := i.Seconds() - mean
+		variance += d * d
+	}
+	variance /= float64(len(intervals))
+
+	stdDev := math.Max(math.Sqrt(variance), mean*phiMinStdDevRatio)
+	y := (elapsed.Seconds() - mean) / stdDev
+	pLater := 0.5 * math.Erfc(y/math.Sqrt2)
+	return -math.Log10(pLater)
+}
+
+// Phi returns the suspicion level of the given peer regarding the metric
+// with the given name, based on when the metrics in its window were added.
+// It returns false when there are not enough metrics to compute it.
+func (mtrs *Store) Phi(name string, pid peer.ID) (float64, bool) {
+	mtrs.mux.RLock()
+	defer mtrs.mux.RUnlock()
+
+	window, ok := mtrs.byName[name][pid]
+	if !ok {
+		return 0, false
+	}
+	intervals := window.Intervals()
+	if len(intervals) < phiMinIntervals {
+		return 0, false
+	}
+	var sum time.Duration
+	for _, i := range intervals {
+		sum += i
+	}
+	if sum <= 0 {
+		return 0, false
+	}
+	last, err := window.LatestArrival()
+	if err != nil {
+		return 0, false
+	}
+	return phi(intervals, time.Since(last)), true
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func TestPhi(t *testing.T) {
+	intervals := []time.Duration{
+		9 * time.Second,
+		10 * time.Second,
+		11 * time.Second,
+		10 * time.Second,
+	}
+
+	p := phi(intervals, 10*time.Second)
+	if math.Abs(p-math.Log10(2)) > 0.001 {
+		t.Error("phi at the mean should be -log10(0.5):", p)
+	}
+
+	prev := 0.0
+	for _, elapsed := range []time.Duration{5, 10, 12, 15, 20} {
+		p := phi(intervals, elapsed*time.Second)
+		if p <= prev {
+			t.Errorf("phi should grow with the elapsed time (%s: %f)", elapsed*time.Second, p)
+		}
+		prev = p
+	}
+
+	if !math.IsInf(phi(intervals, time.Hour), 1) {
+		t.Error("expected an infinite phi")
+	}
+
+	// A perfectly regular peer is not immediately suspicious
+	regular := []time.Duration{time.Second, time.Second, time.Second}
+	if p := phi(regular, 1100*time.Millisecond); p > 1 {
+		t.Error("phi is too high for a small delay:", p)
+	}
+}
+
+func TestStorePhi(t *testing.T) {
+	metrics := NewStore()
+	metr := api.Metric{
+		Name:  "test",
+		Peer:  test.TestPeerID1,
+		Value: "1",
+		Valid: true,
+	}
+
+	if _, ok := metrics.Phi("test", test.TestPeerID1); ok {
+		t.Error("phi should not be available without metrics")
+	}
+
+	now := time.Now()
+	for i := 3; i > 0; i-- {
+		metrics.add(metr, now.Add(time.Duration(-i)*time.Second))
+	}
+	if _, ok := metrics.Phi("test", test.TestPeerID1); ok {
+		t.Error("phi should not be available with 2 intervals")
+	}
+
+	metrics.add(metr, now)
+	p, ok := metrics.Phi("test", test.TestPeerID1)
+	if !ok {
+		t.Fatal("phi should be available")
+	}
+	if p > 1 {
+		t.Error("the peer should not be suspicious yet:", p)
+	}
+}
@@ -1,7 +1,9 @@
 package metrics
 
 import (
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
 
@@ -13,19 +15,40 @@ type PeerMetrics map[peer.ID]*Window
 
 // Store can be used to store and access metrics.
 type Store struct {
-	mux    sync.RWMutex
-	byName map[string]PeerMetrics
+	mux       sync.RWMutex
+	windowCap int
+	byName    map[string]PeerMetrics
+	// restored keeps the metrics loaded with LoadFile. They are only
+	// used to complete the history and are never checked nor
+	// returned as the latest metrics.
+	restored map[string]map[peer.ID][]api.Metric
 }
 
-// NewStore can be used to create a Store.
+// NewStore can be used to create a Store which keeps
+// DefaultWindowCap metrics per peer.
 func NewStore() *Store {
+	return NewStoreWithCap(DefaultWindowCap)
+}
+
+// NewStoreWithCap can be used to create a Store which keeps up to
+// windowCap metrics per peer.
+func NewStoreWithCap(windowCap int) *Store {
+	if windowCap <= 0 {
+		panic("invalid windowCap")
+	}
 	return &Store{
-		byName: make(map[string]PeerMetrics),
+		windowCap: windowCap,
+		byName:    make(map[string]PeerMetrics),
+		restored:  make(map[string]map[peer.ID][]api.Metric),
 	}
 }
 
 // Add inserts a new metric in Metrics.
 func (mtrs *Store) Add(m api.Metric) {
+	mtrs.add(m, time.Now())
+}
+
+func (mtrs *Store) add(m api.Metric, arrival time.Time) {
 	mtrs.mux.Lock()
 	defer mtrs.mux.Unlock()
 
@@ -40,11 +63,11 @@ func (mtrs *Store) Add(m api.Metric) {
 	if !ok {
 		// We always lock the outer map, so we can use unsafe
 		// Window.
-		window = NewWindow(DefaultWindowCap)
+		window = NewWindow(mtrs.windowCap)
 		mbyp[peer] = window
 	}
 
-	window.Add(m)
+	window.add(m, arrival)
 }
 
 // Latest returns all the last known valid metrics. A metric is valid
@@ -90,3 +113,54 @@ func (mtrs *Store) PeerMetrics(pid peer.ID) []api.Metric {
 	}
 	return result
 }
+
+// History returns the metrics of the given name kept for the given peer,
+// from the newest to the oldest, including expired ones. When pid is
+// empty, the history of every peer is returned, grouped by peer.
+func (mtrs *Store) History(name string, pid peer.ID) []api.Metric {
+	mtrs.mux.RLock()
+	defer mtrs.mux.RUnlock()
+
+	peers := []peer.ID{pid}
+	if pid == "" {
+		peers = mtrs.unsafePeers(name)
+	}
+
+	result := make([]api.Metric, 0)
+	for _, p := range peers {
+		result = append(result, mtrs.unsafePeerHistory(name, p)...)
+	}
+	return result
+}
+
+// unsafePeers returns the sorted list of peers with metrics of the given
+// name.
+func (mtrs *Store) unsafePeers(name string) []peer.ID {
+	var peers []peer.ID
+	for p := range mtrs.byName[name] {
+		peers = append(peers, p)
+	}
+	for p := range mtrs.restored[name] {
+		if _, ok := mtrs.byName[name][p]; !ok {
+			peers = append(peers, p)
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i] < peers[j] })
+	return peers
+}
+
+// unsafePeerHistory returns the metrics of a peer, followed by the
+// restored ones, up to the window capacity.
+func (mtrs *Store) unsafePeerHistory(name string, pid peer.ID) []api.Metric {
+	var metrics []api.Metric
+	if window, ok := mtrs.byName[name][pid]; ok {
+		metrics = window.All()
+	}
+	for _, m := range mtrs.restored[name][pid] {
+		if len(metrics) >= mtrs.windowCap {
+			break
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
@@ -1,6 +1,10 @@
 package metrics
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -32,3 +36,100 @@ func TestStoreLatest(t *testing.T) {
 		t.Error("expected no metrics")
 	}
 }
+
+func TestStoreHistory(t *testing.T) {
+	store := NewStoreWithCap(3)
+
+	for i := 0; i < 5; i++ {
+		metr := api.Metric{
+			Name:  "test",
+			Peer:  test.TestPeerID1,
+			Value: fmt.Sprintf("%d", i),
+			Valid: true,
+		}
+		metr.SetTTL(time.Millisecond)
+		store.Add(metr)
+	}
+	metr := api.Metric{
+		Name:  "test",
+		Peer:  test.TestPeerID2,
+		Value: "10",
+		Valid: true,
+	}
+	store.Add(metr)
+
+	hist := store.History("test", test.TestPeerID1)
+	if len(hist) != 3 {
+		t.Fatal("expected 3 metrics")
+	}
+	if hist[0].Value != "4" || hist[2].Value != "2" {
+		t.Error("expected the newest metrics first")
+	}
+
+	if len(store.History("test", "")) != 4 {
+		t.Error("expected the metrics of both peers")
+	}
+	if len(store.History("other", "")) != 0 {
+		t.Error("expected no metrics")
+	}
+}
+
+func TestStoreSaveLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history")
+
+	store := NewStoreWithCap(3)
+	err = store.LoadFile(path)
+	if err != nil {
+		t.Fatal("a missing file should not be an error:", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		metr := api.Metric{
+			Name:  "test",
+			Peer:  test.TestPeerID1,
+			Value: fmt.Sprintf("%d", i),
+			Valid: true,
+		}
+		metr.SetTTL(time.Minute)
+		store.Add(metr)
+	}
+	err = store.SaveFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store2 := NewStoreWithCap(3)
+	err = store2.LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store2.Latest("test")) != 0 || len(store2.PeerMetrics(test.TestPeerID1)) != 0 {
+		t.Error("restored metrics should only be part of the history")
+	}
+
+	metr := api.Metric{
+		Name:  "test",
+		Peer:  test.TestPeerID1,
+		Value: "2",
+		Valid: true,
+	}
+	store2.Add(metr)
+	metr.Value = "3"
+	store2.Add(metr)
+
+	hist := store2.History("test", test.TestPeerID1)
+	if len(hist) != 3 {
+		t.Fatal("expected 3 metrics")
+	}
+	if hist[0].Value != "3" || hist[1].Value != "2" || hist[2].Value != "1" {
+		t.Errorf("unexpected history: %+v", hist)
+	}
+	if hist[2].Peer != test.TestPeerID1 {
+		t.Error("the peer was not restored")
+	}
+}
@@ -5,6 +5,7 @@ package metrics
 
 import (
 	"errors"
+	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
 )
@@ -15,10 +16,13 @@ var DefaultWindowCap = 25
 // ErrNoMetrics is returned when there are no metrics in a Window.
 var ErrNoMetrics = errors.New("no metrics have been added to this window")
 
-// Window implements a circular queue to store metrics.
+// Window implements a circular queue to store metrics. It also
+// remembers when each metric was added, so that the inter-arrival
+// times can be used to detect failures.
 type Window struct {
-	last   int
-	window []api.Metric
+	last     int
+	window   []api.Metric
+	arrivals []time.Time
 }
 
 // NewWindow creates an instance with the given
@@ -30,8 +34,9 @@ func NewWindow(windowCap int) *Window {
 
 	w := make([]api.Metric, 0, windowCap)
 	return &Window{
-		last:   0,
-		window: w,
+		last:     0,
+		window:   w,
+		arrivals: make([]time.Time, 0, windowCap),
 	}
 }
 
@@ -39,8 +44,13 @@ func NewWindow(windowCap int) *Window {
 // has been reached, the oldest metric (by the time it was added),
 // will be discarded.
 func (mw *Window) Add(m api.Metric) {
+	mw.add(m, time.Now())
+}
+
+func (mw *Window) add(m api.Metric, arrival time.Time) {
 	if len(mw.window) < cap(mw.window) {
 		mw.window = append(mw.window, m)
+		mw.arrivals = append(mw.arrivals, arrival)
 		mw.last = len(mw.window) - 1
 		return
 	}
@@ -48,6 +58,7 @@ func (mw *Window) Add(m api.Metric) {
 	// len == cap
 	mw.last = (mw.last + 1) % cap(mw.window)
 	mw.window[mw.last] = m
+	mw.arrivals[mw.last] = arrival
 	return
 }
 
@@ -77,3 +88,29 @@ func (mw *Window) All() []api.Metric {
 	}
 	return res
 }
+
+// LatestArrival returns when the last metric was added. It returns an
+// error if no metrics were added.
+func (mw *Window) LatestArrival() (time.Time, error) {
+	if len(mw.arrivals) == 0 {
+		return time.Time{}, ErrNoMetrics
+	}
+	return mw.arrivals[mw.last], nil
+}
+
+// Intervals returns the times elapsed between the additions of
+// consecutive metrics in the window, from the newest to the oldest.
+func (mw *Window) Intervals() []time.Duration {
+	wlen := len(mw.arrivals)
+	if wlen < 2 {
+		return nil
+	}
+	res := make([]time.Duration, 0, wlen-1)
+	prev := mw.arrivals[mw.last]
+	for i := 1; i < wlen; i++ {
+		arrival := mw.arrivals[(mw.last-i+wlen)%wlen]
+		res = append(res, prev.Sub(arrival))
+		prev = arrival
+	}
+	return res
+}
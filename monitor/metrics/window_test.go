@@ -70,3 +70,37 @@ func TestMetricsWindow(t *testing.T) {
 		t.Error("oldest metric should be 2")
 	}
 }
+
+func TestMetricsWindowIntervals(t *testing.T) {
+	mw := NewWindow(3)
+	if len(mw.Intervals()) != 0 {
+		t.Error("expected no intervals")
+	}
+	if _, err := mw.LatestArrival(); err != ErrNoMetrics {
+		t.Error("expected ErrNoMetrics")
+	}
+
+	now := time.Now()
+	metr := api.Metric{Name: "test", Valid: true}
+	mw.add(metr, now)
+	mw.add(metr, now.Add(1*time.Second))
+	mw.add(metr, now.Add(3*time.Second))
+	// discards the first arrival
+	mw.add(metr, now.Add(6*time.Second))
+
+	intervals := mw.Intervals()
+	if len(intervals) != 2 {
+		t.Fatal("expected 2 intervals")
+	}
+	if intervals[0] != 3*time.Second || intervals[1] != 2*time.Second {
+		t.Error("unexpected intervals:", intervals)
+	}
+
+	last, err := mw.LatestArrival()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !last.Equal(now.Add(6 * time.Second)) {
+		t.Error("unexpected latest arrival")
+	}
+}
@@ -3,9 +3,11 @@ package pubsubmon
 import (
 	"encoding/json"
 	"errors"
+	"path/filepath"
 	"time"
 
 	"github.com/ipfs/ipfs-cluster/config"
+	"github.com/ipfs/ipfs-cluster/monitor/metrics"
 )
 
 const configKey = "pubsubmon"
@@ -13,6 +15,8 @@ const configKey = "pubsubmon"
 // Default values for this Config.
 const (
 	DefaultCheckInterval = 15 * time.Second
+	DefaultHistoryFile   = ""
+	DefaultPhiThreshold  = 0
 )
 
 // Config allows to initialize a Monitor and customize some parameters.
@@ -20,10 +24,29 @@ type Config struct {
 	config.Saver
 
 	CheckInterval time.Duration
+
+	// WindowCap is the number of metrics of each type kept for every
+	// peer. Older metrics are discarded.
+	WindowCap int
+
+	// HistoryFile, when set, is the file where the metric history is
+	// saved on shutdown and restored from on start. Relative paths are
+	// relative to the configuration folder.
+	HistoryFile string
+
+	// PhiThreshold, when positive, enables phi-accrual failure
+	// detection: a peer is only considered down when the suspicion
+	// level derived from the arrival times of its metrics reaches this
+	// value, instead of as soon as a metric expires. A threshold of 8
+	// means a chance of about 1 in 10^8 that the peer is fine.
+	PhiThreshold float64
 }
 
 type jsonConfig struct {
-	CheckInterval string `json:"check_interval"`
+	CheckInterval string  `json:"check_interval"`
+	WindowCap     int     `json:"window_cap"`
+	HistoryFile   string  `json:"history_file"`
+	PhiThreshold  float64 `json:"phi_threshold"`
 }
 
 // ConfigKey provides a human-friendly identifier for this type of Config.
@@ -34,6 +57,9 @@ func (cfg *Config) ConfigKey() string {
 // Default sets the fields of this Config to sensible values.
 func (cfg *Config) Default() error {
 	cfg.CheckInterval = DefaultCheckInterval
+	cfg.WindowCap = metrics.DefaultWindowCap
+	cfg.HistoryFile = DefaultHistoryFile
+	cfg.PhiThreshold = DefaultPhiThreshold
 	return nil
 }
 
@@ -43,6 +69,12 @@ func (cfg *Config) Validate() error {
 	if cfg.CheckInterval <= 0 {
 		return errors.New("basic.check_interval too low")
 	}
+	if cfg.WindowCap <= 0 {
+		return errors.New("pubsubmon.window_cap must be positive")
+	}
+	if cfg.PhiThreshold < 0 {
+		return errors.New("pubsubmon.phi_threshold cannot be negative")
+	}
 	return nil
 }
 
@@ -59,6 +91,11 @@ func (cfg *Config) LoadJSON(raw []byte) error {
 	interval, _ := time.ParseDuration(jcfg.CheckInterval)
 	cfg.CheckInterval = interval
 
+	cfg.WindowCap = metrics.DefaultWindowCap
+	config.SetIfNotDefault(jcfg.WindowCap, &cfg.WindowCap)
+	cfg.HistoryFile = jcfg.HistoryFile
+	cfg.PhiThreshold = jcfg.PhiThreshold
+
 	return cfg.Validate()
 }
 
@@ -67,6 +104,19 @@ func (cfg *Config) ToJSON() ([]byte, error) {
 	jcfg := &jsonConfig{}
 
 	jcfg.CheckInterval = cfg.CheckInterval.String()
+	jcfg.WindowCap = cfg.WindowCap
+	jcfg.HistoryFile = cfg.HistoryFile
+	jcfg.PhiThreshold = cfg.PhiThreshold
 
 	return json.MarshalIndent(jcfg, "", "    ")
 }
+
+// GetHistoryPath returns the full path of the HistoryFile, joined
+// with BaseDir when relative. An empty string is returned when no
+// HistoryFile is set.
+func (cfg *Config) GetHistoryPath() string {
+	if cfg.HistoryFile == "" || filepath.IsAbs(cfg.HistoryFile) {
+		return cfg.HistoryFile
+	}
+	return filepath.Join(cfg.BaseDir, cfg.HistoryFile)
+}
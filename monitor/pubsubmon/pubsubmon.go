@@ -57,16 +57,39 @@ func New(h host.Host, cfg *Config) (*Monitor, error) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	mtrs := metrics.NewStore()
-	checker := metrics.NewChecker(mtrs)
-
 	pubsub, err := pubsub.NewGossipSub(ctx, h)
 	if err != nil {
 		cancel()
 		return nil, err
 	}
 
-	subscription, err := pubsub.Subscribe(PubsubTopic)
+	return newMonitor(ctx, cancel, h, pubsub, cfg)
+}
+
+// NewWithPubSub creates a new PubSub monitor which uses an existing
+// PubSub instance. This allows sharing the PubSub router with other
+// components running on the same host.
+func NewWithPubSub(h host.Host, psub *pubsub.PubSub, cfg *Config) (*Monitor, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return newMonitor(ctx, cancel, h, psub, cfg)
+}
+
+func newMonitor(ctx context.Context, cancel func(), h host.Host, psub *pubsub.PubSub, cfg *Config) (*Monitor, error) {
+	mtrs := metrics.NewStoreWithCap(cfg.WindowCap)
+	if path := cfg.GetHistoryPath(); path != "" {
+		err := mtrs.LoadFile(path)
+		if err != nil {
+			logger.Warningf("error restoring the metric history: %s", err)
+		}
+	}
+	checker := metrics.NewCheckerWithThreshold(mtrs, cfg.PhiThreshold)
+
+	subscription, err := psub.Subscribe(PubsubTopic)
 	if err != nil {
 		cancel()
 		return nil, err
@@ -78,7 +101,7 @@ func New(h host.Host, cfg *Config) (*Monitor, error) {
 		rpcReady: make(chan struct{}, 1),
 
 		host:         h,
-		pubsub:       pubsub,
+		pubsub:       psub,
 		subscription: subscription,
 
 		metrics: mtrs,
@@ -158,6 +181,7 @@ func (mon *Monitor) Shutdown() error {
 	mon.cancel()
 
 	mon.wg.Wait()
+	mon.saveHistory()
 	mon.shutdown = true
 	return nil
 }
@@ -230,6 +254,25 @@ func (mon *Monitor) LatestMetrics(name string) []api.Metric {
 	return metrics.PeersetFilter(latest, peers)
 }
 
+// MetricHistory returns the metrics of the given type kept for the given
+// peer (or for all peers when pid is empty), from the newest to the
+// oldest. Expired metrics and those from former peers are included.
+func (mon *Monitor) MetricHistory(name string, pid peer.ID) []api.Metric {
+	return mon.metrics.History(name, pid)
+}
+
+// saveHistory persists the metric history, when enabled.
+func (mon *Monitor) saveHistory() {
+	path := mon.config.GetHistoryPath()
+	if path == "" {
+		return
+	}
+	err := mon.metrics.SaveFile(path)
+	if err != nil {
+		logger.Errorf("error saving the metric history: %s", err)
+	}
+}
+
 // Alerts returns a channel on which alerts are sent when the
 // monitor detects a failure.
 func (mon *Monitor) Alerts() <-chan api.Alert {
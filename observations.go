@@ -0,0 +1,186 @@
+package ipfscluster
+
+import (
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/observations"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// This file gathers the metrics describing the internals of this peer,
+// which are exported in the Prometheus text format (see the REST API
+// "/metrics" endpoint):
+//
+// * Counters are updated as things happen: RPC calls handled, commits
+//   to the shared state, consensus leader changes and alerts.
+// * Gauges are computed when the metrics are requested: pins by status,
+//   pending pin tracker operations and the values of the informers'
+//   metrics for every peer. Obtaining the status of every pin may
+//   require asking IPFS for all its pins, so the pins by status are
+//   only counted again once per IPFSSyncInterval.
+
+// leaderWatchInterval is how often the consensus leader is checked in
+// order to count leader changes.
+var leaderWatchInterval = 5 * time.Second
+
+type clusterObservations struct {
+	registry *observations.Registry
+
+	rpcCalls       *observations.Counter
+	rpcErrors      *observations.Counter
+	commitDuration *observations.Histogram
+	leaderChanges  *observations.Counter
+	alerts         *observations.Counter
+
+	pins           *observations.Gauge
+	operations     *observations.Gauge
+	informerValues *observations.Gauge
+
+	pinCountsMux sync.Mutex
+	pinCounts    map[string]int
+	pinCountsAt  time.Time
+}
+
+func newClusterObservations() *clusterObservations {
+	r := observations.NewRegistry()
+	obs := &clusterObservations{
+		registry: r,
+		rpcCalls: r.NewCounter(
+			"cluster_rpc_calls_total",
+			"RPC calls handled by this peer, by method.",
+			"method",
+		),
+		rpcErrors: r.NewCounter(
+			"cluster_rpc_errors_total",
+			"RPC calls handled by this peer which returned an error, by method.",
+			"method",
+		),
+		commitDuration: r.NewHistogram(
+			"cluster_consensus_commit_duration_seconds",
+			"Time taken to commit operations to the shared state, by operation.",
+			observations.DefaultBuckets,
+			"op",
+		),
+		leaderChanges: r.NewCounter(
+			"cluster_consensus_leader_changes_total",
+			"Consensus leader changes seen by this peer.",
+		),
+		alerts: r.NewCounter(
+			"cluster_alerts_total",
+			"Alerts emitted by the peer monitor, by metric and peer.",
+			"metric", "peer",
+		),
+		pins: r.NewGauge(
+			"cluster_pins",
+			"Pins tracked by this peer, by status.",
+			"status",
+		),
+		operations: r.NewGauge(
+			"cluster_pintracker_operations",
+			"Pin operations of the pin tracker which have not completed, by status.",
+			"status",
+		),
+		informerValues: r.NewGauge(
+			"cluster_informer_value",
+			"Latest valid numeric values of the metrics of this peer's informers, by metric and peer.",
+			"metric", "peer",
+		),
+	}
+	obs.leaderChanges.Add(0)
+	return obs
+}
+
+// WriteObservations writes the metrics describing the internals of this
+// peer in the Prometheus text format.
+func (c *Cluster) WriteObservations(w io.Writer) error {
+	return c.observations.registry.WriteText(w)
+}
+
+// collectObservations updates the gauges of the observations. It is
+// called every time they are written.
+func (c *Cluster) collectObservations() {
+	obs := c.observations
+
+	obs.pins.Reset()
+	for st, n := range c.pinCounts() {
+		obs.pins.Set(float64(n), st)
+	}
+
+	backlog := c.tracker.Backlog()
+	obs.operations.Set(float64(backlog.PinQueued), api.TrackerStatusPinQueued.String())
+	obs.operations.Set(float64(backlog.Pinning), api.TrackerStatusPinning.String())
+	obs.operations.Set(float64(backlog.PinError), api.TrackerStatusPinError.String())
+
+	obs.informerValues.Reset()
+	for _, informer := range c.informers {
+		name := informer.Name()
+		for _, m := range c.monitor.LatestMetrics(name) {
+			v, err := strconv.ParseFloat(m.Value, 64)
+			if err != nil { // i.e. tags
+				continue
+			}
+			obs.informerValues.Set(v, name, peer.IDB58Encode(m.Peer))
+		}
+	}
+}
+
+// pinCounts returns the number of pins tracked by this peer by status.
+// They are counted at most once per IPFSSyncInterval.
+func (c *Cluster) pinCounts() map[string]int {
+	obs := c.observations
+	obs.pinCountsMux.Lock()
+	defer obs.pinCountsMux.Unlock()
+
+	if obs.pinCounts != nil && time.Since(obs.pinCountsAt) < c.config.IPFSSyncInterval {
+		return obs.pinCounts
+	}
+
+	counts := make(map[string]int)
+	for _, pinfo := range c.tracker.StatusAll() {
+		if st := pinfo.Status.String(); st != "" {
+			counts[st]++
+		}
+	}
+	obs.pinCounts = counts
+	obs.pinCountsAt = time.Now()
+	return counts
+}
+
+// observeCommit records how long it took to commit an operation to the
+// shared state since start.
+func (c *Cluster) observeCommit(op string, start time.Time) {
+	c.observations.commitDuration.Observe(time.Since(start).Seconds(), op)
+}
+
+// leaderWatcher counts the consensus leader changes and emits an event
+// for each of them.
+func (c *Cluster) leaderWatcher() {
+	ticker := time.NewTicker(leaderWatchInterval)
+	defer ticker.Stop()
+
+	var last peer.ID
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			leader, err := c.consensus.Leader()
+			if err != nil {
+				continue
+			}
+			if last != "" && leader != last {
+				c.observations.leaderChanges.Inc()
+				c.publishEvent(api.Event{
+					Type: api.EventLeaderChanged,
+					Peer: peer.IDB58Encode(leader),
+				})
+			}
+			last = leader
+		}
+	}
+}
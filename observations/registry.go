@@ -0,0 +1,289 @@
+// Package observations provides a minimal registry of counters, gauges and
+// histograms describing the internals of a cluster peer, which can be
+// written in the Prometheus text exposition format.
+package observations
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the HTTP Content-Type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds, in seconds, used by histograms
+// measuring latencies.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+// Registry keeps a set of metrics. It is safe for concurrent use.
+type Registry struct {
+	mu         sync.Mutex
+	families   map[string]*family
+	collectors []func()
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make(map[string]*family),
+	}
+}
+
+// family holds all the series of a metric, indexed by their
+// rendered labels.
+type family struct {
+	name       string
+	help       string
+	typ        metricType
+	labelNames []string
+	buckets    []float64
+	series     map[string]*series
+}
+
+type series struct {
+	labels  string
+	value   float64
+	buckets []uint64
+	count   uint64
+}
+
+func (r *Registry) register(name, help string, typ metricType, buckets []float64, labelNames []string) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.families[name]; ok {
+		panic("metric already registered: " + name)
+	}
+	f := &family{
+		name:       name,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*series),
+	}
+	r.families[name] = f
+	return f
+}
+
+// OnCollect registers a function which is called before writing the
+// metrics. It is used to update gauges which are only worth computing
+// when the metrics are requested.
+func (r *Registry) OnCollect(f func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, f)
+}
+
+// unsafeSeries returns the series for the given label values, creating it
+// if needed.
+func (f *family) unsafeSeries(labelValues []string) *series {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("%s: expected %d label values", f.name, len(f.labelNames)))
+	}
+	labels := renderLabels(f.labelNames, labelValues)
+	s, ok := f.series[labels]
+	if !ok {
+		s = &series{labels: labels}
+		if f.typ == histogramType {
+			s.buckets = make([]uint64, len(f.buckets))
+		}
+		f.series[labels] = s
+	}
+	return s
+}
+
+// Counter is a metric which only goes up.
+type Counter struct {
+	r *Registry
+	f *family
+}
+
+// NewCounter registers a Counter with the given label names.
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+	return &Counter{r, r.register(name, help, counterType, nil, labelNames)}
+}
+
+// Inc increments by one the counter with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter with the given label values by v, which
+// must not be negative.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("counters cannot decrease")
+	}
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	c.f.unsafeSeries(labelValues).value += v
+}
+
+// Gauge is a metric which can take any value.
+type Gauge struct {
+	r *Registry
+	f *family
+}
+
+// NewGauge registers a Gauge with the given label names.
+func (r *Registry) NewGauge(name, help string, labelNames ...string) *Gauge {
+	return &Gauge{r, r.register(name, help, gaugeType, nil, labelNames)}
+}
+
+// Set sets the gauge with the given label values to v.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.r.mu.Lock()
+	defer g.r.mu.Unlock()
+	g.f.unsafeSeries(labelValues).value = v
+}
+
+// Reset removes all the series of the gauge, so that values which are no
+// longer set (i.e. of peers which left) are not reported.
+func (g *Gauge) Reset() {
+	g.r.mu.Lock()
+	defer g.r.mu.Unlock()
+	g.f.series = make(map[string]*series)
+}
+
+// Histogram counts observations in buckets.
+type Histogram struct {
+	r *Registry
+	f *family
+}
+
+// NewHistogram registers a Histogram with the given bucket upper bounds,
+// which must be sorted, and label names.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic("histogram buckets must be sorted")
+	}
+	return &Histogram{r, r.register(name, help, histogramType, buckets, labelNames)}
+}
+
+// Observe adds an observation to the histogram with the given
+// label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.r.mu.Lock()
+	defer h.r.mu.Unlock()
+	s := h.f.unsafeSeries(labelValues)
+	for i, upper := range h.f.buckets {
+		if v <= upper {
+			s.buckets[i]++
+		}
+	}
+	s.count++
+	s.value += v
+}
+
+// WriteText runs the collectors and writes all the metrics to w in the
+// Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	collectors := r.collectors
+	r.mu.Unlock()
+	for _, f := range collectors {
+		f()
+	}
+
+	var buf bytes.Buffer
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.families[name].unsafeWrite(&buf)
+	}
+	r.mu.Unlock()
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (f *family) unsafeWrite(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(buf, "# TYPE %s %s\n", f.name, f.typ)
+
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := f.series[k]
+		if f.typ != histogramType {
+			fmt.Fprintf(buf, "%s%s %s\n", f.name, braces(s.labels), formatFloat(s.value))
+			continue
+		}
+		for i, upper := range f.buckets {
+			le := appendLabel(s.labels, "le", formatFloat(upper))
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", f.name, braces(le), s.buckets[i])
+		}
+		le := appendLabel(s.labels, "le", "+Inf")
+		fmt.Fprintf(buf, "%s_bucket%s %d\n", f.name, braces(le), s.count)
+		fmt.Fprintf(buf, "%s_sum%s %s\n", f.name, braces(s.labels), formatFloat(s.value))
+		fmt.Fprintf(buf, "%s_count%s %d\n", f.name, braces(s.labels), s.count)
+	}
+}
+
+func renderLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i := range names {
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", names[i], escapeLabel(values[i]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func appendLabel(labels, name, value string) string {
+	l := fmt.Sprintf("%s=\"%s\"", name, value)
+	if labels == "" {
+		return l
+	}
+	return labels + "," + l
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func escapeHelp(v string) string {
+	return helpEscaper.Replace(v)
+}
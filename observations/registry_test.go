@@ -0,0 +1,96 @@
+package observations
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func writeText(t *testing.T, r *Registry) string {
+	var buf bytes.Buffer
+	err := r.WriteText(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestCounter(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("test_calls_total", "Calls by method.", "method")
+	c.Inc("Pin")
+	c.Inc("Pin")
+	c.Add(3, "Unpin")
+
+	expected := `# HELP test_calls_total Calls by method.
+# TYPE test_calls_total counter
+test_calls_total{method="Pin"} 2
+test_calls_total{method="Unpin"} 3
+`
+	if out := writeText(t, r); out != expected {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestGaugeAndCollectors(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGauge("test_value", "A value.", "peer")
+	noLabels := r.NewGauge("test_up", "Whether it is up.")
+	g.Set(1, "a")
+
+	calls := 0
+	r.OnCollect(func() {
+		calls++
+		g.Reset()
+		g.Set(2.5, "b\"c")
+		noLabels.Set(1)
+	})
+
+	out := writeText(t, r)
+	if calls != 1 {
+		t.Error("the collector should have run")
+	}
+	if strings.Contains(out, `peer="a"`) {
+		t.Error("the gauge should have been reset")
+	}
+	if !strings.Contains(out, `test_value{peer="b\"c"} 2.5`) {
+		t.Errorf("label values should be escaped:\n%s", out)
+	}
+	if !strings.Contains(out, "\ntest_up 1\n") {
+		t.Errorf("expected a metric without labels:\n%s", out)
+	}
+	if strings.Index(out, "test_up") > strings.Index(out, "test_value") {
+		t.Error("metrics should be sorted by name")
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogram("test_seconds", "Durations.", []float64{0.1, 1}, "op")
+	h.Observe(0.05, "pin")
+	h.Observe(0.5, "pin")
+	h.Observe(2, "pin")
+
+	expected := `# HELP test_seconds Durations.
+# TYPE test_seconds histogram
+test_seconds_bucket{op="pin",le="0.1"} 1
+test_seconds_bucket{op="pin",le="1"} 2
+test_seconds_bucket{op="pin",le="+Inf"} 3
+test_seconds_sum{op="pin"} 2.55
+test_seconds_count{op="pin"} 3
+`
+	if out := writeText(t, r); out != expected {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	r := NewRegistry()
+	r.NewCounter("test", "")
+	r.NewGauge("test", "")
+}
@@ -69,7 +69,7 @@ func TestClustersPeerAdd(t *testing.T) {
 	}
 
 	for i := 1; i < len(clusters); i++ {
-		id, err := clusters[0].PeerAdd(clusters[i].id)
+		id, err := clusters[0].PeerAdd(clusters[i].id, api.PeerRoleVoter)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -136,6 +136,48 @@ func TestClustersPeerAdd(t *testing.T) {
 	runF(t, clusters, f2)
 }
 
+func TestClustersPeerAddNonVoter(t *testing.T) {
+	clusters, mocks := peerManagerClusters(t)
+	defer shutdownClusters(t, clusters, mocks)
+
+	if len(clusters) < 2 {
+		t.Skip("need at least 2 nodes for this test")
+	}
+
+	for i := 1; i < len(clusters); i++ {
+		id, err := clusters[0].PeerAdd(clusters[i].id, api.PeerRoleNonVoter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id.Role != api.PeerRoleNonVoter {
+			t.Error("the peer should have been added as non-voter")
+		}
+	}
+
+	if clusters[0].ID().Role != api.PeerRoleVoter {
+		t.Error("the first peer should be the only voter")
+	}
+
+	// Non-voters can pin (the operation is forwarded to the leader)
+	h, _ := cid.Decode(test.TestCid1)
+	err := clusters[1].Pin(api.PinCid(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+
+	f := func(t *testing.T, c *Cluster) {
+		if len(c.Peers()) != nClusters {
+			t.Error("non-voters should be part of the peerset")
+		}
+		pins := c.Pins()
+		if len(pins) != 1 {
+			t.Error("expected 1 pin everywhere")
+		}
+	}
+	runF(t, clusters, f)
+}
+
 func TestClustersJoinBadPeer(t *testing.T) {
 	clusters, mocks := peerManagerClusters(t)
 	defer shutdownClusters(t, clusters, mocks)
@@ -172,7 +214,7 @@ func TestClustersPeerAddInUnhealthyCluster(t *testing.T) {
 		t.Skip("need at least 3 nodes for this test")
 	}
 
-	_, err := clusters[0].PeerAdd(clusters[1].id)
+	_, err := clusters[0].PeerAdd(clusters[1].id, api.PeerRoleVoter)
 	ids := clusters[1].Peers()
 	if len(ids) != 2 {
 		t.Error("expected 2 peers")
@@ -186,7 +228,7 @@ func TestClustersPeerAddInUnhealthyCluster(t *testing.T) {
 	}
 	delay() // This makes sure the leader realizes
 	//that it's not leader anymore. Otherwise it commits fine.
-	_, err = clusters[0].PeerAdd(clusters[2].id)
+	_, err = clusters[0].PeerAdd(clusters[2].id, api.PeerRoleVoter)
 
 	if err == nil {
 		t.Error("expected an error")
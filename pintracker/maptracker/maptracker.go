@@ -230,6 +230,18 @@ func (mpt *MapPinTracker) StatusAll() []api.PinInfo {
 	return mpt.optracker.GetAll()
 }
 
+// Backlog returns the number of pin operations which are queued, pinning
+// or in error.
+func (mpt *MapPinTracker) Backlog() api.TrackerBacklog {
+	return mpt.optracker.PinBacklog()
+}
+
+// StatusChanges returns a channel on which the local status of a Cid is
+// sent every time it changes.
+func (mpt *MapPinTracker) StatusChanges() <-chan api.PinInfo {
+	return mpt.optracker.Changes()
+}
+
 // Sync verifies that the status of a Cid matches that of
 // the IPFS daemon. If not, it will be transitioned
 // to PinError or UnpinError.
@@ -316,26 +328,21 @@ func (mpt *MapPinTracker) syncStatus(c cid.Cid, ips api.IPFSPinStatus) api.PinIn
 		status = api.TrackerStatusUnpinned
 	}
 
-	// TODO(hector): for sharding, we may need to check that a shard
-	// is pinned to the right depth. For now, we assumed that if it's pinned
-	// in some way, then it must be right (including direct).
-	pinned := func(i api.IPFSPinStatus) bool {
-		switch i {
-		case api.IPFSPinStatusRecursive:
-			return i.IsPinned(-1)
-		case api.IPFSPinStatusDirect:
-			return i.IsPinned(0)
-		default:
-			return i.IsPinned(1) // Pinned with depth 1 or more.
-		}
+	// The pin of the last operation tells the depth to which the
+	// item should be pinned.
+	pin, _ := mpt.optracker.GetPin(c)
+	pinned := ips.IsPinned(pin.MaxDepth)
+	if status == api.TrackerStatusUnpinError {
+		// anything left pinned means unpinning did not work
+		pinned = ips.IsPinned(0)
 	}
 
-	if pinned(ips) {
+	if pinned {
 		switch status {
 		case api.TrackerStatusPinError:
 			// If an item that we wanted to pin is pinned, we mark it so
 			mpt.optracker.TrackNewOperation(
-				api.PinCid(c),
+				pin,
 				optracker.OperationPin,
 				optracker.PhaseDone,
 			)
@@ -377,7 +384,9 @@ func (mpt *MapPinTracker) Recover(c cid.Cid) (api.PinInfo, error) {
 
 	switch pInfo.Status {
 	case api.TrackerStatusPinError:
-		err = mpt.enqueue(api.PinCid(c), optracker.OperationPin, mpt.pinCh)
+		// re-pin with the same options (i.e. depth)
+		pin, _ := mpt.optracker.GetPin(c)
+		err = mpt.enqueue(pin, optracker.OperationPin, mpt.pinCh)
 	case api.TrackerStatusUnpinError:
 		err = mpt.enqueue(api.PinCid(c), optracker.OperationUnpin, mpt.unpinCh)
 	}
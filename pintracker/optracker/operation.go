@@ -54,8 +54,9 @@ type Operation struct {
 	cancel func()
 
 	// RO fields
-	opType OperationType
-	pin    api.Pin
+	opType   OperationType
+	pin      api.Pin
+	onChange func(*Operation) // set by the OperationTracker
 
 	// RW fields
 	mu    sync.RWMutex
@@ -106,9 +107,10 @@ func (op *Operation) Phase() Phase {
 // SetPhase changes the Phase and updates the timestamp.
 func (op *Operation) SetPhase(ph Phase) {
 	op.mu.Lock()
-	defer op.mu.Unlock()
 	op.phase = ph
 	op.ts = time.Now()
+	op.mu.Unlock()
+	op.changed()
 }
 
 // Error returns any error message attached to the operation.
@@ -122,10 +124,19 @@ func (op *Operation) Error() string {
 // an error message. It updates the timestamp.
 func (op *Operation) SetError(err error) {
 	op.mu.Lock()
-	defer op.mu.Unlock()
 	op.phase = PhaseError
 	op.error = err.Error()
 	op.ts = time.Now()
+	op.mu.Unlock()
+	op.changed()
+}
+
+// changed notifies that the operation has been modified. It must be
+// called without holding the lock.
+func (op *Operation) changed() {
+	if op.onChange != nil {
+		op.onChange(op)
+	}
 }
 
 // Type returns the operation Type.
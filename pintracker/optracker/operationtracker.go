@@ -19,6 +19,9 @@ import (
 
 var logger = logging.Logger("optracker")
 
+// changesBufferSize is the capacity of the channel returned by Changes().
+const changesBufferSize = 1024
+
 // OperationTracker tracks and manages all inflight Operations.
 type OperationTracker struct {
 	ctx      context.Context // parent context for all ops
@@ -27,6 +30,8 @@ type OperationTracker struct {
 
 	mu         sync.RWMutex
 	operations map[string]*Operation
+
+	changes chan api.PinInfo
 }
 
 // NewOperationTracker creates a new OperationTracker.
@@ -36,6 +41,7 @@ func NewOperationTracker(ctx context.Context, pid peer.ID, peerName string) *Ope
 		pid:        pid,
 		peerName:   peerName,
 		operations: make(map[string]*Operation),
+		changes:    make(chan api.PinInfo, changesBufferSize),
 	}
 }
 
@@ -59,11 +65,37 @@ func (opt *OperationTracker) TrackNewOperation(pin api.Pin, typ OperationType, p
 	}
 
 	op2 := NewOperation(opt.ctx, pin, typ, ph)
+	op2.onChange = opt.notify
 	logger.Debugf("'%s' on cid '%s' has been created with phase '%s'", typ, cidStr, ph)
 	opt.operations[cidStr] = op2
+	opt.notify(op2)
 	return op2
 }
 
+// notify sends the PinInfo of an operation to the Changes() channel. It
+// does not block: the change is dropped when the channel is full.
+func (opt *OperationTracker) notify(op *Operation) {
+	pinfo := api.PinInfo{
+		Cid:      op.Cid(),
+		Peer:     opt.pid,
+		PeerName: opt.peerName,
+		Status:   op.ToTrackerStatus(),
+		TS:       op.Timestamp(),
+		Error:    op.Error(),
+	}
+	select {
+	case opt.changes <- pinfo:
+	default:
+		logger.Debugf("changes channel full. Dropping change for %s", pinfo.Cid)
+	}
+}
+
+// Changes returns a channel on which the PinInfo of an operation is sent
+// every time it is created, changes phase or errors.
+func (opt *OperationTracker) Changes() <-chan api.PinInfo {
+	return opt.changes
+}
+
 // Clean deletes an operation from the tracker if it is the one we are tracking
 // (compares pointers).
 func (opt *OperationTracker) Clean(op *Operation) {
@@ -108,8 +140,7 @@ func (opt *OperationTracker) SetError(c cid.Cid, err error) {
 	}
 
 	if ph := op.Phase(); ph == PhaseDone || ph == PhaseError {
-		op.SetPhase(PhaseError)
-		op.SetError(err)
+		op.SetError(err) // sets PhaseError too
 	}
 }
 
@@ -159,6 +190,19 @@ func (opt *OperationTracker) GetExists(c cid.Cid) (api.PinInfo, bool) {
 	return pInfo, true
 }
 
+// GetPin returns the Pin associated to the last operation known for
+// the given Cid. It returns false if we are not tracking any operation
+// for it.
+func (opt *OperationTracker) GetPin(c cid.Cid) (api.Pin, bool) {
+	opt.mu.RLock()
+	defer opt.mu.RUnlock()
+	op, ok := opt.operations[c.String()]
+	if !ok {
+		return api.PinCid(c), false
+	}
+	return op.Pin(), true
+}
+
 // GetAll returns PinInfo objets for all known operations.
 func (opt *OperationTracker) GetAll() []api.PinInfo {
 	var pinfos []api.PinInfo
@@ -170,6 +214,26 @@ func (opt *OperationTracker) GetAll() []api.PinInfo {
 	return pinfos
 }
 
+// PinBacklog counts the pin operations which are queued, in progress
+// or failed, and adds up the sizes of the pins which are queued or in
+// progress.
+func (opt *OperationTracker) PinBacklog() api.TrackerBacklog {
+	queued := opt.filterOps(OperationPin, PhaseQueued)
+	inProgress := opt.filterOps(OperationPin, PhaseInProgress)
+
+	var size uint64
+	for _, op := range append(queued, inProgress...) {
+		size += op.Pin().Size
+	}
+
+	return api.TrackerBacklog{
+		PinQueued:   len(queued),
+		Pinning:     len(inProgress),
+		PinError:    len(opt.filterOps(OperationPin, PhaseError)),
+		PendingSize: size,
+	}
+}
+
 // CleanError removes the associated Operation, if it is
 // in PhaseError.
 func (opt *OperationTracker) CleanError(c cid.Cid) {
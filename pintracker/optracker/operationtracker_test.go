@@ -177,6 +177,25 @@ func TestOperationTracker_Get(t *testing.T) {
 	})
 }
 
+func TestOperationTracker_GetPin(t *testing.T) {
+	opt := testOperationTracker(t)
+	h := test.MustDecodeCid(test.TestCid1)
+	h2 := test.MustDecodeCid(test.TestCid2)
+	pin := api.PinCid(h)
+	pin.MaxDepth = 2
+	opt.TrackNewOperation(pin, OperationPin, PhaseDone)
+
+	p, ok := opt.GetPin(h)
+	if !ok || p.MaxDepth != 2 {
+		t.Error("expected the tracked pin")
+	}
+
+	p, ok = opt.GetPin(h2)
+	if ok || p.Cid != h2 {
+		t.Error("expected an untracked pin")
+	}
+}
+
 func TestOperationTracker_GetAll(t *testing.T) {
 	opt := testOperationTracker(t)
 	h := test.MustDecodeCid(test.TestCid1)
@@ -190,6 +209,61 @@ func TestOperationTracker_GetAll(t *testing.T) {
 	}
 }
 
+func TestOperationTracker_PinBacklog(t *testing.T) {
+	opt := testOperationTracker(t)
+	pin := api.PinCid(test.MustDecodeCid(test.TestCid1))
+	pin.Size = 1000
+	opt.TrackNewOperation(pin, OperationPin, PhaseQueued)
+	opt.TrackNewOperation(api.PinCid(test.MustDecodeCid(test.TestCid2)), OperationPin, PhaseQueued)
+	opt.TrackNewOperation(api.PinCid(test.MustDecodeCid(test.TestCid3)), OperationPin, PhaseInProgress)
+	opt.TrackNewOperation(api.PinCid(test.MustDecodeCid(test.TestCid4)), OperationPin, PhaseError)
+	opt.TrackNewOperation(api.PinCid(test.MustDecodeCid(test.TestSlowCid1)), OperationUnpin, PhaseQueued)
+
+	b := opt.PinBacklog()
+	if b.PinQueued != 2 || b.Pinning != 1 || b.PinError != 1 {
+		t.Errorf("unexpected backlog: %+v", b)
+	}
+	if b.Total() != 4 {
+		t.Error("bad total")
+	}
+	if b.PendingSize != 1000 {
+		t.Error("bad pending size")
+	}
+}
+
+func TestOperationTracker_Changes(t *testing.T) {
+	opt := testOperationTracker(t)
+	h := test.MustDecodeCid(test.TestCid1)
+	op := opt.TrackNewOperation(api.PinCid(h), OperationPin, PhaseQueued)
+	op.SetPhase(PhaseInProgress)
+	op.SetError(errors.New("fake error"))
+
+	expected := []api.TrackerStatus{
+		api.TrackerStatusPinQueued,
+		api.TrackerStatusPinning,
+		api.TrackerStatusPinError,
+	}
+	for _, st := range expected {
+		select {
+		case pinfo := <-opt.Changes():
+			if !pinfo.Cid.Equals(h) || pinfo.Peer != test.TestPeerID1 {
+				t.Error("bad pin info")
+			}
+			if pinfo.Status != st {
+				t.Errorf("expected %s but got %s", st, pinfo.Status)
+			}
+		default:
+			t.Fatal("expected a change")
+		}
+	}
+
+	select {
+	case <-opt.Changes():
+		t.Error("no more changes expected")
+	default:
+	}
+}
+
 func TestOperationTracker_OpContext(t *testing.T) {
 	opt := testOperationTracker(t)
 	h := test.MustDecodeCid(test.TestCid1)
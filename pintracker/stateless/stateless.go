@@ -263,6 +263,18 @@ func (spt *Tracker) StatusAll() []api.PinInfo {
 	return pis
 }
 
+// Backlog returns the number of pin operations which are queued, pinning
+// or in error. Unlike StatusAll, it does not contact IPFS.
+func (spt *Tracker) Backlog() api.TrackerBacklog {
+	return spt.optracker.PinBacklog()
+}
+
+// StatusChanges returns a channel on which the local status of a Cid is
+// sent every time it changes.
+func (spt *Tracker) StatusChanges() <-chan api.PinInfo {
+	return spt.optracker.Changes()
+}
+
 // Status returns information for a Cid pinned to the local IPFS node.
 func (spt *Tracker) Status(c cid.Cid) api.PinInfo {
 	// check if c has an inflight operation or errorred operation in optracker
@@ -340,13 +352,24 @@ func (spt *Tracker) Status(c cid.Cid) api.PinInfo {
 	pi := api.PinInfo{
 		Cid:    c,
 		Peer:   spt.peerID,
-		Status: ips.ToTrackerStatus(),
+		Status: pinnedStatus(ips, gpin.MaxDepth),
 		TS:     time.Now(),
 	}
 
 	return pi
 }
 
+// pinnedStatus returns the TrackerStatus for an item with the given
+// IPFS status which should be pinned to maxDepth. Items which are not
+// pinned deep enough are considered unpinned.
+func pinnedStatus(ips api.IPFSPinStatus, maxDepth int) api.TrackerStatus {
+	status := ips.ToTrackerStatus()
+	if status == api.TrackerStatusPinned && !ips.IsPinned(maxDepth) {
+		return api.TrackerStatusUnpinned
+	}
+	return status
+}
+
 // SyncAll verifies that the statuses of all tracked Cids (from the shared state)
 // match the one reported by the IPFS daemon. If not, they will be transitioned
 // to PinError or UnpinError.
@@ -364,7 +387,7 @@ func (spt *Tracker) SyncAll() ([]api.PinInfo, error) {
 	}
 
 	for _, p := range spt.optracker.Filter(optracker.OperationPin, optracker.PhaseError) {
-		if _, ok := localpis[p.Cid.String()]; ok {
+		if lp, ok := localpis[p.Cid.String()]; ok && lp.Status == api.TrackerStatusPinned {
 			spt.optracker.CleanError(p.Cid)
 		}
 	}
@@ -448,12 +471,13 @@ func (spt *Tracker) Sync(c cid.Cid) (api.PinInfo, error) {
 				Error:  err.Error(),
 			}, err
 		}
-		if ips.ToTrackerStatus() == api.TrackerStatusPinned {
+		pin, _ := spt.optracker.GetPin(c)
+		if pinnedStatus(ips, pin.MaxDepth) == api.TrackerStatusPinned {
 			spt.optracker.CleanError(c)
 			pi := api.PinInfo{
 				Cid:    c,
 				Peer:   spt.peerID,
-				Status: ips.ToTrackerStatus(),
+				Status: api.TrackerStatusPinned,
 				TS:     time.Now(),
 			}
 			return pi, nil
@@ -490,7 +514,9 @@ func (spt *Tracker) Recover(c cid.Cid) (api.PinInfo, error) {
 	var err error
 	switch pInfo.Status {
 	case api.TrackerStatusPinError:
-		err = spt.enqueue(api.PinCid(c), optracker.OperationPin)
+		// re-pin with the same options (i.e. depth)
+		pin, _ := spt.optracker.GetPin(c)
+		err = spt.enqueue(pin, optracker.OperationPin)
 	case api.TrackerStatusUnpinError:
 		err = spt.enqueue(api.PinCid(c), optracker.OperationUnpin)
 	}
@@ -501,7 +527,7 @@ func (spt *Tracker) Recover(c cid.Cid) (api.PinInfo, error) {
 	return spt.Status(c), nil
 }
 
-func (spt *Tracker) ipfsStatusAll() (map[string]api.PinInfo, error) {
+func (spt *Tracker) ipfsStatusAll() (map[string]api.IPFSPinStatus, error) {
 	var ipsMap map[string]api.IPFSPinStatus
 	err := spt.rpcClient.Call(
 		"",
@@ -514,22 +540,7 @@ func (spt *Tracker) ipfsStatusAll() (map[string]api.PinInfo, error) {
 		logger.Error(err)
 		return nil, err
 	}
-	pins := make(map[string]api.PinInfo, 0)
-	for cidstr, ips := range ipsMap {
-		c, err := cid.Decode(cidstr)
-		if err != nil {
-			logger.Error(err)
-			continue
-		}
-		p := api.PinInfo{
-			Cid:    c,
-			Peer:   spt.peerID,
-			Status: ips.ToTrackerStatus(),
-			TS:     time.Now(),
-		}
-		pins[cidstr] = p
-	}
-	return pins, nil
+	return ipsMap, nil
 }
 
 // localStatus returns a joint set of consensusState and ipfsStatus
@@ -557,7 +568,7 @@ func (spt *Tracker) localStatus(incExtra bool) (map[string]api.PinInfo, error) {
 	}
 
 	// get statuses from ipfs node first
-	localpis, err := spt.ipfsStatusAll()
+	ipsMap, err := spt.ipfsStatusAll()
 	if err != nil {
 		logger.Error(err)
 		return nil, err
@@ -586,9 +597,14 @@ func (spt *Tracker) localStatus(incExtra bool) (map[string]api.PinInfo, error) {
 			}
 			continue
 		}
-		// lookup p in localpis
-		if lp, ok := localpis[pCid]; ok {
-			pininfos[pCid] = lp
+		// lookup p in the ipfs statuses
+		if ips, ok := ipsMap[pCid]; ok {
+			pininfos[pCid] = api.PinInfo{
+				Cid:    p.Cid,
+				Peer:   spt.peerID,
+				Status: pinnedStatus(ips, p.MaxDepth),
+				TS:     time.Now(),
+			}
 		}
 	}
 	return pininfos, nil
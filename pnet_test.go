@@ -2,6 +2,8 @@ package ipfscluster
 
 import (
 	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
 )
 
 func TestClusterSecretFormat(t *testing.T) {
@@ -42,7 +44,7 @@ func TestSimplePNet(t *testing.T) {
 		t.Skip("need at least 2 nodes for this test")
 	}
 
-	_, err := clusters[0].PeerAdd(clusters[1].id)
+	_, err := clusters[0].PeerAdd(clusters[1].id, api.PeerRoleVoter)
 	if err != nil {
 		t.Fatal(err)
 	}
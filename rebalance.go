@@ -0,0 +1,281 @@
+package ipfscluster
+
+import (
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// This file gathers the logic of the rebalancer, which periodically moves
+// pins from over-full peers to under-used ones (i.e. peers which joined
+// after most of the content was pinned).
+//
+// A rebalancing round works as follows:
+//
+// * Only the leader performs it, so that moves are not duplicated.
+// * Peers with valid metrics are ranked by the configured allocator, from
+//   the most preferred to the least preferred. Peers vetoed by the
+//   allocator do not receive new allocations.
+// * The number of allocations of every peer is obtained from the shared
+//   state. Peers with more allocations than the average plus
+//   RebalanceThreshold are over-full, peers with less than the average minus
+//   RebalanceThreshold are under-used.
+// * Up to RebalanceMaxMoves pins are moved from the most loaded over-full
+//   peers to the under-used ones, re-pinning them with the over-full peer
+//   blacklisted and the under-used peers as priority.
+
+// rebalanceMove describes moving a pin allocation from a peer to one of
+// the given peers (by order of preference).
+type rebalanceMove struct {
+	pin  api.Pin
+	from peer.ID
+	to   []peer.ID
+}
+
+// rebalanceWatcher triggers rebalancing every RebalanceInterval.
+func (c *Cluster) rebalanceWatcher() {
+	if c.config.RebalanceInterval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.config.RebalanceInterval)
+	for {
+		select {
+		case <-c.ctx.Done():
+			ticker.Stop()
+			return
+		case <-ticker.C:
+			logger.Debug("auto-triggering rebalancing")
+			c.rebalance(c.config.RebalanceDryRun)
+		}
+	}
+}
+
+// rebalance runs a rebalancing round, as long as this peer is the leader.
+// When dryRun is set, moves are only logged. It returns the planned moves.
+func (c *Cluster) rebalance(dryRun bool) []rebalanceMove {
+	leader, err := c.consensus.Leader()
+	if err != nil || leader != c.id {
+		return nil
+	}
+
+	cState, err := c.consensus.State()
+	if err != nil {
+		logger.Warning(err)
+		return nil
+	}
+
+	// Draining peers are being emptied and are left out. No pin is
+	// being allocated, so all the peers are candidates.
+	_, current, candidates, priority := c.divideMetrics(cid.Undef, 0, nil, nil)
+	peers := make([]peer.ID, 0, len(candidates))
+	for p := range candidates {
+		peers = append(peers, p)
+	}
+
+	// the allocator sorts the peers, and may veto some, which then
+	// cannot receive new allocations.
+	ranked, err := c.runAllocator(cid.Undef, current, candidates, priority)
+	if err != nil {
+		logger.Warningf("cannot rank peers for rebalancing: %s", err)
+		return nil
+	}
+
+	// The state is read twice rather than kept in memory: first to
+	// count the allocations of every peer, then to pick the pins which
+	// can be moved out of the over-full peers, up to RebalanceMaxMoves
+	// for each of them.
+	load := newRebalanceLoad(peers)
+	for pin := range cState.Stream(c.ctx) {
+		load.add(pin)
+	}
+	_, high := load.bounds(c.config.RebalanceThreshold)
+
+	var pins []api.Pin
+	kept := make(map[peer.ID]int)
+	for pin := range cState.Stream(c.ctx) {
+		if !movable(pin) {
+			continue
+		}
+		for _, p := range pin.Allocations {
+			n, ok := load[p]
+			if ok && float64(n) > high && kept[p] < c.config.RebalanceMaxMoves {
+				kept[p]++
+				pins = append(pins, pin)
+				break
+			}
+		}
+	}
+
+	moves := planRebalance(
+		load,
+		pins,
+		peers,
+		ranked,
+		c.config.RebalanceThreshold,
+		c.config.RebalanceMaxMoves,
+	)
+
+	for _, m := range moves {
+		if dryRun {
+			logger.Infof("rebalance (dry-run): would move %s from %s to one of %s", m.pin.Cid, m.from.Pretty(), m.to)
+			continue
+		}
+		ok, err := c.pin(m.pin, []peer.ID{m.from}, m.to)
+		if err != nil {
+			logger.Errorf("error moving %s from %s: %s", m.pin.Cid, m.from.Pretty(), err)
+			continue
+		}
+		if ok {
+			logger.Infof("rebalance: moved %s out of %s", m.pin.Cid, m.from.Pretty())
+		}
+	}
+	return moves
+}
+
+// rebalanceLoad holds the number of allocations of every peer which can
+// hold them.
+type rebalanceLoad map[peer.ID]int
+
+func newRebalanceLoad(peers []peer.ID) rebalanceLoad {
+	load := make(rebalanceLoad, len(peers))
+	for _, p := range peers {
+		load[p] = 0
+	}
+	return load
+}
+
+// add counts the allocations of the given pin.
+func (load rebalanceLoad) add(pin api.Pin) {
+	for _, p := range pin.Allocations {
+		if _, ok := load[p]; ok {
+			load[p]++
+		}
+	}
+}
+
+// bounds returns the number of allocations below which peers are
+// under-used and above which they are over-full.
+func (load rebalanceLoad) bounds(threshold float64) (low, high float64) {
+	if len(load) == 0 {
+		return 0, 0
+	}
+	total := 0
+	for _, n := range load {
+		total += n
+	}
+	mean := float64(total) / float64(len(load))
+	return mean * (1 - threshold), mean * (1 + threshold)
+}
+
+// planRebalance decides which pins to move given the allocations of the
+// peers which can hold them, the pins which can be moved and the peers
+// which can receive new allocations, sorted by preference. Only pins whose
+// replication factor forces a re-allocation when one of their allocations
+// is blacklisted, and which were not allocated by the user, are moved.
+func planRebalance(load rebalanceLoad, pins []api.Pin, peers, ranked []peer.ID, threshold float64, maxMoves int) []rebalanceMove {
+	if len(peers) < 2 || maxMoves <= 0 {
+		return nil
+	}
+
+	// order has the ranked peers first and the vetoed ones last.
+	order := make([]peer.ID, 0, len(peers))
+	for _, p := range ranked {
+		if containsPeer(peers, p) {
+			order = append(order, p)
+		}
+	}
+	destinations := len(order)
+	for _, p := range peers {
+		if !containsPeer(order, p) {
+			order = append(order, p)
+		}
+	}
+
+	low, high := load.bounds(threshold)
+	if high == 0 {
+		return nil
+	}
+	// moves are planned on a copy
+	planned := make(rebalanceLoad, len(load))
+	for p, n := range load {
+		planned[p] = n
+	}
+	load = planned
+
+	var moves []rebalanceMove
+	moved := make(map[string]bool)
+	exhausted := make(map[peer.ID]bool)
+	for len(moves) < maxMoves {
+		// the most loaded over-full peer, the least preferred on ties
+		var from peer.ID
+		for _, p := range order {
+			if exhausted[p] || float64(load[p]) <= high {
+				continue
+			}
+			if from == "" || load[p] >= load[from] {
+				from = p
+			}
+		}
+		if from == "" {
+			break
+		}
+
+		// under-used peers, most preferred first
+		var under []peer.ID
+		for _, p := range order[:destinations] {
+			if float64(load[p]) < low {
+				under = append(under, p)
+			}
+		}
+		if len(under) == 0 {
+			break
+		}
+
+		move, ok := findMove(pins, moved, from, under)
+		if !ok {
+			exhausted[from] = true
+			continue
+		}
+		moves = append(moves, move)
+		moved[move.pin.Cid.String()] = true
+		load[from]--
+		load[move.to[0]]++
+	}
+	return moves
+}
+
+// movable returns true when the given pin can be moved by the rebalancer.
+func movable(pin api.Pin) bool {
+	return pin.Type == api.DataType &&
+		len(pin.UserAllocations) == 0 &&
+		pin.ReplicationFactorMin >= 0 &&
+		len(pin.Allocations) <= pin.ReplicationFactorMin
+}
+
+// findMove finds a pin allocated to the given peer which can be moved to
+// some of the given destinations.
+func findMove(pins []api.Pin, moved map[string]bool, from peer.ID, dests []peer.ID) (rebalanceMove, bool) {
+	for _, pin := range pins {
+		if moved[pin.Cid.String()] ||
+			!movable(pin) ||
+			!containsPeer(pin.Allocations, from) {
+			continue
+		}
+
+		var to []peer.ID
+		for _, p := range dests {
+			if !containsPeer(pin.Allocations, p) {
+				to = append(to, p)
+			}
+		}
+		if len(to) == 0 {
+			continue
+		}
+		return rebalanceMove{pin: pin, from: from, to: to}, true
+	}
+	return rebalanceMove{}, false
+}
@@ -0,0 +1,107 @@
+package ipfscluster
+
+import (
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+func rebalanceTestPins(allocs ...[]peer.ID) []api.Pin {
+	cids := []string{test.TestCid1, test.TestCid2, test.TestCid3, test.TestCid4}
+	pins := make([]api.Pin, 0, len(allocs))
+	for i, a := range allocs {
+		pin := api.PinCid(test.MustDecodeCid(cids[i]))
+		pin.ReplicationFactorMin = len(a)
+		pin.ReplicationFactorMax = len(a)
+		pin.Allocations = a
+		pins = append(pins, pin)
+	}
+	return pins
+}
+
+func rebalanceTestLoad(pins []api.Pin, peers []peer.ID) rebalanceLoad {
+	load := newRebalanceLoad(peers)
+	for _, pin := range pins {
+		load.add(pin)
+	}
+	return load
+}
+
+func TestPlanRebalance(t *testing.T) {
+	p1 := test.TestPeerID1
+	p2 := test.TestPeerID2
+	p3 := test.TestPeerID3
+	p4 := test.TestPeerID4
+
+	// p4 is a new peer with nothing
+	pins := rebalanceTestPins(
+		[]peer.ID{p1, p2},
+		[]peer.ID{p1, p3},
+		[]peer.ID{p1, p2},
+		[]peer.ID{p2, p3},
+	)
+	peers := []peer.ID{p1, p2, p3, p4}
+
+	moves := planRebalance(rebalanceTestLoad(pins, peers), pins, peers, []peer.ID{p4, p3, p2, p1}, 0.2, 10)
+	if len(moves) != 2 {
+		t.Fatalf("expected 2 moves, got %d", len(moves))
+	}
+	for _, m := range moves {
+		if m.to[0] != p4 {
+			t.Error("pins should be moved to the new peer")
+		}
+	}
+	if moves[0].from != p1 {
+		t.Error("the most loaded peer should be rebalanced first")
+	}
+
+	moves = planRebalance(rebalanceTestLoad(pins, peers), pins, peers, []peer.ID{p4, p3, p2, p1}, 0.2, 1)
+	if len(moves) != 1 {
+		t.Error("the number of moves should be limited")
+	}
+
+	// p4 is vetoed by the allocator
+	moves = planRebalance(rebalanceTestLoad(pins, peers), pins, peers, []peer.ID{p3, p2, p1}, 0.2, 10)
+	if len(moves) != 0 {
+		t.Error("vetoed peers should not receive pins")
+	}
+}
+
+func TestPlanRebalanceBalanced(t *testing.T) {
+	p1 := test.TestPeerID1
+	p2 := test.TestPeerID2
+	p3 := test.TestPeerID3
+
+	pins := rebalanceTestPins(
+		[]peer.ID{p1, p2},
+		[]peer.ID{p2, p3},
+		[]peer.ID{p3, p1},
+	)
+	peers := []peer.ID{p1, p2, p3}
+	moves := planRebalance(rebalanceTestLoad(pins, peers), pins, peers, peers, 0.2, 10)
+	if len(moves) != 0 {
+		t.Error("a balanced cluster should not be rebalanced")
+	}
+}
+
+func TestPlanRebalanceSkipsPins(t *testing.T) {
+	p1 := test.TestPeerID1
+	p2 := test.TestPeerID2
+
+	pins := rebalanceTestPins(
+		[]peer.ID{p1},
+		[]peer.ID{p1},
+		[]peer.ID{p1},
+	)
+	pins[0].UserAllocations = []string{peer.IDB58Encode(p1)}
+	pins[1].ReplicationFactorMin = -1
+	pins[1].ReplicationFactorMax = -1
+
+	moves := planRebalance(rebalanceTestLoad(pins, []peer.ID{p1, p2}), pins, []peer.ID{p1, p2}, []peer.ID{p2, p1}, 0.2, 10)
+	if len(moves) != 1 || !moves[0].pin.Cid.Equals(pins[2].Cid) {
+		t.Error("user-allocated and pin-everywhere pins should not be moved")
+	}
+}
@@ -1,8 +1,11 @@
 package ipfscluster
 
 import (
+	"bytes"
 	"context"
+	"time"
 
+	cid "github.com/ipfs/go-cid"
 	peer "github.com/libp2p/go-libp2p-peer"
 
 	"github.com/ipfs/ipfs-cluster/api"
@@ -19,30 +22,73 @@ type RPCAPI struct {
 	c *Cluster
 }
 
+// observe counts a call to the given method and whether it failed.
+func (rpcapi *RPCAPI) observe(method string, err *error) {
+	rpcapi.c.observations.rpcCalls.Inc(method)
+	if *err != nil {
+		rpcapi.c.observations.rpcErrors.Inc(method)
+	}
+}
+
 /*
    Cluster components methods
 */
 
 // ID runs Cluster.ID()
-func (rpcapi *RPCAPI) ID(ctx context.Context, in struct{}, out *api.IDSerial) error {
+func (rpcapi *RPCAPI) ID(ctx context.Context, in struct{}, out *api.IDSerial) (err error) {
+	defer rpcapi.observe("ID", &err)
 	id := rpcapi.c.ID().ToSerial()
 	*out = id
 	return nil
 }
 
 // Pin runs Cluster.Pin().
-func (rpcapi *RPCAPI) Pin(ctx context.Context, in api.PinSerial, out *struct{}) error {
+func (rpcapi *RPCAPI) Pin(ctx context.Context, in api.PinSerial, out *struct{}) (err error) {
+	defer rpcapi.observe("Pin", &err)
 	return rpcapi.c.Pin(in.ToPin())
 }
 
 // Unpin runs Cluster.Unpin().
-func (rpcapi *RPCAPI) Unpin(ctx context.Context, in api.PinSerial, out *struct{}) error {
+func (rpcapi *RPCAPI) Unpin(ctx context.Context, in api.PinSerial, out *struct{}) (err error) {
+	defer rpcapi.observe("Unpin", &err)
 	c := in.DecodeCid()
 	return rpcapi.c.Unpin(c)
 }
 
+// PinPath runs Cluster.PinPath().
+func (rpcapi *RPCAPI) PinPath(ctx context.Context, in api.PinSerial, out *api.PinSerial) (err error) {
+	defer rpcapi.observe("PinPath", &err)
+	pin, err := rpcapi.c.PinPath(in.ToPin())
+	if err == nil {
+		*out = pin.ToSerial()
+	}
+	return err
+}
+
+// PinUpdate runs Cluster.PinUpdate(). The input pin carries the Cid to
+// update to and, in its PinUpdate option, the Cid of the pin to update.
+func (rpcapi *RPCAPI) PinUpdate(ctx context.Context, in api.PinSerial, out *api.PinSerial) (err error) {
+	defer rpcapi.observe("PinUpdate", &err)
+	from, err := cid.Decode(in.PinUpdate)
+	if err != nil {
+		return err
+	}
+	pin, err := rpcapi.c.PinUpdate(from, in.DecodeCid())
+	if err == nil {
+		*out = pin.ToSerial()
+	}
+	return err
+}
+
+// PinBatch runs Cluster.PinBatch().
+func (rpcapi *RPCAPI) PinBatch(ctx context.Context, in api.PinBatchSerial, out *struct{}) (err error) {
+	defer rpcapi.observe("PinBatch", &err)
+	return rpcapi.c.PinBatch(in.ToPinBatch())
+}
+
 // Pins runs Cluster.Pins().
-func (rpcapi *RPCAPI) Pins(ctx context.Context, in struct{}, out *[]api.PinSerial) error {
+func (rpcapi *RPCAPI) Pins(ctx context.Context, in struct{}, out *[]api.PinSerial) (err error) {
+	defer rpcapi.observe("Pins", &err)
 	cidList := rpcapi.c.Pins()
 	cidSerialList := make([]api.PinSerial, 0, len(cidList))
 	for _, c := range cidList {
@@ -52,8 +98,21 @@ func (rpcapi *RPCAPI) Pins(ctx context.Context, in struct{}, out *[]api.PinSeria
 	return nil
 }
 
+// PinsFiltered runs Cluster.PinsFiltered().
+func (rpcapi *RPCAPI) PinsFiltered(ctx context.Context, in api.PinsFilter, out *[]api.PinSerial) (err error) {
+	defer rpcapi.observe("PinsFiltered", &err)
+	cidList := rpcapi.c.PinsFiltered(in)
+	cidSerialList := make([]api.PinSerial, 0, len(cidList))
+	for _, c := range cidList {
+		cidSerialList = append(cidSerialList, c.ToSerial())
+	}
+	*out = cidSerialList
+	return nil
+}
+
 // PinGet runs Cluster.PinGet().
-func (rpcapi *RPCAPI) PinGet(ctx context.Context, in api.PinSerial, out *api.PinSerial) error {
+func (rpcapi *RPCAPI) PinGet(ctx context.Context, in api.PinSerial, out *api.PinSerial) (err error) {
+	defer rpcapi.observe("PinGet", &err)
 	cidarg := in.ToPin()
 	pin, err := rpcapi.c.PinGet(cidarg.Cid)
 	if err == nil {
@@ -63,7 +122,8 @@ func (rpcapi *RPCAPI) PinGet(ctx context.Context, in api.PinSerial, out *api.Pin
 }
 
 // Version runs Cluster.Version().
-func (rpcapi *RPCAPI) Version(ctx context.Context, in struct{}, out *api.Version) error {
+func (rpcapi *RPCAPI) Version(ctx context.Context, in struct{}, out *api.Version) (err error) {
+	defer rpcapi.observe("Version", &err)
 	*out = api.Version{
 		Version: rpcapi.c.Version(),
 	}
@@ -71,7 +131,8 @@ func (rpcapi *RPCAPI) Version(ctx context.Context, in struct{}, out *api.Version
 }
 
 // Peers runs Cluster.Peers().
-func (rpcapi *RPCAPI) Peers(ctx context.Context, in struct{}, out *[]api.IDSerial) error {
+func (rpcapi *RPCAPI) Peers(ctx context.Context, in struct{}, out *[]api.IDSerial) (err error) {
+	defer rpcapi.observe("Peers", &err)
 	peers := rpcapi.c.Peers()
 	var sPeers []api.IDSerial
 	for _, p := range peers {
@@ -82,48 +143,104 @@ func (rpcapi *RPCAPI) Peers(ctx context.Context, in struct{}, out *[]api.IDSeria
 }
 
 // PeerAdd runs Cluster.PeerAdd().
-func (rpcapi *RPCAPI) PeerAdd(ctx context.Context, in string, out *api.IDSerial) error {
-	pid, _ := peer.IDB58Decode(in)
-	id, err := rpcapi.c.PeerAdd(pid)
+func (rpcapi *RPCAPI) PeerAdd(ctx context.Context, in api.PeerAddRequest, out *api.IDSerial) (err error) {
+	defer rpcapi.observe("PeerAdd", &err)
+	pid, _ := peer.IDB58Decode(in.PeerID)
+	role, err := api.PeerRoleFromString(string(in.Role))
+	if err != nil {
+		return err
+	}
+	id, err := rpcapi.c.PeerAdd(pid, role)
 	*out = id.ToSerial()
 	return err
 }
 
 // ConnectGraph runs Cluster.GetConnectGraph().
-func (rpcapi *RPCAPI) ConnectGraph(ctx context.Context, in struct{}, out *api.ConnectGraphSerial) error {
+func (rpcapi *RPCAPI) ConnectGraph(ctx context.Context, in struct{}, out *api.ConnectGraphSerial) (err error) {
+	defer rpcapi.observe("ConnectGraph", &err)
 	graph, err := rpcapi.c.ConnectGraph()
 	*out = graph.ToSerial()
 	return err
 }
 
+// Observations runs Cluster.WriteObservations().
+func (rpcapi *RPCAPI) Observations(ctx context.Context, in struct{}, out *[]byte) (err error) {
+	defer rpcapi.observe("Observations", &err)
+	var buf bytes.Buffer
+	err = rpcapi.c.WriteObservations(&buf)
+	*out = buf.Bytes()
+	return err
+}
+
+// Events runs Cluster.Events().
+func (rpcapi *RPCAPI) Events(ctx context.Context, in api.EventsRequest, out *api.EventsResponse) (err error) {
+	defer rpcapi.observe("Events", &err)
+	*out = rpcapi.c.Events(ctx, in)
+	return nil
+}
+
+// PeerLatencies runs Cluster.PeerLatencies().
+func (rpcapi *RPCAPI) PeerLatencies(ctx context.Context, in struct{}, out *map[string]time.Duration) (err error) {
+	defer rpcapi.observe("PeerLatencies", &err)
+	*out = api.LatenciesToSerial(rpcapi.c.PeerLatencies())
+	return nil
+}
+
 // PeerRemove runs Cluster.PeerRm().
-func (rpcapi *RPCAPI) PeerRemove(ctx context.Context, in peer.ID, out *struct{}) error {
+func (rpcapi *RPCAPI) PeerRemove(ctx context.Context, in peer.ID, out *struct{}) (err error) {
+	defer rpcapi.observe("PeerRemove", &err)
 	return rpcapi.c.PeerRemove(in)
 }
 
+// PeerDrain runs Cluster.PeerDrain().
+func (rpcapi *RPCAPI) PeerDrain(ctx context.Context, in peer.ID, out *api.DrainStatus) (err error) {
+	defer rpcapi.observe("PeerDrain", &err)
+	status, err := rpcapi.c.PeerDrain(in)
+	*out = status
+	return err
+}
+
+// PeerUndrain runs Cluster.PeerUndrain().
+func (rpcapi *RPCAPI) PeerUndrain(ctx context.Context, in peer.ID, out *struct{}) (err error) {
+	defer rpcapi.observe("PeerUndrain", &err)
+	return rpcapi.c.PeerUndrain(in)
+}
+
+// PeerDrainStatus runs Cluster.PeerDrainStatus().
+func (rpcapi *RPCAPI) PeerDrainStatus(ctx context.Context, in peer.ID, out *api.DrainStatus) (err error) {
+	defer rpcapi.observe("PeerDrainStatus", &err)
+	status, err := rpcapi.c.PeerDrainStatus(in)
+	*out = status
+	return err
+}
+
 // Join runs Cluster.Join().
-func (rpcapi *RPCAPI) Join(ctx context.Context, in api.MultiaddrSerial, out *struct{}) error {
+func (rpcapi *RPCAPI) Join(ctx context.Context, in api.MultiaddrSerial, out *struct{}) (err error) {
+	defer rpcapi.observe("Join", &err)
 	addr := in.ToMultiaddr()
-	err := rpcapi.c.Join(addr)
+	err = rpcapi.c.Join(addr)
 	return err
 }
 
 // StatusAll runs Cluster.StatusAll().
-func (rpcapi *RPCAPI) StatusAll(ctx context.Context, in struct{}, out *[]api.GlobalPinInfoSerial) error {
+func (rpcapi *RPCAPI) StatusAll(ctx context.Context, in struct{}, out *[]api.GlobalPinInfoSerial) (err error) {
+	defer rpcapi.observe("StatusAll", &err)
 	pinfos, err := rpcapi.c.StatusAll()
 	*out = GlobalPinInfoSliceToSerial(pinfos)
 	return err
 }
 
 // StatusAllLocal runs Cluster.StatusAllLocal().
-func (rpcapi *RPCAPI) StatusAllLocal(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
+func (rpcapi *RPCAPI) StatusAllLocal(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) (err error) {
+	defer rpcapi.observe("StatusAllLocal", &err)
 	pinfos := rpcapi.c.StatusAllLocal()
 	*out = pinInfoSliceToSerial(pinfos)
 	return nil
 }
 
 // Status runs Cluster.Status().
-func (rpcapi *RPCAPI) Status(ctx context.Context, in api.PinSerial, out *api.GlobalPinInfoSerial) error {
+func (rpcapi *RPCAPI) Status(ctx context.Context, in api.PinSerial, out *api.GlobalPinInfoSerial) (err error) {
+	defer rpcapi.observe("Status", &err)
 	c := in.DecodeCid()
 	pinfo, err := rpcapi.c.Status(c)
 	*out = pinfo.ToSerial()
@@ -131,7 +248,8 @@ func (rpcapi *RPCAPI) Status(ctx context.Context, in api.PinSerial, out *api.Glo
 }
 
 // StatusLocal runs Cluster.StatusLocal().
-func (rpcapi *RPCAPI) StatusLocal(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
+func (rpcapi *RPCAPI) StatusLocal(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) (err error) {
+	defer rpcapi.observe("StatusLocal", &err)
 	c := in.DecodeCid()
 	pinfo := rpcapi.c.StatusLocal(c)
 	*out = pinfo.ToSerial()
@@ -139,21 +257,24 @@ func (rpcapi *RPCAPI) StatusLocal(ctx context.Context, in api.PinSerial, out *ap
 }
 
 // SyncAll runs Cluster.SyncAll().
-func (rpcapi *RPCAPI) SyncAll(ctx context.Context, in struct{}, out *[]api.GlobalPinInfoSerial) error {
+func (rpcapi *RPCAPI) SyncAll(ctx context.Context, in struct{}, out *[]api.GlobalPinInfoSerial) (err error) {
+	defer rpcapi.observe("SyncAll", &err)
 	pinfos, err := rpcapi.c.SyncAll()
 	*out = GlobalPinInfoSliceToSerial(pinfos)
 	return err
 }
 
 // SyncAllLocal runs Cluster.SyncAllLocal().
-func (rpcapi *RPCAPI) SyncAllLocal(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
+func (rpcapi *RPCAPI) SyncAllLocal(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) (err error) {
+	defer rpcapi.observe("SyncAllLocal", &err)
 	pinfos, err := rpcapi.c.SyncAllLocal()
 	*out = pinInfoSliceToSerial(pinfos)
 	return err
 }
 
 // Sync runs Cluster.Sync().
-func (rpcapi *RPCAPI) Sync(ctx context.Context, in api.PinSerial, out *api.GlobalPinInfoSerial) error {
+func (rpcapi *RPCAPI) Sync(ctx context.Context, in api.PinSerial, out *api.GlobalPinInfoSerial) (err error) {
+	defer rpcapi.observe("Sync", &err)
 	c := in.DecodeCid()
 	pinfo, err := rpcapi.c.Sync(c)
 	*out = pinfo.ToSerial()
@@ -161,7 +282,8 @@ func (rpcapi *RPCAPI) Sync(ctx context.Context, in api.PinSerial, out *api.Globa
 }
 
 // SyncLocal runs Cluster.SyncLocal().
-func (rpcapi *RPCAPI) SyncLocal(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
+func (rpcapi *RPCAPI) SyncLocal(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) (err error) {
+	defer rpcapi.observe("SyncLocal", &err)
 	c := in.DecodeCid()
 	pinfo, err := rpcapi.c.SyncLocal(c)
 	*out = pinfo.ToSerial()
@@ -169,14 +291,16 @@ func (rpcapi *RPCAPI) SyncLocal(ctx context.Context, in api.PinSerial, out *api.
 }
 
 // RecoverAllLocal runs Cluster.RecoverAllLocal().
-func (rpcapi *RPCAPI) RecoverAllLocal(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
+func (rpcapi *RPCAPI) RecoverAllLocal(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) (err error) {
+	defer rpcapi.observe("RecoverAllLocal", &err)
 	pinfos, err := rpcapi.c.RecoverAllLocal()
 	*out = pinInfoSliceToSerial(pinfos)
 	return err
 }
 
 // Recover runs Cluster.Recover().
-func (rpcapi *RPCAPI) Recover(ctx context.Context, in api.PinSerial, out *api.GlobalPinInfoSerial) error {
+func (rpcapi *RPCAPI) Recover(ctx context.Context, in api.PinSerial, out *api.GlobalPinInfoSerial) (err error) {
+	defer rpcapi.observe("Recover", &err)
 	c := in.DecodeCid()
 	pinfo, err := rpcapi.c.Recover(c)
 	*out = pinfo.ToSerial()
@@ -184,7 +308,8 @@ func (rpcapi *RPCAPI) Recover(ctx context.Context, in api.PinSerial, out *api.Gl
 }
 
 // RecoverLocal runs Cluster.RecoverLocal().
-func (rpcapi *RPCAPI) RecoverLocal(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
+func (rpcapi *RPCAPI) RecoverLocal(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) (err error) {
+	defer rpcapi.observe("RecoverLocal", &err)
 	c := in.DecodeCid()
 	pinfo, err := rpcapi.c.RecoverLocal(c)
 	*out = pinfo.ToSerial()
@@ -193,9 +318,10 @@ func (rpcapi *RPCAPI) RecoverLocal(ctx context.Context, in api.PinSerial, out *a
 
 // BlockAllocate returns allocations for blocks. This is used in the adders.
 // It's different from pin allocations when ReplicationFactor < 0.
-func (rpcapi *RPCAPI) BlockAllocate(ctx context.Context, in api.PinSerial, out *[]string) error {
+func (rpcapi *RPCAPI) BlockAllocate(ctx context.Context, in api.PinSerial, out *[]string) (err error) {
+	defer rpcapi.observe("BlockAllocate", &err)
 	pin := in.ToPin()
-	err := rpcapi.c.setupPin(&pin)
+	err = rpcapi.c.setupPin(&pin)
 	if err != nil {
 		return err
 	}
@@ -216,10 +342,11 @@ func (rpcapi *RPCAPI) BlockAllocate(ctx context.Context, in api.PinSerial, out *
 
 	allocs, err := rpcapi.c.allocate(
 		pin.Cid,
+		pin.Size,
 		pin.ReplicationFactorMin,
 		pin.ReplicationFactorMax,
-		[]peer.ID{}, // blacklist
-		[]peer.ID{}, // prio list
+		[]peer.ID{},                             // blacklist
+		api.StringsToPeers(pin.UserAllocations), // prio list
 	)
 
 	if err != nil {
@@ -230,36 +357,60 @@ func (rpcapi *RPCAPI) BlockAllocate(ctx context.Context, in api.PinSerial, out *
 	return nil
 }
 
-// SendInformerMetric runs Cluster.sendInformerMetric().
-func (rpcapi *RPCAPI) SendInformerMetric(ctx context.Context, in struct{}, out *api.Metric) error {
-	m, err := rpcapi.c.sendInformerMetric()
-	*out = m
+// SimulateAllocation runs Cluster.SimulateAllocation().
+func (rpcapi *RPCAPI) SimulateAllocation(ctx context.Context, in api.PinSerial, out *api.AllocationSimulation) (err error) {
+	defer rpcapi.observe("SimulateAllocation", &err)
+	sim, err := rpcapi.c.SimulateAllocation(in.ToPin())
+	*out = sim
 	return err
 }
 
+// SendInformersMetrics runs Cluster.sendInformersMetrics().
+func (rpcapi *RPCAPI) SendInformersMetrics(ctx context.Context, in struct{}, out *struct{}) (err error) {
+	defer rpcapi.observe("SendInformersMetrics", &err)
+	return rpcapi.c.sendInformersMetrics()
+}
+
 /*
    Tracker component methods
 */
 
 // Track runs PinTracker.Track().
-func (rpcapi *RPCAPI) Track(ctx context.Context, in api.PinSerial, out *struct{}) error {
+func (rpcapi *RPCAPI) Track(ctx context.Context, in api.PinSerial, out *struct{}) (err error) {
+	defer rpcapi.observe("Track", &err)
 	return rpcapi.c.tracker.Track(in.ToPin())
 }
 
 // Untrack runs PinTracker.Untrack().
-func (rpcapi *RPCAPI) Untrack(ctx context.Context, in api.PinSerial, out *struct{}) error {
+func (rpcapi *RPCAPI) Untrack(ctx context.Context, in api.PinSerial, out *struct{}) (err error) {
+	defer rpcapi.observe("Untrack", &err)
 	c := in.DecodeCid()
 	return rpcapi.c.tracker.Untrack(c)
 }
 
+// UntrackUpdated runs Cluster.untrackUpdated().
+func (rpcapi *RPCAPI) UntrackUpdated(ctx context.Context, in api.PinSerial, out *struct{}) (err error) {
+	defer rpcapi.observe("UntrackUpdated", &err)
+	return rpcapi.c.untrackUpdated(in.ToPin())
+}
+
 // TrackerStatusAll runs PinTracker.StatusAll().
-func (rpcapi *RPCAPI) TrackerStatusAll(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
+func (rpcapi *RPCAPI) TrackerStatusAll(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) (err error) {
+	defer rpcapi.observe("TrackerStatusAll", &err)
 	*out = pinInfoSliceToSerial(rpcapi.c.tracker.StatusAll())
 	return nil
 }
 
+// TrackerBacklog runs PinTracker.Backlog().
+func (rpcapi *RPCAPI) TrackerBacklog(ctx context.Context, in struct{}, out *api.TrackerBacklog) (err error) {
+	defer rpcapi.observe("TrackerBacklog", &err)
+	*out = rpcapi.c.tracker.Backlog()
+	return nil
+}
+
 // TrackerStatus runs PinTracker.Status().
-func (rpcapi *RPCAPI) TrackerStatus(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
+func (rpcapi *RPCAPI) TrackerStatus(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) (err error) {
+	defer rpcapi.observe("TrackerStatus", &err)
 	c := in.DecodeCid()
 	pinfo := rpcapi.c.tracker.Status(c)
 	*out = pinfo.ToSerial()
@@ -267,14 +418,16 @@ func (rpcapi *RPCAPI) TrackerStatus(ctx context.Context, in api.PinSerial, out *
 }
 
 // TrackerRecoverAll runs PinTracker.RecoverAll().f
-func (rpcapi *RPCAPI) TrackerRecoverAll(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
+func (rpcapi *RPCAPI) TrackerRecoverAll(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) (err error) {
+	defer rpcapi.observe("TrackerRecoverAll", &err)
 	pinfos, err := rpcapi.c.tracker.RecoverAll()
 	*out = pinInfoSliceToSerial(pinfos)
 	return err
 }
 
 // TrackerRecover runs PinTracker.Recover().
-func (rpcapi *RPCAPI) TrackerRecover(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
+func (rpcapi *RPCAPI) TrackerRecover(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) (err error) {
+	defer rpcapi.observe("TrackerRecover", &err)
 	c := in.DecodeCid()
 	pinfo, err := rpcapi.c.tracker.Recover(c)
 	*out = pinfo.ToSerial()
@@ -285,21 +438,23 @@ func (rpcapi *RPCAPI) TrackerRecover(ctx context.Context, in api.PinSerial, out
    IPFS Connector component methods
 */
 
-// IPFSPin runs IPFSConnector.Pin().
-func (rpcapi *RPCAPI) IPFSPin(ctx context.Context, in api.PinSerial, out *struct{}) error {
-	c := in.DecodeCid()
-	depth := in.ToPin().MaxDepth
-	return rpcapi.c.ipfs.Pin(ctx, c, depth)
+// IPFSPin runs IPFSConnector.Pin(), or IPFSConnector.PinUpdate() for pins
+// resulting from an update (see Cluster.ipfsPin).
+func (rpcapi *RPCAPI) IPFSPin(ctx context.Context, in api.PinSerial, out *struct{}) (err error) {
+	defer rpcapi.observe("IPFSPin", &err)
+	return rpcapi.c.ipfsPin(ctx, in.ToPin())
 }
 
 // IPFSUnpin runs IPFSConnector.Unpin().
-func (rpcapi *RPCAPI) IPFSUnpin(ctx context.Context, in api.PinSerial, out *struct{}) error {
+func (rpcapi *RPCAPI) IPFSUnpin(ctx context.Context, in api.PinSerial, out *struct{}) (err error) {
+	defer rpcapi.observe("IPFSUnpin", &err)
 	c := in.DecodeCid()
 	return rpcapi.c.ipfs.Unpin(ctx, c)
 }
 
 // IPFSPinLsCid runs IPFSConnector.PinLsCid().
-func (rpcapi *RPCAPI) IPFSPinLsCid(ctx context.Context, in api.PinSerial, out *api.IPFSPinStatus) error {
+func (rpcapi *RPCAPI) IPFSPinLsCid(ctx context.Context, in api.PinSerial, out *api.IPFSPinStatus) (err error) {
+	defer rpcapi.observe("IPFSPinLsCid", &err)
 	c := in.DecodeCid()
 	b, err := rpcapi.c.ipfs.PinLsCid(ctx, c)
 	*out = b
@@ -307,46 +462,53 @@ func (rpcapi *RPCAPI) IPFSPinLsCid(ctx context.Context, in api.PinSerial, out *a
 }
 
 // IPFSPinLs runs IPFSConnector.PinLs().
-func (rpcapi *RPCAPI) IPFSPinLs(ctx context.Context, in string, out *map[string]api.IPFSPinStatus) error {
+func (rpcapi *RPCAPI) IPFSPinLs(ctx context.Context, in string, out *map[string]api.IPFSPinStatus) (err error) {
+	defer rpcapi.observe("IPFSPinLs", &err)
 	m, err := rpcapi.c.ipfs.PinLs(ctx, in)
 	*out = m
 	return err
 }
 
 // IPFSConnectSwarms runs IPFSConnector.ConnectSwarms().
-func (rpcapi *RPCAPI) IPFSConnectSwarms(ctx context.Context, in struct{}, out *struct{}) error {
-	err := rpcapi.c.ipfs.ConnectSwarms()
+func (rpcapi *RPCAPI) IPFSConnectSwarms(ctx context.Context, in struct{}, out *struct{}) (err error) {
+	defer rpcapi.observe("IPFSConnectSwarms", &err)
+	err = rpcapi.c.ipfs.ConnectSwarms()
 	return err
 }
 
 // IPFSConfigKey runs IPFSConnector.ConfigKey().
-func (rpcapi *RPCAPI) IPFSConfigKey(ctx context.Context, in string, out *interface{}) error {
+func (rpcapi *RPCAPI) IPFSConfigKey(ctx context.Context, in string, out *interface{}) (err error) {
+	defer rpcapi.observe("IPFSConfigKey", &err)
 	res, err := rpcapi.c.ipfs.ConfigKey(in)
 	*out = res
 	return err
 }
 
 // IPFSRepoStat runs IPFSConnector.RepoStat().
-func (rpcapi *RPCAPI) IPFSRepoStat(ctx context.Context, in struct{}, out *api.IPFSRepoStat) error {
+func (rpcapi *RPCAPI) IPFSRepoStat(ctx context.Context, in struct{}, out *api.IPFSRepoStat) (err error) {
+	defer rpcapi.observe("IPFSRepoStat", &err)
 	res, err := rpcapi.c.ipfs.RepoStat()
 	*out = res
 	return err
 }
 
 // IPFSSwarmPeers runs IPFSConnector.SwarmPeers().
-func (rpcapi *RPCAPI) IPFSSwarmPeers(ctx context.Context, in struct{}, out *api.SwarmPeersSerial) error {
+func (rpcapi *RPCAPI) IPFSSwarmPeers(ctx context.Context, in struct{}, out *api.SwarmPeersSerial) (err error) {
+	defer rpcapi.observe("IPFSSwarmPeers", &err)
 	res, err := rpcapi.c.ipfs.SwarmPeers()
 	*out = res.ToSerial()
 	return err
 }
 
 // IPFSBlockPut runs IPFSConnector.BlockPut().
-func (rpcapi *RPCAPI) IPFSBlockPut(ctx context.Context, in api.NodeWithMeta, out *struct{}) error {
+func (rpcapi *RPCAPI) IPFSBlockPut(ctx context.Context, in api.NodeWithMeta, out *struct{}) (err error) {
+	defer rpcapi.observe("IPFSBlockPut", &err)
 	return rpcapi.c.ipfs.BlockPut(in)
 }
 
 // IPFSBlockGet runs IPFSConnector.BlockGet().
-func (rpcapi *RPCAPI) IPFSBlockGet(ctx context.Context, in api.PinSerial, out *[]byte) error {
+func (rpcapi *RPCAPI) IPFSBlockGet(ctx context.Context, in api.PinSerial, out *[]byte) (err error) {
+	defer rpcapi.observe("IPFSBlockGet", &err)
 	c := in.DecodeCid()
 	res, err := rpcapi.c.ipfs.BlockGet(c)
 	*out = res
@@ -358,29 +520,64 @@ func (rpcapi *RPCAPI) IPFSBlockGet(ctx context.Context, in api.PinSerial, out *[
 */
 
 // ConsensusLogPin runs Consensus.LogPin().
-func (rpcapi *RPCAPI) ConsensusLogPin(ctx context.Context, in api.PinSerial, out *struct{}) error {
+func (rpcapi *RPCAPI) ConsensusLogPin(ctx context.Context, in api.PinSerial, out *struct{}) (err error) {
+	defer rpcapi.observe("ConsensusLogPin", &err)
 	c := in.ToPin()
 	return rpcapi.c.consensus.LogPin(c)
 }
 
 // ConsensusLogUnpin runs Consensus.LogUnpin().
-func (rpcapi *RPCAPI) ConsensusLogUnpin(ctx context.Context, in api.PinSerial, out *struct{}) error {
+func (rpcapi *RPCAPI) ConsensusLogUnpin(ctx context.Context, in api.PinSerial, out *struct{}) (err error) {
+	defer rpcapi.observe("ConsensusLogUnpin", &err)
 	c := in.ToPin()
 	return rpcapi.c.consensus.LogUnpin(c)
 }
 
+// ConsensusLogBatch runs Consensus.LogBatch().
+func (rpcapi *RPCAPI) ConsensusLogBatch(ctx context.Context, in api.PinBatchSerial, out *struct{}) (err error) {
+	defer rpcapi.observe("ConsensusLogBatch", &err)
+	return rpcapi.c.consensus.LogBatch(in.ToPinBatch())
+}
+
+// ConsensusLogUpdate runs Consensus.LogUpdate().
+func (rpcapi *RPCAPI) ConsensusLogUpdate(ctx context.Context, in api.PinSerial, out *struct{}) (err error) {
+	defer rpcapi.observe("ConsensusLogUpdate", &err)
+	return rpcapi.c.consensus.LogUpdate(in.ToPin())
+}
+
+// ConsensusLogDrain runs Consensus.LogDrain().
+func (rpcapi *RPCAPI) ConsensusLogDrain(ctx context.Context, in api.PeerDrainRequest, out *struct{}) (err error) {
+	defer rpcapi.observe("ConsensusLogDrain", &err)
+	pid, err := peer.IDB58Decode(in.PeerID)
+	if err != nil {
+		return err
+	}
+	return rpcapi.c.consensus.LogDrain(pid, in.Draining)
+}
+
 // ConsensusAddPeer runs Consensus.AddPeer().
-func (rpcapi *RPCAPI) ConsensusAddPeer(ctx context.Context, in peer.ID, out *struct{}) error {
-	return rpcapi.c.consensus.AddPeer(in)
+func (rpcapi *RPCAPI) ConsensusAddPeer(ctx context.Context, in api.PeerAddRequest, out *struct{}) (err error) {
+	defer rpcapi.observe("ConsensusAddPeer", &err)
+	pid, err := peer.IDB58Decode(in.PeerID)
+	if err != nil {
+		return err
+	}
+	role, err := api.PeerRoleFromString(string(in.Role))
+	if err != nil {
+		return err
+	}
+	return rpcapi.c.consensus.AddPeer(pid, role)
 }
 
 // ConsensusRmPeer runs Consensus.RmPeer().
-func (rpcapi *RPCAPI) ConsensusRmPeer(ctx context.Context, in peer.ID, out *struct{}) error {
+func (rpcapi *RPCAPI) ConsensusRmPeer(ctx context.Context, in peer.ID, out *struct{}) (err error) {
+	defer rpcapi.observe("ConsensusRmPeer", &err)
 	return rpcapi.c.consensus.RmPeer(in)
 }
 
 // ConsensusPeers runs Consensus.Peers().
-func (rpcapi *RPCAPI) ConsensusPeers(ctx context.Context, in struct{}, out *[]peer.ID) error {
+func (rpcapi *RPCAPI) ConsensusPeers(ctx context.Context, in struct{}, out *[]peer.ID) (err error) {
+	defer rpcapi.observe("ConsensusPeers", &err)
 	peers, err := rpcapi.c.consensus.Peers()
 	*out = peers
 	return err
@@ -391,13 +588,30 @@ func (rpcapi *RPCAPI) ConsensusPeers(ctx context.Context, in struct{}, out *[]pe
 */
 
 // PeerMonitorLogMetric runs PeerMonitor.LogMetric().
-func (rpcapi *RPCAPI) PeerMonitorLogMetric(ctx context.Context, in api.Metric, out *struct{}) error {
+func (rpcapi *RPCAPI) PeerMonitorLogMetric(ctx context.Context, in api.Metric, out *struct{}) (err error) {
+	defer rpcapi.observe("PeerMonitorLogMetric", &err)
 	rpcapi.c.monitor.LogMetric(in)
 	return nil
 }
 
 // PeerMonitorLatestMetrics runs PeerMonitor.LatestMetrics().
-func (rpcapi *RPCAPI) PeerMonitorLatestMetrics(ctx context.Context, in string, out *[]api.Metric) error {
+func (rpcapi *RPCAPI) PeerMonitorLatestMetrics(ctx context.Context, in string, out *[]api.Metric) (err error) {
+	defer rpcapi.observe("PeerMonitorLatestMetrics", &err)
 	*out = rpcapi.c.monitor.LatestMetrics(in)
 	return nil
 }
+
+// PeerMonitorMetricHistory runs PeerMonitor.MetricHistory().
+func (rpcapi *RPCAPI) PeerMonitorMetricHistory(ctx context.Context, in api.MetricHistoryRequest, out *[]api.Metric) (err error) {
+	defer rpcapi.observe("PeerMonitorMetricHistory", &err)
+	var pid peer.ID
+	if in.PeerID != "" {
+		p, err := peer.IDB58Decode(in.PeerID)
+		if err != nil {
+			return err
+		}
+		pid = p
+	}
+	*out = rpcapi.c.monitor.MetricHistory(in.Name, pid)
+	return nil
+}
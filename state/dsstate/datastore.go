@@ -0,0 +1,593 @@
+// Package dsstate implements the State interface for IPFS Cluster by
+// storing every pin as an individual entry in a go-datastore.
+//
+// Unlike mapstate, pins are persisted one by one as they are added and
+// removed, so the pinset does not need to be held in memory, and listing
+// it can be done in a streaming fashion. Serialization (i.e. for Raft
+// snapshots) writes the stored entries one after another, as they are
+// read from the datastore, rather than encoding one large object.
+//
+// Peers marked as draining are stored separately, under the "/draining"
+// namespace. The index of the last consensus operation applied to the
+// state is kept under "/applied_index", so that consensus components can
+// resume from a state persisted in a previous run instead of rebuilding it.
+package dsstate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state/mapstate"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-peer"
+	msgpack "github.com/multiformats/go-multicodec/msgpack"
+)
+
+// Version is the version of the pin format used by this state. It
+// follows the mapstate versions, since both store api.PinSerial objects
+// and share migrations.
+const Version = mapstate.Version
+
+// formatMarker follows the version byte in serialized states produced by
+// this package. 0xc1 is never used in msgpack, so it cannot be the first
+// byte of a serialized mapstate.
+const formatMarker = 0xc1
+
+// drainingVersion is the first version whose serialized states include a
+// drainingRecord before the pins. In version 6, the draining peers were
+// serialized as the allocations of a pin with an empty Cid.
+const drainingVersion = 7
+
+// batchSize is the maximum number of operations included in a
+// datastore batch.
+var batchSize = 1000
+
+var logger = logging.Logger("dsstate")
+
+var msgpackHandle = msgpack.DefaultMsgpackHandle()
+
+// drainingRecord is serialized before the pins and holds the peers
+// marked as draining.
+type drainingRecord struct {
+	Draining []string
+}
+
+// State implements the State interface by storing pins in a datastore.
+// It is thread safe as long as the underlying datastore is.
+type State struct {
+	store          ds.Datastore
+	namespace      ds.Key
+	drainNamespace ds.Key
+	appliedKey     ds.Key
+	version        int
+}
+
+// New returns a new State which stores pins in the given datastore,
+// under the given namespace.
+func New(store ds.Datastore, namespace string) *State {
+	return &State{
+		store:          store,
+		namespace:      ds.NewKey(namespace),
+		drainNamespace: ds.NewKey("/draining").Child(ds.NewKey(namespace)),
+		appliedKey:     ds.NewKey("/applied_index").Child(ds.NewKey(namespace)),
+		version:        Version,
+	}
+}
+
+func (st *State) key(c cid.Cid) ds.Key {
+	return st.namespace.ChildString(c.String())
+}
+
+// Add stores a Pin in the datastore.
+func (st *State) Add(c api.Pin) error {
+	b, err := encodePin(c.ToSerial())
+	if err != nil {
+		return err
+	}
+	return st.store.Put(st.key(c.Cid), b)
+}
+
+// Rm removes a Cid from the datastore.
+func (st *State) Rm(c cid.Cid) error {
+	err := st.store.Delete(st.key(c))
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// Get returns Pin information for a CID. As in mapstate, the
+// returned object is initialized with the given Cid regardless
+// of whether it is in the state.
+func (st *State) Get(c cid.Cid) (api.Pin, bool) {
+	if !c.Defined() {
+		return api.PinCid(c), false
+	}
+
+	b, err := st.store.Get(st.key(c))
+	if err != nil {
+		if err != ds.ErrNotFound {
+			logger.Error(err)
+		}
+		return api.PinCid(c), false
+	}
+
+	pinS, err := decodePin(b)
+	if err != nil {
+		logger.Error(err)
+		return api.PinCid(c), false
+	}
+	return pinS.ToPin(), true
+}
+
+// Has returns true if the Cid belongs to the State.
+func (st *State) Has(c cid.Cid) bool {
+	ok, err := st.store.Has(st.key(c))
+	if err != nil {
+		logger.Error(err)
+	}
+	return ok && err == nil
+}
+
+// List provides the list of tracked Pins. Prefer Stream when the
+// pinset is large.
+func (st *State) List() []api.Pin {
+	pins := []api.Pin{}
+	for p := range st.Stream(context.Background()) {
+		pins = append(pins, p)
+	}
+	return pins
+}
+
+// Stream sends all the pins in the state on the returned channel, which
+// is closed when done or when the context is cancelled. Pins are read
+// from the datastore as they are sent.
+func (st *State) Stream(ctx context.Context) <-chan api.Pin {
+	out := make(chan api.Pin, 1024)
+
+	go func() {
+		defer close(out)
+		results, err := st.query(false)
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+		defer results.Close()
+
+		for r := range results.Next() {
+			if r.Error != nil {
+				logger.Error(r.Error)
+				return
+			}
+			pinS, err := decodePin(r.Value)
+			if err != nil {
+				logger.Error(err)
+				continue
+			}
+			if pinS.Cid == "" {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case out <- pinS.ToPin():
+			}
+		}
+	}()
+	return out
+}
+
+// SetDraining marks a peer as draining, or removes the mark.
+func (st *State) SetDraining(p peer.ID, draining bool) error {
+	key := st.drainNamespace.ChildString(peer.IDB58Encode(p))
+	if draining {
+		return st.store.Put(key, []byte{1})
+	}
+	err := st.store.Delete(key)
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// Draining returns the peers marked as draining.
+func (st *State) Draining() []peer.ID {
+	peers := []peer.ID{}
+	results, err := st.store.Query(query.Query{
+		Prefix:   st.drainNamespace.String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		logger.Error(err)
+		return peers
+	}
+	defer results.Close()
+
+	for r := range results.Next() {
+		if r.Error != nil {
+			logger.Error(r.Error)
+			return peers
+		}
+		p, err := peer.IDB58Decode(ds.NewKey(r.Key).Name())
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+// AppliedIndex returns the index of the last consensus operation applied
+// to the state, as set with SetAppliedIndex, or 0 if none was set.
+func (st *State) AppliedIndex() (uint64, error) {
+	b, err := st.store.Get(st.appliedKey)
+	if err == ds.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(b) != 8 {
+		return 0, errors.New("bad applied index")
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// SetAppliedIndex records the index of the last consensus operation
+// applied to the state.
+func (st *State) SetAppliedIndex(i uint64) error {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, i)
+	return st.store.Put(st.appliedKey, b)
+}
+
+func (st *State) query(keysOnly bool) (query.Results, error) {
+	return st.store.Query(query.Query{
+		Prefix:   st.namespace.String(),
+		KeysOnly: keysOnly,
+	})
+}
+
+// GetVersion returns the current version of this state object.
+// It is not necessarily up to date.
+func (st *State) GetVersion() int {
+	return st.version
+}
+
+// Marshal serializes the state. It is a wrapper around MarshalTo.
+func (st *State) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	err := st.MarshalTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalTo writes the serialized state to the given writer: a version
+// byte, a format marker, a msgpack-encoded drainingRecord and then all the
+// msgpack-encoded pins, which are copied one by one from the datastore.
+func (st *State) MarshalTo(w io.Writer) error {
+	logger.Debugf("Marshal-- Marshalling state of version %d", st.version)
+	bw := bufio.NewWriter(w)
+	_, err := bw.Write([]byte{byte(st.version), formatMarker})
+	if err != nil {
+		return err
+	}
+
+	enc := msgpack.Multicodec(msgpackHandle).Encoder(bw)
+	err = enc.Encode(drainingRecord{
+		Draining: api.PeersToStrings(st.Draining()),
+	})
+	if err != nil {
+		return err
+	}
+
+	results, err := st.query(false)
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	for r := range results.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		_, err = bw.Write(r.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Unmarshal replaces the contents of the state with the given
+// serialized state. It is a wrapper around UnmarshalFrom.
+func (st *State) Unmarshal(bs []byte) error {
+	return st.UnmarshalFrom(bytes.NewReader(bs))
+}
+
+// UnmarshalFrom replaces the contents of the state with the serialized
+// state read from r. It understands both the format produced by this
+// package and the one produced by mapstate. As in mapstate, if the
+// serialized state is not of the current version, only the version is
+// read and Migrate should be used to restore it.
+func (st *State) UnmarshalFrom(r io.Reader) error {
+	br := bufio.NewReader(r)
+	v, err := br.ReadByte()
+	if err != nil {
+		return errors.New("cannot unmarshal from empty bytes")
+	}
+
+	st.version = int(v)
+	logger.Debugf("The interpreted version: %d", st.version)
+	if st.version != Version { // snapshot is out of date
+		return nil
+	}
+	return st.restore(br, st.version)
+}
+
+// Migrate restores a serialized state from the given reader and, if
+// necessary, migrates it to the current version. States serialized by
+// mapstate are migrated using mapstate's migrations. States serialized by
+// this package are decoded with the current pin format, which leaves any
+// fields added by newer versions with their zero values.
+func (st *State) Migrate(r io.Reader) error {
+	br := bufio.NewReader(r)
+	v, err := br.ReadByte()
+	if err != nil {
+		return errors.New("cannot migrate from empty bytes")
+	}
+	err = st.restore(br, int(v))
+	if err != nil {
+		return err
+	}
+	st.version = Version
+	return nil
+}
+
+// restore replaces the contents of the state with those in r, which is
+// positioned after the version byte.
+func (st *State) restore(br *bufio.Reader, version int) error {
+	marker, err := br.Peek(1)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	err = st.Clear()
+	if err != nil {
+		return err
+	}
+
+	if len(marker) == 0 || marker[0] != formatMarker {
+		return st.restoreMapState(br, version)
+	}
+
+	br.ReadByte() // discard the marker
+	dec := msgpack.Multicodec(msgpackHandle).Decoder(br)
+	if version >= drainingVersion {
+		var rec drainingRecord
+		err := dec.Decode(&rec)
+		if err != nil {
+			return err
+		}
+		err = st.setDraining(api.StringsToPeers(rec.Draining))
+		if err != nil {
+			return err
+		}
+	}
+
+	b := st.newBatch()
+	for {
+		if _, err := br.Peek(1); err == io.EOF {
+			break
+		}
+		var pinS api.PinSerial
+		err := dec.Decode(&pinS)
+		if err != nil {
+			return err
+		}
+		if pinS.Cid == "" { // draining peers in version 6
+			err = st.setDraining(api.StringsToPeers(pinS.Allocations))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		enc, err := encodePin(pinS)
+		if err != nil {
+			return err
+		}
+		err = b.put(st.namespace.ChildString(pinS.Cid), enc)
+		if err != nil {
+			return err
+		}
+	}
+	return b.commit()
+}
+
+// restoreMapState reads a state serialized by mapstate, migrating it
+// when needed, and stores its pins.
+func (st *State) restoreMapState(r io.Reader, version int) error {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	bs := append([]byte{byte(version)}, raw...)
+
+	ms := mapstate.NewMapState()
+	if version == mapstate.Version {
+		err = ms.Unmarshal(bs)
+	} else {
+		err = ms.Migrate(bytes.NewReader(bs))
+	}
+	if err != nil {
+		return err
+	}
+
+	err = st.setDraining(ms.Draining())
+	if err != nil {
+		return err
+	}
+
+	b := st.newBatch()
+	for _, pin := range ms.List() {
+		enc, err := encodePin(pin.ToSerial())
+		if err != nil {
+			return err
+		}
+		err = b.put(st.key(pin.Cid), enc)
+		if err != nil {
+			return err
+		}
+	}
+	return b.commit()
+}
+
+// setDraining marks the given peers as draining.
+func (st *State) setDraining(peers []peer.ID) error {
+	for _, p := range peers {
+		err := st.SetDraining(p, true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clear removes all the pins, drain marks and the applied index from
+// the state.
+func (st *State) Clear() error {
+	results, err := st.query(true)
+	if err != nil {
+		return err
+	}
+
+	var keys []ds.Key
+	for r := range results.Next() {
+		if r.Error != nil {
+			results.Close()
+			return r.Error
+		}
+		keys = append(keys, ds.NewKey(r.Key))
+	}
+	results.Close()
+
+	for _, p := range st.Draining() {
+		keys = append(keys, st.drainNamespace.ChildString(peer.IDB58Encode(p)))
+	}
+	if ok, _ := st.store.Has(st.appliedKey); ok {
+		keys = append(keys, st.appliedKey)
+	}
+
+	b := st.newBatch()
+	for _, k := range keys {
+		err = b.delete(k)
+		if err != nil {
+			return err
+		}
+	}
+	return b.commit()
+}
+
+// batch groups writes in datastore batches of batchSize operations
+// when the datastore supports them.
+type batch struct {
+	store ds.Datastore
+	b     ds.Batch
+	n     int
+}
+
+func (st *State) newBatch() *batch {
+	return &batch{store: st.store}
+}
+
+func (b *batch) current() (ds.Batch, error) {
+	if b.b != nil {
+		return b.b, nil
+	}
+	batching, ok := b.store.(ds.Batching)
+	if !ok {
+		return nil, nil
+	}
+	var err error
+	b.b, err = batching.Batch()
+	return b.b, err
+}
+
+func (b *batch) put(k ds.Key, v []byte) error {
+	cur, err := b.current()
+	if err != nil {
+		return err
+	}
+	if cur == nil {
+		return b.store.Put(k, v)
+	}
+	err = cur.Put(k, v)
+	if err != nil {
+		return err
+	}
+	return b.done()
+}
+
+func (b *batch) delete(k ds.Key) error {
+	cur, err := b.current()
+	if err != nil {
+		return err
+	}
+	if cur == nil {
+		return b.store.Delete(k)
+	}
+	err = cur.Delete(k)
+	if err != nil {
+		return err
+	}
+	return b.done()
+}
+
+// done commits the current batch when it reaches batchSize operations.
+func (b *batch) done() error {
+	b.n++
+	if b.n < batchSize {
+		return nil
+	}
+	return b.commit()
+}
+
+func (b *batch) commit() error {
+	if b.b == nil {
+		return nil
+	}
+	err := b.b.Commit()
+	b.b = nil
+	b.n = 0
+	return err
+}
+
+func encodePin(pinS api.PinSerial) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.Multicodec(msgpackHandle).Encoder(&buf)
+	err := enc.Encode(pinS)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodePin(b []byte) (api.PinSerial, error) {
+	var pinS api.PinSerial
+	dec := msgpack.Multicodec(msgpackHandle).Decoder(bytes.NewReader(b))
+	err := dec.Decode(&pinS)
+	return pinS, err
+}
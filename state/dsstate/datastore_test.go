@@ -0,0 +1,338 @@
+package dsstate
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state/mapstate"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	peer "github.com/libp2p/go-libp2p-peer"
+	msgpack "github.com/multiformats/go-multicodec/msgpack"
+)
+
+var testCid1, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq")
+var testCid2, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmma")
+var testPeerID1, _ = peer.IDB58Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
+
+var c = api.Pin{
+	Cid:         testCid1,
+	Allocations: []peer.ID{testPeerID1},
+	MaxDepth:    -1,
+	PinOptions: api.PinOptions{
+		ReplicationFactorMax: -1,
+		ReplicationFactorMin: -1,
+		Name:                 "test",
+	},
+}
+
+func newState() *State {
+	return New(dssync.MutexWrap(ds.NewMapDatastore()), "/pins")
+}
+
+func TestAdd(t *testing.T) {
+	st := newState()
+	st.Add(c)
+	if !st.Has(c.Cid) {
+		t.Error("should have added it")
+	}
+}
+
+func TestRm(t *testing.T) {
+	st := newState()
+	st.Add(c)
+	st.Rm(c.Cid)
+	if st.Has(c.Cid) {
+		t.Error("should have removed it")
+	}
+
+	err := st.Rm(testCid2)
+	if err != nil {
+		t.Error("removing a missing pin should not fail")
+	}
+}
+
+func TestGet(t *testing.T) {
+	st := newState()
+	st.Add(c)
+	get, ok := st.Get(c.Cid)
+	if !ok {
+		t.Fatal("pin should be in the state")
+	}
+	if get.Cid.String() != c.Cid.String() ||
+		get.Allocations[0] != c.Allocations[0] ||
+		get.ReplicationFactorMax != c.ReplicationFactorMax ||
+		get.ReplicationFactorMin != c.ReplicationFactorMin {
+		t.Error("returned something different")
+	}
+
+	get, ok = st.Get(testCid2)
+	if ok || !get.Cid.Equals(testCid2) {
+		t.Error("expected an empty pin for a missing cid")
+	}
+}
+
+func TestListAndStream(t *testing.T) {
+	st := newState()
+	st.Add(c)
+	c2 := c
+	c2.Cid = testCid2
+	st.Add(c2)
+
+	list := st.List()
+	if len(list) != 2 {
+		t.Fatal("expected two pins")
+	}
+
+	n := 0
+	for p := range st.Stream(context.Background()) {
+		if p.Allocations[0] != testPeerID1 {
+			t.Error("returned something different")
+		}
+		n++
+	}
+	if n != 2 {
+		t.Error("expected two streamed pins")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for range st.Stream(ctx) {
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	store := dssync.MutexWrap(ds.NewMapDatastore())
+	st1 := New(store, "/a")
+	st2 := New(store, "/b")
+	st1.Add(c)
+	if st2.Has(c.Cid) || len(st2.List()) != 0 {
+		t.Error("states should not share pins")
+	}
+}
+
+func TestMarshalUnmarshal(t *testing.T) {
+	st := newState()
+	st.Add(c)
+	b, err := st.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st2 := newState()
+	c2 := c
+	c2.Cid = testCid2
+	st2.Add(c2) // should be removed by Unmarshal
+	err = st2.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.GetVersion() != st2.GetVersion() {
+		t.Fatal("versions differ")
+	}
+	get, ok := st2.Get(c.Cid)
+	if !ok || get.Allocations[0] != testPeerID1 {
+		t.Error("expected different peer id")
+	}
+	if st2.Has(testCid2) {
+		t.Error("Unmarshal should replace the contents of the state")
+	}
+}
+
+func TestDraining(t *testing.T) {
+	st := newState()
+	st.Add(c)
+	st.SetDraining(testPeerID1, true)
+	d := st.Draining()
+	if len(d) != 1 || d[0] != testPeerID1 {
+		t.Fatal("the peer should be draining")
+	}
+	if len(st.List()) != 1 {
+		t.Error("drain marks should not be listed as pins")
+	}
+
+	b, err := st.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st2 := newState()
+	err = st2.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st2.Draining()) != 1 || len(st2.List()) != 1 {
+		t.Error("the drain mark and the pin should have been restored")
+	}
+
+	st.SetDraining(testPeerID1, false)
+	if len(st.Draining()) != 0 {
+		t.Error("the drain mark should have been removed")
+	}
+	b, _ = st.Marshal()
+	st2.Unmarshal(b)
+	if len(st2.Draining()) != 0 {
+		t.Error("Unmarshal should replace the drain marks")
+	}
+}
+
+func TestMigrateDrainingV6(t *testing.T) {
+	// Version 6 serialized the draining peers as a pin with an
+	// empty Cid.
+	v6Bytes := []byte{6, formatMarker}
+	b, _ := encodePin(api.PinSerial{Allocations: []string{peer.IDB58Encode(testPeerID1)}})
+	v6Bytes = append(v6Bytes, b...)
+	b, _ = encodePin(c.ToSerial())
+	v6Bytes = append(v6Bytes, b...)
+
+	st := newState()
+	err := st.Migrate(bytes.NewReader(v6Bytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.GetVersion() != Version {
+		t.Error("state should be at the current version")
+	}
+	d := st.Draining()
+	if len(d) != 1 || d[0] != testPeerID1 {
+		t.Error("the peer should be draining")
+	}
+	if len(st.List()) != 1 || !st.Has(c.Cid) {
+		t.Error("expected the pin to be restored")
+	}
+}
+
+func TestAppliedIndex(t *testing.T) {
+	st := newState()
+	i, err := st.AppliedIndex()
+	if err != nil || i != 0 {
+		t.Fatal("expected no applied index")
+	}
+
+	st.Add(c)
+	err = st.SetAppliedIndex(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err = st.AppliedIndex()
+	if err != nil || i != 42 {
+		t.Fatal("expected applied index 42")
+	}
+	if len(st.List()) != 1 {
+		t.Error("the applied index should not be listed as a pin")
+	}
+
+	err = st.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, _ = st.AppliedIndex()
+	if i != 0 || len(st.List()) != 0 {
+		t.Error("Clear should remove the pins and the applied index")
+	}
+}
+
+func TestMarshalUnmarshalEmpty(t *testing.T) {
+	st := newState()
+	b, err := st.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st2 := newState()
+	err = st2.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st2.List()) != 0 {
+		t.Error("expected an empty state")
+	}
+}
+
+func TestUnmarshalMapState(t *testing.T) {
+	ms := mapstate.NewMapState()
+	ms.Add(c)
+	b, err := ms.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := newState()
+	err = st.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get, ok := st.Get(c.Cid)
+	if !ok || get.Allocations[0] != testPeerID1 {
+		t.Error("mapstate was not correctly unmarshaled")
+	}
+}
+
+func TestMigrateFromMapStateV1(t *testing.T) {
+	// Construct the bytes of a v1 mapstate
+	v1State := struct {
+		Version int
+		PinMap  map[string]struct{}
+	}{
+		Version: 1,
+		PinMap: map[string]struct{}{
+			c.Cid.String(): {},
+		},
+	}
+	buf := new(bytes.Buffer)
+	enc := msgpack.Multicodec(msgpack.DefaultMsgpackHandle()).Encoder(buf)
+	err := enc.Encode(v1State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1Bytes := append([]byte{1}, buf.Bytes()...)
+
+	st := newState()
+	err = st.Unmarshal(v1Bytes)
+	if err != nil {
+		t.Error(err)
+	}
+	if st.GetVersion() != 1 {
+		t.Error("unmarshal picked up the wrong version")
+	}
+
+	err = st.Migrate(bytes.NewReader(v1Bytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.GetVersion() != Version {
+		t.Error("state should be at the current version")
+	}
+	get, ok := st.Get(c.Cid)
+	if !ok {
+		t.Fatal("migrated state does not contain cid")
+	}
+	if get.ReplicationFactorMax != -1 || get.ReplicationFactorMin != -1 || !get.Cid.Equals(c.Cid) {
+		t.Error("expected something different")
+		t.Logf("%+v", get)
+	}
+}
+
+func TestBatches(t *testing.T) {
+	defer func(n int) { batchSize = n }(batchSize)
+	batchSize = 2
+
+	st := newState()
+	for _, ci := range []cid.Cid{testCid1, testCid2} {
+		p := c
+		p.Cid = ci
+		st.Add(p)
+	}
+	b, _ := st.Marshal()
+
+	st2 := newState()
+	err := st2.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st2.List()) != 2 {
+		t.Error("expected two pins")
+	}
+}
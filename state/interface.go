@@ -4,9 +4,11 @@ package state
 
 // State represents the shared state of the cluster and it
 import (
+	"context"
 	"io"
 
 	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
 
 	"github.com/ipfs/ipfs-cluster/api"
 )
@@ -20,10 +22,17 @@ type State interface {
 	Rm(cid.Cid) error
 	// List lists all the pins in the state
 	List() []api.Pin
+	// Stream sends all the pins in the state on the returned channel,
+	// which is closed when done or when the context is cancelled
+	Stream(context.Context) <-chan api.Pin
 	// Has returns true if the state is holding information for a Cid
 	Has(cid.Cid) bool
 	// Get returns the information attacthed to this pin
 	Get(cid.Cid) (api.Pin, bool)
+	// SetDraining marks a peer as draining, or removes the mark
+	SetDraining(peer.ID, bool) error
+	// Draining lists the peers marked as draining
+	Draining() []peer.ID
 	// Migrate restores the serialized format of an outdated state to the current version
 	Migrate(r io.Reader) error
 	// Return the version of this state
@@ -4,6 +4,7 @@ package mapstate
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io"
 	"io/ioutil"
@@ -13,13 +14,14 @@ import (
 
 	cid "github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-peer"
 
 	"github.com/ipfs/ipfs-cluster/api"
 )
 
 // Version is the map state Version. States with old versions should
 // perform an upgrade before.
-const Version = 5
+const Version = 7
 
 var logger = logging.Logger("mapstate")
 
@@ -29,13 +31,17 @@ type MapState struct {
 	pinMux  sync.RWMutex
 	PinMap  map[string]api.PinSerial
 	Version int
+	// DrainMap holds the peers marked as draining. It was added in
+	// version 7.
+	DrainMap map[string]bool
 }
 
 // NewMapState initializes the internal map and returns a new MapState object.
 func NewMapState() *MapState {
 	return &MapState{
-		PinMap:  make(map[string]api.PinSerial),
-		Version: Version,
+		PinMap:   make(map[string]api.PinSerial),
+		Version:  Version,
+		DrainMap: make(map[string]bool),
 	}
 }
 
@@ -95,6 +101,56 @@ func (st *MapState) List() []api.Pin {
 	return cids
 }
 
+// Stream sends all the pins on the returned channel, which is closed
+// when done or when the context is cancelled. The pins are those in the
+// state when it is called.
+func (st *MapState) Stream(ctx context.Context) <-chan api.Pin {
+	pins := st.List()
+	out := make(chan api.Pin, 1024)
+	go func() {
+		defer close(out)
+		for _, p := range pins {
+			select {
+			case <-ctx.Done():
+				return
+			case out <- p:
+			}
+		}
+	}()
+	return out
+}
+
+// SetDraining marks a peer as draining, or removes the mark.
+func (st *MapState) SetDraining(p peer.ID, draining bool) error {
+	st.pinMux.Lock()
+	defer st.pinMux.Unlock()
+	if !draining {
+		delete(st.DrainMap, peer.IDB58Encode(p))
+		return nil
+	}
+	if st.DrainMap == nil {
+		st.DrainMap = make(map[string]bool)
+	}
+	st.DrainMap[peer.IDB58Encode(p)] = true
+	return nil
+}
+
+// Draining returns the peers marked as draining.
+func (st *MapState) Draining() []peer.ID {
+	st.pinMux.RLock()
+	defer st.pinMux.RUnlock()
+	peers := make([]peer.ID, 0, len(st.DrainMap))
+	for k := range st.DrainMap {
+		p, err := peer.IDB58Decode(k)
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		peers = append(peers, p)
+	}
+	return peers
+}
+
 // Migrate restores a snapshot from the state's internal bytes and if
 // necessary migrates the format to the current version.
 func (st *MapState) Migrate(r io.Reader) error {
@@ -170,5 +226,6 @@ func (st *MapState) Unmarshal(bs []byte) error {
 
 	st.PinMap = newState.PinMap
 	st.Version = newState.Version
+	st.DrainMap = newState.DrainMap
 	return err
 }
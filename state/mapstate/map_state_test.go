@@ -2,6 +2,7 @@ package mapstate
 
 import (
 	"bytes"
+	"context"
 	"testing"
 
 	msgpack "github.com/multiformats/go-multicodec/msgpack"
@@ -77,6 +78,48 @@ func TestList(t *testing.T) {
 	}
 }
 
+func TestStream(t *testing.T) {
+	ms := NewMapState()
+	ms.Add(c)
+	n := 0
+	for p := range ms.Stream(context.Background()) {
+		if p.Cid.String() != c.Cid.String() {
+			t.Error("returned something different")
+		}
+		n++
+	}
+	if n != 1 {
+		t.Error("expected one streamed pin")
+	}
+}
+
+func TestDraining(t *testing.T) {
+	ms := NewMapState()
+	ms.SetDraining(testPeerID1, true)
+	d := ms.Draining()
+	if len(d) != 1 || d[0] != testPeerID1 {
+		t.Fatal("the peer should be draining")
+	}
+
+	b, err := ms.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms2 := NewMapState()
+	err = ms2.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms2.Draining()) != 1 {
+		t.Error("the drain mark should have been restored")
+	}
+
+	ms.SetDraining(testPeerID1, false)
+	if len(ms.Draining()) != 0 {
+		t.Error("the drain mark should have been removed")
+	}
+}
+
 func TestMarshalUnmarshal(t *testing.T) {
 	ms := NewMapState()
 	ms.Add(c)
@@ -138,3 +181,110 @@ func TestMigrateFromV1(t *testing.T) {
 		t.Logf("%+v", get)
 	}
 }
+
+func TestMigrateFromV5(t *testing.T) {
+	var v5State mapStateV5
+	v5State.PinMap = map[string]pinSerialV5{
+		c.Cid.String(): {
+			pinOptionsV5: pinOptionsV5{
+				ReplicationFactorMin: 1,
+				ReplicationFactorMax: 2,
+				Name:                 "test",
+			},
+			Cid:         c.Cid.String(),
+			Type:        uint64(api.DataType),
+			Allocations: []string{peer.IDB58Encode(testPeerID1)},
+			MaxDepth:    -1,
+		},
+	}
+	v5State.Version = 5
+	buf := new(bytes.Buffer)
+	enc := msgpack.Multicodec(msgpack.DefaultMsgpackHandle()).Encoder(buf)
+	err := enc.Encode(v5State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v5Bytes := append([]byte{5}, buf.Bytes()...)
+
+	ms := NewMapState()
+	err = ms.Migrate(bytes.NewBuffer(v5Bytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms.GetVersion() != Version {
+		t.Error("state should be at the current version")
+	}
+	get, ok := ms.Get(c.Cid)
+	if !ok {
+		t.Fatal("migrated state does not contain cid")
+	}
+	if get.ReplicationFactorMin != 1 || get.ReplicationFactorMax != 2 ||
+		get.Name != "test" || get.Allocations[0] != testPeerID1 {
+		t.Error("expected something different")
+		t.Logf("%+v", get)
+	}
+	if !get.ExpireAt.IsZero() {
+		t.Error("migrated pins should not expire")
+	}
+}
+
+func TestMigrateFromV6(t *testing.T) {
+	var v6State mapStateV6
+	v6State.PinMap = map[string]pinSerialV7{
+		c.Cid.String(): {
+			pinOptionsV7: pinOptionsV7{
+				ReplicationFactorMin: 1,
+				ReplicationFactorMax: 2,
+				Name:                 "test",
+				Metadata:             map[string]string{"a": "b"},
+				UserAllocations:      []string{peer.IDB58Encode(testPeerID1)},
+				Path:                 "/ipns/example.org",
+			},
+			Cid:         c.Cid.String(),
+			Type:        uint64(api.DataType),
+			Allocations: []string{peer.IDB58Encode(testPeerID1)},
+			MaxDepth:    -1,
+			Size:        1000,
+		},
+	}
+	v6State.Version = 6
+	buf := new(bytes.Buffer)
+	enc := msgpack.Multicodec(msgpack.DefaultMsgpackHandle()).Encoder(buf)
+	err := enc.Encode(v6State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v6Bytes := append([]byte{6}, buf.Bytes()...)
+
+	ms := NewMapState()
+	err = ms.Migrate(bytes.NewBuffer(v6Bytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms.GetVersion() != Version {
+		t.Error("state should be at the current version")
+	}
+	get, ok := ms.Get(c.Cid)
+	if !ok {
+		t.Fatal("migrated state does not contain cid")
+	}
+	if get.Name != "test" || get.Metadata["a"] != "b" ||
+		len(get.UserAllocations) != 1 || get.Path != "/ipns/example.org" ||
+		get.Size != 1000 {
+		t.Error("expected something different")
+		t.Logf("%+v", get)
+	}
+	if len(ms.Draining()) != 0 {
+		t.Error("no peers should be draining")
+	}
+
+	b, err := ms.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms2 := NewMapState()
+	err = ms2.Unmarshal(b)
+	if err != nil || ms2.DrainMap == nil {
+		t.Error("the migrated state should include the drain map")
+	}
+}
@@ -8,6 +8,7 @@ package mapstate
 import (
 	"bytes"
 	"errors"
+	"time"
 
 	msgpack "github.com/multiformats/go-multicodec/msgpack"
 
@@ -145,9 +146,9 @@ func (st *mapStateV4) unmarshal(bs []byte) error {
 
 func (st *mapStateV4) next() migrateable {
 	var mst5 mapStateV5
-	mst5.PinMap = make(map[string]api.PinSerial)
+	mst5.PinMap = make(map[string]pinSerialV5)
 	for k, v := range st.PinMap {
-		pinsv5 := api.PinSerial{}
+		pinsv5 := pinSerialV5{}
 		pinsv5.Cid = v.Cid
 		pinsv5.Type = uint64(api.DataType)
 		pinsv5.Allocations = v.Allocations
@@ -170,26 +171,25 @@ func (st *mapStateV4) next() migrateable {
 
 /* V5 */
 
-// Uncomment for next migration
-// type pinOptionsV5 struct {
-// 	ReplicationFactorMin int    `json:"replication_factor_min"`
-// 	ReplicationFactorMax int    `json:"replication_factor_max"`
-// 	Name                 string `json:"name"`
-// 	ShardSize            uint64 `json:"shard_size"`
-// }
+type pinOptionsV5 struct {
+	ReplicationFactorMin int    `json:"replication_factor_min"`
+	ReplicationFactorMax int    `json:"replication_factor_max"`
+	Name                 string `json:"name"`
+	ShardSize            uint64 `json:"shard_size"`
+}
 
-// type pinSerialV5 struct {
-// 	pinOptionsV5
+type pinSerialV5 struct {
+	pinOptionsV5
 
-// 	Cid         string   `json:"cid"`
-// 	Type        uint64   `json:"type"`
-// 	Allocations []string `json:"allocations"`
-// 	MaxDepth    int      `json:"max_depth"`
-// 	Reference   string   `json:"reference"`
-// }
+	Cid         string   `json:"cid"`
+	Type        uint64   `json:"type"`
+	Allocations []string `json:"allocations"`
+	MaxDepth    int      `json:"max_depth"`
+	Reference   string   `json:"reference"`
+}
 
 type mapStateV5 struct {
-	PinMap  map[string]api.PinSerial
+	PinMap  map[string]pinSerialV5
 	Version int
 }
 
@@ -200,14 +200,119 @@ func (st *mapStateV5) unmarshal(bs []byte) error {
 }
 
 func (st *mapStateV5) next() migrateable {
+	var mst6 mapStateV6
+	mst6.PinMap = make(map[string]pinSerialV7)
+	for k, v := range st.PinMap {
+		pinsv6 := pinSerialV7{}
+		pinsv6.Cid = v.Cid
+		pinsv6.Type = v.Type
+		pinsv6.Allocations = v.Allocations
+		pinsv6.MaxDepth = v.MaxDepth
+		pinsv6.Reference = v.Reference
+
+		// Options. Existing pins do not expire.
+		pinsv6.Name = v.Name
+		pinsv6.ReplicationFactorMin = v.ReplicationFactorMin
+		pinsv6.ReplicationFactorMax = v.ReplicationFactorMax
+		pinsv6.ShardSize = v.ShardSize
+
+		mst6.PinMap[k] = pinsv6
+	}
+	return &mst6
+}
+
+/* V6 */
+
+// V6 adds ExpireAt. V6 states are decoded with the V7 pin format: the
+// fields missing in them are left empty.
+type mapStateV6 struct {
+	PinMap  map[string]pinSerialV7
+	Version int
+}
+
+func (st *mapStateV6) unmarshal(bs []byte) error {
+	buf := bytes.NewBuffer(bs)
+	dec := msgpack.Multicodec(msgpack.DefaultMsgpackHandle()).Decoder(buf)
+	return dec.Decode(st)
+}
+
+func (st *mapStateV6) next() migrateable {
+	var mst7 mapStateV7
+	mst7.PinMap = st.PinMap
+	// No peers were draining.
+	mst7.DrainMap = make(map[string]bool)
+	return &mst7
+}
+
+/* V7 */
+
+type pinOptionsV7 struct {
+	ReplicationFactorMin int               `json:"replication_factor_min"`
+	ReplicationFactorMax int               `json:"replication_factor_max"`
+	Name                 string            `json:"name"`
+	ShardSize            uint64            `json:"shard_size"`
+	ExpireAt             time.Time         `json:"expire_at"`
+	Metadata             map[string]string `json:"metadata"`
+	UserAllocations      []string          `json:"user_allocations"`
+	Path                 string            `json:"path"`
+}
+
+type pinSerialV7 struct {
+	pinOptionsV7
+
+	Cid         string   `json:"cid"`
+	Type        uint64   `json:"type"`
+	Allocations []string `json:"allocations"`
+	MaxDepth    int      `json:"max_depth"`
+	Reference   string   `json:"reference"`
+	Size        uint64   `json:"size"`
+}
+
+// V7 adds the DrainMap.
+type mapStateV7 struct {
+	PinMap   map[string]pinSerialV7
+	Version  int
+	DrainMap map[string]bool
+}
+
+func (st *mapStateV7) unmarshal(bs []byte) error {
+	buf := bytes.NewBuffer(bs)
+	dec := msgpack.Multicodec(msgpack.DefaultMsgpackHandle()).Decoder(buf)
+	return dec.Decode(st)
+}
+
+func (st *mapStateV7) next() migrateable {
 	return nil
 }
 
 // Migrate code
 
-func finalCopy(st *MapState, internal *mapStateV5) {
+func finalCopy(st *MapState, internal *mapStateV7) {
 	for k, v := range internal.PinMap {
-		st.PinMap[k] = v
+		pinS := api.PinSerial{}
+		pinS.Cid = v.Cid
+		pinS.Type = v.Type
+		pinS.Allocations = v.Allocations
+		pinS.MaxDepth = v.MaxDepth
+		pinS.Reference = v.Reference
+		pinS.Size = v.Size
+
+		pinS.ReplicationFactorMin = v.ReplicationFactorMin
+		pinS.ReplicationFactorMax = v.ReplicationFactorMax
+		pinS.Name = v.Name
+		pinS.ShardSize = v.ShardSize
+		pinS.ExpireAt = v.ExpireAt
+		pinS.Metadata = v.Metadata
+		pinS.UserAllocations = v.UserAllocations
+		pinS.Path = v.Path
+
+		st.PinMap[k] = pinS
+	}
+	if st.DrainMap == nil {
+		st.DrainMap = make(map[string]bool)
+	}
+	for k, v := range internal.DrainMap {
+		st.DrainMap[k] = v
 	}
 }
 
@@ -226,6 +331,12 @@ func (st *MapState) migrateFrom(version int, snap []byte) error {
 	case 4:
 		var mst4 mapStateV4
 		m = &mst4
+	case 5:
+		var mst5 mapStateV5
+		m = &mst5
+	case 6:
+		var mst6 mapStateV6
+		m = &mst6
 	default:
 		return errors.New("version migration not supported")
 	}
@@ -238,11 +349,11 @@ func (st *MapState) migrateFrom(version int, snap []byte) error {
 	for {
 		next = m.next()
 		if next == nil {
-			mst5, ok := m.(*mapStateV5)
+			mst7, ok := m.(*mapStateV7)
 			if !ok {
 				return errors.New("migration ended prematurely")
 			}
-			finalCopy(st, mst5)
+			finalCopy(st, mst7)
 			return nil
 		}
 		m = next
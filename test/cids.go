@@ -29,6 +29,11 @@ var (
 	TestPeerName4 = "TestPeer4"
 	TestPeerName5 = "TestPeer5"
 	TestPeerName6 = "TestPeer6"
+
+	// TestIPNSPath and TestDNSLinkPath are resolved by the ipfs
+	// mock to TestCid1 and TestCid2 respectively.
+	TestIPNSPath    = "/ipns/QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc"
+	TestDNSLinkPath = "/ipns/example.com"
 )
 
 // MustDecodeCid provides a test helper that ignores
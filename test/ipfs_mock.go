@@ -24,6 +24,9 @@ type IpfsMock struct {
 	Port       int
 	pinMap     *mapstate.MapState
 	BlockStore map[string][]byte
+	// Names maps the IPNS paths known by the mock to the Cids
+	// that they resolve to.
+	Names map[string]string
 }
 
 type mockPinResp struct {
@@ -83,6 +86,15 @@ type mockBlockPutResp struct {
 	Key string
 }
 
+type mockResolveResp struct {
+	Path string
+}
+
+type mockObjectStatResp struct {
+	Hash           string
+	CumulativeSize uint64
+}
+
 // NewIpfsMock returns a new mock.
 func NewIpfsMock() *IpfsMock {
 	st := mapstate.NewMapState()
@@ -90,6 +102,10 @@ func NewIpfsMock() *IpfsMock {
 	m := &IpfsMock{
 		pinMap:     st,
 		BlockStore: blocks,
+		Names: map[string]string{
+			TestIPNSPath:    TestCid1,
+			TestDNSLinkPath: TestCid2,
+		},
 	}
 	ts := httptest.NewServer(http.HandlerFunc(m.handler))
 	m.server = ts
@@ -130,12 +146,49 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			goto ERROR
 		}
-		m.pinMap.Add(api.PinCid(c))
+		pin := api.PinCid(c)
+		q := r.URL.Query()
+		if q.Get("recursive") == "false" {
+			pin.MaxDepth = 0
+		} else if depth := q.Get("max-depth"); depth != "" {
+			pin.MaxDepth, err = strconv.Atoi(depth)
+			if err != nil {
+				goto ERROR
+			}
+		}
+		m.pinMap.Add(pin)
 		resp := mockPinResp{
 			Pins: []string{arg},
 		}
 		j, _ := json.Marshal(resp)
 		w.Write(j)
+	case "pin/update":
+		q := r.URL.Query()
+		args := q["arg"]
+		if len(args) != 2 {
+			goto ERROR
+		}
+		from, err := cid.Decode(args[0])
+		if err != nil {
+			goto ERROR
+		}
+		to, err := cid.Decode(args[1])
+		if err != nil {
+			goto ERROR
+		}
+		fromPin, ok := m.pinMap.Get(from)
+		if !ok || fromPin.MaxDepth != -1 {
+			goto ERROR
+		}
+		m.pinMap.Add(api.PinCid(to))
+		if q.Get("unpin") != "false" {
+			m.pinMap.Rm(from)
+		}
+		resp := mockPinResp{
+			Pins: []string{from.String(), to.String()},
+		}
+		j, _ := json.Marshal(resp)
+		w.Write(j)
 	case "pin/rm":
 		arg, ok := extractCid(r.URL)
 		if !ok {
@@ -157,7 +210,7 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 			rMap := make(map[string]mockPinType)
 			pins := m.pinMap.List()
 			for _, p := range pins {
-				rMap[p.Cid.String()] = mockPinType{"recursive"}
+				rMap[p.Cid.String()] = mockPinType{mockPinTypeString(p.MaxDepth)}
 			}
 			j, _ := json.Marshal(mockPinLsResp{rMap})
 			w.Write(j)
@@ -169,10 +222,10 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			goto ERROR
 		}
-		ok = m.pinMap.Has(c)
+		pin, ok := m.pinMap.Get(c)
 		if ok {
 			rMap := make(map[string]mockPinType)
-			rMap[cidStr] = mockPinType{"recursive"}
+			rMap[cidStr] = mockPinType{mockPinTypeString(pin.MaxDepth)}
 			j, _ := json.Marshal(mockPinLsResp{rMap})
 			w.Write(j)
 		} else {
@@ -294,6 +347,29 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 		}
 		j, _ := json.Marshal(resp)
 		w.Write(j)
+	case "resolve":
+		arg := r.URL.Query().Get("arg")
+		c, ok := m.Names[arg]
+		if !ok {
+			goto ERROR
+		}
+		resp := mockResolveResp{
+			Path: "/ipfs/" + c,
+		}
+		j, _ := json.Marshal(resp)
+		w.Write(j)
+	case "object/stat":
+		arg, ok := extractCid(r.URL)
+		if !ok || arg == ErrorCid {
+			goto ERROR
+		}
+		// every DAG in the mock is 1000 bytes
+		resp := mockObjectStatResp{
+			Hash:           arg,
+			CumulativeSize: 1000,
+		}
+		j, _ := json.Marshal(resp)
+		w.Write(j)
 	case "version":
 		w.Write([]byte("{\"Version\":\"m.o.c.k\"}"))
 	default:
@@ -310,6 +386,19 @@ func (m *IpfsMock) Close() {
 	m.server.Close()
 }
 
+// mockPinTypeString returns the pin type reported by pin/ls for
+// items pinned with the given depth.
+func mockPinTypeString(maxDepth int) string {
+	switch {
+	case maxDepth < 0:
+		return "recursive"
+	case maxDepth == 0:
+		return "direct"
+	default:
+		return fmt.Sprintf("recursive (%d)", maxDepth)
+	}
+}
+
 // extractCid extracts the cid argument from a url.URL, either via
 // the query string parameters or from the url path itself.
 func extractCid(u *url.URL) (string, bool) {
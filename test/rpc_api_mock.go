@@ -3,6 +3,7 @@ package test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -52,16 +53,67 @@ func (mock *mockService) Unpin(ctx context.Context, in api.PinSerial, out *struc
 	return nil
 }
 
+func (mock *mockService) PinPath(ctx context.Context, in api.PinSerial, out *api.PinSerial) error {
+	var c string
+	switch in.Path {
+	case TestIPNSPath:
+		c = TestCid1
+	case TestDNSLinkPath:
+		c = TestCid2
+	default:
+		return errors.New("cannot resolve path")
+	}
+	pin := in.Clone()
+	pin.Cid = c
+	*out = pin
+	return nil
+}
+
+func (mock *mockService) PinUpdate(ctx context.Context, in api.PinSerial, out *api.PinSerial) error {
+	if in.Cid == ErrorCid || in.PinUpdate == ErrorCid {
+		return ErrBadCid
+	}
+	pin := in.Clone()
+	pin.ReplicationFactorMin = -1
+	pin.ReplicationFactorMax = -1
+	*out = pin
+	return nil
+}
+
+func (mock *mockService) PinBatch(ctx context.Context, in api.PinBatchSerial, out *struct{}) error {
+	for _, p := range append(in.Pins, in.Unpins...) {
+		if p.Cid == ErrorCid {
+			return ErrBadCid
+		}
+	}
+	return nil
+}
+
 func (mock *mockService) Pins(ctx context.Context, in struct{}, out *[]api.PinSerial) error {
 	opts := api.PinOptions{
 		ReplicationFactorMin: -1,
 		ReplicationFactorMax: -1,
 	}
 
+	pin3 := api.PinWithOpts(MustDecodeCid(TestCid3), opts)
+	pin3.Metadata = map[string]string{"project": "test"}
+
 	*out = []api.PinSerial{
 		api.PinWithOpts(MustDecodeCid(TestCid1), opts).ToSerial(),
 		api.PinCid(MustDecodeCid(TestCid2)).ToSerial(),
-		api.PinWithOpts(MustDecodeCid(TestCid3), opts).ToSerial(),
+		pin3.ToSerial(),
+	}
+	return nil
+}
+
+func (mock *mockService) PinsFiltered(ctx context.Context, in api.PinsFilter, out *[]api.PinSerial) error {
+	var pins []api.PinSerial
+	mock.Pins(ctx, struct{}{}, &pins)
+	*out = []api.PinSerial{}
+	for _, pinS := range pins {
+		if in.Matches(pinS.ToPin()) {
+			*out = append(*out, pinS)
+		}
 	}
 	return nil
 }
@@ -95,6 +147,7 @@ func (mock *mockService) ID(ctx context.Context, in struct{}, out *api.IDSerial)
 		ID: TestPeerID1.Pretty(),
 		//PublicKey: pubkey,
 		Version: "0.0.mock",
+		Role:    string(api.PeerRoleVoter),
 		IPFS: api.IPFSIDSerial{
 			ID: TestPeerID1.Pretty(),
 			Addresses: api.MultiaddrsSerial{
@@ -120,9 +173,12 @@ func (mock *mockService) Peers(ctx context.Context, in struct{}, out *[]api.IDSe
 	return nil
 }
 
-func (mock *mockService) PeerAdd(ctx context.Context, in string, out *api.IDSerial) error {
+func (mock *mockService) PeerAdd(ctx context.Context, in api.PeerAddRequest, out *api.IDSerial) error {
 	id := api.IDSerial{}
 	mock.ID(ctx, struct{}{}, &id)
+	if in.Role != "" {
+		id.Role = string(in.Role)
+	}
 	*out = id
 	return nil
 }
@@ -131,6 +187,33 @@ func (mock *mockService) PeerRemove(ctx context.Context, in peer.ID, out *struct
 	return nil
 }
 
+func (mock *mockService) PeerDrain(ctx context.Context, in peer.ID, out *api.DrainStatus) error {
+	return mock.PeerDrainStatus(ctx, in, out)
+}
+
+func (mock *mockService) PeerUndrain(ctx context.Context, in peer.ID, out *struct{}) error {
+	return nil
+}
+
+func (mock *mockService) PeerDrainStatus(ctx context.Context, in peer.ID, out *api.DrainStatus) error {
+	*out = api.DrainStatus{
+		Peer:       peer.IDB58Encode(in),
+		Draining:   true,
+		Remaining:  1,
+		InProgress: true,
+		Total:      2,
+	}
+	return nil
+}
+
+func (mock *mockService) PeerLatencies(ctx context.Context, in struct{}, out *map[string]time.Duration) error {
+	*out = map[string]time.Duration{
+		TestPeerID2.Pretty(): time.Millisecond,
+		TestPeerID3.Pretty(): 2 * time.Millisecond,
+	}
+	return nil
+}
+
 func (mock *mockService) ConnectGraph(ctx context.Context, in struct{}, out *api.ConnectGraphSerial) error {
 	*out = api.ConnectGraphSerial{
 		ClusterID: TestPeerID1.Pretty(),
@@ -258,7 +341,31 @@ func (mock *mockService) BlockAllocate(ctx context.Context, in api.PinSerial, ou
 	return nil
 }
 
-func (mock *mockService) SendInformerMetric(ctx context.Context, in struct{}, out *api.Metric) error {
+func (mock *mockService) SimulateAllocation(ctx context.Context, in api.PinSerial, out *api.AllocationSimulation) error {
+	if in.Cid == ErrorCid {
+		return ErrBadCid
+	}
+	*out = api.AllocationSimulation{
+		Cid:         in.Cid,
+		Allocations: []string{TestPeerID1.Pretty()},
+		Candidates: []api.AllocationCandidate{
+			{
+				Peer:      TestPeerID1.Pretty(),
+				Metrics:   []api.Metric{},
+				Allocated: true,
+				Reason:    "selected by the allocator",
+			},
+			{
+				Peer:    TestPeerID2.Pretty(),
+				Metrics: []api.Metric{},
+				Reason:  "blacklisted",
+			},
+		},
+	}
+	return nil
+}
+
+func (mock *mockService) SendInformersMetrics(ctx context.Context, in struct{}, out *struct{}) error {
 	return nil
 }
 
@@ -272,6 +379,10 @@ func (mock *mockService) Untrack(ctx context.Context, in api.PinSerial, out *str
 	return nil
 }
 
+func (mock *mockService) UntrackUpdated(ctx context.Context, in api.PinSerial, out *struct{}) error {
+	return nil
+}
+
 func (mock *mockService) TrackerStatusAll(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
 	c1, _ := cid.Decode(TestCid1)
 	c3, _ := cid.Decode(TestCid3)
@@ -308,6 +419,65 @@ func (mock *mockService) TrackerStatus(ctx context.Context, in api.PinSerial, ou
 	return nil
 }
 
+func (mock *mockService) Observations(ctx context.Context, in struct{}, out *[]byte) error {
+	*out = []byte(`# HELP cluster_pins Pins tracked by this peer, by status.
+# TYPE cluster_pins gauge
+cluster_pins{status="pinned"} 3
+`)
+	return nil
+}
+
+func (mock *mockService) Events(ctx context.Context, in api.EventsRequest, out *api.EventsResponse) error {
+	if in.Since >= 2 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(100 * time.Millisecond):
+		}
+		*out = api.EventsResponse{Last: in.Since}
+		return nil
+	}
+
+	events := []api.Event{
+		{
+			Seq:       1,
+			Type:      api.EventPeerJoined,
+			Timestamp: time.Now(),
+			Peer:      peer.IDB58Encode(TestPeerID2),
+		},
+		{
+			Seq:       2,
+			Type:      api.EventPinStatus,
+			Timestamp: time.Now(),
+			Peer:      peer.IDB58Encode(TestPeerID1),
+			Cid:       TestCid1,
+			Status:    api.TrackerStatusPinned.String(),
+		},
+	}
+	var matching []api.Event
+	for _, e := range events {
+		if len(in.Types) == 0 {
+			matching = append(matching, e)
+			continue
+		}
+		for _, t := range in.Types {
+			if e.Type == t {
+				matching = append(matching, e)
+			}
+		}
+	}
+	*out = api.EventsResponse{Events: matching, Last: 2}
+	return nil
+}
+
+func (mock *mockService) TrackerBacklog(ctx context.Context, in struct{}, out *api.TrackerBacklog) error {
+	*out = api.TrackerBacklog{
+		PinQueued: 2,
+		Pinning:   1,
+		PinError:  1,
+	}
+	return nil
+}
+
 func (mock *mockService) TrackerRecoverAll(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
 	*out = make([]api.PinInfoSerial, 0, 0)
 	return nil
@@ -345,6 +515,23 @@ func (mock *mockService) PeerMonitorLatestMetrics(ctx context.Context, in string
 	return nil
 }
 
+// PeerMonitorMetricHistory runs PeerMonitor.MetricHistory().
+func (mock *mockService) PeerMonitorMetricHistory(ctx context.Context, in api.MetricHistoryRequest, out *[]api.Metric) error {
+	var hist []api.Metric
+	for i := 2; i >= 0; i-- {
+		m := api.Metric{
+			Name:  in.Name,
+			Peer:  TestPeerID1,
+			Value: fmt.Sprintf("%d", i),
+			Valid: true,
+		}
+		m.SetTTL(time.Duration(i-2) * time.Second)
+		hist = append(hist, m)
+	}
+	*out = hist
+	return nil
+}
+
 /* IPFSConnector methods */
 
 func (mock *mockService) IPFSPin(ctx context.Context, in api.PinSerial, out *struct{}) error {
@@ -406,7 +593,19 @@ func (mock *mockService) IPFSBlockPut(ctx context.Context, in api.NodeWithMeta,
 	return nil
 }
 
-func (mock *mockService) ConsensusAddPeer(ctx context.Context, in peer.ID, out *struct{}) error {
+func (mock *mockService) ConsensusLogBatch(ctx context.Context, in api.PinBatchSerial, out *struct{}) error {
+	return errors.New("mock rpc cannot redirect")
+}
+
+func (mock *mockService) ConsensusLogUpdate(ctx context.Context, in api.PinSerial, out *struct{}) error {
+	return errors.New("mock rpc cannot redirect")
+}
+
+func (mock *mockService) ConsensusLogDrain(ctx context.Context, in api.PeerDrainRequest, out *struct{}) error {
+	return errors.New("mock rpc cannot redirect")
+}
+
+func (mock *mockService) ConsensusAddPeer(ctx context.Context, in api.PeerAddRequest, out *struct{}) error {
 	return errors.New("mock rpc cannot redirect")
 }
 
@@ -9,9 +9,11 @@ import (
 
 // Version is the current cluster version. Version alignment between
 // components, apis and tools ensures compatibility among them.
-var Version = semver.MustParse("0.7.0")
+var Version = semver.MustParse("0.8.0-dev")
 
-// RPCProtocol is used to send libp2p messages between cluster peers
+// RPCProtocol is used to send libp2p messages between cluster peers. It
+// changes with the minor version, so the Version must be bumped whenever
+// the RPC API changes in an incompatible way.
 var RPCProtocol = protocol.ID(
 	fmt.Sprintf("/ipfscluster/%d.%d/rpc", Version.Major, Version.Minor),
 )